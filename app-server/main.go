@@ -1,41 +1,168 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 
-	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/config" // Import the new config package
+	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/envelope"
+	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/faultinject"
 	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/handlers"
+	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/localfs"
+	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/metadata"
+	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/resilience"
 	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/s3"
+	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/storagemetrics"
 	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/templates"
+	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/webhooks"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/audit"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/config"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/csrf"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/flash"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/health"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/logging"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/metrics"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/ratelimit"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/secheaders"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/server"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/session"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/tracing"
 )
 
 func main() {
+	if handled, err := config.HandleCommand(os.Args[1:], os.Stdout, os.Stderr); handled {
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 	fmt.Println("📱 App Server Starting...")
 
 	// Load application configuration
-	appConfig, err := config.LoadConfig()
+	appConfig, err := config.Load(os.Args[1:])
 	if err != nil {
 		log.Fatalf("Failed to load application configuration: %v", err)
 	}
+	logging.Setup(appConfig.Log.Level)
+	shutdownTracing, err := tracing.Setup(context.Background(), appConfig.Tracing.Exporter, "app-server")
+	if err != nil {
+		log.Fatalf("Failed to initialize tracing: %v", err)
+	}
 
-	fmt.Printf("📱 App Server Starting on :%s\n", appConfig.PortAppServer)
+	fmt.Printf("📱 App Server Starting on :%s\n", appConfig.Server.AppPort)
 
-	// Initialize template renderer
-	renderer, err := templates.NewTemplateRenderer()
+	// Initialize template renderer, re-reading templates from the checkout
+	// outside production so edits show up without a rebuild
+	var templateOpts []templates.Option
+	if !appConfig.IsProduction() {
+		templateOpts = append(templateOpts, templates.WithLiveReload(".."))
+	}
+	renderer, err := templates.NewTemplateRenderer(templateOpts...)
 	if err != nil {
 		log.Fatalf("Failed to initialize template renderer: %v", err)
 	}
 
-	// Initialize S3 client
-	s3Client, err := s3.NewS3Client()
+	// Initialize storage backend
+	var s3Client s3.S3ClientIface
+	var localStorage *localfs.Client
+	var shutdownHooks []func(context.Context) error
+	readiness := health.NewChecker(0, 0)
+	faults, err := faultinject.ParseConfig(appConfig.Storage.FaultInjection)
 	if err != nil {
-		log.Fatalf("Failed to initialize S3 client: %v", err)
+		log.Fatalf("Invalid FAULT_INJECTION: %v", err)
+	}
+	switch appConfig.Storage.Backend {
+	case "local":
+		localStorage, err = localfs.NewClient(appConfig.Storage.LocalDir, appConfig.Server.AppURL, []byte(appConfig.Storage.LocalSigningKey))
+		if err != nil {
+			log.Fatalf("Failed to initialize local storage: %v", err)
+		}
+		s3Client = localStorage
+		log.Printf("📁 Using local storage at %s", appConfig.Storage.LocalDir)
+	default:
+		encryption, err := s3.NewEncryptionConfig(appConfig.Storage.SSEMode, appConfig.Storage.SSEKMSKeyID, appConfig.Storage.SSEBucketKey, appConfig.Storage.SSECustomerKey)
+		if err != nil {
+			log.Fatalf("Invalid S3 encryption settings: %v", err)
+		}
+		s3Client, err = s3.NewS3Client(
+			s3.WithBucket(appConfig.Storage.Bucket, appConfig.Storage.Region),
+			s3.WithEncryption(encryption),
+			s3.WithEndpoint(appConfig.Storage.Endpoint, appConfig.Storage.UsePathStyle),
+			s3.WithCABundle(appConfig.Storage.CABundle),
+			s3.WithStaticCredentials(appConfig.Storage.AccessKeyID, appConfig.Storage.SecretAccessKey, appConfig.Storage.SessionToken),
+			s3.WithRetryPolicy(appConfig.Storage.RetryMode, appConfig.Storage.MaxAttempts),
+			s3.WithHTTPClientWrapper(faultinject.WrapHTTPClient(faults)),
+		)
+		if err != nil {
+			log.Fatalf("Failed to initialize S3 client: %v", err)
+		}
+		if uploads, ok := s3Client.(s3.UploadAborter); ok {
+			shutdownHooks = append(shutdownHooks, uploads.AbortPendingUploads)
+		}
+	}
+	if backend, ok := s3Client.(s3.Pinger); ok {
+		readiness.Register("storage", backend.Ping)
+	}
+	if faults.Enabled() {
+		// The S3 SDK sees its faults over HTTP, so it retries them as it would real ones
+		if appConfig.Storage.Backend != "local" {
+			faults = faults.Only(faultinject.OpPresign)
+		}
+		s3Client = faultinject.NewClient(s3Client, faults)
+		log.Printf("💥 Storage fault injection enabled: %s", appConfig.Storage.FaultInjection)
+	}
+	s3Client = storagemetrics.NewClient(s3Client)
+	resilientStorage := resilience.NewClient(s3Client, resilience.Policy{
+		OperationTimeout: appConfig.Storage.OperationTimeout,
+		UploadTimeout:    appConfig.Storage.UploadTimeout,
+		Breaker: resilience.BreakerConfig{
+			FailureThreshold: appConfig.Storage.BreakerFailures,
+			Cooldown:         appConfig.Storage.BreakerCooldown,
+		},
+	})
+	s3Client = resilientStorage
+	if appConfig.Storage.CSEMasterKey != nil {
+		kms, err := envelope.NewLocalKMS(appConfig.Storage.CSEMasterKey)
+		if err != nil {
+			log.Fatalf("Invalid client-side encryption key: %v", err)
+		}
+		s3Client = envelope.NewClient(s3Client, kms)
+		log.Printf("🔐 Client-side encryption enabled (master key %s)", kms.KeyID())
 	}
 
+	// Initialize metadata store (share links)
+	store := metadata.NewMemoryStore()
+	readiness.Register("metadata", store.Ping)
+
+	// Initialize webhook notifications
+	notifier := webhooks.NewDispatcher(webhooks.Config{
+		URLs:        config.SplitList(appConfig.Webhooks.URLs),
+		Events:      config.SplitList(appConfig.Webhooks.Events),
+		Secret:      []byte(appConfig.Webhooks.Secret),
+		MaxAttempts: appConfig.Webhooks.MaxAttempts,
+		Backoff:     appConfig.Webhooks.Backoff,
+		Timeout:     appConfig.Webhooks.Timeout,
+	}, store)
+	shutdownHooks = append(shutdownHooks, notifier.Close)
+
 	// Initialize handlers
-	appHandler := handlers.NewAppHandler(appConfig, renderer, s3Client) // Pass appConfig
+	appHandler := handlers.NewAppHandler(appConfig, renderer, s3Client, store, notifier) // Pass appConfig
+
+	// Initialize audit log
+	auditRecorder, err := audit.Open(audit.Config{
+		Sinks:          config.SplitList(appConfig.Audit.Sinks),
+		File:           appConfig.Audit.File,
+		S3Prefix:       appConfig.Audit.S3Prefix,
+		BatchSize:      appConfig.Audit.BatchSize,
+		FlushInterval:  appConfig.Audit.FlushInterval,
+		TrustedProxies: appConfig.Server.TrustedProxies,
+	}, store, s3Client)
+	if err != nil {
+		log.Fatalf("Failed to open audit log: %v", err)
+	}
+	shutdownHooks = append(shutdownHooks, auditRecorder.Close)
 
 	// Define routes
 	http.HandleFunc("/", appHandler.HandleHome)
@@ -50,7 +177,7 @@ func main() {
 		}
 	})
 
-	// API endpoint for file upload (used by frontend form)
+	// API endpoint for file upload; rejections get a 400 rather than a redirect to the form
 	http.HandleFunc("/api/upload", func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodPost:
@@ -62,18 +189,93 @@ func main() {
 
 	http.HandleFunc("/success", appHandler.HandleSuccess)
 
-	// 健康检查端点 (App Runner 要求)
-	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("OK"))
+	// File list, downloads and share links
+	http.HandleFunc("/files", appHandler.HandleFiles)
+	http.HandleFunc("/download", appHandler.HandleDownload)
+	http.HandleFunc("/files/delete", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			appHandler.HandleFileDelete(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	http.HandleFunc("/shares", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			appHandler.HandleShares(w, r)
+		case http.MethodPost:
+			appHandler.HandleShareCreate(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	http.HandleFunc("/shares/revoke", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			appHandler.HandleShareRevoke(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	// Audit log search and webhook deliveries for ADMIN_IDS
+	http.HandleFunc("/admin/audit", appHandler.HandleAuditLog)
+	http.HandleFunc("/admin/webhooks", appHandler.HandleWebhookDeliveries)
+
+	// Public share pages (no login required)
+	http.HandleFunc("/s/", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			appHandler.HandleShareLanding(w, r)
+		case http.MethodPost:
+			appHandler.HandleShareDownload(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
 	})
 
+	// Presigned downloads for the local storage backend
+	if localStorage != nil {
+		http.Handle(localfs.RoutePrefix, localStorage)
+	}
+
+	// 健康检查端点 (App Runner 要求)
+	http.HandleFunc("/health", handlers.NewHealthHandler(resilientStorage))
+	http.HandleFunc("/healthz", health.LiveHandler())
+	http.HandleFunc("/readyz", readiness.ReadyHandler())
+
+	// Prometheus metrics
+	if appConfig.Metrics.Enabled {
+		http.Handle("/metrics", metrics.Handler(metrics.HandlerConfig{Token: appConfig.Metrics.Token, AllowedNets: appConfig.Metrics.AllowedNets}))
+	}
+
 	// Serve static files
 	http.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("../shared/static/"))))
 
 	fmt.Println("✅ App Server ready")
-	fmt.Printf("🌐 Visit: %s\n", appConfig.AppServerURL) // Use AppServerURL for visit message
+	fmt.Printf("🌐 Visit: %s\n", appConfig.Server.AppURL)
 
 	// Start server
-	log.Fatal(http.ListenAndServe(":"+appConfig.PortAppServer, nil))
+	rules, err := ratelimit.ParseRules(appConfig.Server.RateLimits)
+	if err != nil {
+		log.Fatalf("Invalid rate limits: %v", err)
+	}
+	limits := ratelimit.Config{Rules: rules, TrustedProxies: appConfig.Server.TrustedProxies}
+	router := flash.Middleware([]byte(appConfig.Server.CookieKey), http.DefaultServeMux)
+	router = csrf.Middleware(renderer, audit.Middleware(auditRecorder, router))
+	router = session.Middleware([]byte(appConfig.Server.CookieKey), ratelimit.Middleware(ratelimit.NewMemoryStore(), limits, renderer, router))
+	router = secheaders.Middleware(handlers.SecurityHeaders(appConfig), router)
+	srv := server.New(":"+appConfig.Server.AppPort, tracing.Middleware(logging.Middleware(metrics.Middleware(router))), server.Config{
+		ReadTimeout:     appConfig.Server.ReadTimeout,
+		WriteTimeout:    appConfig.Server.WriteTimeout,
+		ShutdownTimeout: appConfig.Server.ShutdownTimeout,
+	})
+	for _, hook := range shutdownHooks {
+		srv.OnShutdown(hook)
+	}
+	srv.OnShutdown(shutdownTracing) // Last, so spans from the other hooks are flushed
+	if err := srv.ListenAndServe(); err != nil {
+		log.Fatalf("Server error: %v", err)
+	}
 }
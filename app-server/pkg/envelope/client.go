@@ -0,0 +1,273 @@
+package envelope
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/s3"
+)
+
+// DefaultChunkSize is the amount of plaintext sealed per AES-GCM chunk
+const DefaultChunkSize = 64 * 1024
+
+// Envelope metadata stored with each encrypted object
+const (
+	metaPrefix     = "cse-"
+	metaAlgorithm  = "cse-alg"
+	metaWrappedKey = "cse-key"
+	metaKeyID      = "cse-key-id"
+	metaNonce      = "cse-nonce"
+	metaChunkSize  = "cse-chunk-size"
+
+	algorithm = "AES256-GCM-CHUNKED-V1"
+)
+
+// ErrTampered is returned when encrypted data fails authentication
+var ErrTampered = errors.New("encrypted object failed authentication")
+
+// Client encrypts objects before handing them to another storage client and
+// decrypts them on the way back. Objects without an envelope are passed
+// through unchanged, so data stored before encryption was enabled stays readable.
+type Client struct {
+	inner     s3.S3ClientIface
+	kms       KMS
+	chunkSize int
+}
+
+// NewClient wraps a storage client with client-side envelope encryption
+func NewClient(inner s3.S3ClientIface, kms KMS) *Client {
+	return &Client{
+		inner:     inner,
+		kms:       kms,
+		chunkSize: DefaultChunkSize,
+	}
+}
+
+// envelope holds the per-object encryption parameters
+type envelope struct {
+	wrappedKey []byte
+	keyID      string
+	nonce      []byte
+	chunkSize  int
+}
+
+// UploadFile encrypts and uploads a file
+func (c *Client) UploadFile(ctx context.Context, key string, file io.Reader, contentType string) error {
+	return c.UploadFileWithMetadata(ctx, key, file, contentType, nil)
+}
+
+// UploadFileWithMetadata encrypts a file with a fresh data key and uploads it with its envelope
+func (c *Client) UploadFileWithMetadata(ctx context.Context, key string, file io.Reader, contentType string, metadata map[string]string) error {
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return fmt.Errorf("failed to generate data key: %w", err)
+	}
+	wrapped, keyID, err := c.kms.WrapKey(ctx, dataKey)
+	if err != nil {
+		return fmt.Errorf("failed to wrap data key: %w", err)
+	}
+
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	withEnvelope := make(map[string]string, len(metadata)+5)
+	for k, v := range metadata {
+		withEnvelope[k] = v
+	}
+	withEnvelope[metaAlgorithm] = algorithm
+	withEnvelope[metaWrappedKey] = base64.StdEncoding.EncodeToString(wrapped)
+	withEnvelope[metaKeyID] = keyID
+	withEnvelope[metaNonce] = base64.StdEncoding.EncodeToString(nonce)
+	withEnvelope[metaChunkSize] = strconv.Itoa(c.chunkSize)
+
+	encrypted := newEncryptReader(file, aead, nonce, c.chunkSize)
+	return c.inner.UploadFileWithMetadata(ctx, key, encrypted, contentType, withEnvelope)
+}
+
+// StatFile returns the plaintext size and caller metadata of a file
+func (c *Client) StatFile(ctx context.Context, key string) (*s3.FileInfo, error) {
+	info, err := c.inner.StatFile(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	env, err := parseEnvelope(info.Metadata)
+	if err != nil || env == nil {
+		return info, err
+	}
+
+	size, err := plaintextSize(info.Size, env.chunkSize)
+	if err != nil {
+		return nil, err
+	}
+	plain := *info
+	plain.Size = size
+	plain.Metadata = stripEnvelope(info.Metadata)
+	return &plain, nil
+}
+
+// GetFile downloads and decrypts a file. Ranged reads fetch only the chunks covering the range.
+func (c *Client) GetFile(ctx context.Context, key string, rng *s3.ByteRange) (io.ReadCloser, error) {
+	info, err := c.inner.StatFile(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	env, err := parseEnvelope(info.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	if env == nil {
+		return c.inner.GetFile(ctx, key, rng)
+	}
+
+	size, err := plaintextSize(info.Size, env.chunkSize)
+	if err != nil {
+		return nil, err
+	}
+	start, end := int64(0), size-1
+	if rng != nil {
+		start = rng.Start
+		if rng.End >= 0 && rng.End < end {
+			end = rng.End
+		}
+	}
+	if start > end {
+		return io.NopCloser(bytes.NewReader(nil)), nil
+	}
+
+	chunk := int64(env.chunkSize)
+	sealed := chunk + tagSize
+	firstChunk, lastChunk := start/chunk, end/chunk
+	totalChunks := chunkCount(info.Size, env.chunkSize)
+
+	var cipherRange *s3.ByteRange
+	if firstChunk > 0 || lastChunk < totalChunks-1 {
+		cipherRange = &s3.ByteRange{Start: firstChunk * sealed, End: min((lastChunk+1)*sealed, info.Size) - 1}
+	}
+
+	dataKey, err := c.kms.UnwrapKey(ctx, env.wrappedKey, env.keyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := c.inner.GetFile(ctx, key, cipherRange)
+	if err != nil {
+		return nil, err
+	}
+	return &decryptReader{
+		src:       body,
+		aead:      aead,
+		baseNonce: env.nonce,
+		sealed:    make([]byte, sealed),
+		plain:     make([]byte, 0, chunk),
+		index:     firstChunk,
+		lastIndex: totalChunks - 1,
+		skip:      start - firstChunk*chunk,
+		remaining: end - start + 1,
+	}, nil
+}
+
+// PresignGetURL presigns plaintext objects only; S3 would hand out ciphertext for encrypted ones
+func (c *Client) PresignGetURL(ctx context.Context, key string, expires time.Duration) (string, error) {
+	info, err := c.inner.StatFile(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	if env, err := parseEnvelope(info.Metadata); err != nil || env != nil {
+		return "", s3.ErrPresignUnsupported
+	}
+	return c.inner.PresignGetURL(ctx, key, expires)
+}
+
+// GetFileURL returns the underlying URL of a file
+func (c *Client) GetFileURL(key string) string {
+	return c.inner.GetFileURL(key)
+}
+
+// DeleteFile deletes a file
+func (c *Client) DeleteFile(ctx context.Context, key string) error {
+	return c.inner.DeleteFile(ctx, key)
+}
+
+// ListFiles lists files with a given prefix
+func (c *Client) ListFiles(ctx context.Context, prefix string) ([]string, error) {
+	return c.inner.ListFiles(ctx, prefix)
+}
+
+// parseEnvelope reads the envelope from object metadata, returning nil for plaintext objects
+func parseEnvelope(metadata map[string]string) (*envelope, error) {
+	alg, ok := lookup(metadata, metaAlgorithm)
+	if !ok {
+		return nil, nil
+	}
+	if alg != algorithm {
+		return nil, fmt.Errorf("unsupported envelope algorithm %q", alg)
+	}
+
+	wrappedKey, _ := lookup(metadata, metaWrappedKey)
+	keyID, _ := lookup(metadata, metaKeyID)
+	nonce, _ := lookup(metadata, metaNonce)
+	chunkSize, _ := lookup(metadata, metaChunkSize)
+
+	env := &envelope{keyID: keyID}
+	var err error
+	if env.wrappedKey, err = base64.StdEncoding.DecodeString(wrappedKey); err != nil || len(env.wrappedKey) == 0 {
+		return nil, fmt.Errorf("envelope has an invalid wrapped key")
+	}
+	if env.nonce, err = base64.StdEncoding.DecodeString(nonce); err != nil || len(env.nonce) != 12 {
+		return nil, fmt.Errorf("envelope has an invalid nonce")
+	}
+	if env.chunkSize, err = strconv.Atoi(chunkSize); err != nil || env.chunkSize <= 0 {
+		return nil, fmt.Errorf("envelope has an invalid chunk size")
+	}
+	return env, nil
+}
+
+// lookup finds a metadata value regardless of case, as S3 lowercases metadata keys
+func lookup(metadata map[string]string, key string) (string, bool) {
+	for k, v := range metadata {
+		if strings.EqualFold(k, key) {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// stripEnvelope returns the caller's metadata without envelope entries
+func stripEnvelope(metadata map[string]string) map[string]string {
+	stripped := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		if !strings.HasPrefix(strings.ToLower(k), metaPrefix) {
+			stripped[k] = v
+		}
+	}
+	return stripped
+}
+
+// newAEAD creates the AES-256-GCM cipher for a data key
+func newAEAD(dataKey []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create data key cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,280 @@
+package envelope
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/s3"
+)
+
+// memoryStorage is an in-memory S3ClientIface that keeps objects and their metadata
+type memoryStorage struct {
+	objects  map[string][]byte
+	metadata map[string]map[string]string
+	ranges   []*s3.ByteRange
+}
+
+func newMemoryStorage() *memoryStorage {
+	return &memoryStorage{objects: map[string][]byte{}, metadata: map[string]map[string]string{}}
+}
+
+func (m *memoryStorage) UploadFile(ctx context.Context, key string, file io.Reader, contentType string) error {
+	return m.UploadFileWithMetadata(ctx, key, file, contentType, nil)
+}
+
+func (m *memoryStorage) UploadFileWithMetadata(ctx context.Context, key string, file io.Reader, contentType string, metadata map[string]string) error {
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return err
+	}
+	m.objects[key] = data
+	m.metadata[key] = metadata
+	return nil
+}
+
+func (m *memoryStorage) StatFile(ctx context.Context, key string) (*s3.FileInfo, error) {
+	data, ok := m.objects[key]
+	if !ok {
+		return nil, s3.ErrNotFound
+	}
+	return &s3.FileInfo{Key: key, Size: int64(len(data)), Metadata: m.metadata[key]}, nil
+}
+
+func (m *memoryStorage) GetFile(ctx context.Context, key string, rng *s3.ByteRange) (io.ReadCloser, error) {
+	data, ok := m.objects[key]
+	if !ok {
+		return nil, s3.ErrNotFound
+	}
+	m.ranges = append(m.ranges, rng)
+	if rng != nil {
+		end := rng.End
+		if end < 0 || end >= int64(len(data)) {
+			end = int64(len(data)) - 1
+		}
+		data = data[rng.Start : end+1]
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (m *memoryStorage) PresignGetURL(ctx context.Context, key string, expires time.Duration) (string, error) {
+	return "https://test-bucket.s3.amazonaws.com/" + key, nil
+}
+
+func (m *memoryStorage) GetFileURL(key string) string {
+	return "https://test-bucket.s3.amazonaws.com/" + key
+}
+
+func (m *memoryStorage) DeleteFile(ctx context.Context, key string) error {
+	delete(m.objects, key)
+	return nil
+}
+
+func (m *memoryStorage) ListFiles(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	for key := range m.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// newTestClient returns an encrypting client with a small chunk size so tests span many chunks
+func newTestClient(t *testing.T, masterKey byte) (*Client, *memoryStorage) {
+	t.Helper()
+	kms, err := NewLocalKMS(bytes.Repeat([]byte{masterKey}, 32))
+	if err != nil {
+		t.Fatalf("NewLocalKMS() error = %v", err)
+	}
+	storage := newMemoryStorage()
+	client := NewClient(storage, kms)
+	client.chunkSize = 16
+	return client, storage
+}
+
+func testPayload(size int) []byte {
+	data := make([]byte, size)
+	rand.New(rand.NewSource(int64(size))).Read(data)
+	return data
+}
+
+func readAll(t *testing.T, client *Client, key string, rng *s3.ByteRange) ([]byte, error) {
+	t.Helper()
+	body, err := client.GetFile(context.Background(), key, rng)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return io.ReadAll(body)
+}
+
+func TestClient_RoundTrip(t *testing.T) {
+	for _, size := range []int{0, 1, 15, 16, 17, 32, 100} {
+		client, storage := newTestClient(t, 1)
+		payload := testPayload(size)
+		ctx := context.Background()
+
+		err := client.UploadFileWithMetadata(ctx, "k", bytes.NewReader(payload), "application/octet-stream", map[string]string{"owner": "u1"})
+		if err != nil {
+			t.Fatalf("size %d: UploadFileWithMetadata() error = %v", size, err)
+		}
+		if size > 0 && bytes.Contains(storage.objects["k"], payload) {
+			t.Errorf("size %d: stored object contains the plaintext", size)
+		}
+
+		info, err := client.StatFile(ctx, "k")
+		if err != nil {
+			t.Fatalf("size %d: StatFile() error = %v", size, err)
+		}
+		if info.Size != int64(size) {
+			t.Errorf("size %d: StatFile().Size = %d", size, info.Size)
+		}
+		if len(info.Metadata) != 1 || info.Metadata["owner"] != "u1" {
+			t.Errorf("size %d: StatFile().Metadata = %v, want only caller metadata", size, info.Metadata)
+		}
+
+		got, err := readAll(t, client, "k", nil)
+		if err != nil {
+			t.Fatalf("size %d: GetFile() error = %v", size, err)
+		}
+		if !bytes.Equal(got, payload) {
+			t.Errorf("size %d: GetFile() returned %d bytes that do not match", size, len(got))
+		}
+	}
+}
+
+func TestClient_RangedReads(t *testing.T) {
+	client, storage := newTestClient(t, 1)
+	payload := testPayload(100)
+	if err := client.UploadFile(context.Background(), "k", bytes.NewReader(payload), "application/octet-stream"); err != nil {
+		t.Fatalf("UploadFile() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		start, end int64
+		wantStart  int64
+		wantEnd    int64
+		wantFetch  bool // whether only part of the ciphertext should be fetched
+	}{
+		{"within first chunk", 2, 5, 2, 5, true},
+		{"across boundary", 10, 40, 10, 40, true},
+		{"exact chunk", 16, 31, 16, 31, true},
+		{"open ended", 90, -1, 90, 99, true},
+		{"last byte", 99, 99, 99, 99, true},
+		{"whole object", 0, -1, 0, 99, false},
+		{"end past size", 50, 500, 50, 99, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage.ranges = nil
+			got, err := readAll(t, client, "k", &s3.ByteRange{Start: tt.start, End: tt.end})
+			if err != nil {
+				t.Fatalf("GetFile() error = %v", err)
+			}
+			if want := payload[tt.wantStart : tt.wantEnd+1]; !bytes.Equal(got, want) {
+				t.Errorf("GetFile() = %d bytes, want %d matching bytes", len(got), len(want))
+			}
+			if fetched := storage.ranges[0] != nil; fetched != tt.wantFetch {
+				t.Errorf("ciphertext range = %+v, want partial fetch %v", storage.ranges[0], tt.wantFetch)
+			}
+		})
+	}
+}
+
+func TestClient_DetectsTampering(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func([]byte) []byte
+	}{
+		{"flipped bit", func(b []byte) []byte { b[20] ^= 1; return b }},
+		{"truncated to chunk boundary", func(b []byte) []byte { return b[:2*(16+tagSize)] }},
+		{"dropped tail", func(b []byte) []byte { return b[:len(b)-3] }},
+		{"swapped chunks", func(b []byte) []byte {
+			sealed := 16 + tagSize
+			first := append([]byte(nil), b[:sealed]...)
+			copy(b[:sealed], b[sealed:2*sealed])
+			copy(b[sealed:2*sealed], first)
+			return b
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, storage := newTestClient(t, 1)
+			if err := client.UploadFile(context.Background(), "k", bytes.NewReader(testPayload(100)), "text/plain"); err != nil {
+				t.Fatalf("UploadFile() error = %v", err)
+			}
+			storage.objects["k"] = tt.mutate(storage.objects["k"])
+
+			if _, err := readAll(t, client, "k", nil); err == nil {
+				t.Error("GetFile() succeeded on a modified object")
+			}
+		})
+	}
+}
+
+func TestClient_ModifiedChunkIsTampered(t *testing.T) {
+	client, storage := newTestClient(t, 1)
+	if err := client.UploadFile(context.Background(), "k", bytes.NewReader(testPayload(40)), "text/plain"); err != nil {
+		t.Fatalf("UploadFile() error = %v", err)
+	}
+	storage.objects["k"][0] ^= 1
+
+	if _, err := readAll(t, client, "k", nil); !errors.Is(err, ErrTampered) {
+		t.Errorf("GetFile() error = %v, want ErrTampered", err)
+	}
+}
+
+func TestClient_WrongMasterKey(t *testing.T) {
+	client, storage := newTestClient(t, 1)
+	if err := client.UploadFile(context.Background(), "k", strings.NewReader("secret"), "text/plain"); err != nil {
+		t.Fatalf("UploadFile() error = %v", err)
+	}
+
+	other, _ := newTestClient(t, 2)
+	other.inner = storage
+	if _, err := readAll(t, other, "k", nil); err == nil {
+		t.Error("GetFile() succeeded with a different master key")
+	}
+}
+
+func TestClient_PlaintextPassthrough(t *testing.T) {
+	client, storage := newTestClient(t, 1)
+	storage.objects["legacy"] = []byte("uploaded before encryption")
+
+	got, err := readAll(t, client, "legacy", &s3.ByteRange{Start: 9, End: 14})
+	if err != nil {
+		t.Fatalf("GetFile() error = %v", err)
+	}
+	if string(got) != "before" {
+		t.Errorf("GetFile() = %q, want %q", got, "before")
+	}
+
+	url, err := client.PresignGetURL(context.Background(), "legacy", time.Minute)
+	if err != nil || url == "" {
+		t.Errorf("PresignGetURL() = %q, %v; want a URL for plaintext objects", url, err)
+	}
+}
+
+func TestClient_PresignUnsupported(t *testing.T) {
+	client, _ := newTestClient(t, 1)
+	if err := client.UploadFile(context.Background(), "k", strings.NewReader("secret"), "text/plain"); err != nil {
+		t.Fatalf("UploadFile() error = %v", err)
+	}
+
+	if _, err := client.PresignGetURL(context.Background(), "k", time.Minute); !errors.Is(err, s3.ErrPresignUnsupported) {
+		t.Errorf("PresignGetURL() error = %v, want ErrPresignUnsupported", err)
+	}
+}
+
+func TestNewLocalKMS_KeyLength(t *testing.T) {
+	if _, err := NewLocalKMS(make([]byte, 16)); err == nil {
+		t.Error("NewLocalKMS() accepted a 128-bit key")
+	}
+}
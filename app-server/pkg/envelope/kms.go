@@ -0,0 +1,80 @@
+package envelope
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// KMS wraps and unwraps per-object data keys with a master key it holds
+type KMS interface {
+	// WrapKey encrypts a data key and returns it with the ID of the master key used
+	WrapKey(ctx context.Context, dataKey []byte) (wrapped []byte, keyID string, err error)
+	// UnwrapKey decrypts a data key wrapped by the master key with the given ID
+	UnwrapKey(ctx context.Context, wrapped []byte, keyID string) ([]byte, error)
+}
+
+// wrapAAD binds wrapped keys to their purpose
+var wrapAAD = []byte("go-google-s3-uploader/envelope/data-key")
+
+// LocalKMS implements KMS with an AES-256 master key held in process memory
+type LocalKMS struct {
+	keyID string
+	aead  cipher.AEAD
+}
+
+// NewLocalKMS creates a KMS backed by a 256-bit master key from configuration
+func NewLocalKMS(masterKey []byte) (*LocalKMS, error) {
+	if len(masterKey) != 32 {
+		return nil, fmt.Errorf("master key must be 32 bytes, got %d", len(masterKey))
+	}
+	block, err := aes.NewCipher(masterKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create master key cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create master key cipher: %w", err)
+	}
+
+	// The key ID is a fingerprint so a wrong master key is reported clearly
+	sum := sha256.Sum256(masterKey)
+	return &LocalKMS{
+		keyID: "local:" + hex.EncodeToString(sum[:8]),
+		aead:  aead,
+	}, nil
+}
+
+// KeyID returns the identifier recorded with keys wrapped by this KMS
+func (k *LocalKMS) KeyID() string {
+	return k.keyID
+}
+
+// WrapKey encrypts a data key with the master key
+func (k *LocalKMS) WrapKey(ctx context.Context, dataKey []byte) ([]byte, string, error) {
+	nonce := make([]byte, k.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return k.aead.Seal(nonce, nonce, dataKey, wrapAAD), k.keyID, nil
+}
+
+// UnwrapKey decrypts a data key with the master key
+func (k *LocalKMS) UnwrapKey(ctx context.Context, wrapped []byte, keyID string) ([]byte, error) {
+	if keyID != k.keyID {
+		return nil, fmt.Errorf("data key was wrapped by unknown master key %q", keyID)
+	}
+	nonceSize := k.aead.NonceSize()
+	if len(wrapped) < nonceSize {
+		return nil, fmt.Errorf("wrapped data key is truncated")
+	}
+	dataKey, err := k.aead.Open(nil, wrapped[:nonceSize], wrapped[nonceSize:], wrapAAD)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	return dataKey, nil
+}
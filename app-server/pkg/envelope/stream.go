@@ -0,0 +1,181 @@
+package envelope
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"fmt"
+	"io"
+)
+
+// Objects are encrypted as a sequence of independently sealed AES-GCM chunks.
+// Chunk i uses the object's base nonce with i XORed into its last 8 bytes, and
+// the final chunk is sealed with a different additional data byte so that a
+// truncated object fails authentication instead of decrypting short.
+
+// tagSize is the AES-GCM authentication tag appended to each chunk
+const tagSize = 16
+
+var (
+	aadChunk = []byte{0}
+	aadFinal = []byte{1}
+)
+
+// chunkNonce derives the nonce of chunk index from the base nonce
+func chunkNonce(base []byte, index int64) []byte {
+	nonce := append([]byte(nil), base...)
+	for i := 0; i < 8; i++ {
+		nonce[len(nonce)-1-i] ^= byte(uint64(index) >> (8 * i))
+	}
+	return nonce
+}
+
+// plaintextSize recovers the plaintext length from the encrypted object length
+func plaintextSize(cipherSize int64, chunkSize int) (int64, error) {
+	sealed := int64(chunkSize + tagSize)
+	full, rem := cipherSize/sealed, cipherSize%sealed
+	switch {
+	case rem == 0 && full > 0:
+		return full * int64(chunkSize), nil
+	case rem >= tagSize:
+		return full*int64(chunkSize) + rem - tagSize, nil
+	default:
+		return 0, fmt.Errorf("encrypted object has invalid length %d", cipherSize)
+	}
+}
+
+// chunkCount returns how many chunks an encrypted object of the given length holds
+func chunkCount(cipherSize int64, chunkSize int) int64 {
+	sealed := int64(chunkSize + tagSize)
+	return (cipherSize + sealed - 1) / sealed
+}
+
+// encryptReader seals plaintext read from src into chunks
+type encryptReader struct {
+	src       *bufio.Reader
+	aead      cipher.AEAD
+	baseNonce []byte
+	plain     []byte
+	sealed    []byte
+	out       []byte
+	index     int64
+	done      bool
+}
+
+func newEncryptReader(src io.Reader, aead cipher.AEAD, baseNonce []byte, chunkSize int) *encryptReader {
+	return &encryptReader{
+		src:       bufio.NewReaderSize(src, chunkSize),
+		aead:      aead,
+		baseNonce: baseNonce,
+		plain:     make([]byte, chunkSize),
+		sealed:    make([]byte, 0, chunkSize+tagSize),
+	}
+}
+
+func (r *encryptReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.sealNext(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+// sealNext reads and seals the next chunk, peeking ahead to tell whether it is the last
+func (r *encryptReader) sealNext() error {
+	n, err := io.ReadFull(r.src, r.plain)
+	final := false
+	switch {
+	case err == io.EOF || err == io.ErrUnexpectedEOF:
+		final = true
+	case err != nil:
+		return err
+	default:
+		if _, err := r.src.Peek(1); err == io.EOF {
+			final = true
+		} else if err != nil {
+			return err
+		}
+	}
+
+	aad := aadChunk
+	if final {
+		aad = aadFinal
+	}
+	r.out = r.aead.Seal(r.sealed[:0], chunkNonce(r.baseNonce, r.index), r.plain[:n], aad)
+	r.index++
+	r.done = final
+	return nil
+}
+
+// decryptReader opens chunks read from src, starting at chunk index, and
+// returns remaining bytes of plaintext after skipping skip bytes
+type decryptReader struct {
+	src       io.ReadCloser
+	aead      cipher.AEAD
+	baseNonce []byte
+	sealed    []byte
+	plain     []byte
+	out       []byte
+	index     int64
+	lastIndex int64
+	skip      int64
+	remaining int64
+}
+
+func (r *decryptReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.remaining == 0 {
+			return 0, io.EOF
+		}
+		if err := r.openNext(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+func (r *decryptReader) openNext() error {
+	if r.index > r.lastIndex {
+		return io.ErrUnexpectedEOF
+	}
+	n, err := io.ReadFull(r.src, r.sealed)
+	if err == io.ErrUnexpectedEOF || err == io.EOF {
+		if r.index != r.lastIndex {
+			return fmt.Errorf("encrypted object truncated at chunk %d: %w", r.index, io.ErrUnexpectedEOF)
+		}
+	} else if err != nil {
+		return err
+	}
+
+	aad := aadChunk
+	if r.index == r.lastIndex {
+		aad = aadFinal
+	}
+	plain, err := r.aead.Open(r.plain[:0], chunkNonce(r.baseNonce, r.index), r.sealed[:n], aad)
+	if err != nil {
+		return fmt.Errorf("chunk %d: %w: %v", r.index, ErrTampered, err)
+	}
+	r.index++
+
+	if r.skip > 0 {
+		plain = plain[r.skip:]
+		r.skip = 0
+	}
+	if int64(len(plain)) > r.remaining {
+		plain = plain[:r.remaining]
+	}
+	r.remaining -= int64(len(plain))
+	r.out = plain
+	return nil
+}
+
+func (r *decryptReader) Close() error {
+	return r.src.Close()
+}
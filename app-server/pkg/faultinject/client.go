@@ -0,0 +1,221 @@
+package faultinject
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/s3"
+	"github.com/aws/smithy-go"
+)
+
+// ErrInjected is matched by every error the wrapper makes up
+var ErrInjected = errors.New("injected fault")
+
+// injectedError reports an injected fault. It unwraps to ErrInjected and to
+// the error S3 would have returned, so callers can't tell it from the real thing.
+type injectedError struct {
+	op    Op
+	cause error
+}
+
+func (e *injectedError) Error() string {
+	return fmt.Sprintf("faultinject: %s: %v", e.op, e.cause)
+}
+
+func (e *injectedError) Unwrap() []error {
+	return []error{ErrInjected, e.cause}
+}
+
+// Client injects faults into calls to another storage client
+type Client struct {
+	inner s3.S3ClientIface
+	*injector
+}
+
+// NewClient wraps a storage client with the configured faults
+func NewClient(inner s3.S3ClientIface, cfg Config) *Client {
+	return &Client{inner: inner, injector: newInjector(cfg)}
+}
+
+// injector rolls the dice for the faults in cfg
+type injector struct {
+	cfg Config
+
+	mu       sync.Mutex
+	rand     *rand.Rand
+	injected int
+}
+
+func newInjector(cfg Config) *injector {
+	seed := uint64(cfg.Seed)
+	if seed == 0 {
+		seed = rand.Uint64()
+	}
+	return &injector{cfg: cfg, rand: rand.New(rand.NewPCG(seed, seed))}
+}
+
+// Injected returns how many faults have fired, latency aside
+func (c *injector) Injected() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.injected
+}
+
+// UploadFile uploads a file, possibly failing or cutting the body off part way
+func (c *Client) UploadFile(ctx context.Context, key string, file io.Reader, contentType string) error {
+	return c.UploadFileWithMetadata(ctx, key, file, contentType, nil)
+}
+
+// UploadFileWithMetadata uploads a file with metadata, possibly failing or cutting the body off part way
+func (c *Client) UploadFileWithMetadata(ctx context.Context, key string, file io.Reader, contentType string, metadata map[string]string) error {
+	truncate, err := c.before(ctx, OpUpload)
+	if err != nil {
+		return err
+	}
+	if truncate >= 0 {
+		file = &truncatedReader{r: file, op: OpUpload, remaining: truncate, limit: truncate}
+	}
+	return c.inner.UploadFileWithMetadata(ctx, key, file, contentType, metadata)
+}
+
+// GetFileURL never fails, so it is passed straight through
+func (c *Client) GetFileURL(key string) string {
+	return c.inner.GetFileURL(key)
+}
+
+// DeleteFile deletes a file unless a fault fires first
+func (c *Client) DeleteFile(ctx context.Context, key string) error {
+	if _, err := c.before(ctx, OpDelete); err != nil {
+		return err
+	}
+	return c.inner.DeleteFile(ctx, key)
+}
+
+// ListFiles lists files unless a fault fires first
+func (c *Client) ListFiles(ctx context.Context, prefix string) ([]string, error) {
+	if _, err := c.before(ctx, OpList); err != nil {
+		return nil, err
+	}
+	return c.inner.ListFiles(ctx, prefix)
+}
+
+// StatFile describes a file unless a fault fires first
+func (c *Client) StatFile(ctx context.Context, key string) (*s3.FileInfo, error) {
+	if _, err := c.before(ctx, OpStat); err != nil {
+		return nil, err
+	}
+	return c.inner.StatFile(ctx, key)
+}
+
+// GetFile opens a file, possibly failing or cutting the body off part way
+func (c *Client) GetFile(ctx context.Context, key string, rng *s3.ByteRange) (io.ReadCloser, error) {
+	truncate, err := c.before(ctx, OpGet)
+	if err != nil {
+		return nil, err
+	}
+	body, err := c.inner.GetFile(ctx, key, rng)
+	if err != nil || truncate < 0 {
+		return body, err
+	}
+	return &truncatedReadCloser{
+		truncatedReader: truncatedReader{r: body, op: OpGet, remaining: truncate, limit: truncate},
+		closer:          body,
+	}, nil
+}
+
+// PresignGetURL presigns a download unless a fault fires first
+func (c *Client) PresignGetURL(ctx context.Context, key string, expires time.Duration) (string, error) {
+	if _, err := c.before(ctx, OpPresign); err != nil {
+		return "", err
+	}
+	return c.inner.PresignGetURL(ctx, key, expires)
+}
+
+// before applies the op's latency and rolls for a failure. It returns the
+// number of bytes to let through before truncating, or -1 to leave the transfer alone.
+func (c *injector) before(ctx context.Context, op Op) (int64, error) {
+	f, ok := c.cfg.fault(op)
+	if !ok {
+		return -1, nil
+	}
+
+	if f.Latency > 0 {
+		timer := time.NewTimer(f.Latency)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return -1, ctx.Err()
+		}
+	}
+
+	if c.roll(f.ThrottleRate) {
+		return -1, &injectedError{op: op, cause: &smithy.GenericAPIError{
+			Code:    "SlowDown",
+			Message: "Please reduce your request rate.",
+			Fault:   smithy.FaultServer,
+		}}
+	}
+	if c.roll(f.ErrorRate) {
+		return -1, &injectedError{op: op, cause: &smithy.GenericAPIError{
+			Code:    "InternalError",
+			Message: "We encountered an internal error. Please try again.",
+			Fault:   smithy.FaultServer,
+		}}
+	}
+	if (op == OpUpload || op == OpGet) && c.roll(f.TruncateRate) {
+		if f.TruncateAfter > 0 {
+			return f.TruncateAfter, nil
+		}
+		return DefaultTruncateAfter, nil
+	}
+	return -1, nil
+}
+
+// roll returns true with the given probability
+func (c *injector) roll(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fired := c.rand.Float64() < rate
+	if fired {
+		c.injected++
+	}
+	return fired
+}
+
+// truncatedReader fails with io.ErrUnexpectedEOF once limit bytes have been read
+type truncatedReader struct {
+	r         io.Reader
+	op        Op
+	remaining int64
+	limit     int64
+}
+
+func (t *truncatedReader) Read(p []byte) (int, error) {
+	if t.remaining <= 0 {
+		return 0, &injectedError{op: t.op, cause: fmt.Errorf("connection reset after %d bytes: %w", t.limit, io.ErrUnexpectedEOF)}
+	}
+	if int64(len(p)) > t.remaining {
+		p = p[:t.remaining]
+	}
+	n, err := t.r.Read(p)
+	t.remaining -= int64(n)
+	return n, err
+}
+
+type truncatedReadCloser struct {
+	truncatedReader
+	closer io.Closer
+}
+
+func (t *truncatedReadCloser) Close() error {
+	return t.closer.Close()
+}
@@ -0,0 +1,223 @@
+package faultinject
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/localfs"
+	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/s3"
+	"github.com/aws/smithy-go"
+)
+
+func newTestClient(t *testing.T, faults map[Op]Fault) (*Client, s3.S3ClientIface) {
+	t.Helper()
+	inner, err := localfs.NewClient(t.TempDir(), "http://localhost:8080", []byte("test-signing-key"))
+	if err != nil {
+		t.Fatalf("localfs.NewClient() error = %v", err)
+	}
+	return NewClient(inner, Config{Faults: faults, Seed: 1}), inner
+}
+
+func apiErrorCode(err error) string {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorCode()
+	}
+	return ""
+}
+
+func TestParseConfig(t *testing.T) {
+	cfg, err := ParseConfig("get:latency=200ms,truncate=0.5,truncate_after=10; upload:error=0.25 ;*:throttle=1")
+	if err != nil {
+		t.Fatalf("ParseConfig() error = %v", err)
+	}
+	want := map[Op]Fault{
+		OpGet:    {Latency: 200 * time.Millisecond, TruncateRate: 0.5, TruncateAfter: 10},
+		OpUpload: {ErrorRate: 0.25},
+		OpAll:    {ThrottleRate: 1},
+	}
+	if len(cfg.Faults) != len(want) {
+		t.Fatalf("ParseConfig() faults = %+v, want %+v", cfg.Faults, want)
+	}
+	for op, f := range want {
+		if cfg.Faults[op] != f {
+			t.Errorf("fault[%s] = %+v, want %+v", op, cfg.Faults[op], f)
+		}
+	}
+	if f, _ := cfg.fault(OpStat); f.ThrottleRate != 1 {
+		t.Errorf("stat should fall back to the * fault, got %+v", f)
+	}
+
+	if only := cfg.Only(OpPresign, OpGet); len(only.Faults) != 2 || only.Faults[OpPresign].ThrottleRate != 1 || only.Faults[OpGet] != want[OpGet] {
+		t.Errorf("Only(presign, get) = %+v, want the * fault for presign and get's own", only.Faults)
+	}
+	if only := (Config{Faults: map[Op]Fault{OpGet: {ErrorRate: 1}}}).Only(OpPresign); only.Enabled() {
+		t.Errorf("Only(presign) = %+v, want no faults", only.Faults)
+	}
+
+	if cfg, err := ParseConfig(""); err != nil || cfg.Enabled() {
+		t.Errorf("ParseConfig(\"\") = %+v, %v; want disabled", cfg, err)
+	}
+
+	for _, spec := range []string{"get", "rename:error=1", "get:error=2", "get:latency=soon", "get:explode=1", "get:error"} {
+		if _, err := ParseConfig(spec); err == nil {
+			t.Errorf("ParseConfig(%q) succeeded, want error", spec)
+		}
+	}
+}
+
+func TestClient_PassesThroughWithoutFaults(t *testing.T) {
+	client, _ := newTestClient(t, nil)
+	ctx := context.Background()
+
+	if err := client.UploadFile(ctx, "uploads/u1/a.txt", strings.NewReader("hello"), "text/plain"); err != nil {
+		t.Fatalf("UploadFile() error = %v", err)
+	}
+	body, err := client.GetFile(ctx, "uploads/u1/a.txt", nil)
+	if err != nil {
+		t.Fatalf("GetFile() error = %v", err)
+	}
+	got, _ := io.ReadAll(body)
+	body.Close()
+	if string(got) != "hello" {
+		t.Errorf("GetFile() = %q", got)
+	}
+	if _, err := client.StatFile(ctx, "missing"); !errors.Is(err, s3.ErrNotFound) {
+		t.Errorf("StatFile(missing) error = %v, want ErrNotFound from the inner client", err)
+	}
+}
+
+func TestClient_InjectsErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		fault Fault
+		code  string
+	}{
+		{"internal error", Fault{ErrorRate: 1}, "InternalError"},
+		{"throttling", Fault{ThrottleRate: 1}, "SlowDown"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, inner := newTestClient(t, map[Op]Fault{OpAll: tt.fault})
+			ctx := context.Background()
+			inner.UploadFile(ctx, "k", strings.NewReader("data"), "text/plain")
+
+			_, listErr := client.ListFiles(ctx, "")
+			_, statErr := client.StatFile(ctx, "k")
+			_, getErr := client.GetFile(ctx, "k", nil)
+			_, presignErr := client.PresignGetURL(ctx, "k", time.Minute)
+			for op, err := range map[Op]error{
+				OpUpload:  client.UploadFile(ctx, "k2", strings.NewReader("data"), "text/plain"),
+				OpDelete:  client.DeleteFile(ctx, "k"),
+				OpList:    listErr,
+				OpStat:    statErr,
+				OpGet:     getErr,
+				OpPresign: presignErr,
+			} {
+				if !errors.Is(err, ErrInjected) || apiErrorCode(err) != tt.code {
+					t.Errorf("%s error = %v, want injected %s", op, err, tt.code)
+				}
+			}
+			if _, err := inner.StatFile(ctx, "k2"); !errors.Is(err, s3.ErrNotFound) {
+				t.Error("failed upload reached the inner client")
+			}
+			if _, err := inner.StatFile(ctx, "k"); err != nil {
+				t.Error("failed delete reached the inner client")
+			}
+		})
+	}
+}
+
+func TestClient_OnlyConfiguredOpsFail(t *testing.T) {
+	client, _ := newTestClient(t, map[Op]Fault{OpGet: {ErrorRate: 1}})
+	ctx := context.Background()
+	if err := client.UploadFile(ctx, "k", strings.NewReader("data"), "text/plain"); err != nil {
+		t.Errorf("UploadFile() error = %v, want success", err)
+	}
+	if _, err := client.GetFile(ctx, "k", nil); !errors.Is(err, ErrInjected) {
+		t.Errorf("GetFile() error = %v, want injected", err)
+	}
+}
+
+func TestClient_TruncatesDownloads(t *testing.T) {
+	client, inner := newTestClient(t, map[Op]Fault{OpGet: {TruncateRate: 1, TruncateAfter: 4}})
+	ctx := context.Background()
+	inner.UploadFile(ctx, "k", strings.NewReader("0123456789"), "text/plain")
+
+	body, err := client.GetFile(ctx, "k", nil)
+	if err != nil {
+		t.Fatalf("GetFile() error = %v", err)
+	}
+	defer body.Close()
+	got, err := io.ReadAll(body)
+	if string(got) != "0123" {
+		t.Errorf("read %q before truncation, want %q", got, "0123")
+	}
+	if !errors.Is(err, io.ErrUnexpectedEOF) || !errors.Is(err, ErrInjected) {
+		t.Errorf("read error = %v, want injected io.ErrUnexpectedEOF", err)
+	}
+}
+
+func TestClient_TruncatesUploads(t *testing.T) {
+	client, inner := newTestClient(t, map[Op]Fault{OpUpload: {TruncateRate: 1, TruncateAfter: 4}})
+	ctx := context.Background()
+
+	err := client.UploadFile(ctx, "k", bytes.NewReader(bytes.Repeat([]byte("x"), 100)), "text/plain")
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("UploadFile() error = %v, want io.ErrUnexpectedEOF", err)
+	}
+	if _, err := inner.StatFile(ctx, "k"); !errors.Is(err, s3.ErrNotFound) {
+		t.Errorf("a cut-off upload left an object behind: %v", err)
+	}
+}
+
+func TestClient_Latency(t *testing.T) {
+	client, _ := newTestClient(t, map[Op]Fault{OpList: {Latency: 50 * time.Millisecond}})
+
+	start := time.Now()
+	if _, err := client.ListFiles(context.Background(), ""); err != nil {
+		t.Fatalf("ListFiles() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("ListFiles() took %v, want at least 50ms", elapsed)
+	}
+
+	// A cancelled request stops waiting
+	client, _ = newTestClient(t, map[Op]Fault{OpList: {Latency: time.Hour}})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := client.ListFiles(ctx, ""); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ListFiles() error = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestClient_RatesAreSeeded(t *testing.T) {
+	run := func() []bool {
+		client, _ := newTestClient(t, map[Op]Fault{OpList: {ErrorRate: 0.5}})
+		var failures []bool
+		for i := 0; i < 200; i++ {
+			_, err := client.ListFiles(context.Background(), "")
+			failures = append(failures, err != nil)
+		}
+		return failures
+	}
+
+	first, second := run(), run()
+	failed := 0
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("call %d differs between runs with the same seed", i)
+		}
+		if first[i] {
+			failed++
+		}
+	}
+	if failed < 60 || failed > 140 {
+		t.Errorf("%d of 200 calls failed at a 0.5 error rate", failed)
+	}
+}
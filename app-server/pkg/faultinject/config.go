@@ -0,0 +1,156 @@
+// Package faultinject injects latency, errors, throttling and truncated
+// transfers into storage calls, so tests and staging can see how the app
+// behaves when S3 misbehaves. Client wraps any storage client; Transport wraps
+// the AWS SDK's HTTP client, below its retries.
+package faultinject
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Op names a storage operation that faults can be configured for
+type Op string
+
+const (
+	OpUpload  Op = "upload"
+	OpGet     Op = "get"
+	OpStat    Op = "stat"
+	OpList    Op = "list"
+	OpDelete  Op = "delete"
+	OpPresign Op = "presign"
+
+	// OpAll configures every operation that has no fault of its own
+	OpAll Op = "*"
+)
+
+var knownOps = []Op{OpUpload, OpGet, OpStat, OpList, OpDelete, OpPresign, OpAll}
+
+// DefaultTruncateAfter is how many bytes pass before a truncated transfer fails
+const DefaultTruncateAfter = 1024
+
+// Fault describes how one operation misbehaves. Rates are probabilities from 0 to 1.
+type Fault struct {
+	// Latency is added before the operation runs
+	Latency time.Duration
+	// ErrorRate fails the operation with an S3 InternalError (HTTP 500)
+	ErrorRate float64
+	// ThrottleRate fails the operation with an S3 SlowDown error (HTTP 503)
+	ThrottleRate float64
+	// TruncateRate cuts uploads and downloads off after TruncateAfter bytes
+	TruncateRate float64
+	// TruncateAfter defaults to DefaultTruncateAfter
+	TruncateAfter int64
+}
+
+// Config maps operations to their faults. Seed makes the dice rolls repeatable; 0 picks a random seed.
+type Config struct {
+	Faults map[Op]Fault
+	Seed   int64
+}
+
+// Enabled reports whether any fault is configured
+func (c Config) Enabled() bool {
+	return len(c.Faults) > 0
+}
+
+// Only returns the faults that apply to ops, with OpAll resolved for each
+func (c Config) Only(ops ...Op) Config {
+	only := Config{Seed: c.Seed}
+	for _, op := range ops {
+		if f, ok := c.fault(op); ok {
+			if only.Faults == nil {
+				only.Faults = make(map[Op]Fault)
+			}
+			only.Faults[op] = f
+		}
+	}
+	return only
+}
+
+// fault returns the fault for op, falling back to OpAll
+func (c Config) fault(op Op) (Fault, bool) {
+	if f, ok := c.Faults[op]; ok {
+		return f, true
+	}
+	f, ok := c.Faults[OpAll]
+	return f, ok
+}
+
+// ParseConfig parses a fault spec such as
+//
+//	get:latency=200ms,truncate=0.1;upload:error=0.05;*:throttle=0.01
+//
+// Each ";"-separated entry names an operation (or * for all others) and its
+// settings: latency, error, throttle, truncate and truncate_after. An empty
+// spec disables fault injection.
+func ParseConfig(spec string) (Config, error) {
+	cfg := Config{Faults: make(map[Op]Fault)}
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, settings, found := strings.Cut(entry, ":")
+		if !found {
+			return Config{}, fmt.Errorf("fault %q: expected op:key=value", entry)
+		}
+		op := Op(strings.TrimSpace(name))
+		if !isKnownOp(op) {
+			return Config{}, fmt.Errorf("fault %q: unknown operation %q", entry, op)
+		}
+
+		var f Fault
+		for _, setting := range strings.Split(settings, ",") {
+			key, value, found := strings.Cut(strings.TrimSpace(setting), "=")
+			if !found {
+				return Config{}, fmt.Errorf("fault %q: expected key=value, got %q", entry, setting)
+			}
+			var err error
+			switch key {
+			case "latency":
+				f.Latency, err = time.ParseDuration(value)
+			case "error":
+				f.ErrorRate, err = parseRate(value)
+			case "throttle":
+				f.ThrottleRate, err = parseRate(value)
+			case "truncate":
+				f.TruncateRate, err = parseRate(value)
+			case "truncate_after":
+				f.TruncateAfter, err = strconv.ParseInt(value, 10, 64)
+			default:
+				err = fmt.Errorf("unknown setting")
+			}
+			if err != nil {
+				return Config{}, fmt.Errorf("fault %q: %s: %w", entry, key, err)
+			}
+		}
+		cfg.Faults[op] = f
+	}
+	if !cfg.Enabled() {
+		cfg.Faults = nil
+	}
+	return cfg, nil
+}
+
+func isKnownOp(op Op) bool {
+	for _, known := range knownOps {
+		if op == known {
+			return true
+		}
+	}
+	return false
+}
+
+func parseRate(value string) (float64, error) {
+	rate, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, err
+	}
+	if rate < 0 || rate > 1 {
+		return 0, fmt.Errorf("rate %v is not between 0 and 1", rate)
+	}
+	return rate, nil
+}
@@ -0,0 +1,126 @@
+package faultinject
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/smithy-go"
+)
+
+// Transport injects faults into the HTTP requests the AWS SDK sends. It sits
+// below the SDK's retryer, so a throttled or failed attempt is retried just as
+// a real S3 error would be, and only faults that outlast the retries reach the
+// app. Presigning sends nothing, so presign faults need the Client wrapper.
+type Transport struct {
+	inner aws.HTTPClient
+	*injector
+}
+
+// NewTransport wraps the SDK's HTTP client with the configured faults
+func NewTransport(inner aws.HTTPClient, cfg Config) *Transport {
+	return &Transport{inner: inner, injector: newInjector(cfg)}
+}
+
+// WrapHTTPClient returns a wrapper for s3.WithHTTPClientWrapper that injects
+// cfg's faults, or nil, which leaves the client alone, if there are none
+func WrapHTTPClient(cfg Config) func(aws.HTTPClient) aws.HTTPClient {
+	if !cfg.Enabled() {
+		return nil
+	}
+	return func(inner aws.HTTPClient) aws.HTTPClient {
+		return NewTransport(inner, cfg)
+	}
+}
+
+// Do sends req unless a fault fires first. Injected errors come back as the
+// S3 error response, and truncation cuts off the request or response body.
+func (t *Transport) Do(req *http.Request) (*http.Response, error) {
+	op := opOf(req)
+	truncate, err := t.before(req.Context(), op)
+	var injected *injectedError
+	if errors.As(err, &injected) {
+		return errorResponse(req, injected), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if truncate >= 0 && op == OpUpload && req.Body != nil {
+		req = req.Clone(req.Context())
+		req.Body = &truncatedReadCloser{
+			truncatedReader: truncatedReader{r: req.Body, op: op, remaining: truncate, limit: truncate},
+			closer:          req.Body,
+		}
+	}
+	resp, err := t.inner.Do(req)
+	if err != nil || truncate < 0 || op != OpGet {
+		return resp, err
+	}
+	resp.Body = &truncatedReadCloser{
+		truncatedReader: truncatedReader{r: resp.Body, op: op, remaining: truncate, limit: truncate},
+		closer:          resp.Body,
+	}
+	return resp, nil
+}
+
+// opOf names the storage operation an S3 request belongs to
+func opOf(req *http.Request) Op {
+	query := req.URL.Query()
+	if query.Has("uploads") || query.Has("uploadId") {
+		return OpUpload // Multipart uploads, including aborting one
+	}
+	switch req.Method {
+	case http.MethodPut, http.MethodPost:
+		return OpUpload
+	case http.MethodHead:
+		return OpStat
+	case http.MethodDelete:
+		return OpDelete
+	}
+	if query.Has("list-type") {
+		return OpList
+	}
+	return OpGet
+}
+
+// s3Error is the body S3 sends with an error status
+type s3Error struct {
+	XMLName   xml.Name `xml:"Error"`
+	Code      string   `xml:"Code"`
+	Message   string   `xml:"Message"`
+	RequestID string   `xml:"RequestId"`
+}
+
+// errorResponse renders an injected error as S3 would send it
+func errorResponse(req *http.Request, injected *injectedError) *http.Response {
+	var apiErr *smithy.GenericAPIError
+	errors.As(injected.cause, &apiErr)
+	status := http.StatusInternalServerError
+	if apiErr.Code == "SlowDown" {
+		status = http.StatusServiceUnavailable
+	}
+
+	var body bytes.Buffer
+	body.WriteString(xml.Header)
+	xml.NewEncoder(&body).Encode(s3Error{Code: apiErr.Code, Message: apiErr.Message, RequestID: "faultinject"})
+	return &http.Response{
+		Status:     fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode: status,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header: http.Header{
+			"Content-Type":   {"application/xml"},
+			"Content-Length": {strconv.Itoa(body.Len())},
+		},
+		Body:          io.NopCloser(&body),
+		ContentLength: int64(body.Len()),
+		Request:       req,
+	}
+}
@@ -0,0 +1,109 @@
+package faultinject
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/s3"
+	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/s3/s3test"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+)
+
+const testBucket = "faults"
+
+// newSDKClient returns a real S3Client whose HTTP requests pass through a
+// Transport with the given faults
+func newSDKClient(t *testing.T, cfg Config, maxAttempts int) (s3.S3ClientIface, *Transport, *s3test.Server) {
+	t.Helper()
+	srv := s3test.NewServer(testBucket)
+	t.Cleanup(srv.Close)
+
+	var transport *Transport
+	client, err := s3.NewS3Client(
+		s3.WithBucket(testBucket, s3test.DefaultRegion),
+		s3.WithEndpoint(srv.URL, true),
+		s3.WithStaticCredentials(srv.AccessKeyID, srv.SecretAccessKey, ""),
+		s3.WithRetryPolicy("standard", maxAttempts),
+		s3.WithHTTPClientWrapper(func(inner aws.HTTPClient) aws.HTTPClient {
+			transport = NewTransport(inner, cfg)
+			return transport
+		}),
+	)
+	if err != nil {
+		t.Fatalf("NewS3Client() error = %v", err)
+	}
+	return client, transport, srv
+}
+
+func TestTransport_SDKRetriesAbsorbTransientThrottling(t *testing.T) {
+	// With this seed the first roll throttles and the second does not
+	client, transport, srv := newSDKClient(t, Config{Faults: map[Op]Fault{OpUpload: {ThrottleRate: 0.5}}, Seed: 1}, 3)
+
+	if err := client.UploadFile(context.Background(), "k", strings.NewReader("data"), "text/plain"); err != nil {
+		t.Fatalf("UploadFile() error = %v, want the SDK to retry past the 503", err)
+	}
+	if got := transport.Injected(); got != 1 {
+		t.Errorf("injected %d faults, want 1", got)
+	}
+	if obj, ok := srv.Object(testBucket, "k"); !ok || string(obj.Data) != "data" {
+		t.Errorf("stored object = %+v, want the retried upload", obj)
+	}
+}
+
+func TestTransport_FaultsOutlastingRetriesReachTheCaller(t *testing.T) {
+	client, transport, srv := newSDKClient(t, Config{Faults: map[Op]Fault{OpAll: {ThrottleRate: 1}}, Seed: 1}, 2)
+
+	err := client.UploadFile(context.Background(), "k", strings.NewReader("data"), "text/plain")
+	var respErr *awshttp.ResponseError
+	if !errors.As(err, &respErr) || respErr.HTTPStatusCode() != http.StatusServiceUnavailable || apiErrorCode(err) != "SlowDown" {
+		t.Fatalf("UploadFile() error = %v, want S3's 503 SlowDown", err)
+	}
+	if got := transport.Injected(); got != 2 {
+		t.Errorf("injected %d faults, want one for each of the 2 attempts", got)
+	}
+	if _, ok := srv.Object(testBucket, "k"); ok {
+		t.Error("a throttled upload reached the server")
+	}
+}
+
+func TestTransport_TruncatesDownloads(t *testing.T) {
+	client, _, srv := newSDKClient(t, Config{Faults: map[Op]Fault{OpGet: {TruncateRate: 1, TruncateAfter: 4}}, Seed: 1}, 1)
+	srv.PutObject(testBucket, "k", []byte("0123456789"), "text/plain")
+
+	body, err := client.GetFile(context.Background(), "k", nil)
+	if err != nil {
+		t.Fatalf("GetFile() error = %v", err)
+	}
+	defer body.Close()
+	got, err := io.ReadAll(body)
+	if string(got) != "0123" || !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("read %q, %v; want %q and io.ErrUnexpectedEOF", got, err, "0123")
+	}
+}
+
+func TestOpOf(t *testing.T) {
+	tests := []struct {
+		method, target string
+		want           Op
+	}{
+		{http.MethodPut, "/b/k", OpUpload},
+		{http.MethodPost, "/b/k?uploads", OpUpload},
+		{http.MethodPut, "/b/k?partNumber=1&uploadId=u", OpUpload},
+		{http.MethodDelete, "/b/k?uploadId=u", OpUpload},
+		{http.MethodGet, "/b/k", OpGet},
+		{http.MethodHead, "/b/k", OpStat},
+		{http.MethodGet, "/b?list-type=2&prefix=uploads%2F", OpList},
+		{http.MethodDelete, "/b/k", OpDelete},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, "http://s3.test"+tt.target, nil)
+		if got := opOf(req); got != tt.want {
+			t.Errorf("opOf(%s %s) = %s, want %s", tt.method, tt.target, got, tt.want)
+		}
+	}
+}
@@ -1,74 +1,101 @@
 package handlers
 
 import (
-	"context"
-	"encoding/base64"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"slices"
 	"strconv"
 	"time"
 
-	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/config"
+	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/metadata"
 	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/s3"
 	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/templates"
+	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/webhooks"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/audit"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/config"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/csrf"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/flash"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/logging"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/metrics"
 	"github.com/aruruka/go-google-s3-uploader/shared/pkg/models"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/session"
 )
 
+// maxUploadSize is the largest file HandleUploadPost accepts
+const maxUploadSize = 50 << 20 // 50 MB
+
+// allowedUploadTypes are the content types HandleUploadPost accepts. The
+// upload page hands both limits to upload.js so the browser checks the same.
+var allowedUploadTypes = []string{
+	"image/jpeg",
+	"image/png",
+	"image/gif",
+	"image/webp",
+	"application/pdf",
+	"application/zip",
+	"application/x-zip-compressed",
+}
+
 // AppHandlerIface defines the interface for application handlers
 type AppHandlerIface interface {
 	HandleHome(w http.ResponseWriter, r *http.Request)
 	HandleUpload(w http.ResponseWriter, r *http.Request)
 	HandleUploadPost(w http.ResponseWriter, r *http.Request)
 	HandleSuccess(w http.ResponseWriter, r *http.Request)
+	HandleFiles(w http.ResponseWriter, r *http.Request)
+	HandleDownload(w http.ResponseWriter, r *http.Request)
+	HandleFileDelete(w http.ResponseWriter, r *http.Request)
+	HandleShares(w http.ResponseWriter, r *http.Request)
+	HandleShareCreate(w http.ResponseWriter, r *http.Request)
+	HandleShareRevoke(w http.ResponseWriter, r *http.Request)
+	HandleShareLanding(w http.ResponseWriter, r *http.Request)
+	HandleShareDownload(w http.ResponseWriter, r *http.Request)
+	HandleAuditLog(w http.ResponseWriter, r *http.Request)
+	HandleWebhookDeliveries(w http.ResponseWriter, r *http.Request)
 }
 
 // AppHandler implements application handlers
 type AppHandler struct {
-	appConfig *config.AppConfig // Add appConfig
+	appConfig *config.Config // Add appConfig
 	renderer  templates.TemplateRendererIface
 	s3Client  s3.S3ClientIface
+	store     metadata.Store
+	webhooks  webhooks.NotifierIface // Optional
 }
 
 // NewAppHandler creates a new application handler
-func NewAppHandler(appConfig *config.AppConfig, renderer templates.TemplateRendererIface, s3Client s3.S3ClientIface) AppHandlerIface {
+func NewAppHandler(appConfig *config.Config, renderer templates.TemplateRendererIface, s3Client s3.S3ClientIface, store metadata.Store, notifier webhooks.NotifierIface) AppHandlerIface {
 	return &AppHandler{
 		appConfig: appConfig, // Store appConfig
 		renderer:  renderer,
 		s3Client:  s3Client,
+		store:     store,
+		webhooks:  notifier,
 	}
 }
 
 // HandleHome displays the home page
 func (h *AppHandler) HandleHome(w http.ResponseWriter, r *http.Request) {
-	log.Printf("🏠 App-server HandleHome called from: %s", r.RemoteAddr)
-
 	// Check if user is authenticated
 	user := h.getUserFromSession(r)
 	if user == nil {
-		log.Printf("❌ No user session found, redirecting to auth-server")
-		
-		// 🔍 Debug: Print configuration values for investigation
-		log.Printf("🔍 DEBUG - AuthServerURL: %s", h.appConfig.AuthServerURL)
-		log.Printf("🔍 DEBUG - AppServerURL: %s", h.appConfig.AppServerURL)
-		log.Printf("🔍 DEBUG - URLs equal? %v", h.appConfig.AuthServerURL == h.appConfig.AppServerURL)
-		
+		logging.FromRequest(r).Debug("no user session, redirecting to login",
+			"auth_server_url", h.appConfig.Server.AuthURL, "app_server_url", h.appConfig.Server.AppURL)
+
 		// Check if AuthServerURL is the same as our domain (App Runner scenario)
-		if h.appConfig.AuthServerURL == h.appConfig.AppServerURL {
+		if h.appConfig.Server.AuthURL == h.appConfig.Server.AppURL {
 			// Internal redirect to login page within the same service
-			log.Printf("🔄 Internal redirect to /login (same domain)")
 			http.Redirect(w, r, "/login", http.StatusTemporaryRedirect)
 		} else {
 			// External redirect to separate auth server (local development)
-			log.Printf("🔄 External redirect to: %s/login (different domains)", h.appConfig.AuthServerURL)
-			http.Redirect(w, r, h.appConfig.AuthServerURL+"/login", http.StatusTemporaryRedirect)
+			http.Redirect(w, r, h.appConfig.Server.AuthURL+"/login", http.StatusTemporaryRedirect)
 		}
 		return
 	}
 
-	log.Printf("✅ User session found: %s (%s)", user.Name, user.Email)
-
 	// Prepare page data
 	pageData := &models.PageData{
 		Title: "Google S3 Uploader - Home",
@@ -77,13 +104,13 @@ func (h *AppHandler) HandleHome(w http.ResponseWriter, r *http.Request) {
 			RecentUploads: []models.FileUpload{}, // TODO: Load from database
 			TotalUploads:  0,
 			TotalSize:     0,
-			AuthServerURL: h.appConfig.AuthServerURL, // Pass AuthServerURL to template
+			AuthServerURL: h.appConfig.Server.AuthURL, // Pass AuthServerURL to template
 		},
 	}
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	if err := h.renderer.RenderTemplate(w, "home.html", pageData); err != nil {
-		log.Printf("Failed to render home template: %v", err)
+		logging.FromRequest(r).Error("failed to render home template", "err", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
@@ -95,23 +122,24 @@ func (h *AppHandler) HandleUpload(w http.ResponseWriter, r *http.Request) {
 	user := h.getUserFromSession(r)
 	if user == nil {
 		// Redirect to auth server for login
-		http.Redirect(w, r, h.appConfig.AuthServerURL+"/login", http.StatusTemporaryRedirect) // Use appConfig
+		http.Redirect(w, r, h.appConfig.Server.AuthURL+"/login", http.StatusTemporaryRedirect) // Use appConfig
 		return
 	}
 
 	pageData := &models.PageData{
-		Title: "Upload File - Google S3 Uploader",
-		User:  user,
+		Title:     "Upload File - Google S3 Uploader",
+		User:      user,
+		CSRFToken: csrf.Token(r),
 		Data: &models.UploadData{
-			MaxFileSize:  50 * 1024 * 1024, // 50 MB
-			AllowedTypes: []string{"image/*", "application/pdf", "application/zip"},
-			S3BucketName: h.appConfig.S3BucketName, // Use appConfig
+			MaxFileSize:  maxUploadSize,
+			AllowedTypes: allowedUploadTypes,
+			S3BucketName: h.appConfig.Storage.Bucket, // Use appConfig
 		},
 	}
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	if err := h.renderer.RenderTemplate(w, "upload.html", pageData); err != nil {
-		log.Printf("Failed to render upload template: %v", err)
+		logging.FromRequest(r).Error("failed to render upload template", "err", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
@@ -127,9 +155,9 @@ func (h *AppHandler) HandleUploadPost(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Parse multipart form
-	err := r.ParseMultipartForm(50 << 20) // 50 MB max
+	err := r.ParseMultipartForm(maxUploadSize)
 	if err != nil {
-		log.Printf("Failed to parse multipart form: %v", err)
+		logging.FromRequest(r).Warn("failed to parse multipart form", "err", err)
 		h.renderError(w, "Failed to parse upload form", http.StatusBadRequest)
 		return
 	}
@@ -137,34 +165,36 @@ func (h *AppHandler) HandleUploadPost(w http.ResponseWriter, r *http.Request) {
 	// Get file from form
 	file, fileHeader, err := r.FormFile("file")
 	if err != nil {
-		log.Printf("Failed to get file from form: %v", err)
-		h.renderError(w, "No file provided", http.StatusBadRequest)
+		logging.FromRequest(r).Warn("no file in upload form", "err", err)
+		h.rejectUpload(w, r, "No file provided")
 		return
 	}
 	defer file.Close()
 
-	// TODO: Validate file type and size
-	if fileHeader.Size > 50*1024*1024 { // 50 MB
-		h.renderError(w, "File too large (max 50 MB)", http.StatusBadRequest)
+	if fileHeader.Size > maxUploadSize {
+		h.recordUpload(fileHeader.Header.Get("Content-Type"), "rejected", fileHeader.Size)
+		h.rejectUpload(w, r, "File too large (max 50 MB)")
 		return
 	}
 
 	// Validate file type
 	contentType := fileHeader.Header.Get("Content-Type")
 	if !h.isValidFileType(contentType) {
-		h.renderError(w, "Invalid file type. Only images, PDFs, and ZIP files are allowed", http.StatusBadRequest)
+		h.recordUpload(contentType, "rejected", fileHeader.Size)
+		h.rejectUpload(w, r, "Invalid file type. Only images, PDFs, and ZIP files are allowed")
 		return
 	}
 
 	// Generate S3 key
-	s3Key := fmt.Sprintf("uploads/%s/%d_%s", user.ID, time.Now().Unix(), fileHeader.Filename)
+	s3Key := fmt.Sprintf("%s%d_%s", userPrefix(user.ID), time.Now().Unix(), fileHeader.Filename)
 
 	// Upload to S3
-	ctx := context.Background()
+	ctx := r.Context()
 	err = h.s3Client.UploadFile(ctx, s3Key, file, contentType)
 	if err != nil {
-		log.Printf("Failed to upload file to S3: %v", err)
-		h.renderError(w, "Failed to upload file", http.StatusInternalServerError)
+		logging.FromRequest(r).Error("failed to upload file", "key", s3Key, "err", err)
+		h.recordUpload(contentType, "failed", fileHeader.Size)
+		h.renderStorageError(w, err, "Failed to upload file")
 		return
 	}
 
@@ -180,20 +210,34 @@ func (h *AppHandler) HandleUploadPost(w http.ResponseWriter, r *http.Request) {
 		UserID:      user.ID,
 	}
 
-	log.Printf("File uploaded successfully: %s (%d bytes)", uploadedFile.Filename, uploadedFile.Size)
+	h.recordUpload(contentType, "stored", uploadedFile.Size)
+	logging.FromRequest(r).Info("file uploaded", "key", s3Key, "size", uploadedFile.Size, "content_type", contentType)
+	audit.Record(r, audit.FileUpload, user, s3Key, fmt.Sprintf("%d bytes, %s", uploadedFile.Size, contentType))
+	h.notify(r, models.WebhookFileUploaded, *uploadedFile, nil)
 
 	// For now, we'll pass the file info via query parameters
 	// In production, this would be stored in a database
-	queryParams := fmt.Sprintf("?filename=%s&size=%d&contentType=%s&s3url=%s&uploadTime=%s",
-		uploadedFile.Filename,
-		uploadedFile.Size,
-		uploadedFile.ContentType,
-		uploadedFile.S3URL,
-		uploadedFile.UploadedAt.Format("2006-01-02 15:04:05"),
-	)
+	queryParams := url.Values{}
+	queryParams.Set("filename", uploadedFile.Filename)
+	queryParams.Set("size", strconv.FormatInt(uploadedFile.Size, 10))
+	queryParams.Set("contentType", uploadedFile.ContentType)
+	queryParams.Set("s3url", uploadedFile.S3URL)
+	queryParams.Set("uploadTime", uploadedFile.UploadedAt.Format("2006-01-02 15:04:05"))
 
 	// Redirect to success page
-	http.Redirect(w, r, "/success"+queryParams, http.StatusSeeOther)
+	flash.Set(w, flash.Success, "🎉 File uploaded successfully to AWS S3!")
+	http.Redirect(w, r, "/success?"+queryParams.Encode(), http.StatusSeeOther)
+}
+
+// rejectUpload sends a browser that posted the upload form back to it with
+// the reason. Clients of /api/upload get a 400 with the reason instead.
+func (h *AppHandler) rejectUpload(w http.ResponseWriter, r *http.Request, reason string) {
+	if r.URL.Path != "/upload" {
+		h.renderError(w, reason, http.StatusBadRequest)
+		return
+	}
+	flash.Set(w, flash.Error, "Upload rejected: "+reason)
+	http.Redirect(w, r, "/upload", http.StatusSeeOther)
 }
 
 // HandleSuccess displays the success page
@@ -201,7 +245,7 @@ func (h *AppHandler) HandleSuccess(w http.ResponseWriter, r *http.Request) {
 	// Check if user is authenticated
 	user := h.getUserFromSession(r)
 	if user == nil {
-		http.Redirect(w, r, h.appConfig.AuthServerURL+"/login", http.StatusTemporaryRedirect) // Use appConfig
+		http.Redirect(w, r, h.appConfig.Server.AuthURL+"/login", http.StatusTemporaryRedirect) // Use appConfig
 		return
 	}
 
@@ -220,14 +264,14 @@ func (h *AppHandler) HandleSuccess(w http.ResponseWriter, r *http.Request) {
 	// Parse size
 	size, err := strconv.ParseInt(sizeStr, 10, 64)
 	if err != nil {
-		log.Printf("Failed to parse file size: %v", err)
+		logging.FromRequest(r).Warn("failed to parse file size", "err", err)
 		size = 0
 	}
 
 	// Parse upload time
 	uploadTime, err := time.Parse("2006-01-02 15:04:05", uploadTimeStr)
 	if err != nil {
-		log.Printf("Failed to parse upload time: %v", err)
+		logging.FromRequest(r).Warn("failed to parse upload time", "err", err)
 		uploadTime = time.Now()
 	}
 
@@ -253,73 +297,34 @@ func (h *AppHandler) HandleSuccess(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	if err := h.renderer.RenderTemplate(w, "success.html", pageData); err != nil {
-		log.Printf("Failed to render success template: %v", err)
+		logging.FromRequest(r).Error("failed to render success template", "err", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 }
 
-// getUserFromSession extracts user from session cookie
+// getUserFromSession returns the user named by a validly signed session cookie
 func (h *AppHandler) getUserFromSession(r *http.Request) *models.User {
-	log.Printf("🍪 Checking for user_session cookie...")
-
-	// Debug: print all cookies
-	for _, cookie := range r.Cookies() {
-		log.Printf("🍪 Found cookie: %s = %s", cookie.Name, cookie.Value[:min(50, len(cookie.Value))])
-	}
-
-	cookie, err := r.Cookie("user_session")
-	if err != nil {
-		log.Printf("❌ user_session cookie not found: %v", err)
-		return nil
-	}
-
-	log.Printf("✅ user_session cookie found, decoding...")
-
-	// Decode base64 session data
-	sessionData, err := base64.StdEncoding.DecodeString(cookie.Value)
-	if err != nil {
-		log.Printf("Failed to decode session data: %v", err)
-		return nil
-	}
-
-	// Parse user JSON
-	var user models.User
-	if err := json.Unmarshal(sessionData, &user); err != nil {
-		log.Printf("Failed to parse user session: %v", err)
+	user := session.Read(r, []byte(h.appConfig.Server.CookieKey))
+	if user == nil {
+		if _, err := r.Cookie(session.CookieName); err == nil {
+			logging.FromRequest(r).Warn("ignoring session cookie with a bad signature or expired session")
+		}
 		return nil
 	}
 
-	log.Printf("✅ Session decoded successfully: %s", user.Name)
-	return &user
+	logging.SetUser(r.Context(), user.ID)
+	metrics.SessionSeen(user.ID)
+	return user
 }
 
 // isValidFileType checks if the content type is allowed
 func (h *AppHandler) isValidFileType(contentType string) bool {
-	allowedTypes := map[string]bool{
-		"image/jpeg":                   true,
-		"image/png":                    true,
-		"image/gif":                    true,
-		"image/webp":                   true,
-		"application/pdf":              true,
-		"application/zip":              true,
-		"application/x-zip-compressed": true,
-	}
-	return allowedTypes[contentType]
-}
-
-// Helper function for min
-func min(a, b int) int {
-	if a < b {
-		return a
-	}
-	return b
+	return slices.Contains(allowedUploadTypes, contentType)
 }
 
 // renderError renders an error page
 func (h *AppHandler) renderError(w http.ResponseWriter, message string, statusCode int) {
-	w.WriteHeader(statusCode)
-
 	pageData := &models.PageData{
 		Title: "Error",
 		Data: &models.ErrorData{
@@ -329,9 +334,20 @@ func (h *AppHandler) renderError(w http.ResponseWriter, message string, statusCo
 	}
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(statusCode)
 	if err := h.renderer.RenderTemplate(w, "error.html", pageData); err != nil {
-		log.Printf("Failed to render error template: %v", err)
+		slog.Error("failed to render error template", "err", err)
 		// Fallback to plain text error
 		http.Error(w, message, statusCode)
 	}
 }
+
+// renderStorageError renders a failed storage call. While storage is known to be
+// unhealthy the user gets a 503 asking them to retry instead of a generic error.
+func (h *AppHandler) renderStorageError(w http.ResponseWriter, err error, message string) {
+	if errors.Is(err, s3.ErrUnavailable) {
+		h.renderError(w, "File storage is temporarily unavailable. Please try again in a minute.", http.StatusServiceUnavailable)
+		return
+	}
+	h.renderError(w, message, http.StatusInternalServerError)
+}
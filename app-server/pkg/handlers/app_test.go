@@ -1,14 +1,25 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
-	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/config" // Import the config package
+	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/metadata"
+	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/s3"
+	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/templates"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/config"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/flash"
 )
 
 // MockS3Client for testing handlers
@@ -17,6 +28,9 @@ type MockS3Client struct {
 	GetFileURLFunc    func(key string) string
 	DeleteFileFunc    func(ctx context.Context, key string) error
 	ListFilesFunc     func(ctx context.Context, prefix string) ([]string, error)
+	StatFileFunc      func(ctx context.Context, key string) (*s3.FileInfo, error)
+	GetFileFunc       func(ctx context.Context, key string, rng *s3.ByteRange) (io.ReadCloser, error)
+	PresignGetURLFunc func(ctx context.Context, key string, expires time.Duration) (string, error)
 	ShouldReturnError bool
 }
 
@@ -30,6 +44,10 @@ func (m *MockS3Client) UploadFile(ctx context.Context, key string, file io.Reade
 	return nil
 }
 
+func (m *MockS3Client) UploadFileWithMetadata(ctx context.Context, key string, file io.Reader, contentType string, metadata map[string]string) error {
+	return m.UploadFile(ctx, key, file, contentType)
+}
+
 func (m *MockS3Client) GetFileURL(key string) string {
 	if m.GetFileURLFunc != nil {
 		return m.GetFileURLFunc(key)
@@ -57,6 +75,36 @@ func (m *MockS3Client) ListFiles(ctx context.Context, prefix string) ([]string,
 	return []string{}, nil
 }
 
+func (m *MockS3Client) StatFile(ctx context.Context, key string) (*s3.FileInfo, error) {
+	if m.ShouldReturnError {
+		return nil, errors.New("mock S3 stat error")
+	}
+	if m.StatFileFunc != nil {
+		return m.StatFileFunc(ctx, key)
+	}
+	return nil, s3.ErrNotFound
+}
+
+func (m *MockS3Client) GetFile(ctx context.Context, key string, rng *s3.ByteRange) (io.ReadCloser, error) {
+	if m.ShouldReturnError {
+		return nil, errors.New("mock S3 get error")
+	}
+	if m.GetFileFunc != nil {
+		return m.GetFileFunc(ctx, key, rng)
+	}
+	return nil, s3.ErrNotFound
+}
+
+func (m *MockS3Client) PresignGetURL(ctx context.Context, key string, expires time.Duration) (string, error) {
+	if m.ShouldReturnError {
+		return "", errors.New("mock S3 presign error")
+	}
+	if m.PresignGetURLFunc != nil {
+		return m.PresignGetURLFunc(ctx, key, expires)
+	}
+	return "https://mock-bucket.s3.amazonaws.com/" + key + "?X-Amz-Signature=mock", nil
+}
+
 // MockTemplateRenderer for testing
 type MockTemplateRenderer struct {
 	ShouldReturnError bool
@@ -74,12 +122,12 @@ func (m *MockTemplateRenderer) RenderTemplate(w io.Writer, templateName string,
 func TestNewAppHandler(t *testing.T) {
 	mockRenderer := &MockTemplateRenderer{}
 	mockS3Client := &MockS3Client{}
-	mockAppConfig := &config.AppConfig{
-		AuthServerURL: "http://mock-auth-server.com", // Mock URL for testing redirects
-		S3BucketName:  "mock-s3-bucket",
+	mockAppConfig := &config.Config{
+		Server:  config.ServerConfig{AuthURL: "http://mock-auth-server.com"}, // Mock URL for testing redirects
+		Storage: config.StorageConfig{Bucket: "mock-s3-bucket"},
 	}
 
-	handler := NewAppHandler(mockAppConfig, mockRenderer, mockS3Client)
+	handler := NewAppHandler(mockAppConfig, mockRenderer, mockS3Client, metadata.NewMemoryStore(), nil)
 
 	if handler == nil {
 		t.Error("Expected handler to be created, got nil")
@@ -90,9 +138,9 @@ func TestNewAppHandler(t *testing.T) {
 func TestAppHandler_IsValidFileType(t *testing.T) {
 	mockRenderer := &MockTemplateRenderer{}
 	mockS3Client := &MockS3Client{}
-	mockAppConfig := &config.AppConfig{
-		AuthServerURL: "http://mock-auth-server.com",
-		S3BucketName:  "mock-s3-bucket",
+	mockAppConfig := &config.Config{
+		Server:  config.ServerConfig{AuthURL: "http://mock-auth-server.com"},
+		Storage: config.StorageConfig{Bucket: "mock-s3-bucket"},
 	}
 	handler := &AppHandler{
 		appConfig: mockAppConfig, // Add appConfig
@@ -127,13 +175,96 @@ func TestAppHandler_IsValidFileType(t *testing.T) {
 	}
 }
 
+// The upload page hands its limits to upload.js, which must check the same
+// ones the server does rather than its own
+func TestAppHandler_HandleUpload_LimitsMatchScript(t *testing.T) {
+	renderer, err := templates.NewTemplateRenderer()
+	if err != nil {
+		t.Fatalf("NewTemplateRenderer() error = %v", err)
+	}
+	handler := &AppHandler{
+		appConfig: &config.Config{Server: config.ServerConfig{CookieKey: testCookieKey}},
+		renderer:  renderer,
+	}
+	req := httptest.NewRequest("GET", "/upload", nil)
+	req.AddCookie(&http.Cookie{Name: "user_session", Value: testSessionCookie})
+	w := httptest.NewRecorder()
+	handler.HandleUpload(w, req)
+	page := w.Body.String()
+
+	match := regexp.MustCompile(`data-max-size="(\d+)"`).FindStringSubmatch(page)
+	if match == nil {
+		t.Fatalf("upload page has no data-max-size attribute:\n%s", page)
+	}
+	if got, _ := strconv.ParseInt(match[1], 10, 64); got != maxUploadSize {
+		t.Errorf("data-max-size = %d, want %d", got, maxUploadSize)
+	}
+	if !strings.Contains(page, "Maximum file size: 50.0 MB") {
+		t.Error("upload page does not state the 50 MB limit")
+	}
+	if want := `data-allowed-types="` + strings.Join(allowedUploadTypes, ",") + `"`; !strings.Contains(page, want) {
+		t.Errorf("upload page is missing %s", want)
+	}
+
+	script, err := os.ReadFile("../../../shared/static/js/upload.js")
+	if err != nil {
+		t.Fatalf("reading upload.js: %v", err)
+	}
+	for _, want := range []string{"dataset.maxSize", "dataset.allowedTypes"} {
+		if !bytes.Contains(script, []byte(want)) {
+			t.Errorf("upload.js does not read %s", want)
+		}
+	}
+	if limit := regexp.MustCompile(`\d+\s*\*\s*1024\s*\*\s*1024`).Find(script); limit != nil {
+		t.Errorf("upload.js hard-codes a size limit: %s", limit)
+	}
+}
+
+// The upload form gets a flash and a redirect back; /api/upload keeps its 400
+func TestAppHandler_HandleUploadPost_Rejected(t *testing.T) {
+	handler := &AppHandler{
+		appConfig: &config.Config{Server: config.ServerConfig{CookieKey: testCookieKey}},
+		renderer:  &MockTemplateRenderer{},
+		s3Client:  &MockS3Client{},
+	}
+	noFile := func(path string) *http.Request {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		mw.Close()
+		req := httptest.NewRequest(http.MethodPost, path, &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		req.AddCookie(&http.Cookie{Name: "user_session", Value: testSessionCookie})
+		return req
+	}
+
+	upload := flash.Middleware([]byte(testCookieKey), http.HandlerFunc(handler.HandleUploadPost))
+
+	w := httptest.NewRecorder()
+	upload.ServeHTTP(w, noFile("/upload"))
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/upload" {
+		t.Errorf("form upload = %d to %q, want 303 to /upload", w.Code, w.Header().Get("Location"))
+	}
+	if !strings.HasPrefix(w.Header().Get("Set-Cookie"), flash.CookieName+"=") {
+		t.Error("form upload set no flash message")
+	}
+
+	w = httptest.NewRecorder()
+	upload.ServeHTTP(w, noFile("/api/upload"))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("API upload status = %d, want 400", w.Code)
+	}
+	if w.Header().Get("Location") != "" || w.Header().Get("Set-Cookie") != "" {
+		t.Errorf("API upload redirected or set a cookie: %v", w.Header())
+	}
+}
+
 // Test HandleHome
 func TestAppHandler_HandleHome(t *testing.T) {
 	mockRenderer := &MockTemplateRenderer{}
 	mockS3Client := &MockS3Client{}
-	mockAppConfig := &config.AppConfig{
-		AuthServerURL: "http://mock-auth-server.com", // Mock URL for testing redirects
-		S3BucketName:  "mock-s3-bucket",
+	mockAppConfig := &config.Config{
+		Server:  config.ServerConfig{AuthURL: "http://mock-auth-server.com", CookieKey: testCookieKey}, // Mock URL for testing redirects
+		Storage: config.StorageConfig{Bucket: "mock-s3-bucket"},
 	}
 	handler := &AppHandler{
 		appConfig: mockAppConfig, // Add appConfig
@@ -145,7 +276,7 @@ func TestAppHandler_HandleHome(t *testing.T) {
 	// Add session cookie for authenticated user - use "user_session" as cookie name
 	req.AddCookie(&http.Cookie{
 		Name:  "user_session",
-		Value: "eyJpZCI6InRlc3QtdXNlci1pZCIsIm5hbWUiOiJKb2huIERvZSIsImVtYWlsIjoidGVzdEBleGFtcGxlLmNvbSJ9", // base64 encoded JSON
+		Value: testSessionCookie,
 	})
 
 	w := httptest.NewRecorder()
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/audit"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/logging"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/models"
+)
+
+// auditPageSize is how many events the audit log page shows
+const auditPageSize = 200
+
+// HandleAuditLog lets admins search the audit log
+func (h *AppHandler) HandleAuditLog(w http.ResponseWriter, r *http.Request) {
+	user := h.getUserFromSession(r)
+	if user == nil {
+		http.Redirect(w, r, h.appConfig.Server.AuthURL+"/login", http.StatusTemporaryRedirect)
+		return
+	}
+	if !h.appConfig.Auth.IsAdmin(user) {
+		logging.FromRequest(r).Warn("audit log denied to non-admin")
+		h.renderError(w, "Only administrators can view the audit log", http.StatusForbidden)
+		return
+	}
+
+	params := r.URL.Query()
+	data := &models.AuditData{
+		Query: models.AuditQuery{
+			Actor:  strings.TrimSpace(params.Get("actor")),
+			Action: params.Get("action"),
+			Object: strings.TrimSpace(params.Get("object")),
+			Limit:  auditPageSize,
+		},
+		Since:   params.Get("since"),
+		Until:   params.Get("until"),
+		Actions: audit.Actions,
+	}
+
+	var err error
+	if data.Query.Since, err = parseDay(data.Since); err != nil {
+		data.Error = "Invalid start date, use YYYY-MM-DD"
+	}
+	if data.Query.Until, err = parseDay(data.Until); err != nil {
+		data.Error = "Invalid end date, use YYYY-MM-DD"
+	} else if !data.Query.Until.IsZero() {
+		data.Query.Until = data.Query.Until.AddDate(0, 0, 1) // Include the whole end day
+	}
+
+	if data.Error == "" {
+		data.Events, err = audit.Search(r, data.Query)
+		switch {
+		case errors.Is(err, audit.ErrNotSearchable):
+			data.Error = "No searchable audit sink is configured; set AUDIT_SINKS to include file or db"
+		case err != nil:
+			logging.FromRequest(r).Error("failed to search audit log", "err", err)
+			data.Error = "Failed to search the audit log"
+		}
+		audit.Record(r, audit.AdminSearch, user, "", r.URL.RawQuery)
+	}
+
+	pageData := &models.PageData{
+		Title: "Audit Log - Google S3 Uploader",
+		User:  user,
+		Data:  data,
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := h.renderer.RenderTemplate(w, "audit.html", pageData); err != nil {
+		logging.FromRequest(r).Error("failed to render audit template", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// parseDay parses a YYYY-MM-DD form value as midnight UTC; empty is the zero time
+func parseDay(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.DateOnly, value)
+}
@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/faultinject"
+	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/localfs"
+	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/metadata"
+	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/s3"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/config"
+)
+
+// newFaultyHandler returns a handler whose storage misbehaves as configured.
+// The returned client bypasses the faults for seeding and checking objects.
+func newFaultyHandler(t *testing.T, faults map[faultinject.Op]faultinject.Fault) (*AppHandler, s3.S3ClientIface) {
+	t.Helper()
+	storage, err := localfs.NewClient(t.TempDir(), "https://uploader.example.com", []byte("test-signing-key"))
+	if err != nil {
+		t.Fatalf("localfs.NewClient() error = %v", err)
+	}
+	handler := &AppHandler{
+		appConfig: &config.Config{Server: config.ServerConfig{
+			AppURL:    "https://uploader.example.com",
+			AuthURL:   "https://uploader.example.com",
+			CookieKey: testCookieKey,
+		}},
+		renderer: &MockTemplateRenderer{},
+		s3Client: faultinject.NewClient(storage, faultinject.Config{Faults: faults, Seed: 1}),
+		store:    metadata.NewMemoryStore(),
+	}
+	return handler, storage
+}
+
+// newUploadRequest builds an authenticated multipart upload of a PNG file
+func newUploadRequest(t *testing.T, data []byte) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", `form-data; name="file"; filename="photo.png"`)
+	header.Set("Content-Type", "image/png")
+	part, err := mw.CreatePart(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(data)
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/upload", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.AddCookie(&http.Cookie{Name: "user_session", Value: testSessionCookie})
+	return req
+}
+
+func storedKeys(t *testing.T, storage s3.S3ClientIface) []string {
+	t.Helper()
+	keys, err := storage.ListFiles(context.Background(), "uploads/")
+	if err != nil {
+		t.Fatalf("ListFiles() error = %v", err)
+	}
+	return keys
+}
+
+func TestAppHandler_HandleUploadPost_StorageFaults(t *testing.T) {
+	tests := []struct {
+		name  string
+		fault faultinject.Fault
+	}{
+		{"S3 returns 500", faultinject.Fault{ErrorRate: 1}},
+		{"S3 throttles", faultinject.Fault{ThrottleRate: 1}},
+		{"connection drops halfway", faultinject.Fault{TruncateRate: 1, TruncateAfter: 512}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, storage := newFaultyHandler(t, map[faultinject.Op]faultinject.Fault{faultinject.OpUpload: tt.fault})
+			w := httptest.NewRecorder()
+
+			handler.HandleUploadPost(w, newUploadRequest(t, bytes.Repeat([]byte("p"), 4096)))
+
+			if w.Code != http.StatusInternalServerError {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusInternalServerError)
+			}
+			if w.Header().Get("Location") != "" {
+				t.Errorf("failed upload redirected to %q", w.Header().Get("Location"))
+			}
+			if keys := storedKeys(t, storage); len(keys) != 0 {
+				t.Errorf("failed upload left objects behind: %v", keys)
+			}
+		})
+	}
+}
+
+func TestAppHandler_HandleUploadPost_SlowStorageHonoursCancellation(t *testing.T) {
+	handler, storage := newFaultyHandler(t, map[faultinject.Op]faultinject.Fault{faultinject.OpUpload: {Latency: time.Hour}})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	w := httptest.NewRecorder()
+
+	done := make(chan struct{})
+	go func() {
+		handler.HandleUploadPost(w, newUploadRequest(t, []byte("png")).WithContext(ctx))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("HandleUploadPost() kept waiting on storage after the client went away")
+	}
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+	if keys := storedKeys(t, storage); len(keys) != 0 {
+		t.Errorf("cancelled upload stored %v", keys)
+	}
+}
+
+func TestAppHandler_HandleFiles_StorageFaults(t *testing.T) {
+	handler, _ := newFaultyHandler(t, map[faultinject.Op]faultinject.Fault{faultinject.OpList: {ThrottleRate: 1}})
+	req := httptest.NewRequest(http.MethodGet, "/files", nil)
+	req.AddCookie(&http.Cookie{Name: "user_session", Value: testSessionCookie})
+	w := httptest.NewRecorder()
+
+	handler.HandleFiles(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestAppHandler_HandleDownload_StorageFaults(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 100)
+	tests := []struct {
+		name   string
+		faults map[faultinject.Op]faultinject.Fault
+		status int
+		body   string
+	}{
+		{"stat fails", map[faultinject.Op]faultinject.Fault{faultinject.OpStat: {ErrorRate: 1}}, http.StatusInternalServerError, ""},
+		{"get throttled", map[faultinject.Op]faultinject.Fault{faultinject.OpGet: {ThrottleRate: 1}}, http.StatusInternalServerError, ""},
+		// Headers are already sent when the body breaks, so the client sees a short body
+		{"body truncated", map[faultinject.Op]faultinject.Fault{faultinject.OpGet: {TruncateRate: 1, TruncateAfter: 100}}, http.StatusOK, string(content[:100])},
+		{"slow but healthy", map[faultinject.Op]faultinject.Fault{faultinject.OpAll: {Latency: 10 * time.Millisecond}}, http.StatusOK, string(content)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, storage := newFaultyHandler(t, tt.faults)
+			if err := storage.UploadFile(context.Background(), testFileKey, bytes.NewReader(content), "application/pdf"); err != nil {
+				t.Fatalf("seeding file: %v", err)
+			}
+			req := httptest.NewRequest(http.MethodGet, "/download?key="+url.QueryEscape(testFileKey), nil)
+			req.AddCookie(&http.Cookie{Name: "user_session", Value: testSessionCookie})
+			w := httptest.NewRecorder()
+
+			handler.HandleDownload(w, req)
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			if tt.status == http.StatusOK && w.Body.String() != tt.body {
+				t.Errorf("body is %d bytes, want %d", w.Body.Len(), len(tt.body))
+			}
+			if tt.status != http.StatusOK && strings.Contains(w.Body.String(), "0123456789") {
+				t.Error("error response leaked file content")
+			}
+		})
+	}
+}
+
+func TestAppHandler_HandleShareDownload_StorageFaults(t *testing.T) {
+	handler, storage := newFaultyHandler(t, map[faultinject.Op]faultinject.Fault{faultinject.OpGet: {ErrorRate: 1}})
+	storage.UploadFile(context.Background(), testFileKey, strings.NewReader("%PDF-1.4"), "application/pdf")
+	token := createTestShare(t, handler, url.Values{"key": {testFileKey}})
+
+	w := downloadShare(handler, token, "")
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestAppHandler_StorageUnavailable(t *testing.T) {
+	unavailable := fmt.Errorf("circuit breaker is open: %w", s3.ErrUnavailable)
+	handler := &AppHandler{
+		appConfig: &config.Config{Server: config.ServerConfig{AuthURL: "https://uploader.example.com", CookieKey: testCookieKey}},
+		renderer:  &MockTemplateRenderer{},
+		s3Client: &MockS3Client{
+			UploadFileFunc: func(ctx context.Context, key string, file io.Reader, contentType string) error { return unavailable },
+			ListFilesFunc:  func(ctx context.Context, prefix string) ([]string, error) { return nil, unavailable },
+			StatFileFunc:   func(ctx context.Context, key string) (*s3.FileInfo, error) { return nil, unavailable },
+		},
+		store: metadata.NewMemoryStore(),
+	}
+	authed := func(method, target string) *http.Request {
+		req := httptest.NewRequest(method, target, nil)
+		req.AddCookie(&http.Cookie{Name: "user_session", Value: testSessionCookie})
+		return req
+	}
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		req     *http.Request
+	}{
+		{"upload", handler.HandleUploadPost, newUploadRequest(t, []byte("png"))},
+		{"files", handler.HandleFiles, authed(http.MethodGet, "/files")},
+		{"download", handler.HandleDownload, authed(http.MethodGet, "/download?key="+url.QueryEscape(testFileKey))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			tt.handler(w, tt.req)
+			if w.Code != http.StatusServiceUnavailable {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+			}
+		})
+	}
+}
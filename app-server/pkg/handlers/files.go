@@ -0,0 +1,280 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/s3"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/audit"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/csrf"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/flash"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/logging"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/models"
+)
+
+// HandleFiles lists the current user's uploaded files
+func (h *AppHandler) HandleFiles(w http.ResponseWriter, r *http.Request) {
+	user := h.getUserFromSession(r)
+	if user == nil {
+		http.Redirect(w, r, h.appConfig.Server.AuthURL+"/login", http.StatusTemporaryRedirect)
+		return
+	}
+
+	keys, err := h.s3Client.ListFiles(r.Context(), userPrefix(user.ID))
+	if err != nil {
+		logging.FromRequest(r).Error("failed to list files", "err", err)
+		h.renderStorageError(w, err, "Failed to load your files")
+		return
+	}
+
+	files := make([]models.FileEntry, 0, len(keys))
+	for _, key := range keys {
+		filename, uploadedAt := describeKey(key)
+		files = append(files, models.FileEntry{
+			S3Key:      key,
+			Filename:   filename,
+			UploadedAt: uploadedAt,
+		})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].UploadedAt.After(files[j].UploadedAt)
+	})
+
+	pageData := &models.PageData{
+		Title:     "My Files - Google S3 Uploader",
+		User:      user,
+		Data:      &models.FilesData{Files: files},
+		CSRFToken: csrf.Token(r),
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := h.renderer.RenderTemplate(w, "files.html", pageData); err != nil {
+		logging.FromRequest(r).Error("failed to render files template", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// HandleDownload streams one of the current user's files
+func (h *AppHandler) HandleDownload(w http.ResponseWriter, r *http.Request) {
+	user := h.getUserFromSession(r)
+	if user == nil {
+		http.Redirect(w, r, h.appConfig.Server.AuthURL+"/login", http.StatusTemporaryRedirect)
+		return
+	}
+
+	key := r.URL.Query().Get("key")
+	if !ownsKey(user.ID, key) {
+		h.renderError(w, "File not found", http.StatusNotFound)
+		return
+	}
+
+	filename, _ := describeKey(key)
+	if h.serveFile(w, r, key, filename) {
+		audit.Record(r, audit.FileDownload, user, key, r.Header.Get("Range"))
+	}
+}
+
+// HandleFileDelete deletes one of the current user's files
+func (h *AppHandler) HandleFileDelete(w http.ResponseWriter, r *http.Request) {
+	user := h.getUserFromSession(r)
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	key := r.FormValue("key")
+	if !ownsKey(user.ID, key) {
+		h.renderError(w, "File not found", http.StatusNotFound)
+		return
+	}
+
+	// Looked up first so the webhook can describe the deleted file
+	info, err := h.s3Client.StatFile(r.Context(), key)
+	if err != nil {
+		if errors.Is(err, s3.ErrNotFound) {
+			h.renderError(w, "File not found", http.StatusNotFound)
+			return
+		}
+		logging.FromRequest(r).Error("failed to stat file", "key", key, "err", err)
+		h.renderStorageError(w, err, "Failed to delete file")
+		return
+	}
+
+	if err := h.s3Client.DeleteFile(r.Context(), key); err != nil {
+		logging.FromRequest(r).Error("failed to delete file", "key", key, "err", err)
+		h.renderStorageError(w, err, "Failed to delete file")
+		return
+	}
+
+	filename, _ := describeKey(key)
+	logging.FromRequest(r).Info("file deleted", "key", key)
+	audit.Record(r, audit.FileDelete, user, key, "")
+	h.notify(r, models.WebhookFileDeleted, h.fileRecord(user.ID, key, info), nil)
+	flash.Set(w, flash.Success, "Deleted "+filename)
+	http.Redirect(w, r, "/files", http.StatusSeeOther)
+}
+
+// serveFile proxies an object to the client, honouring a single Range header.
+// It reports whether the object was found and its body sent.
+func (h *AppHandler) serveFile(w http.ResponseWriter, r *http.Request, key, filename string) bool {
+	file, ok := h.openFile(w, r, key)
+	if !ok {
+		return false
+	}
+	defer file.body.Close()
+	h.sendFile(w, r, file, filename)
+	return true
+}
+
+// openedFile is an object ready to be sent
+type openedFile struct {
+	key  string
+	info *s3.FileInfo
+	rng  *s3.ByteRange // nil for the whole object
+	body io.ReadCloser
+}
+
+// openFile looks the object up, checks the request's Range header against it
+// and opens its body. When any step fails it writes the error response and
+// returns false, so nothing has been counted or sent yet.
+func (h *AppHandler) openFile(w http.ResponseWriter, r *http.Request, key string) (*openedFile, bool) {
+	info, err := h.s3Client.StatFile(r.Context(), key)
+	if err != nil {
+		if errors.Is(err, s3.ErrNotFound) {
+			h.renderError(w, "File not found", http.StatusNotFound)
+			return nil, false
+		}
+		logging.FromRequest(r).Error("failed to stat file", "key", key, "err", err)
+		h.renderStorageError(w, err, "Failed to download file")
+		return nil, false
+	}
+
+	rng, ok := parseRange(r.Header.Get("Range"), info.Size)
+	if !ok {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", info.Size))
+		http.Error(w, "Requested range not satisfiable", http.StatusRequestedRangeNotSatisfiable)
+		return nil, false
+	}
+
+	body, err := h.s3Client.GetFile(r.Context(), key, rng)
+	if err != nil {
+		logging.FromRequest(r).Error("failed to open file", "key", key, "err", err)
+		h.renderStorageError(w, err, "Failed to download file")
+		return nil, false
+	}
+	return &openedFile{key: key, info: info, rng: rng, body: body}, true
+}
+
+// sendFile writes the headers and streams an opened object
+func (h *AppHandler) sendFile(w http.ResponseWriter, r *http.Request, file *openedFile, filename string) {
+	info, rng, key := file.info, file.rng, file.key
+	contentType := info.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	w.Header().Set("Accept-Ranges", "bytes")
+	if info.ETag != "" {
+		w.Header().Set("ETag", info.ETag)
+	}
+	if !info.LastModified.IsZero() {
+		w.Header().Set("Last-Modified", info.LastModified.UTC().Format(http.TimeFormat))
+	}
+
+	status := http.StatusOK
+	length := info.Size
+	if rng != nil {
+		status = http.StatusPartialContent
+		length = rng.Length(info.Size)
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", rng.Start, rng.Start+length-1, info.Size))
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(length, 10))
+	w.WriteHeader(status)
+
+	if _, err := io.Copy(w, file.body); err != nil {
+		logging.FromRequest(r).Warn("failed to stream file", "key", key, "err", err)
+	}
+}
+
+// parseRange parses a single-range "bytes=" header against an object size.
+// It returns ok=false when the range cannot be satisfied; unsupported or
+// malformed headers are ignored so the whole object is served.
+func parseRange(header string, size int64) (*s3.ByteRange, bool) {
+	spec, found := strings.CutPrefix(header, "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return nil, true
+	}
+	startStr, endStr, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return nil, true
+	}
+
+	if startStr == "" {
+		// Suffix range: the last N bytes
+		n, err := strconv.ParseInt(endStr, 10, 64)
+		if err != nil || n <= 0 {
+			return nil, true
+		}
+		if size == 0 {
+			return nil, false
+		}
+		if n > size {
+			n = size
+		}
+		return &s3.ByteRange{Start: size - n, End: size - 1}, true
+	}
+
+	start, err := strconv.ParseInt(startStr, 10, 64)
+	if err != nil || start < 0 {
+		return nil, true
+	}
+	if start >= size {
+		return nil, false
+	}
+	end := int64(-1)
+	if endStr != "" {
+		end, err = strconv.ParseInt(endStr, 10, 64)
+		if err != nil || end < start {
+			return nil, true
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	return &s3.ByteRange{Start: start, End: end}, true
+}
+
+// userPrefix returns the S3 prefix under which a user's uploads are stored
+func userPrefix(userID string) string {
+	return "uploads/" + userID + "/"
+}
+
+// ownsKey reports whether key is one of the user's uploads
+func ownsKey(userID, key string) bool {
+	rest, found := strings.CutPrefix(key, userPrefix(userID))
+	return found && rest != "" && !strings.Contains(rest, "/")
+}
+
+// describeKey recovers the original filename and upload time from an upload key
+func describeKey(key string) (string, time.Time) {
+	name := path.Base(key)
+	unix, filename, found := strings.Cut(name, "_")
+	if !found {
+		return name, time.Time{}
+	}
+	seconds, err := strconv.ParseInt(unix, 10, 64)
+	if err != nil {
+		return name, time.Time{}
+	}
+	return filename, time.Unix(seconds, 0)
+}
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/resilience"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/logging"
+)
+
+// HealthResponse is the JSON body served at /health
+type HealthResponse struct {
+	Status  string                   `json:"status"` // "ok", or "degraded" while storage is failing fast
+	Storage resilience.BreakerStatus `json:"storage"`
+}
+
+// NewHealthHandler reports liveness together with the storage circuit breaker state.
+// It always answers 200 so an open breaker does not get healthy instances replaced.
+func NewHealthHandler(storage *resilience.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		resp := HealthResponse{Status: "ok", Storage: storage.BreakerStatus()}
+		if resp.Storage.State == resilience.StateOpen || resp.Storage.State == resilience.StateHalfOpen {
+			resp.Status = "degraded"
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			logging.FromRequest(r).Warn("failed to write health response", "err", err)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	factory = promauto.With(metrics.Registry)
+
+	uploadsTotal = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Name:      "uploads_total",
+		Help:      "Upload attempts by content type and outcome (stored, rejected or failed).",
+	}, []string{"content_type", "outcome"})
+
+	uploadBytes = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Name:      "upload_bytes_total",
+		Help:      "Bytes of successfully stored uploads by content type.",
+	}, []string{"content_type"})
+)
+
+// recordUpload counts an upload. Content types outside the allow-list are
+// folded into "other" so clients cannot create unbounded label values.
+func (h *AppHandler) recordUpload(contentType, outcome string, size int64) {
+	if !h.isValidFileType(contentType) {
+		contentType = "other"
+	}
+	uploadsTotal.WithLabelValues(contentType, outcome).Inc()
+	if outcome == "stored" {
+		uploadBytes.WithLabelValues(contentType).Add(float64(size))
+	}
+}
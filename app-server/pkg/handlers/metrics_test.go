@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/faultinject"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestAppHandler_HandleUploadPost_Metrics(t *testing.T) {
+	stored := testutil.ToFloat64(uploadsTotal.WithLabelValues("image/png", "stored"))
+	failed := testutil.ToFloat64(uploadsTotal.WithLabelValues("image/png", "failed"))
+	bytes := testutil.ToFloat64(uploadBytes.WithLabelValues("image/png"))
+
+	handler, _ := newFaultyHandler(t, nil)
+	handler.HandleUploadPost(httptest.NewRecorder(), newUploadRequest(t, []byte("12345")))
+
+	broken, _ := newFaultyHandler(t, map[faultinject.Op]faultinject.Fault{faultinject.OpUpload: {ErrorRate: 1}})
+	rec := httptest.NewRecorder()
+	broken.HandleUploadPost(rec, newUploadRequest(t, []byte("12345")))
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("failed upload status = %d", rec.Code)
+	}
+
+	if got := testutil.ToFloat64(uploadsTotal.WithLabelValues("image/png", "stored")) - stored; got != 1 {
+		t.Errorf("stored uploads went up by %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(uploadsTotal.WithLabelValues("image/png", "failed")) - failed; got != 1 {
+		t.Errorf("failed uploads went up by %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(uploadBytes.WithLabelValues("image/png")) - bytes; got != 5 {
+		t.Errorf("upload bytes went up by %v, want 5", got)
+	}
+}
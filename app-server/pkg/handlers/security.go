@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/config"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/secheaders"
+)
+
+// SecurityHeaders returns the security header policy for the app's routes.
+// Share pages may be embedded by the configured sites and never send their
+// URL, which holds the share token, as a referrer.
+func SecurityHeaders(cfg *config.Config) secheaders.Config {
+	share := secheaders.Policy{
+		FrameAncestors: strings.Fields(cfg.Security.ShareFrameAncestors),
+		ReferrerPolicy: "no-referrer",
+	}
+	if cfg.Shares.DownloadMode == "presign" {
+		// The download form redirects to a presigned URL on the storage host
+		storage := "https://*.amazonaws.com"
+		if cfg.Storage.Endpoint != "" {
+			storage = cfg.Storage.Endpoint
+		}
+		share.FormAction = []string{storage}
+	}
+	return secheaders.Config{
+		HSTSMaxAge: cfg.Security.HSTSMaxAge,
+		ReportOnly: cfg.Security.CSPReportOnly,
+		Routes:     []secheaders.Route{{Prefix: "/s/", Policy: share, Secret: true}},
+	}
+}
@@ -0,0 +1,475 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/metadata"
+	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/s3"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/audit"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/csrf"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/flash"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/logging"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/models"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/ratelimit"
+)
+
+// sharePasswordIterations is the PBKDF2 work factor for share passwords
+const sharePasswordIterations = 600_000
+
+// shareResumeCookie lets the client that started a counted share download
+// fetch the rest with Range requests; shareResumeWindow is how long it may
+const (
+	shareResumeCookie = "share_resume"
+	shareResumeWindow = time.Hour
+)
+
+// HandleShares lists the current user's share links
+func (h *AppHandler) HandleShares(w http.ResponseWriter, r *http.Request) {
+	user := h.getUserFromSession(r)
+	if user == nil {
+		http.Redirect(w, r, h.appConfig.Server.AuthURL+"/login", http.StatusTemporaryRedirect)
+		return
+	}
+
+	shares, err := h.store.ListShares(r.Context(), user.ID)
+	if err != nil {
+		logging.FromRequest(r).Error("failed to list shares", "err", err)
+		h.renderError(w, "Failed to load your share links", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	data := &models.SharesData{Shares: make([]models.ShareView, 0, len(shares))}
+	for i := range shares {
+		share := &shares[i]
+		accesses, err := h.store.ListShareAccesses(r.Context(), share.Token)
+		if err != nil {
+			logging.FromRequest(r).Error("failed to load share access log", "share", shortToken(share.Token), "err", err)
+		}
+		data.Shares = append(data.Shares, models.ShareView{
+			Share:    share,
+			URL:      h.shareURL(share.Token),
+			Status:   share.Status(now),
+			Accesses: len(accesses),
+		})
+	}
+	if created := r.URL.Query().Get("created"); created != "" {
+		data.CreatedURL = h.shareURL(created)
+	}
+
+	pageData := &models.PageData{
+		Title:     "Share Links - Google S3 Uploader",
+		User:      user,
+		Data:      data,
+		CSRFToken: csrf.Token(r),
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := h.renderer.RenderTemplate(w, "shares.html", pageData); err != nil {
+		logging.FromRequest(r).Error("failed to render shares template", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// HandleShareCreate creates a share link for one of the current user's files
+func (h *AppHandler) HandleShareCreate(w http.ResponseWriter, r *http.Request) {
+	user := h.getUserFromSession(r)
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		h.renderError(w, "Failed to parse share form", http.StatusBadRequest)
+		return
+	}
+
+	key := r.PostForm.Get("key")
+	if !ownsKey(user.ID, key) {
+		h.renderError(w, "File not found", http.StatusNotFound)
+		return
+	}
+	info, err := h.s3Client.StatFile(r.Context(), key)
+	if err != nil {
+		if errors.Is(err, s3.ErrNotFound) {
+			h.renderError(w, "File not found", http.StatusNotFound)
+			return
+		}
+		logging.FromRequest(r).Error("failed to stat file", "key", key, "err", err)
+		h.renderStorageError(w, err, "Failed to create share link")
+		return
+	}
+
+	now := time.Now()
+	filename, _ := describeKey(key)
+	share := &models.Share{
+		S3Key:     key,
+		Filename:  filename,
+		OwnerID:   user.ID,
+		CreatedAt: now,
+	}
+
+	if expiresIn := r.PostForm.Get("expires_in"); expiresIn != "" {
+		d, err := time.ParseDuration(expiresIn)
+		if err != nil || d <= 0 {
+			h.renderError(w, "Invalid expiry", http.StatusBadRequest)
+			return
+		}
+		expiresAt := now.Add(d)
+		share.ExpiresAt = &expiresAt
+	}
+
+	if maxDownloads := r.PostForm.Get("max_downloads"); maxDownloads != "" {
+		n, err := strconv.Atoi(maxDownloads)
+		if err != nil || n < 0 {
+			h.renderError(w, "Invalid download limit", http.StatusBadRequest)
+			return
+		}
+		share.MaxDownloads = n
+	}
+
+	if password := r.PostForm.Get("password"); password != "" {
+		hash, err := hashSharePassword(password)
+		if err != nil {
+			logging.FromRequest(r).Error("failed to hash share password", "err", err)
+			h.renderError(w, "Failed to create share link", http.StatusInternalServerError)
+			return
+		}
+		share.PasswordHash = hash
+	}
+
+	token, err := generateShareToken()
+	if err != nil {
+		logging.FromRequest(r).Error("failed to generate share token", "err", err)
+		h.renderError(w, "Failed to create share link", http.StatusInternalServerError)
+		return
+	}
+	share.Token = token
+
+	if err := h.store.CreateShare(r.Context(), share); err != nil {
+		logging.FromRequest(r).Error("failed to store share", "err", err)
+		h.renderError(w, "Failed to create share link", http.StatusInternalServerError)
+		return
+	}
+
+	logging.FromRequest(r).Info("share created", "share", shortToken(token), "key", key,
+		"expires_at", share.ExpiresAt, "max_downloads", share.MaxDownloads, "has_password", share.HasPassword())
+	audit.Record(r, audit.ShareCreate, user, key, "share "+shortToken(token))
+	h.notify(r, models.WebhookFileShared, h.fileRecord(user.ID, key, info), &models.WebhookShare{
+		ExpiresAt:         share.ExpiresAt,
+		MaxDownloads:      share.MaxDownloads,
+		PasswordProtected: share.HasPassword(),
+	})
+
+	http.Redirect(w, r, "/shares?created="+token, http.StatusSeeOther)
+}
+
+// HandleShareRevoke revokes one of the current user's share links
+func (h *AppHandler) HandleShareRevoke(w http.ResponseWriter, r *http.Request) {
+	user := h.getUserFromSession(r)
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	token := r.FormValue("token")
+	share, err := h.store.GetShare(r.Context(), token)
+	if err != nil || share.OwnerID != user.ID {
+		h.renderError(w, "Share link not found", http.StatusNotFound)
+		return
+	}
+
+	if err := h.store.RevokeShare(r.Context(), token, time.Now()); err != nil {
+		logging.FromRequest(r).Error("failed to revoke share", "share", shortToken(token), "err", err)
+		h.renderError(w, "Failed to revoke share link", http.StatusInternalServerError)
+		return
+	}
+
+	logging.FromRequest(r).Info("share revoked", "share", shortToken(token), "key", share.S3Key)
+	audit.Record(r, audit.ShareRevoke, user, share.S3Key, "share "+shortToken(token))
+	flash.Set(w, flash.Success, "Share link revoked")
+	http.Redirect(w, r, "/shares", http.StatusSeeOther)
+}
+
+// HandleShareLanding shows the public download page of a share link
+func (h *AppHandler) HandleShareLanding(w http.ResponseWriter, r *http.Request) {
+	share, ok := h.loadPublicShare(w, r, false)
+	if !ok {
+		return
+	}
+
+	h.recordShareAccess(r, share.Token, share.S3Key, "viewed")
+	h.renderShareLanding(w, r, share, false, http.StatusOK)
+}
+
+// HandleShareDownload checks the share's password and download limit, then
+// serves the file. A download is only counted once the object is about to be
+// sent, and a Range request past byte 0 from a client that already started
+// this download resumes it without counting again.
+func (h *AppHandler) HandleShareDownload(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.URL.Path, "/s/")
+	resuming := rangeStart(r.Header.Get("Range")) > 0 && h.hasResumeGrant(r, token)
+	share, ok := h.loadPublicShare(w, r, resuming)
+	if !ok {
+		return
+	}
+
+	if !resuming && share.HasPassword() && !checkSharePassword(share.PasswordHash, r.FormValue("password")) {
+		h.recordShareAccess(r, share.Token, share.S3Key, "bad_password")
+		h.renderShareLanding(w, r, share, true, http.StatusForbidden)
+		return
+	}
+
+	// A presigned URL works until it expires however often it is used, so
+	// links with a download limit are always proxied to keep the count honest
+	if h.appConfig.Shares.DownloadMode == "presign" && share.MaxDownloads == 0 && !resuming {
+		url, err := h.s3Client.PresignGetURL(r.Context(), share.S3Key, h.appConfig.Shares.PresignTTL)
+		if err == nil {
+			if h.claimShareDownload(w, r, share) {
+				http.Redirect(w, r, url, http.StatusSeeOther)
+			}
+			return
+		}
+		logging.FromRequest(r).Warn("failed to presign share, falling back to proxy", "share", shortToken(share.Token), "err", err)
+	}
+
+	file, ok := h.openFile(w, r, share.S3Key)
+	if !ok {
+		return
+	}
+	defer file.body.Close()
+
+	if resuming && file.rng != nil && file.rng.Start > 0 {
+		h.recordShareAccess(r, share.Token, share.S3Key, "resumed")
+	} else {
+		if !h.claimShareDownload(w, r, share) {
+			return
+		}
+		h.setResumeGrant(w, share.Token)
+	}
+	h.sendFile(w, r, file, share.Filename)
+}
+
+// claimShareDownload counts a download of share, writing the error response
+// and returning false when the link has run out in the meantime
+func (h *AppHandler) claimShareDownload(w http.ResponseWriter, r *http.Request, share *models.Share) bool {
+	now := time.Now()
+	if _, err := h.store.ClaimShareDownload(r.Context(), share.Token, now); err != nil {
+		if errors.Is(err, metadata.ErrShareUnavailable) {
+			h.recordShareAccess(r, share.Token, share.S3Key, share.Status(now))
+			h.renderError(w, "This share link is no longer available", http.StatusGone)
+			return false
+		}
+		logging.FromRequest(r).Error("failed to claim share download", "share", shortToken(share.Token), "err", err)
+		h.renderError(w, "Failed to download file", http.StatusInternalServerError)
+		return false
+	}
+	h.recordShareAccess(r, share.Token, share.S3Key, "downloaded")
+	return true
+}
+
+// loadPublicShare resolves the share in the request path and rejects unusable
+// links. Exhausted links are accepted when allowExhausted is set, for resuming
+// a download that was already counted.
+func (h *AppHandler) loadPublicShare(w http.ResponseWriter, r *http.Request, allowExhausted bool) (*models.Share, bool) {
+	token := strings.TrimPrefix(r.URL.Path, "/s/")
+	if token == "" || strings.Contains(token, "/") {
+		h.renderError(w, "Share link not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	share, err := h.store.GetShare(r.Context(), token)
+	if err != nil {
+		if !errors.Is(err, metadata.ErrNotFound) {
+			logging.FromRequest(r).Error("failed to load share", "share", shortToken(token), "err", err)
+		}
+		h.recordShareAccess(r, token, "", "not_found")
+		h.renderError(w, "Share link not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	if status := share.Status(time.Now()); status != "active" && !(allowExhausted && status == "exhausted") {
+		h.recordShareAccess(r, token, share.S3Key, status)
+		h.renderError(w, "This share link is no longer available", http.StatusGone)
+		return nil, false
+	}
+
+	return share, true
+}
+
+// renderShareLanding renders the public share page
+func (h *AppHandler) renderShareLanding(w http.ResponseWriter, r *http.Request, share *models.Share, passwordRejected bool, statusCode int) {
+	var size int64
+	if info, err := h.s3Client.StatFile(r.Context(), share.S3Key); err == nil {
+		size = info.Size
+	}
+
+	downloadsLeft := -1
+	if share.MaxDownloads > 0 {
+		downloadsLeft = share.MaxDownloads - share.DownloadCount
+	}
+
+	pageData := &models.PageData{
+		Title: share.Filename + " - Google S3 Uploader",
+		Data: &models.ShareDownloadData{
+			Token:            share.Token,
+			Filename:         share.Filename,
+			Size:             size,
+			ExpiresAt:        share.ExpiresAt,
+			NeedsPassword:    share.HasPassword(),
+			DownloadsLeft:    downloadsLeft,
+			PasswordRejected: passwordRejected,
+		},
+		CSRFToken: csrf.Token(r),
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(statusCode)
+	if err := h.renderer.RenderTemplate(w, "share.html", pageData); err != nil {
+		logging.FromRequest(r).Error("failed to render share template", "err", err)
+	}
+}
+
+// recordShareAccess logs and stores one use of a share link to key, which is
+// empty when the link does not exist. Uses of links that do not exist are
+// only logged, so guessed tokens cannot grow the store.
+func (h *AppHandler) recordShareAccess(r *http.Request, token, key, outcome string) {
+	access := models.ShareAccess{
+		Token:     token,
+		Time:      time.Now(),
+		IP:        ratelimit.ClientIP(r, h.appConfig.Server.TrustedProxies),
+		UserAgent: r.UserAgent(),
+		Outcome:   outcome,
+	}
+
+	logging.FromRequest(r).Info("share accessed", "share", shortToken(token), "outcome", outcome, "ip", access.IP)
+	if key != "" {
+		if err := h.store.RecordShareAccess(r.Context(), access); err != nil {
+			logging.FromRequest(r).Error("failed to record share access", "err", err)
+		}
+	}
+	audit.Record(r, audit.ShareAccess, nil, key, "share "+shortToken(token)+" "+outcome)
+}
+
+// setResumeGrant lets the client that started a download of the share fetch
+// the rest of it with Range requests for shareResumeWindow
+func (h *AppHandler) setResumeGrant(w http.ResponseWriter, token string) {
+	expires := time.Now().Add(shareResumeWindow)
+	value := strconv.FormatInt(expires.Unix(), 10)
+	http.SetCookie(w, &http.Cookie{
+		Name:     shareResumeCookie,
+		Value:    value + "." + h.resumeMAC(token, value),
+		Path:     "/s/" + token,
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// hasResumeGrant reports whether the request carries an unexpired grant for token
+func (h *AppHandler) hasResumeGrant(r *http.Request, token string) bool {
+	cookie, err := r.Cookie(shareResumeCookie)
+	if err != nil {
+		return false
+	}
+	value, mac, ok := strings.Cut(cookie.Value, ".")
+	if !ok || !hmac.Equal([]byte(mac), []byte(h.resumeMAC(token, value))) {
+		return false
+	}
+	expires, err := strconv.ParseInt(value, 10, 64)
+	return err == nil && time.Now().Unix() < expires
+}
+
+func (h *AppHandler) resumeMAC(token, expires string) string {
+	mac := hmac.New(sha256.New, []byte(h.appConfig.Server.CookieKey))
+	mac.Write([]byte("share-resume|" + token + "|" + expires))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// rangeStart returns the first byte a "bytes=N-" Range header asks for, or 0
+func rangeStart(header string) int64 {
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok {
+		return 0
+	}
+	start, _, _ := strings.Cut(strings.TrimSpace(spec), "-")
+	n, err := strconv.ParseInt(start, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// shareURL returns the public URL of a share link
+func (h *AppHandler) shareURL(token string) string {
+	return strings.TrimSuffix(h.appConfig.Server.AppURL, "/") + "/s/" + token
+}
+
+// generateShareToken returns an unguessable URL-safe token
+func generateShareToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// shortToken abbreviates a token for log output
+func shortToken(token string) string {
+	if len(token) > 8 {
+		return token[:8] + "…"
+	}
+	return token
+}
+
+// hashSharePassword derives a salted PBKDF2 hash of a share password
+func hashSharePassword(password string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, sharePasswordIterations, 32)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("pbkdf2-sha256$%d$%s$%s", sharePasswordIterations,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// checkSharePassword compares a password against a hash from hashSharePassword
+func checkSharePassword(hash, password string) bool {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != "pbkdf2-sha256" {
+		return false
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	want, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+	got, err := pbkdf2.Key(sha256.New, password, salt, iterations, len(want))
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(got, want) == 1
+}
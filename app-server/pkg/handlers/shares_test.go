@@ -0,0 +1,397 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/metadata"
+	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/s3"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/config"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/models"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/session"
+)
+
+// testCookieKey signs the test session
+const testCookieKey = "0123456789abcdef0123456789abcdef"
+
+// testSessionCookie is the signed session of user "test-user-id"
+var testSessionCookie = newTestSession(&models.User{ID: "test-user-id", Name: "John Doe", Email: "test@example.com"})
+
+func newTestSession(user *models.User) string {
+	user.Created = time.Now()
+	value, err := session.Encode([]byte(testCookieKey), user)
+	if err != nil {
+		panic(err)
+	}
+	return value
+}
+
+const testFileKey = "uploads/test-user-id/1700000000_report.pdf"
+
+// newShareTestHandler returns a handler backed by a single stored file
+func newShareTestHandler(mode string) (*AppHandler, *metadata.MemoryStore) {
+	content := []byte("%PDF-1.4 shared content")
+	mockS3Client := &MockS3Client{
+		StatFileFunc: func(ctx context.Context, key string) (*s3.FileInfo, error) {
+			if key != testFileKey {
+				return nil, s3.ErrNotFound
+			}
+			return &s3.FileInfo{Key: key, Size: int64(len(content)), ContentType: "application/pdf"}, nil
+		},
+		GetFileFunc: func(ctx context.Context, key string, rng *s3.ByteRange) (io.ReadCloser, error) {
+			body := content
+			if rng != nil {
+				body = body[rng.Start : rng.Start+rng.Length(int64(len(content)))]
+			}
+			return io.NopCloser(bytes.NewReader(body)), nil
+		},
+	}
+	store := metadata.NewMemoryStore()
+	handler := &AppHandler{
+		appConfig: &config.Config{
+			Server: config.ServerConfig{
+				AppURL:    "https://uploader.example.com",
+				AuthURL:   "https://uploader.example.com",
+				CookieKey: testCookieKey,
+			},
+			Shares: config.SharesConfig{DownloadMode: mode, PresignTTL: time.Minute},
+		},
+		renderer: &MockTemplateRenderer{},
+		s3Client: mockS3Client,
+		store:    store,
+	}
+	return handler, store
+}
+
+// createTestShare posts the share form as the test user and returns the new token
+func createTestShare(t *testing.T, handler *AppHandler, form url.Values) string {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/shares", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(&http.Cookie{Name: "user_session", Value: testSessionCookie})
+	w := httptest.NewRecorder()
+
+	handler.HandleShareCreate(w, req)
+
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("HandleShareCreate() status = %d, want %d", w.Code, http.StatusSeeOther)
+	}
+	location, _ := url.Parse(w.Header().Get("Location"))
+	token := location.Query().Get("created")
+	if token == "" {
+		t.Fatalf("redirect %q carries no created token", w.Header().Get("Location"))
+	}
+	return token
+}
+
+// downloadShare posts to the public share endpoint
+func downloadShare(handler *AppHandler, token, password string) *httptest.ResponseRecorder {
+	form := url.Values{}
+	if password != "" {
+		form.Set("password", password)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/s/"+token, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	handler.HandleShareDownload(w, req)
+	return w
+}
+
+func TestAppHandler_HandleShareCreate(t *testing.T) {
+	handler, store := newShareTestHandler("proxy")
+
+	token := createTestShare(t, handler, url.Values{
+		"key":           {testFileKey},
+		"expires_in":    {"24h"},
+		"max_downloads": {"3"},
+		"password":      {"hunter2"},
+	})
+
+	share, err := store.GetShare(context.Background(), token)
+	if err != nil {
+		t.Fatalf("share was not stored: %v", err)
+	}
+	if share.OwnerID != "test-user-id" || share.Filename != "report.pdf" || share.MaxDownloads != 3 {
+		t.Errorf("unexpected share: %+v", share)
+	}
+	if share.ExpiresAt == nil || time.Until(*share.ExpiresAt) < 23*time.Hour {
+		t.Errorf("expected expiry about a day from now, got %v", share.ExpiresAt)
+	}
+	if !share.HasPassword() || strings.Contains(share.PasswordHash, "hunter2") {
+		t.Errorf("expected a hashed password, got %q", share.PasswordHash)
+	}
+}
+
+func TestAppHandler_HandleShareCreate_RejectsForeignKey(t *testing.T) {
+	handler, _ := newShareTestHandler("proxy")
+
+	form := url.Values{"key": {"uploads/someone-else/1700000000_secret.pdf"}}
+	req := httptest.NewRequest(http.MethodPost, "/shares", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(&http.Cookie{Name: "user_session", Value: testSessionCookie})
+	w := httptest.NewRecorder()
+
+	handler.HandleShareCreate(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", w.Code)
+	}
+}
+
+func TestAppHandler_HandleShareDownload(t *testing.T) {
+	t.Run("proxy download counts and logs", func(t *testing.T) {
+		handler, store := newShareTestHandler("proxy")
+		token := createTestShare(t, handler, url.Values{"key": {testFileKey}, "max_downloads": {"1"}})
+
+		w := downloadShare(handler, token, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("first download status = %d, want 200", w.Code)
+		}
+		if !strings.HasPrefix(w.Body.String(), "%PDF") {
+			t.Errorf("unexpected body %q", w.Body.String())
+		}
+		if got := w.Header().Get("Content-Disposition"); !strings.Contains(got, "report.pdf") {
+			t.Errorf("Content-Disposition = %q", got)
+		}
+
+		if w := downloadShare(handler, token, ""); w.Code != http.StatusGone {
+			t.Errorf("download past the limit status = %d, want 410", w.Code)
+		}
+
+		accesses, _ := store.ListShareAccesses(context.Background(), token)
+		var outcomes []string
+		for _, access := range accesses {
+			outcomes = append(outcomes, access.Outcome)
+		}
+		if strings.Join(outcomes, ",") != "downloaded,exhausted" {
+			t.Errorf("access log outcomes = %v", outcomes)
+		}
+	})
+
+	t.Run("password is checked", func(t *testing.T) {
+		handler, _ := newShareTestHandler("proxy")
+		token := createTestShare(t, handler, url.Values{"key": {testFileKey}, "password": {"s3cret"}})
+
+		if w := downloadShare(handler, token, "wrong"); w.Code != http.StatusForbidden {
+			t.Errorf("wrong password status = %d, want 403", w.Code)
+		}
+		if w := downloadShare(handler, token, "s3cret"); w.Code != http.StatusOK {
+			t.Errorf("correct password status = %d, want 200", w.Code)
+		}
+	})
+
+	t.Run("presign mode redirects", func(t *testing.T) {
+		handler, _ := newShareTestHandler("presign")
+		token := createTestShare(t, handler, url.Values{"key": {testFileKey}})
+
+		w := downloadShare(handler, token, "")
+		if w.Code != http.StatusSeeOther {
+			t.Fatalf("presign download status = %d, want 303", w.Code)
+		}
+		if !strings.Contains(w.Header().Get("Location"), "X-Amz-Signature") {
+			t.Errorf("expected presigned redirect, got %q", w.Header().Get("Location"))
+		}
+	})
+
+	t.Run("presign mode proxies limited links", func(t *testing.T) {
+		handler, _ := newShareTestHandler("presign")
+		token := createTestShare(t, handler, url.Values{"key": {testFileKey}, "max_downloads": {"1"}})
+
+		w := downloadShare(handler, token, "")
+		if w.Code != http.StatusOK || !strings.HasPrefix(w.Body.String(), "%PDF") {
+			t.Errorf("limited presign download = %d %q, want the file served directly", w.Code, w.Header().Get("Location"))
+		}
+	})
+
+	t.Run("revoked and expired links are gone", func(t *testing.T) {
+		handler, store := newShareTestHandler("proxy")
+		revoked := createTestShare(t, handler, url.Values{"key": {testFileKey}})
+		if err := store.RevokeShare(context.Background(), revoked, time.Now()); err != nil {
+			t.Fatalf("RevokeShare() error = %v", err)
+		}
+
+		past := time.Now().Add(-time.Minute)
+		expired := &models.Share{Token: "expired-token", S3Key: testFileKey, OwnerID: "test-user-id", ExpiresAt: &past}
+		if err := store.CreateShare(context.Background(), expired); err != nil {
+			t.Fatalf("CreateShare() error = %v", err)
+		}
+
+		for _, token := range []string{revoked, expired.Token} {
+			if w := downloadShare(handler, token, ""); w.Code != http.StatusGone {
+				t.Errorf("download of %s status = %d, want 410", token, w.Code)
+			}
+		}
+		if w := downloadShare(handler, "no-such-token", ""); w.Code != http.StatusNotFound {
+			t.Errorf("unknown token status = %d, want 404", w.Code)
+		}
+	})
+}
+
+func TestAppHandler_HandleShareRevoke_RequiresOwner(t *testing.T) {
+	handler, store := newShareTestHandler("proxy")
+	share := &models.Share{Token: "other-token", S3Key: "uploads/other/1_x.pdf", OwnerID: "other"}
+	if err := store.CreateShare(context.Background(), share); err != nil {
+		t.Fatalf("CreateShare() error = %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/shares/revoke", strings.NewReader("token=other-token"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(&http.Cookie{Name: "user_session", Value: testSessionCookie})
+	w := httptest.NewRecorder()
+	handler.HandleShareRevoke(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", w.Code)
+	}
+	stored, _ := store.GetShare(context.Background(), "other-token")
+	if stored.RevokedAt != nil {
+		t.Error("share of another user was revoked")
+	}
+}
+
+func TestAppHandler_HandleDownload_Range(t *testing.T) {
+	handler, _ := newShareTestHandler("proxy")
+
+	req := httptest.NewRequest(http.MethodGet, "/download?key="+url.QueryEscape(testFileKey), nil)
+	req.AddCookie(&http.Cookie{Name: "user_session", Value: testSessionCookie})
+	req.Header.Set("Range", "bytes=0-3")
+	w := httptest.NewRecorder()
+	handler.HandleDownload(w, req)
+
+	if w.Code != http.StatusPartialContent {
+		t.Fatalf("Expected status 206, got %d", w.Code)
+	}
+	if w.Body.String() != "%PDF" {
+		t.Errorf("range body = %q, want %q", w.Body.String(), "%PDF")
+	}
+	if got := w.Header().Get("Content-Range"); got != "bytes 0-3/23" {
+		t.Errorf("Content-Range = %q", got)
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		header string
+		size   int64
+		want   *s3.ByteRange
+		ok     bool
+	}{
+		{"", 100, nil, true},
+		{"bytes=0-9", 100, &s3.ByteRange{Start: 0, End: 9}, true},
+		{"bytes=90-", 100, &s3.ByteRange{Start: 90, End: -1}, true},
+		{"bytes=-10", 100, &s3.ByteRange{Start: 90, End: 99}, true},
+		{"bytes=50-500", 100, &s3.ByteRange{Start: 50, End: 99}, true},
+		{"bytes=100-", 100, nil, false},
+		{"bytes=0-1,5-6", 100, nil, true},
+		{"items=0-1", 100, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			got, ok := parseRange(tt.header, tt.size)
+			if ok != tt.ok {
+				t.Fatalf("parseRange(%q) ok = %v, want %v", tt.header, ok, tt.ok)
+			}
+			if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+				t.Errorf("parseRange(%q) = %+v, want %+v", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAppHandler_ShareAccessLog(t *testing.T) {
+	handler, store := newShareTestHandler("proxy")
+	_, proxies, _ := net.ParseCIDR("10.0.0.0/8")
+	handler.appConfig.Server.TrustedProxies = []*net.IPNet{proxies}
+	token := createTestShare(t, handler, url.Values{"key": {testFileKey}})
+
+	for _, path := range []string{"/s/" + token, "/s/guessed-token"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = "10.0.0.5:1000"
+		req.Header.Set("X-Forwarded-For", "198.51.100.7")
+		handler.HandleShareLanding(httptest.NewRecorder(), req)
+	}
+
+	accesses, _ := store.ListShareAccesses(context.Background(), token)
+	if len(accesses) != 1 || accesses[0].IP != "198.51.100.7" {
+		t.Errorf("access log = %+v, want one view from the client behind the proxy", accesses)
+	}
+	if accesses, _ := store.ListShareAccesses(context.Background(), "guessed-token"); len(accesses) != 0 {
+		t.Errorf("stored %d accesses for a token with no share", len(accesses))
+	}
+}
+
+func TestAppHandler_HandleShareDownload_CountsOnlySentDownloads(t *testing.T) {
+	download := func(handler *AppHandler, token, rangeHeader string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/s/"+token, nil)
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		handler.HandleShareDownload(w, req)
+		return w
+	}
+	downloads := func(store *metadata.MemoryStore, token string) int {
+		share, _ := store.GetShare(context.Background(), token)
+		return share.DownloadCount
+	}
+
+	t.Run("failures are not counted", func(t *testing.T) {
+		handler, store := newShareTestHandler("proxy")
+		token := createTestShare(t, handler, url.Values{"key": {testFileKey}, "max_downloads": {"1"}})
+
+		if w := download(handler, token, "bytes=100-"); w.Code != http.StatusRequestedRangeNotSatisfiable {
+			t.Errorf("unsatisfiable range = %d, want 416", w.Code)
+		}
+		handler.s3Client.(*MockS3Client).StatFileFunc = func(ctx context.Context, key string) (*s3.FileInfo, error) {
+			return nil, s3.ErrUnavailable
+		}
+		if w := download(handler, token, ""); w.Code != http.StatusServiceUnavailable {
+			t.Errorf("download during an outage = %d, want 503", w.Code)
+		}
+		if n := downloads(store, token); n != 0 {
+			t.Errorf("failed downloads counted %d times, want 0", n)
+		}
+	})
+
+	t.Run("resumes are not counted", func(t *testing.T) {
+		handler, store := newShareTestHandler("proxy")
+		token := createTestShare(t, handler, url.Values{"key": {testFileKey}, "max_downloads": {"1"}})
+
+		w := download(handler, token, "bytes=0-9")
+		if w.Code != http.StatusPartialContent {
+			t.Fatalf("first chunk = %d, want 206", w.Code)
+		}
+		var grant *http.Cookie
+		for _, c := range w.Result().Cookies() {
+			if c.Name == shareResumeCookie {
+				grant = c
+			}
+		}
+		if grant == nil {
+			t.Fatal("counted download set no resume grant")
+		}
+
+		w = download(handler, token, "bytes=10-", grant)
+		if w.Code != http.StatusPartialContent || w.Body.String() != "hared content" {
+			t.Errorf("resumed chunk = %d %q, want the rest of the file", w.Code, w.Body)
+		}
+		if n := downloads(store, token); n != 1 {
+			t.Errorf("chunked download counted %d times, want 1", n)
+		}
+		if w := download(handler, token, "bytes=10-"); w.Code != http.StatusGone {
+			t.Errorf("range request without the grant on a used-up link = %d, want 410", w.Code)
+		}
+	})
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/s3"
+	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/webhooks"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/config"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/logging"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/models"
+)
+
+// webhookPageSize is how many deliveries the delivery log page shows
+const webhookPageSize = 200
+
+// HandleWebhookDeliveries lets admins see recent webhook deliveries and dead letters
+func (h *AppHandler) HandleWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	user := h.getUserFromSession(r)
+	if user == nil {
+		http.Redirect(w, r, h.appConfig.Server.AuthURL+"/login", http.StatusTemporaryRedirect)
+		return
+	}
+	if !h.appConfig.Auth.IsAdmin(user) {
+		logging.FromRequest(r).Warn("webhook deliveries denied to non-admin")
+		h.renderError(w, "Only administrators can view webhook deliveries", http.StatusForbidden)
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", webhooks.StatusPending, webhooks.StatusDelivered, webhooks.StatusDead:
+	default:
+		h.renderError(w, "Unknown delivery status", http.StatusBadRequest)
+		return
+	}
+
+	deliveries, err := h.store.ListWebhookDeliveries(r.Context(), status, webhookPageSize)
+	if err != nil {
+		logging.FromRequest(r).Error("failed to list webhook deliveries", "err", err)
+		h.renderError(w, "Failed to load webhook deliveries", http.StatusInternalServerError)
+		return
+	}
+
+	pageData := &models.PageData{
+		Title: "Webhook Deliveries - Google S3 Uploader",
+		User:  user,
+		Data: &models.WebhooksData{
+			Deliveries: deliveries,
+			Status:     status,
+			Endpoints:  len(config.SplitList(h.appConfig.Webhooks.URLs)),
+		},
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := h.renderer.RenderTemplate(w, "webhooks.html", pageData); err != nil {
+		logging.FromRequest(r).Error("failed to render webhooks template", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// notify sends a webhook event if webhooks are configured
+func (h *AppHandler) notify(r *http.Request, eventType string, file models.FileUpload, share *models.WebhookShare) {
+	if h.webhooks != nil {
+		h.webhooks.Notify(r.Context(), eventType, file, share)
+	}
+}
+
+// fileRecord describes one of the user's stored files for a webhook event;
+// info is nil when the file could not be looked up
+func (h *AppHandler) fileRecord(userID, key string, info *s3.FileInfo) models.FileUpload {
+	filename, uploadedAt := describeKey(key)
+	file := models.FileUpload{
+		ID:         fmt.Sprintf("file_%d", uploadedAt.Unix()),
+		Filename:   filename,
+		S3Key:      key,
+		S3URL:      h.s3Client.GetFileURL(key),
+		UploadedAt: uploadedAt,
+		UserID:     userID,
+	}
+	if info != nil {
+		file.Size, file.ContentType = info.Size, info.ContentType
+	}
+	return file
+}
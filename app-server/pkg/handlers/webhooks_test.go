@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/s3"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/models"
+)
+
+// recordingNotifier keeps the events handlers send
+type recordingNotifier struct {
+	events []models.WebhookEvent
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, eventType string, file models.FileUpload, share *models.WebhookShare) {
+	n.events = append(n.events, models.WebhookEvent{Type: eventType, File: file, Share: share})
+}
+
+func TestAppHandler_Webhooks(t *testing.T) {
+	handler, _ := newShareTestHandler("proxy")
+	notifier := &recordingNotifier{}
+	handler.webhooks = notifier
+
+	createTestShare(t, handler, url.Values{"key": {testFileKey}, "max_downloads": {"3"}, "password": {"hunter2"}})
+
+	form := url.Values{"key": {testFileKey}}
+	req := httptest.NewRequest(http.MethodPost, "/files/delete", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(&http.Cookie{Name: "user_session", Value: testSessionCookie})
+	w := httptest.NewRecorder()
+	handler.HandleFileDelete(w, req)
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("HandleFileDelete() status = %d, want %d", w.Code, http.StatusSeeOther)
+	}
+
+	if len(notifier.events) != 2 {
+		t.Fatalf("sent %d events, want share then delete", len(notifier.events))
+	}
+	shared, deleted := notifier.events[0], notifier.events[1]
+	if shared.Type != models.WebhookFileShared || shared.Share == nil || shared.Share.MaxDownloads != 3 || !shared.Share.PasswordProtected {
+		t.Errorf("share event = %+v", shared)
+	}
+	want := models.FileUpload{Filename: "report.pdf", ContentType: "application/pdf", S3Key: testFileKey, UserID: "test-user-id"}
+	for _, event := range notifier.events {
+		file := event.File
+		if file.Filename != want.Filename || file.ContentType != want.ContentType || file.S3Key != want.S3Key || file.UserID != want.UserID || file.Size == 0 {
+			t.Errorf("%s event file = %+v, want the stored file", event.Type, file)
+		}
+	}
+	if deleted.Type != models.WebhookFileDeleted || deleted.Share != nil {
+		t.Errorf("delete event = %+v", deleted)
+	}
+}
+
+func TestAppHandler_HandleFileDelete_StatError(t *testing.T) {
+	handler, _ := newShareTestHandler("proxy")
+	notifier := &recordingNotifier{}
+	handler.webhooks = notifier
+	deleted := false
+	handler.s3Client = &MockS3Client{
+		StatFileFunc: func(ctx context.Context, key string) (*s3.FileInfo, error) {
+			return nil, errors.New("connection reset")
+		},
+		DeleteFileFunc: func(ctx context.Context, key string) error {
+			deleted = true
+			return nil
+		},
+	}
+
+	form := url.Values{"key": {testFileKey}}
+	req := httptest.NewRequest(http.MethodPost, "/files/delete", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(&http.Cookie{Name: "user_session", Value: testSessionCookie})
+	w := httptest.NewRecorder()
+	handler.HandleFileDelete(w, req)
+
+	if w.Code != http.StatusInternalServerError || deleted || len(notifier.events) != 0 {
+		t.Errorf("HandleFileDelete() after a failed lookup = %d, deleted %v, events %+v; want 500 and nothing deleted or sent",
+			w.Code, deleted, notifier.events)
+	}
+}
+
+func TestAppHandler_HandleWebhookDeliveries_RequiresAdmin(t *testing.T) {
+	handler, _ := newShareTestHandler("proxy")
+	handler.appConfig.Auth.AdminIDs = "admin-id"
+	forged := base64.StdEncoding.EncodeToString([]byte(`{"id":"admin-id","email":"admin@example.com","email_verified":true}`))
+
+	for _, tt := range []struct {
+		name    string
+		session string
+		want    int
+	}{
+		{"non-admin", testSessionCookie, http.StatusForbidden},
+		{"forged admin session", forged, http.StatusTemporaryRedirect},
+		{"admin with an unverified email", newTestSession(&models.User{ID: "admin-id", Email: "admin@example.com"}), http.StatusForbidden},
+		{"non-admin with the admin's email", newTestSession(&models.User{ID: "other-id", Email: "admin@example.com", EmailVerified: true}), http.StatusForbidden},
+		{"admin", newTestSession(&models.User{ID: "admin-id", Email: "admin@example.com", EmailVerified: true}), http.StatusOK},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/admin/webhooks", nil)
+		req.AddCookie(&http.Cookie{Name: "user_session", Value: tt.session})
+		w := httptest.NewRecorder()
+
+		handler.HandleWebhookDeliveries(w, req)
+
+		if w.Code != tt.want {
+			t.Errorf("HandleWebhookDeliveries() as %s = %d, want %d", tt.name, w.Code, tt.want)
+		}
+	}
+}
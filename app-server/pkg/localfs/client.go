@@ -0,0 +1,269 @@
+// Package localfs stores uploads on the local filesystem instead of S3, so the
+// app can run without AWS credentials during development and offline testing.
+package localfs
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/s3"
+)
+
+// RoutePrefix is the path under which the app serves stored files
+const RoutePrefix = "/local-storage/"
+
+// Client implements s3.S3ClientIface on top of a directory.
+// Object data lives under objects/ and a JSON sidecar per object under meta/.
+type Client struct {
+	objectsDir string
+	metaDir    string
+	baseURL    string
+	signingKey []byte
+}
+
+// objectMeta is the sidecar stored next to each object
+type objectMeta struct {
+	ContentType  string            `json:"content_type"`
+	ETag         string            `json:"etag"`
+	LastModified time.Time         `json:"last_modified"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
+}
+
+// NewClient creates a filesystem storage client rooted at dir. Files are served
+// by the app at baseURL + RoutePrefix; presigned URLs are signed with signingKey,
+// or with a random per-process key if it is empty.
+func NewClient(dir, baseURL string, signingKey []byte) (*Client, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("local storage directory is required")
+	}
+	c := &Client{
+		objectsDir: filepath.Join(dir, "objects"),
+		metaDir:    filepath.Join(dir, "meta"),
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		signingKey: signingKey,
+	}
+	for _, d := range []string{c.objectsDir, c.metaDir} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create local storage directory: %w", err)
+		}
+	}
+	if len(c.signingKey) == 0 {
+		c.signingKey = make([]byte, 32)
+		if _, err := rand.Read(c.signingKey); err != nil {
+			return nil, fmt.Errorf("failed to generate signing key: %w", err)
+		}
+	}
+	return c, nil
+}
+
+// paths returns the data and sidecar paths of a key, rejecting keys that would escape the root
+func (c *Client) paths(key string) (string, string, error) {
+	rel := filepath.FromSlash(key)
+	if key == "" || strings.HasSuffix(key, "/") || !filepath.IsLocal(rel) {
+		return "", "", fmt.Errorf("invalid object key %q", key)
+	}
+	return filepath.Join(c.objectsDir, rel), filepath.Join(c.metaDir, rel+".json"), nil
+}
+
+// UploadFile stores a file
+func (c *Client) UploadFile(ctx context.Context, key string, file io.Reader, contentType string) error {
+	return c.UploadFileWithMetadata(ctx, key, file, contentType, nil)
+}
+
+// UploadFileWithMetadata stores a file and its metadata. The data is written to a
+// temporary file and renamed into place so readers never see a partial object.
+func (c *Client) UploadFileWithMetadata(ctx context.Context, key string, file io.Reader, contentType string, metadata map[string]string) error {
+	dataPath, metaPath, err := c.paths(key)
+	if err != nil {
+		return err
+	}
+	for _, p := range []string{dataPath, metaPath} {
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			return fmt.Errorf("failed to create directory: %w", err)
+		}
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dataPath), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := md5.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, hash), file); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+
+	meta, err := json.Marshal(objectMeta{
+		ContentType:  contentType,
+		ETag:         `"` + hex.EncodeToString(hash.Sum(nil)) + `"`,
+		LastModified: time.Now().UTC(),
+		Metadata:     metadata,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode metadata: %w", err)
+	}
+	if err := os.WriteFile(metaPath, meta, 0o644); err != nil {
+		return fmt.Errorf("failed to write metadata: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), dataPath); err != nil {
+		return fmt.Errorf("failed to store file: %w", err)
+	}
+	return nil
+}
+
+// GetFileURL returns the app URL of a file. Like a private S3 object URL it
+// is only usable once signed, see PresignGetURL.
+func (c *Client) GetFileURL(key string) string {
+	return c.baseURL + RoutePrefix + escapeKey(key)
+}
+
+// DeleteFile deletes a file. Deleting a missing file is not an error, matching S3.
+func (c *Client) DeleteFile(ctx context.Context, key string) error {
+	dataPath, metaPath, err := c.paths(key)
+	if err != nil {
+		return err
+	}
+	for _, p := range []string{dataPath, metaPath} {
+		if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to delete file: %w", err)
+		}
+	}
+	return nil
+}
+
+// ListFiles lists files with a given prefix in key order
+func (c *Client) ListFiles(ctx context.Context, prefix string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(c.objectsDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".upload-") {
+			return nil
+		}
+		rel, err := filepath.Rel(c.objectsDir, p)
+		if err != nil {
+			return err
+		}
+		if key := filepath.ToSlash(rel); strings.HasPrefix(key, prefix) {
+			files = append(files, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list local files: %w", err)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Ping checks that the storage directory is still writable
+func (c *Client) Ping(ctx context.Context) error {
+	tmp, err := os.CreateTemp(c.objectsDir, ".upload-ping-*")
+	if err != nil {
+		return fmt.Errorf("local storage is not writable: %w", err)
+	}
+	tmp.Close()
+	return os.Remove(tmp.Name())
+}
+
+// StatFile returns the metadata of a file
+func (c *Client) StatFile(ctx context.Context, key string) (*s3.FileInfo, error) {
+	dataPath, metaPath, err := c.paths(key)
+	if err != nil {
+		return nil, s3.ErrNotFound
+	}
+	stat, err := os.Stat(dataPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, s3.ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+
+	var meta objectMeta
+	if raw, err := os.ReadFile(metaPath); err == nil {
+		if err := json.Unmarshal(raw, &meta); err != nil {
+			return nil, fmt.Errorf("failed to read metadata: %w", err)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read metadata: %w", err)
+	}
+	if meta.LastModified.IsZero() {
+		meta.LastModified = stat.ModTime()
+	}
+
+	return &s3.FileInfo{
+		Key:          key,
+		Size:         stat.Size(),
+		ContentType:  meta.ContentType,
+		ETag:         meta.ETag,
+		LastModified: meta.LastModified,
+		Metadata:     meta.Metadata,
+	}, nil
+}
+
+// GetFile opens a file for reading, optionally limited to a byte range
+func (c *Client) GetFile(ctx context.Context, key string, rng *s3.ByteRange) (io.ReadCloser, error) {
+	dataPath, _, err := c.paths(key)
+	if err != nil {
+		return nil, s3.ErrNotFound
+	}
+	f, err := os.Open(dataPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, s3.ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	if rng == nil {
+		return f, nil
+	}
+
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+	if rng.Start >= stat.Size() {
+		f.Close()
+		return nil, fmt.Errorf("range start %d is beyond the end of %s", rng.Start, key)
+	}
+	return &sectionReadCloser{
+		Reader: io.NewSectionReader(f, rng.Start, rng.Length(stat.Size())),
+		Closer: f,
+	}, nil
+}
+
+// PresignGetURL returns a time-limited app URL that serves the file
+func (c *Client) PresignGetURL(ctx context.Context, key string, expires time.Duration) (string, error) {
+	if _, err := c.StatFile(ctx, key); err != nil {
+		return "", err
+	}
+	expiresAt := time.Now().Add(expires).Unix()
+	return fmt.Sprintf("%s?%s=%d&%s=%s", c.GetFileURL(key),
+		paramExpires, expiresAt, paramSignature, c.sign(key, expiresAt)), nil
+}
+
+// sectionReadCloser closes the underlying file of a ranged read
+type sectionReadCloser struct {
+	io.Reader
+	io.Closer
+}
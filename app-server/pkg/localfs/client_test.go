@@ -0,0 +1,192 @@
+package localfs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/s3"
+)
+
+// Compile-time check that Client is a drop-in storage backend
+var _ s3.S3ClientIface = (*Client)(nil)
+
+func newTestClient(t *testing.T) *Client {
+	t.Helper()
+	client, err := NewClient(t.TempDir(), "http://localhost:8080", []byte("test-signing-key"))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	return client
+}
+
+func readFile(t *testing.T, client *Client, key string, rng *s3.ByteRange) string {
+	t.Helper()
+	body, err := client.GetFile(context.Background(), key, rng)
+	if err != nil {
+		t.Fatalf("GetFile(%q) error = %v", key, err)
+	}
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	return string(data)
+}
+
+func TestClient_UploadStatGet(t *testing.T) {
+	client := newTestClient(t)
+	ctx := context.Background()
+	key := "uploads/u1/1700000000_hello world.txt"
+
+	err := client.UploadFileWithMetadata(ctx, key, strings.NewReader("hello, local storage"), "text/plain", map[string]string{"owner": "u1"})
+	if err != nil {
+		t.Fatalf("UploadFileWithMetadata() error = %v", err)
+	}
+
+	info, err := client.StatFile(ctx, key)
+	if err != nil {
+		t.Fatalf("StatFile() error = %v", err)
+	}
+	if info.Size != 20 || info.ContentType != "text/plain" || info.Metadata["owner"] != "u1" || info.ETag == "" {
+		t.Errorf("StatFile() = %+v", info)
+	}
+
+	if got := readFile(t, client, key, nil); got != "hello, local storage" {
+		t.Errorf("GetFile() = %q", got)
+	}
+	if got := readFile(t, client, key, &s3.ByteRange{Start: 7, End: 11}); got != "local" {
+		t.Errorf("GetFile(range) = %q, want %q", got, "local")
+	}
+	if got := readFile(t, client, key, &s3.ByteRange{Start: 15, End: -1}); got != "orage" {
+		t.Errorf("GetFile(open range) = %q, want %q", got, "orage")
+	}
+
+	if _, err := client.StatFile(ctx, "uploads/u1/missing"); !errors.Is(err, s3.ErrNotFound) {
+		t.Errorf("StatFile(missing) error = %v, want ErrNotFound", err)
+	}
+	if _, err := client.GetFile(ctx, "uploads/u1/missing", nil); !errors.Is(err, s3.ErrNotFound) {
+		t.Errorf("GetFile(missing) error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestClient_ListAndDelete(t *testing.T) {
+	client := newTestClient(t)
+	ctx := context.Background()
+	for _, key := range []string{"uploads/u1/b.txt", "uploads/u1/a.txt", "uploads/u2/c.txt"} {
+		if err := client.UploadFile(ctx, key, strings.NewReader(key), "text/plain"); err != nil {
+			t.Fatalf("UploadFile(%q) error = %v", key, err)
+		}
+	}
+
+	files, err := client.ListFiles(ctx, "uploads/u1/")
+	if err != nil {
+		t.Fatalf("ListFiles() error = %v", err)
+	}
+	if want := []string{"uploads/u1/a.txt", "uploads/u1/b.txt"}; !reflect.DeepEqual(files, want) {
+		t.Errorf("ListFiles() = %v, want %v", files, want)
+	}
+
+	if err := client.DeleteFile(ctx, "uploads/u1/a.txt"); err != nil {
+		t.Fatalf("DeleteFile() error = %v", err)
+	}
+	if err := client.DeleteFile(ctx, "uploads/u1/a.txt"); err != nil {
+		t.Errorf("DeleteFile(missing) error = %v, want nil like S3", err)
+	}
+	files, _ = client.ListFiles(ctx, "uploads/")
+	if want := []string{"uploads/u1/b.txt", "uploads/u2/c.txt"}; !reflect.DeepEqual(files, want) {
+		t.Errorf("ListFiles() after delete = %v, want %v", files, want)
+	}
+}
+
+func TestClient_Ping(t *testing.T) {
+	client := newTestClient(t)
+	ctx := context.Background()
+	if err := client.Ping(ctx); err != nil {
+		t.Fatalf("Ping() error = %v", err)
+	}
+	if files, _ := client.ListFiles(ctx, ""); len(files) != 0 {
+		t.Errorf("Ping() left files behind: %v", files)
+	}
+
+	os.RemoveAll(client.objectsDir)
+	if err := client.Ping(ctx); err == nil {
+		t.Error("Ping() succeeded after the storage directory was removed")
+	}
+}
+
+func TestClient_RejectsEscapingKeys(t *testing.T) {
+	client := newTestClient(t)
+	for _, key := range []string{"../outside.txt", "uploads/../../outside.txt", "/etc/passwd", "", "uploads/"} {
+		if err := client.UploadFile(context.Background(), key, strings.NewReader("x"), "text/plain"); err == nil {
+			t.Errorf("UploadFile(%q) succeeded, want an invalid key error", key)
+		}
+	}
+}
+
+func TestClient_PresignedURLs(t *testing.T) {
+	client := newTestClient(t)
+	ctx := context.Background()
+	key := "uploads/u1/1700000000_report #1.pdf"
+	if err := client.UploadFile(ctx, key, strings.NewReader("%PDF-1.7 report"), "application/pdf"); err != nil {
+		t.Fatalf("UploadFile() error = %v", err)
+	}
+
+	presigned, err := client.PresignGetURL(ctx, key, time.Minute)
+	if err != nil {
+		t.Fatalf("PresignGetURL() error = %v", err)
+	}
+	if !strings.HasPrefix(presigned, "http://localhost:8080"+RoutePrefix) {
+		t.Fatalf("PresignGetURL() = %q, want an app URL", presigned)
+	}
+	if _, err := client.PresignGetURL(ctx, "uploads/u1/missing", time.Minute); !errors.Is(err, s3.ErrNotFound) {
+		t.Errorf("PresignGetURL(missing) error = %v, want ErrNotFound", err)
+	}
+
+	serve := func(rawURL string, header http.Header) *httptest.ResponseRecorder {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			t.Fatalf("url.Parse() error = %v", err)
+		}
+		req := httptest.NewRequest(http.MethodGet, u.RequestURI(), nil)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		rr := httptest.NewRecorder()
+		client.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := serve(presigned, nil)
+	if rr.Code != http.StatusOK || rr.Body.String() != "%PDF-1.7 report" {
+		t.Errorf("presigned GET = %d %q", rr.Code, rr.Body.String())
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/pdf" {
+		t.Errorf("Content-Type = %q, want application/pdf", ct)
+	}
+
+	rr = serve(presigned, http.Header{"Range": {"bytes=0-3"}})
+	if rr.Code != http.StatusPartialContent || rr.Body.String() != "%PDF" {
+		t.Errorf("ranged presigned GET = %d %q", rr.Code, rr.Body.String())
+	}
+
+	if rr := serve(client.GetFileURL(key), nil); rr.Code != http.StatusForbidden {
+		t.Errorf("unsigned GET = %d, want 403", rr.Code)
+	}
+	if rr := serve(strings.Replace(presigned, "report", "other", 1), nil); rr.Code != http.StatusForbidden {
+		t.Errorf("GET with signature for another key = %d, want 403", rr.Code)
+	}
+
+	expired, _ := client.PresignGetURL(ctx, key, -time.Minute)
+	if rr := serve(expired, nil); rr.Code != http.StatusForbidden {
+		t.Errorf("expired GET = %d, want 403", rr.Code)
+	}
+}
@@ -0,0 +1,236 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/models"
+)
+
+// ErrNotFound is returned when a record does not exist
+var ErrNotFound = errors.New("record not found")
+
+// ErrShareUnavailable is returned when a share can no longer be downloaded
+var ErrShareUnavailable = errors.New("share is no longer available")
+
+// Store defines the interface for application records that do not live in S3
+type Store interface {
+	CreateShare(ctx context.Context, share *models.Share) error
+	GetShare(ctx context.Context, token string) (*models.Share, error)
+	ListShares(ctx context.Context, ownerID string) ([]models.Share, error)
+	RevokeShare(ctx context.Context, token string, at time.Time) error
+	// ClaimShareDownload atomically counts a download if the share is still active
+	ClaimShareDownload(ctx context.Context, token string, at time.Time) (*models.Share, error)
+	RecordShareAccess(ctx context.Context, access models.ShareAccess) error
+	ListShareAccesses(ctx context.Context, token string) ([]models.ShareAccess, error)
+	RecordAuditEvent(ctx context.Context, event models.AuditEvent) error
+	// SearchAuditEvents returns the matching audit events, newest first
+	SearchAuditEvents(ctx context.Context, q models.AuditQuery) ([]models.AuditEvent, error)
+	// SaveWebhookDelivery creates the delivery or replaces the one with its ID
+	SaveWebhookDelivery(ctx context.Context, delivery models.WebhookDelivery) error
+	// ListWebhookDeliveries returns deliveries with the given status, or all
+	// when it is empty, newest first
+	ListWebhookDeliveries(ctx context.Context, status string, limit int) ([]models.WebhookDelivery, error)
+	// Ping reports whether the store can serve requests
+	Ping(ctx context.Context) error
+}
+
+// maxShareAccesses bounds the access log MemoryStore keeps per share; the oldest go first
+const maxShareAccesses = 1_000
+
+// maxAuditEvents bounds the audit events MemoryStore keeps; the oldest go first
+const maxAuditEvents = 100_000
+
+// maxWebhookDeliveries bounds the deliveries MemoryStore keeps; the oldest go first
+const maxWebhookDeliveries = 10_000
+
+// MemoryStore implements Store in process memory
+type MemoryStore struct {
+	mu       sync.Mutex
+	shares   map[string]*models.Share
+	accesses map[string][]models.ShareAccess
+	audit    []models.AuditEvent
+
+	deliveries    map[string]*models.WebhookDelivery
+	deliveryOrder []string // IDs, oldest first
+}
+
+// NewMemoryStore creates a new in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		shares:   make(map[string]*models.Share),
+		accesses: make(map[string][]models.ShareAccess),
+
+		deliveries: make(map[string]*models.WebhookDelivery),
+	}
+}
+
+// CreateShare stores a new share
+func (m *MemoryStore) CreateShare(ctx context.Context, share *models.Share) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.shares[share.Token]; exists {
+		return errors.New("share token already exists")
+	}
+	stored := *share
+	m.shares[share.Token] = &stored
+	return nil
+}
+
+// GetShare returns a copy of the share with the given token
+func (m *MemoryStore) GetShare(ctx context.Context, token string) (*models.Share, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	share, ok := m.shares[token]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	result := *share
+	return &result, nil
+}
+
+// ListShares returns the owner's shares, newest first
+func (m *MemoryStore) ListShares(ctx context.Context, ownerID string) ([]models.Share, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var shares []models.Share
+	for _, share := range m.shares {
+		if share.OwnerID == ownerID {
+			shares = append(shares, *share)
+		}
+	}
+	sort.Slice(shares, func(i, j int) bool {
+		return shares[i].CreatedAt.After(shares[j].CreatedAt)
+	})
+	return shares, nil
+}
+
+// RevokeShare marks a share as revoked
+func (m *MemoryStore) RevokeShare(ctx context.Context, token string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	share, ok := m.shares[token]
+	if !ok {
+		return ErrNotFound
+	}
+	if share.RevokedAt == nil {
+		share.RevokedAt = &at
+	}
+	return nil
+}
+
+// ClaimShareDownload increments the download count of an active share
+func (m *MemoryStore) ClaimShareDownload(ctx context.Context, token string, at time.Time) (*models.Share, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	share, ok := m.shares[token]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if share.Status(at) != "active" {
+		return nil, ErrShareUnavailable
+	}
+	share.DownloadCount++
+	result := *share
+	return &result, nil
+}
+
+// RecordShareAccess appends to the share's access log. Accesses to tokens
+// with no share are dropped, so guessing tokens cannot fill memory.
+func (m *MemoryStore) RecordShareAccess(ctx context.Context, access models.ShareAccess) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.shares[access.Token]; !ok {
+		return nil
+	}
+	log := m.accesses[access.Token]
+	if len(log) >= maxShareAccesses {
+		log = append(log[:0], log[len(log)-maxShareAccesses+1:]...)
+	}
+	m.accesses[access.Token] = append(log, access)
+	return nil
+}
+
+// ListShareAccesses returns the share's access log, oldest first
+func (m *MemoryStore) ListShareAccesses(ctx context.Context, token string) ([]models.ShareAccess, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]models.ShareAccess(nil), m.accesses[token]...), nil
+}
+
+// RecordAuditEvent appends to the audit log
+func (m *MemoryStore) RecordAuditEvent(ctx context.Context, event models.AuditEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.audit) >= maxAuditEvents {
+		m.audit = append(m.audit[:0], m.audit[len(m.audit)-maxAuditEvents+1:]...)
+	}
+	m.audit = append(m.audit, event)
+	return nil
+}
+
+// SearchAuditEvents returns the matching audit events, newest first
+func (m *MemoryStore) SearchAuditEvents(ctx context.Context, q models.AuditQuery) ([]models.AuditEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var events []models.AuditEvent
+	for i := len(m.audit) - 1; i >= 0; i-- {
+		if q.Limit > 0 && len(events) == q.Limit {
+			break
+		}
+		if q.Matches(m.audit[i]) {
+			events = append(events, m.audit[i])
+		}
+	}
+	return events, nil
+}
+
+// SaveWebhookDelivery creates or replaces a delivery
+func (m *MemoryStore) SaveWebhookDelivery(ctx context.Context, delivery models.WebhookDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.deliveries[delivery.ID]; !exists {
+		if len(m.deliveryOrder) >= maxWebhookDeliveries {
+			delete(m.deliveries, m.deliveryOrder[0])
+			m.deliveryOrder = m.deliveryOrder[1:]
+		}
+		m.deliveryOrder = append(m.deliveryOrder, delivery.ID)
+	}
+	m.deliveries[delivery.ID] = &delivery
+	return nil
+}
+
+// ListWebhookDeliveries returns deliveries with the given status, newest first
+func (m *MemoryStore) ListWebhookDeliveries(ctx context.Context, status string, limit int) ([]models.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var deliveries []models.WebhookDelivery
+	for i := len(m.deliveryOrder) - 1; i >= 0; i-- {
+		if limit > 0 && len(deliveries) == limit {
+			break
+		}
+		if d := m.deliveries[m.deliveryOrder[i]]; status == "" || d.Status == status {
+			deliveries = append(deliveries, *d)
+		}
+	}
+	return deliveries, nil
+}
+
+// Ping always succeeds; process memory is available while the process runs
+func (m *MemoryStore) Ping(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,158 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/models"
+)
+
+func TestMemoryStore_Shares(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	now := time.Now()
+
+	for i, token := range []string{"a", "b"} {
+		share := &models.Share{Token: token, OwnerID: "user1", CreatedAt: now.Add(time.Duration(i) * time.Minute)}
+		if err := store.CreateShare(ctx, share); err != nil {
+			t.Fatalf("CreateShare(%s) error = %v", token, err)
+		}
+	}
+	if err := store.CreateShare(ctx, &models.Share{Token: "a"}); err == nil {
+		t.Error("Expected duplicate token to be rejected")
+	}
+
+	shares, err := store.ListShares(ctx, "user1")
+	if err != nil {
+		t.Fatalf("ListShares() error = %v", err)
+	}
+	if len(shares) != 2 || shares[0].Token != "b" {
+		t.Errorf("ListShares() = %+v, want newest first", shares)
+	}
+
+	if err := store.RevokeShare(ctx, "a", now); err != nil {
+		t.Fatalf("RevokeShare() error = %v", err)
+	}
+	if _, err := store.ClaimShareDownload(ctx, "a", now); !errors.Is(err, ErrShareUnavailable) {
+		t.Errorf("ClaimShareDownload() on revoked share error = %v", err)
+	}
+	if _, err := store.GetShare(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetShare() on missing share error = %v", err)
+	}
+}
+
+func TestMemoryStore_ClaimShareDownload_Limit(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	if err := store.CreateShare(ctx, &models.Share{Token: "limited", MaxDownloads: 5}); err != nil {
+		t.Fatalf("CreateShare() error = %v", err)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	claimed := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := store.ClaimShareDownload(ctx, "limited", time.Now()); err == nil {
+				mu.Lock()
+				claimed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if claimed != 5 {
+		t.Errorf("claimed %d downloads, want exactly 5", claimed)
+	}
+}
+
+func TestMemoryStore_ShareAccesses(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	if err := store.CreateShare(ctx, &models.Share{Token: "t", OwnerID: "user1"}); err != nil {
+		t.Fatalf("CreateShare() error = %v", err)
+	}
+
+	for _, outcome := range []string{"viewed", "downloaded"} {
+		if err := store.RecordShareAccess(ctx, models.ShareAccess{Token: "t", Outcome: outcome}); err != nil {
+			t.Fatalf("RecordShareAccess() error = %v", err)
+		}
+	}
+	for range maxShareAccesses + 10 {
+		store.RecordShareAccess(ctx, models.ShareAccess{Token: "guessed", Outcome: "not_found"})
+	}
+	if len(store.accesses) != 1 {
+		t.Errorf("kept access logs for %d tokens, want only the real share's", len(store.accesses))
+	}
+
+	accesses, err := store.ListShareAccesses(ctx, "t")
+	if err != nil {
+		t.Fatalf("ListShareAccesses() error = %v", err)
+	}
+	if len(accesses) != 2 || accesses[1].Outcome != "downloaded" {
+		t.Errorf("ListShareAccesses() = %+v", accesses)
+	}
+
+	for range maxShareAccesses {
+		store.RecordShareAccess(ctx, models.ShareAccess{Token: "t", Outcome: "viewed"})
+	}
+	if accesses, _ := store.ListShareAccesses(ctx, "t"); len(accesses) != maxShareAccesses || accesses[0].Outcome != "viewed" {
+		t.Errorf("kept %d accesses starting with %q, want the newest %d", len(accesses), accesses[0].Outcome, maxShareAccesses)
+	}
+}
+
+func TestMemoryStore_AuditEvents(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	start := time.Now()
+
+	for i, action := range []string{"login.success", "file.upload", "file.download", "file.upload"} {
+		event := models.AuditEvent{ID: action, Time: start.Add(time.Duration(i) * time.Minute), Action: action, ActorEmail: "user@example.com"}
+		if err := store.RecordAuditEvent(ctx, event); err != nil {
+			t.Fatalf("RecordAuditEvent() error = %v", err)
+		}
+	}
+
+	events, err := store.SearchAuditEvents(ctx, models.AuditQuery{Action: "file", Actor: "USER@example.com", Limit: 2})
+	if err != nil {
+		t.Fatalf("SearchAuditEvents() error = %v", err)
+	}
+	if len(events) != 2 || events[0].Action != "file.upload" || events[1].Action != "file.download" {
+		t.Errorf("SearchAuditEvents() = %+v, want the two newest file events", events)
+	}
+
+	events, _ = store.SearchAuditEvents(ctx, models.AuditQuery{Since: start.Add(time.Minute), Until: start.Add(2 * time.Minute)})
+	if len(events) != 1 || events[0].Action != "file.upload" {
+		t.Errorf("SearchAuditEvents() in a time window = %+v", events)
+	}
+}
+
+func TestMemoryStore_WebhookDeliveries(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	for _, id := range []string{"a", "b", "c"} {
+		if err := store.SaveWebhookDelivery(ctx, models.WebhookDelivery{ID: id, Status: "pending"}); err != nil {
+			t.Fatalf("SaveWebhookDelivery(%s) error = %v", id, err)
+		}
+	}
+	// Saving again updates in place
+	if err := store.SaveWebhookDelivery(ctx, models.WebhookDelivery{ID: "a", Status: "dead", Attempts: 5}); err != nil {
+		t.Fatalf("SaveWebhookDelivery() update error = %v", err)
+	}
+
+	all, _ := store.ListWebhookDeliveries(ctx, "", 0)
+	if len(all) != 3 || all[0].ID != "c" || all[2].ID != "a" {
+		t.Errorf("ListWebhookDeliveries() = %+v, want 3 newest first", all)
+	}
+	dead, _ := store.ListWebhookDeliveries(ctx, "dead", 10)
+	if len(dead) != 1 || dead[0].Attempts != 5 {
+		t.Errorf("ListWebhookDeliveries(dead) = %+v", dead)
+	}
+}
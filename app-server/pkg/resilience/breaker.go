@@ -0,0 +1,142 @@
+// Package resilience bounds how long storage calls may take and stops calling
+// storage for a while once it keeps failing, so an S3 outage turns into quick
+// 503 pages instead of requests piling up behind it.
+package resilience
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/s3"
+)
+
+// ErrOpen is returned while the breaker is rejecting calls. It wraps s3.ErrUnavailable.
+var ErrOpen = fmt.Errorf("circuit breaker is open: %w", s3.ErrUnavailable)
+
+// State is the position of a circuit breaker
+type State string
+
+const (
+	// StateClosed lets every call through
+	StateClosed State = "closed"
+	// StateOpen rejects calls until the cooldown has passed
+	StateOpen State = "open"
+	// StateHalfOpen lets a single trial call through to probe recovery
+	StateHalfOpen State = "half-open"
+	// StateDisabled is reported when no breaker is configured
+	StateDisabled State = "disabled"
+)
+
+// BreakerConfig controls when the breaker trips. A zero FailureThreshold disables it.
+type BreakerConfig struct {
+	FailureThreshold int           // Consecutive failures that open the breaker
+	Cooldown         time.Duration // How long the breaker stays open before a trial call
+}
+
+// BreakerStatus is a snapshot of a breaker for health output
+type BreakerStatus struct {
+	State               State      `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`
+	RetryAt             *time.Time `json:"retry_at,omitempty"`
+}
+
+// Breaker is a consecutive-failure circuit breaker
+type Breaker struct {
+	cfg BreakerConfig
+	now func() time.Time
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	probing  bool // a half-open trial call is in flight
+}
+
+// NewBreaker returns a closed breaker
+func NewBreaker(cfg BreakerConfig) *Breaker {
+	return &Breaker{cfg: cfg, now: time.Now, state: StateClosed}
+}
+
+// Allow reports whether a call may proceed, returning ErrOpen if not.
+// Every allowed call must be followed by Record.
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateOpen:
+		if b.now().Sub(b.openedAt) < b.cfg.Cooldown {
+			return ErrOpen
+		}
+		b.state = StateHalfOpen
+		b.probing = true
+		log.Printf("🔌 Storage circuit breaker half-open, sending a trial request")
+		return nil
+	case StateHalfOpen:
+		if b.probing {
+			return ErrOpen
+		}
+		b.probing = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+// Record reports the outcome of an allowed call
+func (b *Breaker) Record(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !failed {
+		if b.state != StateClosed {
+			log.Printf("✅ Storage circuit breaker closed, storage has recovered")
+		}
+		b.state = StateClosed
+		b.failures = 0
+		b.probing = false
+		return
+	}
+
+	b.failures++
+	switch {
+	case b.state == StateHalfOpen:
+		b.trip()
+	case b.state == StateClosed && b.failures >= b.cfg.FailureThreshold:
+		b.trip()
+	}
+}
+
+// release ends an allowed call whose outcome says nothing about storage health,
+// such as one the caller cancelled
+func (b *Breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// trip opens the breaker. The caller holds b.mu.
+func (b *Breaker) trip() {
+	b.state = StateOpen
+	b.openedAt = b.now()
+	b.probing = false
+	log.Printf("⚡ Storage circuit breaker opened after %d consecutive failures, failing fast for %v", b.failures, b.cfg.Cooldown)
+}
+
+// Status returns a snapshot of the breaker
+func (b *Breaker) Status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := BreakerStatus{State: b.state, ConsecutiveFailures: b.failures}
+	if b.state != StateClosed {
+		openedAt := b.openedAt
+		retryAt := openedAt.Add(b.cfg.Cooldown)
+		status.OpenedAt = &openedAt
+		status.RetryAt = &retryAt
+	}
+	return status
+}
@@ -0,0 +1,196 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/s3"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/smithy-go"
+)
+
+// Policy bounds storage calls. Zero timeouts leave calls bounded only by the request context.
+type Policy struct {
+	OperationTimeout time.Duration // Limit for stat, list, delete, presign and opening a download
+	UploadTimeout    time.Duration // Limit for a whole upload
+	Breaker          BreakerConfig
+}
+
+// Client applies timeouts and a circuit breaker to another storage client
+type Client struct {
+	inner   s3.S3ClientIface
+	policy  Policy
+	breaker *Breaker // nil when disabled
+}
+
+// NewClient wraps a storage client with the given policy
+func NewClient(inner s3.S3ClientIface, policy Policy) *Client {
+	c := &Client{inner: inner, policy: policy}
+	if policy.Breaker.FailureThreshold > 0 {
+		c.breaker = NewBreaker(policy.Breaker)
+	}
+	return c
+}
+
+// BreakerStatus reports the breaker's state for health checks
+func (c *Client) BreakerStatus() BreakerStatus {
+	if c.breaker == nil {
+		return BreakerStatus{State: StateDisabled}
+	}
+	return c.breaker.Status()
+}
+
+// UploadFile uploads a file within the upload timeout
+func (c *Client) UploadFile(ctx context.Context, key string, file io.Reader, contentType string) error {
+	return c.UploadFileWithMetadata(ctx, key, file, contentType, nil)
+}
+
+// UploadFileWithMetadata uploads a file with metadata within the upload timeout
+func (c *Client) UploadFileWithMetadata(ctx context.Context, key string, file io.Reader, contentType string, metadata map[string]string) error {
+	return c.call(ctx, "upload", c.policy.UploadTimeout, func(ctx context.Context) error {
+		return c.inner.UploadFileWithMetadata(ctx, key, file, contentType, metadata)
+	})
+}
+
+// GetFileURL makes no network call, so it is passed straight through
+func (c *Client) GetFileURL(key string) string {
+	return c.inner.GetFileURL(key)
+}
+
+// DeleteFile deletes a file within the operation timeout
+func (c *Client) DeleteFile(ctx context.Context, key string) error {
+	return c.call(ctx, "delete", c.policy.OperationTimeout, func(ctx context.Context) error {
+		return c.inner.DeleteFile(ctx, key)
+	})
+}
+
+// ListFiles lists files within the operation timeout
+func (c *Client) ListFiles(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	err := c.call(ctx, "list", c.policy.OperationTimeout, func(ctx context.Context) error {
+		var err error
+		keys, err = c.inner.ListFiles(ctx, prefix)
+		return err
+	})
+	return keys, err
+}
+
+// StatFile describes a file within the operation timeout
+func (c *Client) StatFile(ctx context.Context, key string) (*s3.FileInfo, error) {
+	var info *s3.FileInfo
+	err := c.call(ctx, "stat", c.policy.OperationTimeout, func(ctx context.Context) error {
+		var err error
+		info, err = c.inner.StatFile(ctx, key)
+		return err
+	})
+	return info, err
+}
+
+// GetFile opens a file within the operation timeout. Streaming the body is
+// bounded only by the request context, so large downloads are not cut off.
+func (c *Client) GetFile(ctx context.Context, key string, rng *s3.ByteRange) (io.ReadCloser, error) {
+	if err := c.allow(); err != nil {
+		return nil, err
+	}
+
+	callCtx, cancel := context.WithCancel(ctx)
+	var timer *time.Timer
+	if c.policy.OperationTimeout > 0 {
+		timer = time.AfterFunc(c.policy.OperationTimeout, cancel)
+	}
+	body, err := c.inner.GetFile(callCtx, key, rng)
+	if timer != nil && !timer.Stop() && err != nil && ctx.Err() == nil {
+		err = fmt.Errorf("get timed out after %v: %w", c.policy.OperationTimeout, context.DeadlineExceeded)
+	}
+	c.record(ctx, err)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &cancelOnClose{ReadCloser: body, cancel: cancel}, nil
+}
+
+// PresignGetURL presigns a download within the operation timeout
+func (c *Client) PresignGetURL(ctx context.Context, key string, expires time.Duration) (string, error) {
+	var url string
+	err := c.call(ctx, "presign", c.policy.OperationTimeout, func(ctx context.Context) error {
+		var err error
+		url, err = c.inner.PresignGetURL(ctx, key, expires)
+		return err
+	})
+	return url, err
+}
+
+// call runs fn with a timeout derived from ctx and reports the outcome to the breaker
+func (c *Client) call(ctx context.Context, op string, timeout time.Duration, fn func(context.Context) error) error {
+	if err := c.allow(); err != nil {
+		return err
+	}
+
+	callCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		callCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	err := fn(callCtx)
+	if err != nil && ctx.Err() == nil && errors.Is(callCtx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("%s timed out after %v: %w", op, timeout, err)
+	}
+	c.record(ctx, err)
+	return err
+}
+
+func (c *Client) allow() error {
+	if c.breaker == nil {
+		return nil
+	}
+	return c.breaker.Allow()
+}
+
+// record tells the breaker whether a call showed storage to be unhealthy
+func (c *Client) record(ctx context.Context, err error) {
+	if c.breaker == nil {
+		return
+	}
+	switch {
+	case err != nil && ctx.Err() != nil:
+		// The caller gave up; that says nothing about storage
+		c.breaker.release()
+	default:
+		c.breaker.Record(isStorageFailure(err))
+	}
+}
+
+// isStorageFailure reports whether err means storage is unhealthy, as opposed
+// to the request being wrong (missing object, access denied, bad range)
+func isStorageFailure(err error) bool {
+	if err == nil || errors.Is(err, s3.ErrNotFound) || errors.Is(err, s3.ErrPresignUnsupported) {
+		return false
+	}
+	var respErr *awshttp.ResponseError
+	if errors.As(err, &respErr) {
+		status := respErr.HTTPStatusCode()
+		return status >= 500 || status == 429
+	}
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorFault() == smithy.FaultClient {
+		return false
+	}
+	return true
+}
+
+// cancelOnClose releases a download's context once the body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
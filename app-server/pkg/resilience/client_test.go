@@ -0,0 +1,197 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/faultinject"
+	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/localfs"
+	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/s3"
+	"github.com/aws/smithy-go"
+)
+
+// newTestStorage returns local storage wrapped in the given faults
+func newTestStorage(t *testing.T, faults map[faultinject.Op]faultinject.Fault) (s3.S3ClientIface, s3.S3ClientIface) {
+	t.Helper()
+	inner, err := localfs.NewClient(t.TempDir(), "http://localhost:8080", []byte("test-signing-key"))
+	if err != nil {
+		t.Fatalf("localfs.NewClient() error = %v", err)
+	}
+	return faultinject.NewClient(inner, faultinject.Config{Faults: faults, Seed: 1}), inner
+}
+
+// errorStorage fails every call with err
+type errorStorage struct {
+	s3.S3ClientIface
+	err error
+}
+
+func (e *errorStorage) StatFile(ctx context.Context, key string) (*s3.FileInfo, error) {
+	return nil, e.err
+}
+
+func TestBreaker_Transitions(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	b := NewBreaker(BreakerConfig{FailureThreshold: 3, Cooldown: time.Minute})
+	b.now = func() time.Time { return now }
+
+	// Failures below the threshold, interrupted by a success, keep it closed
+	for _, failed := range []bool{true, true, false, true, true} {
+		if err := b.Allow(); err != nil {
+			t.Fatalf("Allow() while closed = %v", err)
+		}
+		b.Record(failed)
+	}
+	if s := b.Status(); s.State != StateClosed || s.ConsecutiveFailures != 2 {
+		t.Fatalf("Status() = %+v, want closed with 2 failures", s)
+	}
+
+	b.Allow()
+	b.Record(true)
+	if s := b.Status(); s.State != StateOpen || s.RetryAt == nil || !s.RetryAt.Equal(now.Add(time.Minute)) {
+		t.Fatalf("Status() after 3 failures = %+v, want open until %v", s, now.Add(time.Minute))
+	}
+	if err := b.Allow(); !errors.Is(err, ErrOpen) || !errors.Is(err, s3.ErrUnavailable) {
+		t.Fatalf("Allow() while open = %v, want ErrOpen", err)
+	}
+
+	// After the cooldown a single trial call is let through
+	now = now.Add(time.Minute)
+	if err := b.Allow(); err != nil {
+		t.Fatalf("Allow() after cooldown = %v", err)
+	}
+	if err := b.Allow(); !errors.Is(err, ErrOpen) {
+		t.Errorf("second Allow() while half-open = %v, want ErrOpen", err)
+	}
+	b.Record(true)
+	if s := b.Status(); s.State != StateOpen {
+		t.Fatalf("failed trial left breaker %s, want open", s.State)
+	}
+
+	now = now.Add(time.Minute)
+	b.Allow()
+	b.Record(false)
+	if s := b.Status(); s.State != StateClosed || s.ConsecutiveFailures != 0 || s.OpenedAt != nil {
+		t.Errorf("Status() after successful trial = %+v, want closed", s)
+	}
+}
+
+func TestClient_BreakerFailsFast(t *testing.T) {
+	storage, _ := newTestStorage(t, map[faultinject.Op]faultinject.Fault{faultinject.OpList: {ErrorRate: 1}})
+	client := NewClient(storage, Policy{Breaker: BreakerConfig{FailureThreshold: 2, Cooldown: time.Hour}})
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.ListFiles(ctx, ""); !errors.Is(err, faultinject.ErrInjected) {
+			t.Fatalf("ListFiles() #%d error = %v, want the storage error", i+1, err)
+		}
+	}
+	if _, err := client.StatFile(ctx, "k"); !errors.Is(err, s3.ErrUnavailable) {
+		t.Errorf("StatFile() with breaker open = %v, want ErrUnavailable", err)
+	}
+	if _, err := client.GetFile(ctx, "k", nil); !errors.Is(err, s3.ErrUnavailable) {
+		t.Errorf("GetFile() with breaker open = %v, want ErrUnavailable", err)
+	}
+	if err := client.UploadFile(ctx, "k", strings.NewReader("x"), "text/plain"); !errors.Is(err, s3.ErrUnavailable) {
+		t.Errorf("UploadFile() with breaker open = %v, want ErrUnavailable", err)
+	}
+	if got := client.BreakerStatus().State; got != StateOpen {
+		t.Errorf("BreakerStatus().State = %s, want open", got)
+	}
+}
+
+func TestClient_OnlyStorageFailuresCount(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"not found", s3.ErrNotFound},
+		{"client fault", &smithy.GenericAPIError{Code: "AccessDenied", Fault: smithy.FaultClient}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewClient(&errorStorage{err: tt.err}, Policy{Breaker: BreakerConfig{FailureThreshold: 1, Cooldown: time.Hour}})
+			for i := 0; i < 3; i++ {
+				client.StatFile(context.Background(), "k")
+			}
+			if s := client.BreakerStatus(); s.State != StateClosed {
+				t.Errorf("breaker %s after %q errors, want closed", s.State, tt.err)
+			}
+		})
+	}
+
+	// A caller that gives up says nothing about storage either
+	client := NewClient(&errorStorage{err: context.Canceled}, Policy{Breaker: BreakerConfig{FailureThreshold: 1, Cooldown: time.Hour}})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	client.StatFile(ctx, "k")
+	if s := client.BreakerStatus(); s.State != StateClosed {
+		t.Errorf("breaker %s after a cancelled call, want closed", s.State)
+	}
+}
+
+func TestClient_Timeouts(t *testing.T) {
+	storage, inner := newTestStorage(t, map[faultinject.Op]faultinject.Fault{
+		faultinject.OpStat:   {Latency: time.Hour},
+		faultinject.OpUpload: {Latency: time.Hour},
+		faultinject.OpGet:    {Latency: time.Hour},
+	})
+	client := NewClient(storage, Policy{
+		OperationTimeout: 20 * time.Millisecond,
+		UploadTimeout:    20 * time.Millisecond,
+		Breaker:          BreakerConfig{FailureThreshold: 3, Cooldown: time.Hour},
+	})
+	ctx := context.Background()
+	inner.UploadFile(ctx, "k", strings.NewReader("data"), "text/plain")
+
+	start := time.Now()
+	_, statErr := client.StatFile(ctx, "k")
+	uploadErr := client.UploadFile(ctx, "k2", strings.NewReader("data"), "text/plain")
+	_, getErr := client.GetFile(ctx, "k", nil)
+	for name, err := range map[string]error{"StatFile": statErr, "UploadFile": uploadErr, "GetFile": getErr} {
+		if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "timed out") {
+			t.Errorf("%s() error = %v, want a timeout", name, err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("calls took %v despite 20ms timeouts", elapsed)
+	}
+	if s := client.BreakerStatus(); s.State != StateOpen {
+		t.Errorf("breaker %s after 3 timeouts, want open", s.State)
+	}
+}
+
+func TestClient_DownloadBodyOutlivesOperationTimeout(t *testing.T) {
+	storage, inner := newTestStorage(t, nil)
+	client := NewClient(storage, Policy{OperationTimeout: 20 * time.Millisecond})
+	ctx := context.Background()
+	inner.UploadFile(ctx, "k", strings.NewReader("slowly streamed"), "text/plain")
+
+	body, err := client.GetFile(ctx, "k", nil)
+	if err != nil {
+		t.Fatalf("GetFile() error = %v", err)
+	}
+	defer body.Close()
+	time.Sleep(50 * time.Millisecond)
+	got, err := io.ReadAll(body)
+	if err != nil || string(got) != "slowly streamed" {
+		t.Errorf("reading body after the operation timeout = %q, %v", got, err)
+	}
+}
+
+func TestClient_DisabledBreaker(t *testing.T) {
+	storage, _ := newTestStorage(t, map[faultinject.Op]faultinject.Fault{faultinject.OpAll: {ErrorRate: 1}})
+	client := NewClient(storage, Policy{})
+	for i := 0; i < 10; i++ {
+		if _, err := client.ListFiles(context.Background(), ""); errors.Is(err, s3.ErrUnavailable) {
+			t.Fatal("disabled breaker failed fast")
+		}
+	}
+	if got := client.BreakerStatus().State; got != StateDisabled {
+		t.Errorf("BreakerStatus().State = %s, want disabled", got)
+	}
+}
@@ -3,81 +3,353 @@ package s3
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"log"
+	"net/url"
 	"os"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go/tracing/smithyoteltracing"
+	"go.opentelemetry.io/otel"
 )
 
 // S3ClientIface defines the interface for S3 operations
 type S3ClientIface interface {
 	UploadFile(ctx context.Context, key string, file io.Reader, contentType string) error
+	UploadFileWithMetadata(ctx context.Context, key string, file io.Reader, contentType string, metadata map[string]string) error
 	GetFileURL(key string) string
 	DeleteFile(ctx context.Context, key string) error
 	ListFiles(ctx context.Context, prefix string) ([]string, error)
+	StatFile(ctx context.Context, key string) (*FileInfo, error)
+	GetFile(ctx context.Context, key string, rng *ByteRange) (io.ReadCloser, error)
+	PresignGetURL(ctx context.Context, key string, expires time.Duration) (string, error)
 }
 
 // S3API defines the S3 API methods we use (for testing)
 type S3API interface {
 	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
 	DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
 	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+	CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error)
+	UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error)
+	CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error)
+	AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error)
+	HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error)
 }
 
+// Pinger is implemented by backends that can check they are reachable with
+// working credentials, e.g. for readiness probes
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// UploadAborter is implemented by clients that can abort uploads still in progress, e.g. on shutdown
+type UploadAborter interface {
+	AbortPendingUploads(ctx context.Context) error
+}
+
+// S3PresignAPI defines the presigning methods we use (for testing)
+type S3PresignAPI interface {
+	PresignGetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.PresignOptions)) (*v4.PresignedHTTPRequest, error)
+}
+
+// FileInfo describes a stored object
+type FileInfo struct {
+	Key          string
+	Size         int64
+	ContentType  string
+	ETag         string
+	LastModified time.Time
+	Metadata     map[string]string
+}
+
+// ByteRange selects an inclusive range of bytes. An End of -1 reads to the end of the object.
+type ByteRange struct {
+	Start int64
+	End   int64
+}
+
+// Length returns the number of bytes selected from an object of the given size
+func (r ByteRange) Length(size int64) int64 {
+	end := r.End
+	if end < 0 || end >= size {
+		end = size - 1
+	}
+	return end - r.Start + 1
+}
+
+// header formats the range as an HTTP Range header value
+func (r ByteRange) header() string {
+	if r.End < 0 {
+		return fmt.Sprintf("bytes=%d-", r.Start)
+	}
+	return fmt.Sprintf("bytes=%d-%d", r.Start, r.End)
+}
+
+// ErrNotFound is returned when an object does not exist
+var ErrNotFound = errors.New("object not found")
+
+// ErrUnavailable is returned without contacting storage while it is considered unhealthy
+var ErrUnavailable = errors.New("storage temporarily unavailable")
+
 // S3Client implements S3 operations
 type S3Client struct {
 	client     S3API
+	presigner  S3PresignAPI
 	bucketName string
 	region     string
+	encryption EncryptionConfig
+
+	// Connection settings, applied when the SDK client is built
+	endpoint    *url.URL // Custom endpoint for S3-compatible stores; nil uses AWS
+	pathStyle   bool     // Address buckets as endpoint/bucket instead of bucket.endpoint
+	caBundle    []byte   // PEM certificates trusted in addition to the system roots
+	credentials aws.CredentialsProvider
+	retryMode   aws.RetryMode // Empty keeps the SDK default ("standard")
+	maxAttempts int           // 0 keeps the SDK default (3)
+	wrapHTTP    func(aws.HTTPClient) aws.HTTPClient
+
+	partSize int64 // Uploads larger than this use multipart; 0 means DefaultPartSize
+
+	pendingMu sync.Mutex
+	pending   map[string]string // Multipart upload ID -> key, for uploads not yet completed or aborted
 }
 
-// NewS3Client creates a new S3 client
-func NewS3Client() (S3ClientIface, error) {
-	bucketName := os.Getenv("S3_BUCKET_NAME")
-	if bucketName == "" {
-		return nil, fmt.Errorf("S3_BUCKET_NAME environment variable is required")
+// DefaultPartSize is the multipart part size. It is also the most an upload buffers in memory.
+const DefaultPartSize = 8 << 20
+
+// abortTimeout bounds aborting a failed multipart upload, which runs even if the caller gave up
+const abortTimeout = 30 * time.Second
+
+// Option configures an S3Client
+type Option func(*S3Client) error
+
+// WithEncryption sets the server-side encryption applied to every object
+func WithEncryption(cfg EncryptionConfig) Option {
+	return func(s *S3Client) error {
+		if err := cfg.Validate(); err != nil {
+			return fmt.Errorf("invalid encryption config: %w", err)
+		}
+		s.encryption = cfg
+		return nil
 	}
+}
 
+// WithEndpoint points the client at an S3-compatible store such as MinIO or Ceph.
+// An empty endpoint keeps the regional AWS endpoint.
+func WithEndpoint(endpoint string, pathStyle bool) Option {
+	return func(s *S3Client) error {
+		s.pathStyle = pathStyle
+		if endpoint == "" {
+			return nil
+		}
+		u, err := url.Parse(strings.TrimSuffix(endpoint, "/"))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid S3 endpoint %q: want an http or https URL", endpoint)
+		}
+		s.endpoint = u
+		return nil
+	}
+}
+
+// WithCABundle trusts the PEM certificates in the given file, for endpoints with a private CA.
+// An empty path keeps the system roots only.
+func WithCABundle(path string) Option {
+	return func(s *S3Client) error {
+		if path == "" {
+			return nil
+		}
+		pem, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+		s.caBundle = pem
+		return nil
+	}
+}
+
+// WithStaticCredentials uses a fixed access key instead of the default AWS credential chain.
+// An empty access key keeps the default chain.
+func WithStaticCredentials(accessKeyID, secretAccessKey, sessionToken string) Option {
+	return func(s *S3Client) error {
+		if accessKeyID == "" && secretAccessKey == "" {
+			return nil
+		}
+		if accessKeyID == "" || secretAccessKey == "" {
+			return fmt.Errorf("static credentials need both an access key ID and a secret access key")
+		}
+		s.credentials = credentials.NewStaticCredentialsProvider(accessKeyID, secretAccessKey, sessionToken)
+		return nil
+	}
+}
+
+// WithRetryPolicy sets the SDK retry mode ("standard" or "adaptive") and the
+// maximum attempts per request. Empty values keep the SDK defaults.
+func WithRetryPolicy(mode string, maxAttempts int) Option {
+	return func(s *S3Client) error {
+		if mode != "" {
+			retryMode, err := aws.ParseRetryMode(mode)
+			if err != nil {
+				return fmt.Errorf("invalid retry mode: %w", err)
+			}
+			s.retryMode = retryMode
+		}
+		if maxAttempts < 0 {
+			return fmt.Errorf("max attempts must not be negative, got %d", maxAttempts)
+		}
+		s.maxAttempts = maxAttempts
+		return nil
+	}
+}
+
+// WithHTTPClientWrapper wraps the HTTP client the SDK sends requests with.
+// Requests pass through it on every attempt, below the SDK's retries. A nil
+// wrap leaves the client alone.
+func WithHTTPClientWrapper(wrap func(aws.HTTPClient) aws.HTTPClient) Option {
+	return func(s *S3Client) error {
+		s.wrapHTTP = wrap
+		return nil
+	}
+}
+
+// WithPartSize sets the multipart part size. S3 requires at least 5 MiB for every part but the last.
+func WithPartSize(size int64) Option {
+	return func(s *S3Client) error {
+		if size <= 0 {
+			return fmt.Errorf("part size must be positive, got %d", size)
+		}
+		s.partSize = size
+		return nil
+	}
+}
+
+// WithBucket sets the bucket and its region, overriding S3_BUCKET_NAME and
+// AWS_REGION. An empty region keeps the environment's.
+func WithBucket(name, region string) Option {
+	return func(s *S3Client) error {
+		if name == "" {
+			return fmt.Errorf("bucket name must not be empty")
+		}
+		s.bucketName = name
+		if region != "" {
+			s.region = region
+		}
+		return nil
+	}
+}
+
+// NewS3Client creates a new S3 client. Without WithBucket the bucket and
+// region come from S3_BUCKET_NAME and AWS_REGION.
+func NewS3Client(opts ...Option) (S3ClientIface, error) {
 	region := os.Getenv("AWS_REGION")
 	if region == "" {
 		region = "ap-northeast-1" // Default region
 	}
 
+	s3Client := &S3Client{
+		bucketName: os.Getenv("S3_BUCKET_NAME"),
+		region:     region,
+	}
+	for _, opt := range opts {
+		if err := opt(s3Client); err != nil {
+			return nil, err
+		}
+	}
+	if s3Client.bucketName == "" {
+		return nil, fmt.Errorf("S3_BUCKET_NAME environment variable is required")
+	}
+
 	// Load AWS configuration
-	cfg, err := config.LoadDefaultConfig(context.TODO(),
-		config.WithRegion(region),
-	)
+	loadOpts := []func(*config.LoadOptions) error{
+		config.WithRegion(s3Client.region),
+	}
+	if s3Client.caBundle != nil {
+		loadOpts = append(loadOpts, config.WithCustomCABundle(bytes.NewReader(s3Client.caBundle)))
+	}
+	if s3Client.credentials != nil {
+		loadOpts = append(loadOpts, config.WithCredentialsProvider(s3Client.credentials))
+	}
+	if s3Client.retryMode != "" {
+		loadOpts = append(loadOpts, config.WithRetryMode(s3Client.retryMode))
+	}
+	if s3Client.maxAttempts > 0 {
+		loadOpts = append(loadOpts, config.WithRetryMaxAttempts(s3Client.maxAttempts))
+	}
+	cfg, err := config.LoadDefaultConfig(context.TODO(), loadOpts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load AWS config: %w", err)
 	}
 
-	return &S3Client{
-		client:     s3.NewFromConfig(cfg),
-		bucketName: bucketName,
-		region:     region,
-	}, nil
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if s3Client.endpoint != nil {
+			o.BaseEndpoint = aws.String(s3Client.endpoint.String())
+		}
+		o.UsePathStyle = s3Client.pathStyle
+		if s3Client.wrapHTTP != nil {
+			if o.HTTPClient == nil {
+				o.HTTPClient = awshttp.NewBuildableClient()
+			}
+			o.HTTPClient = s3Client.wrapHTTP(o.HTTPClient)
+		}
+		// Each SDK call gets a span under the request's; a no-op unless tracing is set up
+		o.TracerProvider = smithyoteltracing.Adapt(otel.GetTracerProvider())
+	})
+	s3Client.client = client
+	s3Client.presigner = s3.NewPresignClient(client)
+
+	return s3Client, nil
 }
 
 // UploadFile uploads a file to S3
 func (s *S3Client) UploadFile(ctx context.Context, key string, file io.Reader, contentType string) error {
-	// Read the file content
-	content, err := io.ReadAll(file)
-	if err != nil {
+	return s.UploadFileWithMetadata(ctx, key, file, contentType, nil)
+}
+
+// UploadFileWithMetadata uploads a file to S3 with user-defined object metadata.
+// Files larger than one part are streamed as a multipart upload, which is
+// aborted if any step fails, including the caller's context being cancelled.
+func (s *S3Client) UploadFileWithMetadata(ctx context.Context, key string, file io.Reader, contentType string, metadata map[string]string) error {
+	partSize := s.partSize
+	if partSize == 0 {
+		partSize = DefaultPartSize
+	}
+	buf := make([]byte, partSize)
+	n, err := io.ReadFull(file, buf)
+	switch {
+	case err == io.EOF || err == io.ErrUnexpectedEOF:
+		return s.putObject(ctx, key, buf[:n], contentType, metadata)
+	case err != nil:
 		return fmt.Errorf("failed to read file content: %w", err)
 	}
+	return s.uploadMultipart(ctx, key, buf, file, contentType, metadata)
+}
 
-	// Upload to S3
-	_, err = s.client.PutObject(ctx, &s3.PutObjectInput{
+// putObject uploads a file that fits in a single request
+func (s *S3Client) putObject(ctx context.Context, key string, content []byte, contentType string, metadata map[string]string) error {
+	input := &s3.PutObjectInput{
 		Bucket:      aws.String(s.bucketName),
 		Key:         aws.String(key),
 		Body:        bytes.NewReader(content),
 		ContentType: aws.String(contentType),
 		ACL:         types.ObjectCannedACLPrivate, // Private access
-	})
+		Metadata:    metadata,
+	}
+	s.encryption.applyToPut(input)
+
+	_, err := s.client.PutObject(ctx, input)
 	if err != nil {
 		return fmt.Errorf("failed to upload to S3: %w", err)
 	}
@@ -85,9 +357,152 @@ func (s *S3Client) UploadFile(ctx context.Context, key string, file io.Reader, c
 	return nil
 }
 
-// GetFileURL returns the S3 URL for a file
+// uploadMultipart uploads first, which is already full, and the rest of file one part at a time
+func (s *S3Client) uploadMultipart(ctx context.Context, key string, first []byte, file io.Reader, contentType string, metadata map[string]string) error {
+	create := &s3.CreateMultipartUploadInput{
+		Bucket:            aws.String(s.bucketName),
+		Key:               aws.String(key),
+		ContentType:       aws.String(contentType),
+		ACL:               types.ObjectCannedACLPrivate,
+		Metadata:          metadata,
+		ChecksumAlgorithm: types.ChecksumAlgorithmCrc32,
+	}
+	s.encryption.applyToCreateMultipart(create)
+	out, err := s.client.CreateMultipartUpload(ctx, create)
+	if err != nil {
+		return fmt.Errorf("failed to start multipart upload: %w", err)
+	}
+	uploadID := aws.ToString(out.UploadId)
+	s.trackUpload(uploadID, key)
+	defer s.untrackUpload(uploadID)
+
+	if err := s.uploadParts(ctx, key, uploadID, first, file); err != nil {
+		s.abortUpload(context.WithoutCancel(ctx), key, uploadID)
+		return err
+	}
+	return nil
+}
+
+// uploadParts sends the parts of an upload and completes it
+func (s *S3Client) uploadParts(ctx context.Context, key, uploadID string, buf []byte, file io.Reader) error {
+	var parts []types.CompletedPart
+	n := len(buf)
+	for partNumber := int32(1); n > 0; partNumber++ {
+		input := &s3.UploadPartInput{
+			Bucket:            aws.String(s.bucketName),
+			Key:               aws.String(key),
+			UploadId:          aws.String(uploadID),
+			PartNumber:        aws.Int32(partNumber),
+			Body:              bytes.NewReader(buf[:n]),
+			ChecksumAlgorithm: types.ChecksumAlgorithmCrc32,
+		}
+		s.encryption.applyToUploadPart(input)
+		out, err := s.client.UploadPart(ctx, input)
+		if err != nil {
+			return fmt.Errorf("failed to upload part %d: %w", partNumber, err)
+		}
+		parts = append(parts, types.CompletedPart{
+			PartNumber:    aws.Int32(partNumber),
+			ETag:          out.ETag,
+			ChecksumCRC32: out.ChecksumCRC32,
+		})
+
+		n, err = io.ReadFull(file, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return fmt.Errorf("failed to read file content: %w", err)
+		}
+	}
+
+	complete := &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(s.bucketName),
+		Key:             aws.String(key),
+		UploadId:        aws.String(uploadID),
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+	}
+	s.encryption.applyToComplete(complete)
+	if _, err := s.client.CompleteMultipartUpload(ctx, complete); err != nil {
+		return fmt.Errorf("failed to complete multipart upload: %w", err)
+	}
+	return nil
+}
+
+// abortUpload discards the parts of an unfinished upload so they are not billed forever
+func (s *S3Client) abortUpload(ctx context.Context, key, uploadID string) error {
+	ctx, cancel := context.WithTimeout(ctx, abortTimeout)
+	defer cancel()
+	_, err := s.client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(s.bucketName),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	})
+	var noSuchUpload *types.NoSuchUpload
+	if err != nil && !errors.As(err, &noSuchUpload) {
+		log.Printf("⚠️ Failed to abort multipart upload of %s (%s): %v", key, uploadID, err)
+		return fmt.Errorf("failed to abort multipart upload of %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *S3Client) trackUpload(uploadID, key string) {
+	s.pendingMu.Lock()
+	defer s.pendingMu.Unlock()
+	if s.pending == nil {
+		s.pending = make(map[string]string)
+	}
+	s.pending[uploadID] = key
+}
+
+func (s *S3Client) untrackUpload(uploadID string) {
+	s.pendingMu.Lock()
+	defer s.pendingMu.Unlock()
+	delete(s.pending, uploadID)
+}
+
+// AbortPendingUploads aborts every multipart upload still in progress.
+// Uploads that are aborted under them fail and return an error to their caller.
+func (s *S3Client) AbortPendingUploads(ctx context.Context) error {
+	s.pendingMu.Lock()
+	pending := make(map[string]string, len(s.pending))
+	for id, key := range s.pending {
+		pending[id] = key
+	}
+	s.pendingMu.Unlock()
+
+	var errs []error
+	for id, key := range pending {
+		if err := s.abortUpload(ctx, key, id); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(pending) > 0 {
+		log.Printf("🧹 Aborted %d pending multipart uploads", len(pending)-len(errs))
+	}
+	return errors.Join(errs...)
+}
+
+// Ping checks that the bucket exists and the credentials can reach it
+func (s *S3Client) Ping(ctx context.Context) error {
+	_, err := s.client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(s.bucketName)})
+	if err != nil {
+		return fmt.Errorf("failed to access bucket %s: %w", s.bucketName, err)
+	}
+	return nil
+}
+
+// GetFileURL returns the S3 URL for a file, built from the configured endpoint
 func (s *S3Client) GetFileURL(key string) string {
-	return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", s.bucketName, s.region, key)
+	if s.endpoint == nil {
+		if s.pathStyle {
+			return fmt.Sprintf("https://s3.%s.amazonaws.com/%s/%s", s.region, s.bucketName, key)
+		}
+		return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", s.bucketName, s.region, key)
+	}
+	if s.pathStyle {
+		return fmt.Sprintf("%s/%s/%s", s.endpoint, s.bucketName, key)
+	}
+	u := *s.endpoint
+	u.Host = s.bucketName + "." + u.Host
+	return fmt.Sprintf("%s/%s", u.String(), key)
 }
 
 // DeleteFile deletes a file from S3
@@ -103,22 +518,107 @@ func (s *S3Client) DeleteFile(ctx context.Context, key string) error {
 	return nil
 }
 
-// ListFiles lists files with a given prefix
+// ListFiles lists files with a given prefix, following continuation tokens past S3's 1000-key page limit
 func (s *S3Client) ListFiles(ctx context.Context, prefix string) ([]string, error) {
-	result, err := s.client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
 		Bucket: aws.String(s.bucketName),
 		Prefix: aws.String(prefix),
 	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to list S3 objects: %w", err)
-	}
 
 	var files []string
-	for _, obj := range result.Contents {
-		if obj.Key != nil {
-			files = append(files, *obj.Key)
+	for paginator.HasMorePages() {
+		result, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list S3 objects: %w", err)
+		}
+		for _, obj := range result.Contents {
+			if obj.Key != nil {
+				files = append(files, *obj.Key)
+			}
 		}
 	}
 
 	return files, nil
 }
+
+// StatFile returns the metadata of a file without downloading it
+func (s *S3Client) StatFile(ctx context.Context, key string) (*FileInfo, error) {
+	input := &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(key),
+	}
+	s.encryption.applyToHead(input)
+
+	result, err := s.client.HeadObject(ctx, input)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to stat S3 object: %w", err)
+	}
+
+	return &FileInfo{
+		Key:          key,
+		Size:         aws.ToInt64(result.ContentLength),
+		ContentType:  aws.ToString(result.ContentType),
+		ETag:         aws.ToString(result.ETag),
+		LastModified: aws.ToTime(result.LastModified),
+		Metadata:     result.Metadata,
+	}, nil
+}
+
+// GetFile opens a file for reading, optionally limited to a byte range
+func (s *S3Client) GetFile(ctx context.Context, key string, rng *ByteRange) (io.ReadCloser, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(key),
+	}
+	if rng != nil {
+		input.Range = aws.String(rng.header())
+	}
+	s.encryption.applyToGet(input)
+
+	result, err := s.client.GetObject(ctx, input)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to download from S3: %w", err)
+	}
+
+	return result.Body, nil
+}
+
+// PresignGetURL returns a time-limited URL that downloads the file directly from S3
+func (s *S3Client) PresignGetURL(ctx context.Context, key string, expires time.Duration) (string, error) {
+	if s.presigner == nil {
+		return "", fmt.Errorf("presigning is not configured")
+	}
+	if s.encryption.Mode == EncryptionSSEC {
+		return "", ErrPresignUnsupported
+	}
+
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(key),
+	}
+	s.encryption.applyToGet(input)
+
+	req, err := s.presigner.PresignGetObject(ctx, input, s3.WithPresignExpires(expires))
+	if err != nil {
+		return "", fmt.Errorf("failed to presign S3 object: %w", err)
+	}
+
+	return req.URL, nil
+}
+
+// isNotFound reports whether err is S3's answer for a missing object
+func isNotFound(err error) bool {
+	var noSuchKey *types.NoSuchKey
+	var notFound *types.NotFound
+	if errors.As(err, &noSuchKey) || errors.As(err, &notFound) {
+		return true
+	}
+	// HeadObject has no body, so some S3-compatible stores only report the status code
+	return strings.Contains(err.Error(), "StatusCode: 404")
+}
@@ -1,10 +1,12 @@
 package s3
 
 import (
+	"bytes"
 	"context"
 	"io"
 	"strings"
 	"testing"
+	"time"
 )
 
 // MockS3Client implements S3ClientIface for testing
@@ -39,6 +41,11 @@ func (m *MockS3Client) UploadFile(ctx context.Context, key string, file io.Reade
 	return nil
 }
 
+// UploadFileWithMetadata mocks file upload, discarding the metadata
+func (m *MockS3Client) UploadFileWithMetadata(ctx context.Context, key string, file io.Reader, contentType string, metadata map[string]string) error {
+	return m.UploadFile(ctx, key, file, contentType)
+}
+
 // GetFileURL mocks URL generation
 func (m *MockS3Client) GetFileURL(key string) string {
 	return m.baseURL + "/" + key
@@ -69,6 +76,32 @@ func (m *MockS3Client) ListFiles(ctx context.Context, prefix string) ([]string,
 	return files, nil
 }
 
+// StatFile mocks object metadata lookup
+func (m *MockS3Client) StatFile(ctx context.Context, key string) (*FileInfo, error) {
+	content, exists := m.uploadedFiles[key]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return &FileInfo{Key: key, Size: int64(len(content))}, nil
+}
+
+// GetFile mocks file download
+func (m *MockS3Client) GetFile(ctx context.Context, key string, rng *ByteRange) (io.ReadCloser, error) {
+	content, exists := m.uploadedFiles[key]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	if rng != nil {
+		content = content[rng.Start : rng.Start+rng.Length(int64(len(content)))]
+	}
+	return io.NopCloser(bytes.NewReader(content)), nil
+}
+
+// PresignGetURL mocks URL presigning
+func (m *MockS3Client) PresignGetURL(ctx context.Context, key string, expires time.Duration) (string, error) {
+	return m.GetFileURL(key) + "?X-Amz-Expires=" + expires.String(), nil
+}
+
 // Test helper methods
 func (m *MockS3Client) SetUploadError(err error) {
 	m.uploadError = err
@@ -222,3 +255,117 @@ func TestMockS3Client_ListFiles(t *testing.T) {
 		t.Error("ListFiles() did not return expected files")
 	}
 }
+
+func TestMockS3Client_GetFile(t *testing.T) {
+	var _ S3ClientIface = NewMockS3Client()
+	mockClient := NewMockS3Client()
+
+	key := "uploads/user1/range.txt"
+	if err := mockClient.UploadFile(context.Background(), key, strings.NewReader("0123456789"), "text/plain"); err != nil {
+		t.Fatalf("Failed to upload test file: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		rng  *ByteRange
+		want string
+	}{
+		{"whole file", nil, "0123456789"},
+		{"closed range", &ByteRange{Start: 2, End: 4}, "234"},
+		{"open range", &ByteRange{Start: 7, End: -1}, "789"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := mockClient.GetFile(context.Background(), key, tt.rng)
+			if err != nil {
+				t.Fatalf("GetFile() error = %v", err)
+			}
+			defer body.Close()
+			got, _ := io.ReadAll(body)
+			if string(got) != tt.want {
+				t.Errorf("GetFile() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := mockClient.GetFile(context.Background(), "missing", nil); err != ErrNotFound {
+		t.Errorf("GetFile() on missing key error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestS3Client_GetFileURL_Endpoints(t *testing.T) {
+	tests := []struct {
+		name      string
+		endpoint  string
+		pathStyle bool
+		want      string
+	}{
+		{"aws virtual hosted", "", false, "https://test-bucket.s3.ap-northeast-1.amazonaws.com/uploads/a.txt"},
+		{"aws path style", "", true, "https://s3.ap-northeast-1.amazonaws.com/test-bucket/uploads/a.txt"},
+		{"minio path style", "http://localhost:9000/", true, "http://localhost:9000/test-bucket/uploads/a.txt"},
+		{"custom virtual hosted", "https://storage.example.com", false, "https://test-bucket.storage.example.com/uploads/a.txt"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &S3Client{bucketName: "test-bucket", region: "ap-northeast-1"}
+			if err := WithEndpoint(tt.endpoint, tt.pathStyle)(client); err != nil {
+				t.Fatalf("WithEndpoint() error = %v", err)
+			}
+			if got := client.GetFileURL("uploads/a.txt"); got != tt.want {
+				t.Errorf("GetFileURL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewS3Client_CustomEndpoint(t *testing.T) {
+	t.Setenv("S3_BUCKET_NAME", "test-bucket")
+	t.Setenv("AWS_REGION", "us-east-1")
+
+	client, err := NewS3Client(
+		WithEndpoint("http://localhost:9000", true),
+		WithStaticCredentials("minioadmin", "minioadmin", ""),
+	)
+	if err != nil {
+		t.Fatalf("NewS3Client() error = %v", err)
+	}
+
+	// Presigning is local, so it shows which endpoint and addressing style requests use
+	url, err := client.PresignGetURL(context.Background(), "uploads/a.txt", time.Minute)
+	if err != nil {
+		t.Fatalf("PresignGetURL() error = %v", err)
+	}
+	if !strings.HasPrefix(url, "http://localhost:9000/test-bucket/uploads/a.txt?") {
+		t.Errorf("PresignGetURL() = %q, want a path-style URL on the custom endpoint", url)
+	}
+	if !strings.Contains(url, "X-Amz-Credential=minioadmin") {
+		t.Errorf("PresignGetURL() = %q, want it signed with the static credentials", url)
+	}
+}
+
+func TestNewS3Client_InvalidOptions(t *testing.T) {
+	t.Setenv("S3_BUCKET_NAME", "test-bucket")
+
+	tests := []struct {
+		name string
+		opt  Option
+	}{
+		{"endpoint without scheme", WithEndpoint("localhost:9000", true)},
+		{"endpoint with bad scheme", WithEndpoint("ftp://localhost", false)},
+		{"missing CA bundle", WithCABundle("/nonexistent/ca.pem")},
+		{"access key without secret", WithStaticCredentials("AKIA", "", "")},
+		{"unknown retry mode", WithRetryPolicy("aggressive", 3)},
+		{"negative max attempts", WithRetryPolicy("standard", -1)},
+		{"empty bucket name", WithBucket("", "us-east-1")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewS3Client(tt.opt); err == nil {
+				t.Error("NewS3Client() succeeded, want an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package s3
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// recordingS3API captures the inputs S3Client sends to S3
+type recordingS3API struct {
+	put     *s3.PutObjectInput
+	get     *s3.GetObjectInput
+	head    *s3.HeadObjectInput
+	presign *s3.GetObjectInput
+	create  *s3.CreateMultipartUploadInput
+	part    *s3.UploadPartInput
+}
+
+func (r *recordingS3API) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	r.put = params
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (r *recordingS3API) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	r.get = params
+	return &s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader("data"))}, nil
+}
+
+func (r *recordingS3API) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	r.head = params
+	return &s3.HeadObjectOutput{ContentLength: aws.Int64(4)}, nil
+}
+
+func (r *recordingS3API) DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func (r *recordingS3API) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	return &s3.ListObjectsV2Output{}, nil
+}
+
+func (r *recordingS3API) CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	r.create = params
+	return &s3.CreateMultipartUploadOutput{UploadId: aws.String("upload-1")}, nil
+}
+
+func (r *recordingS3API) UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	r.part = params
+	return &s3.UploadPartOutput{ETag: aws.String("etag")}, nil
+}
+
+func (r *recordingS3API) CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	return &s3.CompleteMultipartUploadOutput{}, nil
+}
+
+func (r *recordingS3API) AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+func (r *recordingS3API) HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error) {
+	return &s3.HeadBucketOutput{}, nil
+}
+
+func (r *recordingS3API) PresignGetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.PresignOptions)) (*v4.PresignedHTTPRequest, error) {
+	r.presign = params
+	return &v4.PresignedHTTPRequest{URL: "https://test-bucket.s3.amazonaws.com/" + aws.ToString(params.Key), Method: http.MethodGet}, nil
+}
+
+// exerciseClient runs every read and write path through a recording client
+func exerciseClient(t *testing.T, cfg EncryptionConfig) (*recordingS3API, error) {
+	t.Helper()
+	api := &recordingS3API{}
+	client := &S3Client{client: api, presigner: api, bucketName: "test-bucket", region: "us-east-1", encryption: cfg}
+	ctx := context.Background()
+
+	if err := client.UploadFile(ctx, "k", strings.NewReader("data"), "text/plain"); err != nil {
+		t.Fatalf("UploadFile() error = %v", err)
+	}
+	if _, err := client.StatFile(ctx, "k"); err != nil {
+		t.Fatalf("StatFile() error = %v", err)
+	}
+	body, err := client.GetFile(ctx, "k", nil)
+	if err != nil {
+		t.Fatalf("GetFile() error = %v", err)
+	}
+	body.Close()
+	_, err = client.PresignGetURL(ctx, "k", time.Minute)
+	return api, err
+}
+
+func TestS3Client_Encryption_SSES3(t *testing.T) {
+	api, err := exerciseClient(t, EncryptionConfig{Mode: EncryptionSSES3})
+	if err != nil {
+		t.Fatalf("PresignGetURL() error = %v", err)
+	}
+	if api.put.ServerSideEncryption != types.ServerSideEncryptionAes256 {
+		t.Errorf("PutObject ServerSideEncryption = %q", api.put.ServerSideEncryption)
+	}
+	if api.get.SSECustomerKey != nil || api.head.SSECustomerKey != nil {
+		t.Error("SSE-S3 reads must not send customer key headers")
+	}
+}
+
+func TestS3Client_Encryption_KMS(t *testing.T) {
+	api, err := exerciseClient(t, EncryptionConfig{Mode: EncryptionKMS, KMSKeyID: "alias/uploads", BucketKey: true})
+	if err != nil {
+		t.Fatalf("PresignGetURL() error = %v", err)
+	}
+	if api.put.ServerSideEncryption != types.ServerSideEncryptionAwsKms {
+		t.Errorf("PutObject ServerSideEncryption = %q", api.put.ServerSideEncryption)
+	}
+	if aws.ToString(api.put.SSEKMSKeyId) != "alias/uploads" || !aws.ToBool(api.put.BucketKeyEnabled) {
+		t.Errorf("PutObject KMS settings = %v, %v", aws.ToString(api.put.SSEKMSKeyId), aws.ToBool(api.put.BucketKeyEnabled))
+	}
+	if api.presign == nil {
+		t.Error("Expected a presigned URL for SSE-KMS")
+	}
+}
+
+func TestS3Client_Encryption_SSEC(t *testing.T) {
+	key := make([]byte, 32)
+	for i := range key {
+		key[i] = byte(i)
+	}
+	api, err := exerciseClient(t, EncryptionConfig{Mode: EncryptionSSEC, CustomerKey: key})
+	if !errors.Is(err, ErrPresignUnsupported) {
+		t.Errorf("PresignGetURL() error = %v, want ErrPresignUnsupported", err)
+	}
+
+	wantKey := base64.StdEncoding.EncodeToString(key)
+	for name, got := range map[string]*string{
+		"PutObject":  api.put.SSECustomerKey,
+		"GetObject":  api.get.SSECustomerKey,
+		"HeadObject": api.head.SSECustomerKey,
+	} {
+		if aws.ToString(got) != wantKey {
+			t.Errorf("%s SSECustomerKey = %q, want %q", name, aws.ToString(got), wantKey)
+		}
+	}
+	if aws.ToString(api.get.SSECustomerAlgorithm) != "AES256" || api.head.SSECustomerKeyMD5 == nil {
+		t.Error("Expected SSE-C algorithm and key MD5 on reads")
+	}
+}
+
+func TestS3Client_Encryption_Multipart(t *testing.T) {
+	key := make([]byte, 32)
+	api := &recordingS3API{}
+	client := &S3Client{client: api, bucketName: "test-bucket", encryption: EncryptionConfig{Mode: EncryptionSSEC, CustomerKey: key}, partSize: 2}
+
+	if err := client.UploadFile(context.Background(), "k", strings.NewReader("data!"), "text/plain"); err != nil {
+		t.Fatalf("UploadFile() error = %v", err)
+	}
+	if api.put != nil || api.create == nil {
+		t.Fatal("Expected a multipart upload for a file larger than one part")
+	}
+	wantKey := base64.StdEncoding.EncodeToString(key)
+	if aws.ToString(api.create.SSECustomerKey) != wantKey || aws.ToString(api.part.SSECustomerKey) != wantKey {
+		t.Error("SSE-C multipart uploads must send the customer key when created and with every part")
+	}
+	if aws.ToInt32(api.part.PartNumber) != 3 {
+		t.Errorf("last part number = %d, want 3", aws.ToInt32(api.part.PartNumber))
+	}
+}
+
+func TestNewEncryptionConfig(t *testing.T) {
+	validKey := base64.StdEncoding.EncodeToString(make([]byte, 32))
+
+	tests := []struct {
+		name      string
+		mode      string
+		kmsKeyID  string
+		bucketKey bool
+		key       string
+		wantMode  string
+		wantError bool
+	}{
+		{"disabled", "", "", false, "", EncryptionNone, false},
+		{"sse-s3 alias", "AES256", "", false, "", EncryptionSSES3, false},
+		{"kms with key", "sse-kms", "arn:aws:kms:key", true, "", EncryptionKMS, false},
+		{"sse-c", "SSE-C", "", false, validKey, EncryptionSSEC, false},
+		{"sse-c short key", "SSE-C", "", false, base64.StdEncoding.EncodeToString([]byte("short")), "", true},
+		{"sse-c bad base64", "SSE-C", "", false, "not base64!", "", true},
+		{"kms key without kms", "SSE-S3", "arn:aws:kms:key", false, "", "", true},
+		{"unknown mode", "rot13", "", false, "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := NewEncryptionConfig(tt.mode, tt.kmsKeyID, tt.bucketKey, tt.key)
+			if (err != nil) != tt.wantError {
+				t.Fatalf("NewEncryptionConfig() error = %v, wantError %v", err, tt.wantError)
+			}
+			if !tt.wantError && cfg.Mode != tt.wantMode {
+				t.Errorf("Mode = %q, want %q", cfg.Mode, tt.wantMode)
+			}
+		})
+	}
+}
@@ -0,0 +1,348 @@
+package s3_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/s3"
+	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/s3/s3test"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+const fakeBucket = "fake-bucket"
+
+// newFakeClient returns a real S3Client talking to an in-process fake S3 server
+func newFakeClient(t *testing.T, opts ...s3.Option) (s3.S3ClientIface, *s3test.Server) {
+	t.Helper()
+	srv := s3test.NewServer(fakeBucket)
+	t.Cleanup(srv.Close)
+
+	opts = append(opts,
+		s3.WithBucket(fakeBucket, s3test.DefaultRegion),
+		s3.WithEndpoint(srv.URL, true),
+		s3.WithStaticCredentials(srv.AccessKeyID, srv.SecretAccessKey, ""),
+	)
+	client, err := s3.NewS3Client(opts...)
+	if err != nil {
+		t.Fatalf("NewS3Client() error = %v", err)
+	}
+	return client, srv
+}
+
+func TestS3Client_FakeServer_RoundTrip(t *testing.T) {
+	client, srv := newFakeClient(t)
+	ctx := context.Background()
+	key := "uploads/u1/1700000000_quarterly report.txt"
+
+	err := client.UploadFileWithMetadata(ctx, key, strings.NewReader("0123456789"), "text/plain", map[string]string{"owner": "u1"})
+	if err != nil {
+		t.Fatalf("UploadFileWithMetadata() error = %v", err)
+	}
+	if obj, ok := srv.Object(fakeBucket, key); !ok || string(obj.Data) != "0123456789" {
+		t.Fatalf("stored object = %+v", obj)
+	}
+
+	info, err := client.StatFile(ctx, key)
+	if err != nil {
+		t.Fatalf("StatFile() error = %v", err)
+	}
+	if info.Size != 10 || info.ContentType != "text/plain" || info.Metadata["owner"] != "u1" || info.ETag == "" {
+		t.Errorf("StatFile() = %+v", info)
+	}
+
+	body, err := client.GetFile(ctx, key, &s3.ByteRange{Start: 3, End: 5})
+	if err != nil {
+		t.Fatalf("GetFile() error = %v", err)
+	}
+	got, _ := io.ReadAll(body)
+	body.Close()
+	if string(got) != "345" {
+		t.Errorf("GetFile(range) = %q, want %q", got, "345")
+	}
+
+	if err := client.DeleteFile(ctx, key); err != nil {
+		t.Fatalf("DeleteFile() error = %v", err)
+	}
+	if _, err := client.StatFile(ctx, key); !errors.Is(err, s3.ErrNotFound) {
+		t.Errorf("StatFile() after delete error = %v, want ErrNotFound", err)
+	}
+	if _, err := client.GetFile(ctx, key, nil); !errors.Is(err, s3.ErrNotFound) {
+		t.Errorf("GetFile() after delete error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestS3Client_FakeServer_ListFilesPaginates(t *testing.T) {
+	client, srv := newFakeClient(t)
+	for i := 0; i < 1005; i++ {
+		srv.PutObject(fakeBucket, fmt.Sprintf("uploads/u1/%04d.txt", i), []byte("x"), "text/plain")
+	}
+	srv.PutObject(fakeBucket, "uploads/u2/other.txt", []byte("x"), "text/plain")
+
+	files, err := client.ListFiles(context.Background(), "uploads/u1/")
+	if err != nil {
+		t.Fatalf("ListFiles() error = %v", err)
+	}
+	if len(files) != 1005 || files[1004] != "uploads/u1/1004.txt" {
+		t.Errorf("ListFiles() returned %d keys, want all 1005", len(files))
+	}
+}
+
+func TestS3Client_FakeServer_PresignedURL(t *testing.T) {
+	client, _ := newFakeClient(t)
+	ctx := context.Background()
+	if err := client.UploadFile(ctx, "shared/a b.txt", strings.NewReader("shared content"), "text/plain"); err != nil {
+		t.Fatalf("UploadFile() error = %v", err)
+	}
+
+	url, err := client.PresignGetURL(ctx, "shared/a b.txt", time.Minute)
+	if err != nil {
+		t.Fatalf("PresignGetURL() error = %v", err)
+	}
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET presigned URL error = %v", err)
+	}
+	defer resp.Body.Close()
+	got, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(got) != "shared content" {
+		t.Errorf("GET presigned URL = %d %q", resp.StatusCode, got)
+	}
+}
+
+func TestS3Client_FakeServer_Encryption(t *testing.T) {
+	customerKey := bytes.Repeat([]byte{9}, 32)
+	tests := []struct {
+		name   string
+		cfg    s3.EncryptionConfig
+		header string
+	}{
+		{"SSE-S3", s3.EncryptionConfig{Mode: s3.EncryptionSSES3}, "X-Amz-Server-Side-Encryption"},
+		{"SSE-KMS", s3.EncryptionConfig{Mode: s3.EncryptionKMS, KMSKeyID: "alias/uploads"}, "X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id"},
+		{"SSE-C", s3.EncryptionConfig{Mode: s3.EncryptionSSEC, CustomerKey: customerKey}, "X-Amz-Server-Side-Encryption-Customer-Key-Md5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, srv := newFakeClient(t, s3.WithEncryption(tt.cfg))
+			ctx := context.Background()
+			if err := client.UploadFile(ctx, "k", strings.NewReader("secret"), "text/plain"); err != nil {
+				t.Fatalf("UploadFile() error = %v", err)
+			}
+			if obj, _ := srv.Object(fakeBucket, "k"); obj.Encryption.Get(tt.header) == "" {
+				t.Errorf("object stored without %s", tt.header)
+			}
+
+			// The fake rejects reads that send the wrong encryption headers, as S3 does
+			if _, err := client.StatFile(ctx, "k"); err != nil {
+				t.Errorf("StatFile() error = %v", err)
+			}
+			body, err := client.GetFile(ctx, "k", nil)
+			if err != nil {
+				t.Fatalf("GetFile() error = %v", err)
+			}
+			got, _ := io.ReadAll(body)
+			body.Close()
+			if string(got) != "secret" {
+				t.Errorf("GetFile() = %q", got)
+			}
+		})
+	}
+}
+
+func TestS3Client_FakeServer_RetriesServerErrors(t *testing.T) {
+	srv := s3test.NewServer(fakeBucket)
+	t.Cleanup(srv.Close)
+	target, _ := url.Parse(srv.URL)
+	proxy := httputil.NewSingleHostReverseProxy(target)
+
+	// Fail the first two requests with a 500, as S3 occasionally does
+	var requests atomic.Int32
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) <= 2 {
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, "<Error><Code>InternalError</Code><Message>We encountered an internal error.</Message></Error>")
+			return
+		}
+		proxy.ServeHTTP(w, r)
+	}))
+	t.Cleanup(flaky.Close)
+	srv.PutObject(fakeBucket, "k", []byte("data"), "text/plain")
+
+	t.Setenv("S3_BUCKET_NAME", fakeBucket)
+	t.Setenv("AWS_REGION", s3test.DefaultRegion)
+	newClient := func(maxAttempts int) s3.S3ClientIface {
+		client, err := s3.NewS3Client(
+			s3.WithEndpoint(flaky.URL, true),
+			s3.WithStaticCredentials(srv.AccessKeyID, srv.SecretAccessKey, ""),
+			s3.WithRetryPolicy("standard", maxAttempts),
+		)
+		if err != nil {
+			t.Fatalf("NewS3Client() error = %v", err)
+		}
+		return client
+	}
+
+	if _, err := newClient(1).StatFile(context.Background(), "k"); err == nil {
+		t.Fatal("StatFile() with 1 attempt succeeded, want the 500")
+	}
+	if _, err := newClient(3).StatFile(context.Background(), "k"); err != nil {
+		t.Errorf("StatFile() with 3 attempts error = %v, want success after a retry", err)
+	}
+	if got := requests.Load(); got != 3 {
+		t.Errorf("server saw %d requests, want 3", got)
+	}
+}
+
+func TestS3Client_FakeServer_MultipartUpload(t *testing.T) {
+	client, srv := newFakeClient(t, s3.WithPartSize(16))
+	srv.MinPartSize = 16
+	data := strings.Repeat("0123456789", 5)
+
+	if err := client.UploadFileWithMetadata(context.Background(), "big", strings.NewReader(data), "text/plain", map[string]string{"owner": "u1"}); err != nil {
+		t.Fatalf("UploadFileWithMetadata() error = %v", err)
+	}
+	obj, ok := srv.Object(fakeBucket, "big")
+	if !ok || string(obj.Data) != data || obj.ContentType != "text/plain" || obj.Metadata["owner"] != "u1" {
+		t.Fatalf("stored object = %+v", obj)
+	}
+	if n := srv.PendingUploads(); n != 0 {
+		t.Errorf("PendingUploads() = %d after a completed upload", n)
+	}
+}
+
+// stallingReader returns head, then blocks until release is closed before returning tail
+type stallingReader struct {
+	head, tail io.Reader
+	stalled    chan struct{}
+	release    chan struct{}
+	once       sync.Once
+}
+
+func (r *stallingReader) Read(p []byte) (int, error) {
+	if n, err := r.head.Read(p); err != io.EOF {
+		return n, err
+	}
+	r.once.Do(func() {
+		close(r.stalled)
+		<-r.release
+	})
+	return r.tail.Read(p)
+}
+
+func newStallingReader(head, tail string) *stallingReader {
+	return &stallingReader{
+		head:    strings.NewReader(head),
+		tail:    strings.NewReader(tail),
+		stalled: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+}
+
+func TestS3Client_FakeServer_CancelledUploadIsAborted(t *testing.T) {
+	client, srv := newFakeClient(t, s3.WithPartSize(16))
+	srv.MinPartSize = 16
+	ctx, cancel := context.WithCancel(context.Background())
+	body := newStallingReader(strings.Repeat("a", 16), strings.Repeat("b", 16))
+
+	errc := make(chan error, 1)
+	go func() { errc <- client.UploadFile(ctx, "big", body, "text/plain") }()
+	<-body.stalled
+	if n := srv.PendingUploads(); n != 1 {
+		t.Fatalf("PendingUploads() = %d mid-upload, want 1", n)
+	}
+	cancel()
+	close(body.release)
+
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Errorf("UploadFile() error = %v, want context.Canceled", err)
+	}
+	if n := srv.PendingUploads(); n != 0 {
+		t.Errorf("PendingUploads() = %d, want the cancelled upload aborted", n)
+	}
+	if _, ok := srv.Object(fakeBucket, "big"); ok {
+		t.Error("cancelled upload left an object behind")
+	}
+}
+
+func TestS3Client_FakeServer_AbortPendingUploads(t *testing.T) {
+	client, srv := newFakeClient(t, s3.WithPartSize(16))
+	srv.MinPartSize = 16
+	body := newStallingReader(strings.Repeat("a", 16), strings.Repeat("b", 16))
+
+	errc := make(chan error, 1)
+	go func() { errc <- client.UploadFile(context.Background(), "big", body, "text/plain") }()
+	<-body.stalled
+
+	if err := client.(s3.UploadAborter).AbortPendingUploads(context.Background()); err != nil {
+		t.Fatalf("AbortPendingUploads() error = %v", err)
+	}
+	if n := srv.PendingUploads(); n != 0 {
+		t.Errorf("PendingUploads() = %d after AbortPendingUploads", n)
+	}
+	close(body.release)
+	if err := <-errc; err == nil {
+		t.Error("UploadFile() succeeded after its upload was aborted")
+	}
+	if _, ok := srv.Object(fakeBucket, "big"); ok {
+		t.Error("aborted upload left an object behind")
+	}
+}
+
+func TestS3Client_FakeServer_Traced(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	client, _ := newFakeClient(t)
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "upload request")
+	if err := client.UploadFile(ctx, "uploads/u1/traced.txt", strings.NewReader("data"), "text/plain"); err != nil {
+		t.Fatalf("UploadFile() error = %v", err)
+	}
+	parent.End()
+
+	var names []string
+	for _, span := range recorder.Ended() {
+		if span.Parent().SpanID() == parent.SpanContext().SpanID() {
+			names = append(names, span.Name())
+		}
+	}
+	if !strings.Contains(strings.Join(names, ","), "PutObject") {
+		t.Errorf("child spans = %v, want one for PutObject", names)
+	}
+}
+
+func TestS3Client_FakeServer_Ping(t *testing.T) {
+	client, _ := newFakeClient(t)
+	if err := client.(s3.Pinger).Ping(context.Background()); err != nil {
+		t.Errorf("Ping() error = %v", err)
+	}
+
+	t.Setenv("S3_BUCKET_NAME", "missing-bucket")
+	srv := s3test.NewServer(fakeBucket)
+	defer srv.Close()
+	missing, err := s3.NewS3Client(
+		s3.WithEndpoint(srv.URL, true),
+		s3.WithStaticCredentials(srv.AccessKeyID, srv.SecretAccessKey, ""),
+	)
+	if err != nil {
+		t.Fatalf("NewS3Client() error = %v", err)
+	}
+	if err := missing.(s3.Pinger).Ping(context.Background()); err == nil {
+		t.Error("Ping() succeeded for a bucket that does not exist")
+	}
+}
@@ -0,0 +1,17 @@
+package s3test
+
+import (
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Client returns an AWS SDK S3 client configured for the server
+func (s *Server) Client() *s3.Client {
+	return s3.New(s3.Options{
+		Region:       DefaultRegion,
+		BaseEndpoint: aws.String(s.URL),
+		UsePathStyle: true,
+		Credentials:  credentials.NewStaticCredentialsProvider(s.AccessKeyID, s.SecretAccessKey, ""),
+	})
+}
@@ -0,0 +1,65 @@
+package s3test
+
+import (
+	"encoding/xml"
+	"net/http"
+)
+
+const s3Namespace = "http://s3.amazonaws.com/doc/2006-03-01/"
+
+// errorStatus maps the S3 error codes the server returns to their HTTP status
+var errorStatus = map[string]int{
+	"AccessDenied":                      http.StatusForbidden,
+	"AuthorizationHeaderMalformed":      http.StatusBadRequest,
+	"AuthorizationQueryParametersError": http.StatusBadRequest,
+	"BadDigest":                         http.StatusBadRequest,
+	"BucketAlreadyOwnedByYou":           http.StatusConflict,
+	"EntityTooSmall":                    http.StatusBadRequest,
+	"IncompleteBody":                    http.StatusBadRequest,
+	"InvalidAccessKeyId":                http.StatusForbidden,
+	"InvalidArgument":                   http.StatusBadRequest,
+	"InvalidPart":                       http.StatusBadRequest,
+	"InvalidPartOrder":                  http.StatusBadRequest,
+	"InvalidRange":                      http.StatusRequestedRangeNotSatisfiable,
+	"InvalidRequest":                    http.StatusBadRequest,
+	"MalformedXML":                      http.StatusBadRequest,
+	"NoSuchBucket":                      http.StatusNotFound,
+	"NoSuchKey":                         http.StatusNotFound,
+	"NoSuchUpload":                      http.StatusNotFound,
+	"NotImplemented":                    http.StatusNotImplemented,
+	"SignatureDoesNotMatch":             http.StatusForbidden,
+	"XAmzContentSHA256Mismatch":         http.StatusBadRequest,
+}
+
+type errorResponse struct {
+	XMLName  xml.Name `xml:"Error"`
+	Code     string   `xml:"Code"`
+	Message  string   `xml:"Message"`
+	Resource string   `xml:"Resource"`
+}
+
+// writeError writes an S3 error document. HEAD responses carry only the status, as with S3.
+func writeError(w http.ResponseWriter, r *http.Request, code, message string) {
+	status, ok := errorStatus[code]
+	if !ok {
+		status = http.StatusInternalServerError
+	}
+	if r.Method == http.MethodHead {
+		w.WriteHeader(status)
+		return
+	}
+	writeXML(w, status, errorResponse{Code: code, Message: message, Resource: r.URL.Path})
+}
+
+// writeXML writes an XML response document
+func writeXML(w http.ResponseWriter, status int, v any) {
+	body, err := xml.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	w.Write([]byte(xml.Header))
+	w.Write(body)
+}
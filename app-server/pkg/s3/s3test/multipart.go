@@ -0,0 +1,165 @@
+package s3test
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type initiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	UploadID string   `xml:"UploadId"`
+}
+
+type completeMultipartUpload struct {
+	Parts []struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+	} `xml:"Part"`
+}
+
+type completeMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"CompleteMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Location string   `xml:"Location"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	ETag     string   `xml:"ETag"`
+}
+
+func (s *Server) createMultipartUpload(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	if !s.bucketExists(w, r, bucket) {
+		return
+	}
+	upload := &multipartUpload{
+		bucket: bucket,
+		key:    key,
+		object: newObject(nil, r.Header.Get("Content-Type"), requestMetadata(r), requestEncryption(r), s.now()),
+		parts:  make(map[int]*Object),
+	}
+	id := newUploadID()
+
+	s.mu.Lock()
+	s.uploads[id] = upload
+	s.mu.Unlock()
+
+	writeEncryption(w, upload.object)
+	writeXML(w, http.StatusOK, initiateMultipartUploadResult{
+		Xmlns:    s3Namespace,
+		Bucket:   bucket,
+		Key:      key,
+		UploadID: id,
+	})
+}
+
+func (s *Server) uploadPart(w http.ResponseWriter, r *http.Request, sr *signedRequest, bucket, key string) {
+	query := r.URL.Query()
+	partNumber, err := strconv.Atoi(query.Get("partNumber"))
+	if err != nil || partNumber < 1 || partNumber > 10000 {
+		writeError(w, r, "InvalidArgument", "Part number must be an integer between 1 and 10000, inclusive")
+		return
+	}
+	upload, ok := s.upload(w, r, query.Get("uploadId"), bucket, key)
+	if !ok {
+		return
+	}
+	data, ok := readBody(w, r, sr)
+	if !ok {
+		return
+	}
+	part := newObject(data, "", nil, nil, s.now())
+
+	s.mu.Lock()
+	upload.parts[partNumber] = part
+	s.mu.Unlock()
+
+	writeEncryption(w, upload.object)
+	w.Header().Set("ETag", part.ETag)
+}
+
+func (s *Server) completeMultipartUpload(w http.ResponseWriter, r *http.Request, sr *signedRequest, bucket, key string) {
+	id := r.URL.Query().Get("uploadId")
+	upload, ok := s.upload(w, r, id, bucket, key)
+	if !ok {
+		return
+	}
+	body, ok := readBody(w, r, sr)
+	if !ok {
+		return
+	}
+	var req completeMultipartUpload
+	if err := xml.Unmarshal(body, &req); err != nil || len(req.Parts) == 0 {
+		writeError(w, r, "MalformedXML", "The XML you provided was not well-formed or did not validate against our published schema.")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var parts []*Object
+	var data []byte
+	for i, p := range req.Parts {
+		if i > 0 && p.PartNumber <= req.Parts[i-1].PartNumber {
+			writeError(w, r, "InvalidPartOrder", "The list of parts was not in ascending order. Parts must be ordered by part number.")
+			return
+		}
+		part, ok := upload.parts[p.PartNumber]
+		if !ok || strings.Trim(p.ETag, `"`) != strings.Trim(part.ETag, `"`) {
+			writeError(w, r, "InvalidPart", fmt.Sprintf("Part %d could not be found or its ETag did not match.", p.PartNumber))
+			return
+		}
+		if i < len(req.Parts)-1 && int64(len(part.Data)) < s.MinPartSize {
+			writeError(w, r, "EntityTooSmall", "Your proposed upload is smaller than the minimum allowed object size.")
+			return
+		}
+		parts = append(parts, part)
+		data = append(data, part.Data...)
+	}
+
+	objects, exists := s.buckets[bucket]
+	if !exists {
+		writeError(w, r, "NoSuchBucket", "The specified bucket does not exist")
+		return
+	}
+	obj := newObject(data, upload.object.ContentType, upload.object.Metadata, upload.object.Encryption, s.now())
+	obj.ETag = partETag(parts)
+	objects[key] = obj
+	delete(s.uploads, id)
+
+	writeEncryption(w, obj)
+	writeXML(w, http.StatusOK, completeMultipartUploadResult{
+		Xmlns:    s3Namespace,
+		Location: s.URL + "/" + bucket + "/" + key,
+		Bucket:   bucket,
+		Key:      key,
+		ETag:     obj.ETag,
+	})
+}
+
+func (s *Server) abortMultipartUpload(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	id := r.URL.Query().Get("uploadId")
+	if _, ok := s.upload(w, r, id, bucket, key); !ok {
+		return
+	}
+	s.mu.Lock()
+	delete(s.uploads, id)
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// upload returns an in-progress upload for the object or writes NoSuchUpload
+func (s *Server) upload(w http.ResponseWriter, r *http.Request, id, bucket, key string) (*multipartUpload, bool) {
+	s.mu.Lock()
+	upload, ok := s.uploads[id]
+	s.mu.Unlock()
+	if !ok || upload.bucket != bucket || upload.key != key {
+		writeError(w, r, "NoSuchUpload", "The specified upload does not exist. The upload ID may be invalid, or the upload may have been aborted or completed.")
+		return nil, false
+	}
+	return upload, true
+}
@@ -0,0 +1,460 @@
+package s3test
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Server-side encryption headers stored with objects and echoed back like S3 does
+var encryptionHeaders = []string{
+	"X-Amz-Server-Side-Encryption",
+	"X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id",
+	"X-Amz-Server-Side-Encryption-Bucket-Key-Enabled",
+	"X-Amz-Server-Side-Encryption-Customer-Algorithm",
+	"X-Amz-Server-Side-Encryption-Customer-Key-Md5",
+}
+
+const (
+	customerKeyMD5Header = "X-Amz-Server-Side-Encryption-Customer-Key-Md5"
+	listTimeFormat       = "2006-01-02T15:04:05.000Z"
+)
+
+func (s *Server) putObject(w http.ResponseWriter, r *http.Request, sr *signedRequest, bucket, key string) {
+	data, ok := readBody(w, r, sr)
+	if !ok {
+		return
+	}
+	obj := newObject(data, r.Header.Get("Content-Type"), requestMetadata(r), requestEncryption(r), s.now())
+
+	s.mu.Lock()
+	objects, exists := s.buckets[bucket]
+	if exists {
+		objects[key] = obj
+	}
+	s.mu.Unlock()
+	if !exists {
+		writeError(w, r, "NoSuchBucket", "The specified bucket does not exist")
+		return
+	}
+
+	writeEncryption(w, obj)
+	w.Header().Set("ETag", obj.ETag)
+}
+
+func (s *Server) getObject(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	obj, ok := s.lookup(w, r, bucket, key)
+	if !ok {
+		return
+	}
+	if !checkReadEncryption(w, r, obj) {
+		return
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", obj.ContentType)
+	h.Set("ETag", obj.ETag)
+	h.Set("Last-Modified", obj.LastModified.Format(http.TimeFormat))
+	h.Set("Accept-Ranges", "bytes")
+	for k, v := range obj.Metadata {
+		h.Set("X-Amz-Meta-"+k, v)
+	}
+	writeEncryption(w, obj)
+
+	data, status := obj.Data, http.StatusOK
+	if rangeHeader := r.Header.Get("Range"); rangeHeader != "" {
+		start, end, ok := parseRange(rangeHeader, int64(len(obj.Data)))
+		if !ok {
+			h.Set("Content-Range", fmt.Sprintf("bytes */%d", len(obj.Data)))
+			writeError(w, r, "InvalidRange", "The requested range is not satisfiable")
+			return
+		}
+		data, status = obj.Data[start:end+1], http.StatusPartialContent
+		h.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(obj.Data)))
+	}
+
+	h.Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		w.Write(data)
+	}
+}
+
+func (s *Server) deleteObject(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	if !s.bucketExists(w, r, bucket) {
+		return
+	}
+	s.mu.Lock()
+	delete(s.buckets[bucket], key)
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type copyObjectResult struct {
+	XMLName      xml.Name `xml:"CopyObjectResult"`
+	Xmlns        string   `xml:"xmlns,attr"`
+	ETag         string   `xml:"ETag"`
+	LastModified string   `xml:"LastModified"`
+}
+
+func (s *Server) copyObject(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	source, err := url.PathUnescape(r.Header.Get("X-Amz-Copy-Source"))
+	if err != nil {
+		writeError(w, r, "InvalidArgument", "Copy Source must mention the source bucket and key: sourcebucket/sourcekey")
+		return
+	}
+	source, _, _ = strings.Cut(strings.TrimPrefix(source, "/"), "?")
+	srcBucket, srcKey, _ := strings.Cut(source, "/")
+	if srcBucket == "" || srcKey == "" {
+		writeError(w, r, "InvalidArgument", "Copy Source must mention the source bucket and key: sourcebucket/sourcekey")
+		return
+	}
+
+	src, ok := s.lookup(w, r, srcBucket, srcKey)
+	if !ok {
+		return
+	}
+	if !s.bucketExists(w, r, bucket) {
+		return
+	}
+
+	replace := strings.EqualFold(r.Header.Get("X-Amz-Metadata-Directive"), "REPLACE")
+	if srcBucket == bucket && srcKey == key && !replace && r.Header.Get("X-Amz-Server-Side-Encryption") == "" {
+		writeError(w, r, "InvalidRequest", "This copy request is illegal because it is trying to copy an object to itself without changing the object's metadata, storage class, website redirect location or encryption attributes.")
+		return
+	}
+
+	contentType, metadata := src.ContentType, src.Metadata
+	if replace {
+		contentType, metadata = r.Header.Get("Content-Type"), requestMetadata(r)
+	}
+	obj := newObject(src.Data, contentType, metadata, requestEncryption(r), s.now())
+
+	s.mu.Lock()
+	s.buckets[bucket][key] = obj
+	s.mu.Unlock()
+
+	writeEncryption(w, obj)
+	writeXML(w, http.StatusOK, copyObjectResult{
+		Xmlns:        s3Namespace,
+		ETag:         obj.ETag,
+		LastModified: obj.LastModified.Format(listTimeFormat),
+	})
+}
+
+type listBucketResult struct {
+	XMLName               xml.Name       `xml:"ListBucketResult"`
+	Xmlns                 string         `xml:"xmlns,attr"`
+	Name                  string         `xml:"Name"`
+	Prefix                string         `xml:"Prefix"`
+	Delimiter             string         `xml:"Delimiter,omitempty"`
+	MaxKeys               int            `xml:"MaxKeys"`
+	KeyCount              int            `xml:"KeyCount"`
+	IsTruncated           bool           `xml:"IsTruncated"`
+	ContinuationToken     string         `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string         `xml:"NextContinuationToken,omitempty"`
+	StartAfter            string         `xml:"StartAfter,omitempty"`
+	EncodingType          string         `xml:"EncodingType,omitempty"`
+	Contents              []listContents `xml:"Contents"`
+	CommonPrefixes        []listPrefix   `xml:"CommonPrefixes"`
+}
+
+type listContents struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int    `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+type listPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+func (s *Server) listObjectsV2(w http.ResponseWriter, r *http.Request, bucket string) {
+	query := r.URL.Query()
+	result := listBucketResult{
+		Xmlns:             s3Namespace,
+		Name:              bucket,
+		Prefix:            query.Get("prefix"),
+		Delimiter:         query.Get("delimiter"),
+		MaxKeys:           1000,
+		ContinuationToken: query.Get("continuation-token"),
+		StartAfter:        query.Get("start-after"),
+		EncodingType:      query.Get("encoding-type"),
+	}
+	if maxKeys := query.Get("max-keys"); maxKeys != "" {
+		n, err := strconv.Atoi(maxKeys)
+		if err != nil || n < 0 {
+			writeError(w, r, "InvalidArgument", "Provided max-keys not an integer or within integer range")
+			return
+		}
+		result.MaxKeys = min(n, 1000)
+	}
+
+	// Tokens are opaque to clients; this one is the last key or prefix returned
+	marker := result.StartAfter
+	if result.ContinuationToken != "" {
+		decoded, err := base64.RawURLEncoding.DecodeString(result.ContinuationToken)
+		if err != nil {
+			writeError(w, r, "InvalidArgument", "The continuation token provided is incorrect")
+			return
+		}
+		marker = string(decoded)
+	}
+
+	if !s.bucketExists(w, r, bucket) {
+		return
+	}
+	s.mu.Lock()
+	objects := s.buckets[bucket]
+	keys := make([]string, 0, len(objects))
+	for k := range objects {
+		if strings.HasPrefix(k, result.Prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	encode := func(k string) string { return k }
+	if result.EncodingType == "url" {
+		encode = url.QueryEscape
+	}
+
+	last := ""
+	for _, k := range keys {
+		if k <= marker || (strings.HasSuffix(marker, result.Delimiter) && result.Delimiter != "" && strings.HasPrefix(k, marker)) {
+			continue
+		}
+		entry := k
+		if result.Delimiter != "" {
+			if i := strings.Index(k[len(result.Prefix):], result.Delimiter); i >= 0 {
+				entry = k[:len(result.Prefix)+i+len(result.Delimiter)]
+			}
+		}
+		if entry == last {
+			continue // another key under a common prefix already returned
+		}
+		if result.KeyCount == result.MaxKeys {
+			result.IsTruncated = true
+			break
+		}
+		if entry != k {
+			result.CommonPrefixes = append(result.CommonPrefixes, listPrefix{Prefix: encode(entry)})
+		} else {
+			obj := objects[k]
+			result.Contents = append(result.Contents, listContents{
+				Key:          encode(k),
+				LastModified: obj.LastModified.Format(listTimeFormat),
+				ETag:         obj.ETag,
+				Size:         len(obj.Data),
+				StorageClass: "STANDARD",
+			})
+		}
+		result.KeyCount++
+		last = entry
+	}
+	s.mu.Unlock()
+
+	if result.IsTruncated {
+		result.NextContinuationToken = base64.RawURLEncoding.EncodeToString([]byte(last))
+	}
+	writeXML(w, http.StatusOK, result)
+}
+
+// lookup returns an object or writes NoSuchBucket or NoSuchKey
+func (s *Server) lookup(w http.ResponseWriter, r *http.Request, bucket, key string) (*Object, bool) {
+	s.mu.Lock()
+	objects, bucketOK := s.buckets[bucket]
+	obj, keyOK := objects[key]
+	s.mu.Unlock()
+	switch {
+	case !bucketOK:
+		writeError(w, r, "NoSuchBucket", "The specified bucket does not exist")
+		return nil, false
+	case !keyOK:
+		writeError(w, r, "NoSuchKey", "The specified key does not exist.")
+		return nil, false
+	}
+	return obj, true
+}
+
+// readBody reads a request payload, decoding aws-chunked framing and checking
+// the signed payload hash and Content-MD5 the way S3 does
+func readBody(w http.ResponseWriter, r *http.Request, sr *signedRequest) ([]byte, bool) {
+	var body io.Reader = r.Body
+	if strings.HasPrefix(sr.payloadHash, streamingPayload) || strings.Contains(r.Header.Get("Content-Encoding"), "aws-chunked") {
+		body = &chunkedReader{r: bufio.NewReader(r.Body)}
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		writeError(w, r, "IncompleteBody", "You did not provide the number of bytes specified by the Content-Length HTTP header.")
+		return nil, false
+	}
+
+	if len(sr.payloadHash) == sha256.Size*2 {
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != sr.payloadHash {
+			writeError(w, r, "XAmzContentSHA256Mismatch", "The provided 'x-amz-content-sha256' header does not match what was computed.")
+			return nil, false
+		}
+	}
+	if contentMD5 := r.Header.Get("Content-MD5"); contentMD5 != "" {
+		sum := md5.Sum(data)
+		if base64.StdEncoding.EncodeToString(sum[:]) != contentMD5 {
+			writeError(w, r, "BadDigest", "The Content-MD5 you specified did not match what we received.")
+			return nil, false
+		}
+	}
+	return data, true
+}
+
+// chunkedReader decodes the aws-chunked content encoding: hex-size[;chunk-signature=...]\r\n data \r\n,
+// ending with a zero-size chunk optionally followed by trailing checksum headers
+type chunkedReader struct {
+	r         *bufio.Reader
+	remaining int64
+	done      bool
+}
+
+func (c *chunkedReader) Read(p []byte) (int, error) {
+	for c.remaining == 0 {
+		if c.done {
+			return 0, io.EOF
+		}
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return 0, io.ErrUnexpectedEOF
+		}
+		sizeHex, _, _ := strings.Cut(strings.TrimSpace(line), ";")
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid aws-chunked chunk size %q", sizeHex)
+		}
+		if size == 0 {
+			c.done = true // trailers are not needed by the fake
+			continue
+		}
+		c.remaining = size
+	}
+
+	if int64(len(p)) > c.remaining {
+		p = p[:c.remaining]
+	}
+	n, err := c.r.Read(p)
+	c.remaining -= int64(n)
+	if c.remaining == 0 && err == nil {
+		if _, err := c.r.Discard(2); err != nil { // chunk trailing \r\n
+			return n, io.ErrUnexpectedEOF
+		}
+	}
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// requestMetadata collects x-amz-meta-* headers; S3 stores metadata keys in lower case
+func requestMetadata(r *http.Request) map[string]string {
+	metadata := map[string]string{}
+	for name, values := range r.Header {
+		if k, ok := strings.CutPrefix(strings.ToLower(name), "x-amz-meta-"); ok {
+			metadata[k] = strings.Join(values, ",")
+		}
+	}
+	return metadata
+}
+
+// requestEncryption collects the server-side encryption settings of a write
+func requestEncryption(r *http.Request) http.Header {
+	encryption := http.Header{}
+	for _, name := range encryptionHeaders {
+		if v := r.Header.Get(name); v != "" {
+			encryption.Set(name, v)
+		}
+	}
+	return encryption
+}
+
+// writeEncryption echoes an object's encryption settings in a response
+func writeEncryption(w http.ResponseWriter, obj *Object) {
+	for name, values := range obj.Encryption {
+		w.Header()[name] = values
+	}
+}
+
+// checkReadEncryption applies S3's rules for reads: SSE-C objects need the
+// matching customer key, and other objects reject encryption headers
+func checkReadEncryption(w http.ResponseWriter, r *http.Request, obj *Object) bool {
+	wantMD5 := obj.Encryption.Get(customerKeyMD5Header)
+	gotMD5 := r.Header.Get(customerKeyMD5Header)
+	switch {
+	case r.Header.Get("X-Amz-Server-Side-Encryption") != "":
+		writeError(w, r, "InvalidArgument", "x-amz-server-side-encryption header is not supported for this operation.")
+		return false
+	case wantMD5 != "" && gotMD5 == "":
+		writeError(w, r, "InvalidRequest", "The object was stored using a form of Server Side Encryption. The correct parameters must be provided to retrieve the object.")
+		return false
+	case wantMD5 != "" && gotMD5 != wantMD5:
+		writeError(w, r, "AccessDenied", "The calculated MD5 hash of the key did not match the hash that was provided.")
+		return false
+	case wantMD5 == "" && gotMD5 != "":
+		writeError(w, r, "InvalidRequest", "The encryption parameters are not applicable to this object.")
+		return false
+	}
+	return true
+}
+
+// parseRange resolves a single-range "bytes=" header against an object size
+func parseRange(header string, size int64) (int64, int64, bool) {
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return 0, 0, false
+	}
+	startStr, endStr, ok := strings.Cut(spec, "-")
+	if !ok {
+		return 0, 0, false
+	}
+
+	if startStr == "" {
+		n, err := strconv.ParseInt(endStr, 10, 64)
+		if err != nil || n <= 0 || size == 0 {
+			return 0, 0, false
+		}
+		return max(size-n, 0), size - 1, true
+	}
+	start, err := strconv.ParseInt(startStr, 10, 64)
+	if err != nil || start >= size {
+		return 0, 0, false
+	}
+	end := size - 1
+	if endStr != "" {
+		if end, err = strconv.ParseInt(endStr, 10, 64); err != nil || end < start {
+			return 0, 0, false
+		}
+		end = min(end, size-1)
+	}
+	return start, end, true
+}
+
+// partETag formats the ETag of a completed multipart object: the MD5 of the part MD5s and the part count
+func partETag(parts []*Object) string {
+	digests := new(bytes.Buffer)
+	for _, p := range parts {
+		raw, _ := hex.DecodeString(strings.Trim(p.ETag, `"`))
+		digests.Write(raw)
+	}
+	sum := md5.Sum(digests.Bytes())
+	return fmt.Sprintf(`"%s-%d"`, hex.EncodeToString(sum[:]), len(parts))
+}
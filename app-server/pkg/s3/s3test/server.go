@@ -0,0 +1,269 @@
+// Package s3test runs an in-process, S3-compatible HTTP server for hermetic tests.
+//
+// The server speaks enough of the S3 REST API for the real AWS SDK client to
+// run against it: Put, Get (with ranges), Head, Delete, ListObjectsV2 with
+// pagination, copy, multipart uploads and SigV4-signed or presigned requests.
+// Clients must use path-style addressing against Server.URL.
+package s3test
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default credentials and region accepted by a new Server
+const (
+	DefaultAccessKeyID     = "s3test"
+	DefaultSecretAccessKey = "s3test-secret"
+	DefaultRegion          = "us-east-1"
+)
+
+// DefaultMinPartSize is S3's minimum size for every part of a multipart upload but the last
+const DefaultMinPartSize = 5 << 20
+
+// Object is a stored object as seen by tests
+type Object struct {
+	Data         []byte
+	ContentType  string
+	ETag         string
+	LastModified time.Time
+	Metadata     map[string]string
+	// Encryption holds the server-side encryption headers the object was written with
+	Encryption http.Header
+}
+
+// clone returns a deep copy so callers cannot change stored state
+func (o *Object) clone() *Object {
+	c := *o
+	c.Data = append([]byte(nil), o.Data...)
+	c.Metadata = make(map[string]string, len(o.Metadata))
+	for k, v := range o.Metadata {
+		c.Metadata[k] = v
+	}
+	c.Encryption = o.Encryption.Clone()
+	return &c
+}
+
+// multipartUpload is an upload between CreateMultipartUpload and Complete or Abort
+type multipartUpload struct {
+	bucket string
+	key    string
+	object *Object // content type, metadata and encryption of the final object
+	parts  map[int]*Object
+}
+
+// Server is a fake S3 endpoint backed by memory
+type Server struct {
+	// URL is the endpoint to configure clients with, e.g. http://127.0.0.1:PORT
+	URL string
+
+	// Credentials requests must be signed with
+	AccessKeyID     string
+	SecretAccessKey string
+
+	// MinPartSize is enforced on all but the last part of multipart uploads
+	MinPartSize int64
+
+	// Now is the clock used to check presigned URL expiry
+	Now func() time.Time
+
+	httpServer *httptest.Server
+
+	mu      sync.Mutex
+	buckets map[string]map[string]*Object
+	uploads map[string]*multipartUpload
+}
+
+// NewServer starts a server with the given buckets. Close it when done.
+func NewServer(buckets ...string) *Server {
+	s := &Server{
+		AccessKeyID:     DefaultAccessKeyID,
+		SecretAccessKey: DefaultSecretAccessKey,
+		MinPartSize:     DefaultMinPartSize,
+		Now:             time.Now,
+		buckets:         make(map[string]map[string]*Object),
+		uploads:         make(map[string]*multipartUpload),
+	}
+	for _, b := range buckets {
+		s.CreateBucket(b)
+	}
+	s.httpServer = httptest.NewServer(s)
+	s.URL = s.httpServer.URL
+	return s
+}
+
+// Close shuts the server down
+func (s *Server) Close() {
+	s.httpServer.Close()
+}
+
+// CreateBucket creates an empty bucket if it does not exist
+func (s *Server) CreateBucket(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.buckets[name]; !ok {
+		s.buckets[name] = make(map[string]*Object)
+	}
+}
+
+// PutObject stores an object directly, bypassing HTTP, to seed test data
+func (s *Server) PutObject(bucket, key string, data []byte, contentType string) {
+	s.CreateBucket(bucket)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.buckets[bucket][key] = newObject(data, contentType, nil, nil, s.Now())
+}
+
+// Object returns a copy of a stored object
+func (s *Server) Object(bucket, key string) (*Object, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	obj, ok := s.buckets[bucket][key]
+	if !ok {
+		return nil, false
+	}
+	return obj.clone(), true
+}
+
+// Keys returns the keys of a bucket in lexical order
+func (s *Server) Keys(bucket string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]string, 0, len(s.buckets[bucket]))
+	for k := range s.buckets[bucket] {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// PendingUploads returns the number of multipart uploads neither completed nor aborted
+func (s *Server) PendingUploads() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.uploads)
+}
+
+func (s *Server) now() time.Time {
+	if s.Now == nil {
+		return time.Now()
+	}
+	return s.Now()
+}
+
+// newObject builds an object with an S3-style MD5 ETag
+func newObject(data []byte, contentType string, metadata map[string]string, encryption http.Header, now time.Time) *Object {
+	sum := md5.Sum(data)
+	if contentType == "" {
+		contentType = "binary/octet-stream"
+	}
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+	if encryption == nil {
+		encryption = http.Header{}
+	}
+	return &Object{
+		Data:         data,
+		ContentType:  contentType,
+		ETag:         `"` + hex.EncodeToString(sum[:]) + `"`,
+		LastModified: now.UTC().Truncate(time.Second),
+		Metadata:     metadata,
+		Encryption:   encryption,
+	}
+}
+
+// newUploadID returns a random multipart upload ID
+func newUploadID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// ServeHTTP authenticates a request and dispatches it to the matching S3 operation
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	sr, err := s.verifySignature(r)
+	if err != nil {
+		ae := err.(*authError)
+		writeError(w, r, ae.code, ae.message)
+		return
+	}
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket == "" {
+		writeError(w, r, "NotImplemented", "ListBuckets is not supported.")
+		return
+	}
+
+	if key == "" {
+		s.serveBucket(w, r, bucket)
+		return
+	}
+	s.serveObject(w, r, sr, bucket, key)
+}
+
+func (s *Server) serveBucket(w http.ResponseWriter, r *http.Request, bucket string) {
+	query := r.URL.Query()
+	switch {
+	case r.Method == http.MethodPut:
+		s.mu.Lock()
+		_, exists := s.buckets[bucket]
+		s.mu.Unlock()
+		if exists {
+			writeError(w, r, "BucketAlreadyOwnedByYou", "Your previous request to create the named bucket succeeded and you already own it.")
+			return
+		}
+		s.CreateBucket(bucket)
+		w.Header().Set("Location", "/"+bucket)
+	case r.Method == http.MethodHead:
+		if !s.bucketExists(w, r, bucket) {
+			return
+		}
+	case r.Method == http.MethodGet && query.Get("list-type") == "2":
+		s.listObjectsV2(w, r, bucket)
+	default:
+		writeError(w, r, "NotImplemented", "This bucket operation is not supported.")
+	}
+}
+
+func (s *Server) serveObject(w http.ResponseWriter, r *http.Request, sr *signedRequest, bucket, key string) {
+	query := r.URL.Query()
+	switch {
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		s.createMultipartUpload(w, r, bucket, key)
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		s.uploadPart(w, r, sr, bucket, key)
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		s.completeMultipartUpload(w, r, sr, bucket, key)
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		s.abortMultipartUpload(w, r, bucket, key)
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		s.copyObject(w, r, bucket, key)
+	case r.Method == http.MethodPut:
+		s.putObject(w, r, sr, bucket, key)
+	case r.Method == http.MethodGet, r.Method == http.MethodHead:
+		s.getObject(w, r, bucket, key)
+	case r.Method == http.MethodDelete:
+		s.deleteObject(w, r, bucket, key)
+	default:
+		writeError(w, r, "NotImplemented", "This object operation is not supported.")
+	}
+}
+
+// bucketExists writes NoSuchBucket and returns false if the bucket is missing
+func (s *Server) bucketExists(w http.ResponseWriter, r *http.Request, bucket string) bool {
+	s.mu.Lock()
+	_, ok := s.buckets[bucket]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, r, "NoSuchBucket", "The specified bucket does not exist")
+	}
+	return ok
+}
@@ -0,0 +1,367 @@
+package s3test
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const testBucket = "test-bucket"
+
+func TestServer_PutGetHeadDelete(t *testing.T) {
+	srv := NewServer(testBucket)
+	defer srv.Close()
+	client := srv.Client()
+	ctx := context.Background()
+	key := "uploads/u1/1700000000_my report (final).txt"
+
+	_, err := client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(testBucket),
+		Key:         aws.String(key),
+		Body:        strings.NewReader("hello, fake s3"),
+		ContentType: aws.String("text/plain"),
+		Metadata:    map[string]string{"Owner": "u1"},
+	})
+	if err != nil {
+		t.Fatalf("PutObject() error = %v", err)
+	}
+
+	head, err := client.HeadObject(ctx, &s3.HeadObjectInput{Bucket: aws.String(testBucket), Key: aws.String(key)})
+	if err != nil {
+		t.Fatalf("HeadObject() error = %v", err)
+	}
+	if aws.ToInt64(head.ContentLength) != 14 || aws.ToString(head.ContentType) != "text/plain" || head.Metadata["owner"] != "u1" {
+		t.Errorf("HeadObject() = length %d, type %q, metadata %v", aws.ToInt64(head.ContentLength), aws.ToString(head.ContentType), head.Metadata)
+	}
+
+	get, err := client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(testBucket), Key: aws.String(key), Range: aws.String("bytes=7-10")})
+	if err != nil {
+		t.Fatalf("GetObject() error = %v", err)
+	}
+	body, _ := io.ReadAll(get.Body)
+	get.Body.Close()
+	if string(body) != "fake" || aws.ToString(get.ContentRange) != "bytes 7-10/14" {
+		t.Errorf("GetObject(range) = %q, Content-Range %q", body, aws.ToString(get.ContentRange))
+	}
+
+	if _, err := client.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: aws.String(testBucket), Key: aws.String(key)}); err != nil {
+		t.Fatalf("DeleteObject() error = %v", err)
+	}
+	_, err = client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(testBucket), Key: aws.String(key)})
+	var noSuchKey *types.NoSuchKey
+	if !errors.As(err, &noSuchKey) {
+		t.Errorf("GetObject() after delete error = %v, want NoSuchKey", err)
+	}
+}
+
+func TestServer_ListObjectsV2Pagination(t *testing.T) {
+	srv := NewServer(testBucket)
+	defer srv.Close()
+	var want []string
+	for i := 0; i < 25; i++ {
+		key := fmt.Sprintf("uploads/u1/%03d.txt", i)
+		srv.PutObject(testBucket, key, []byte("x"), "text/plain")
+		want = append(want, key)
+	}
+	srv.PutObject(testBucket, "uploads/u2/other.txt", []byte("x"), "text/plain")
+
+	paginator := s3.NewListObjectsV2Paginator(srv.Client(), &s3.ListObjectsV2Input{
+		Bucket:  aws.String(testBucket),
+		Prefix:  aws.String("uploads/u1/"),
+		MaxKeys: aws.Int32(10),
+	})
+	var got []string
+	pages := 0
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.Background())
+		if err != nil {
+			t.Fatalf("NextPage() error = %v", err)
+		}
+		pages++
+		for _, obj := range page.Contents {
+			got = append(got, aws.ToString(obj.Key))
+		}
+	}
+	if pages != 3 || !reflect.DeepEqual(got, want) {
+		t.Errorf("listed %d keys over %d pages, want %d keys over 3 pages", len(got), pages, len(want))
+	}
+}
+
+func TestServer_ListObjectsV2Delimiter(t *testing.T) {
+	srv := NewServer(testBucket)
+	defer srv.Close()
+	for _, key := range []string{"uploads/u1/a", "uploads/u1/b", "uploads/u2/c", "uploads/readme"} {
+		srv.PutObject(testBucket, key, []byte("x"), "")
+	}
+
+	out, err := srv.Client().ListObjectsV2(context.Background(), &s3.ListObjectsV2Input{
+		Bucket:    aws.String(testBucket),
+		Prefix:    aws.String("uploads/"),
+		Delimiter: aws.String("/"),
+	})
+	if err != nil {
+		t.Fatalf("ListObjectsV2() error = %v", err)
+	}
+	var prefixes []string
+	for _, p := range out.CommonPrefixes {
+		prefixes = append(prefixes, aws.ToString(p.Prefix))
+	}
+	if !reflect.DeepEqual(prefixes, []string{"uploads/u1/", "uploads/u2/"}) || len(out.Contents) != 1 {
+		t.Errorf("ListObjectsV2() prefixes = %v, %d objects", prefixes, len(out.Contents))
+	}
+}
+
+func TestServer_CopyObject(t *testing.T) {
+	srv := NewServer(testBucket)
+	defer srv.Close()
+	srv.PutObject(testBucket, "src/a b.txt", []byte("copy me"), "text/plain")
+	client := srv.Client()
+	ctx := context.Background()
+
+	_, err := client.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:     aws.String(testBucket),
+		Key:        aws.String("dst/copy.txt"),
+		CopySource: aws.String(testBucket + "/src/a%20b.txt"),
+	})
+	if err != nil {
+		t.Fatalf("CopyObject() error = %v", err)
+	}
+	obj, ok := srv.Object(testBucket, "dst/copy.txt")
+	if !ok || string(obj.Data) != "copy me" || obj.ContentType != "text/plain" {
+		t.Errorf("copied object = %+v", obj)
+	}
+
+	_, err = client.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:     aws.String(testBucket),
+		Key:        aws.String("dst/copy.txt"),
+		CopySource: aws.String(testBucket + "/dst/copy.txt"),
+	})
+	if err == nil {
+		t.Error("CopyObject() onto itself without changes succeeded, want InvalidRequest")
+	}
+}
+
+func TestServer_MultipartUpload(t *testing.T) {
+	srv := NewServer(testBucket)
+	defer srv.Close()
+	srv.MinPartSize = 16
+	client := srv.Client()
+	ctx := context.Background()
+	key := "uploads/big.bin"
+
+	create, err := client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:      aws.String(testBucket),
+		Key:         aws.String(key),
+		ContentType: aws.String("application/octet-stream"),
+	})
+	if err != nil {
+		t.Fatalf("CreateMultipartUpload() error = %v", err)
+	}
+
+	chunks := [][]byte{bytes.Repeat([]byte("a"), 16), bytes.Repeat([]byte("b"), 16), []byte("tail")}
+	var completed []types.CompletedPart
+	for i, chunk := range chunks {
+		part, err := client.UploadPart(ctx, &s3.UploadPartInput{
+			Bucket:     aws.String(testBucket),
+			Key:        aws.String(key),
+			UploadId:   create.UploadId,
+			PartNumber: aws.Int32(int32(i + 1)),
+			Body:       bytes.NewReader(chunk),
+		})
+		if err != nil {
+			t.Fatalf("UploadPart(%d) error = %v", i+1, err)
+		}
+		completed = append(completed, types.CompletedPart{ETag: part.ETag, PartNumber: aws.Int32(int32(i + 1))})
+	}
+	if srv.PendingUploads() != 1 {
+		t.Errorf("PendingUploads() = %d before completion, want 1", srv.PendingUploads())
+	}
+
+	done, err := client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(testBucket),
+		Key:             aws.String(key),
+		UploadId:        create.UploadId,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: completed},
+	})
+	if err != nil {
+		t.Fatalf("CompleteMultipartUpload() error = %v", err)
+	}
+	if !strings.HasSuffix(aws.ToString(done.ETag), `-3"`) {
+		t.Errorf("multipart ETag = %s, want a -3 suffix", aws.ToString(done.ETag))
+	}
+	obj, _ := srv.Object(testBucket, key)
+	if want := bytes.Join(chunks, nil); !bytes.Equal(obj.Data, want) {
+		t.Errorf("assembled object = %q, want %q", obj.Data, want)
+	}
+	if srv.PendingUploads() != 0 {
+		t.Errorf("PendingUploads() = %d after completion, want 0", srv.PendingUploads())
+	}
+}
+
+func TestServer_MultipartAbortAndSmallParts(t *testing.T) {
+	srv := NewServer(testBucket)
+	defer srv.Close()
+	client := srv.Client()
+	ctx := context.Background()
+
+	create, err := client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{Bucket: aws.String(testBucket), Key: aws.String("k")})
+	if err != nil {
+		t.Fatalf("CreateMultipartUpload() error = %v", err)
+	}
+	var parts []types.CompletedPart
+	for i := int32(1); i <= 2; i++ {
+		part, err := client.UploadPart(ctx, &s3.UploadPartInput{
+			Bucket: aws.String(testBucket), Key: aws.String("k"), UploadId: create.UploadId,
+			PartNumber: aws.Int32(i), Body: strings.NewReader("too small"),
+		})
+		if err != nil {
+			t.Fatalf("UploadPart() error = %v", err)
+		}
+		parts = append(parts, types.CompletedPart{ETag: part.ETag, PartNumber: aws.Int32(i)})
+	}
+
+	_, err = client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket: aws.String(testBucket), Key: aws.String("k"), UploadId: create.UploadId,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+	})
+	if err == nil || !strings.Contains(err.Error(), "EntityTooSmall") {
+		t.Errorf("CompleteMultipartUpload() error = %v, want EntityTooSmall", err)
+	}
+
+	if _, err := client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{Bucket: aws.String(testBucket), Key: aws.String("k"), UploadId: create.UploadId}); err != nil {
+		t.Fatalf("AbortMultipartUpload() error = %v", err)
+	}
+	if srv.PendingUploads() != 0 {
+		t.Errorf("PendingUploads() = %d after abort, want 0", srv.PendingUploads())
+	}
+	if _, ok := srv.Object(testBucket, "k"); ok {
+		t.Error("aborted upload created an object")
+	}
+}
+
+func TestServer_Presign(t *testing.T) {
+	srv := NewServer(testBucket)
+	defer srv.Close()
+	srv.PutObject(testBucket, "docs/report #1.pdf", []byte("%PDF"), "application/pdf")
+	presigner := s3.NewPresignClient(srv.Client())
+	ctx := context.Background()
+
+	req, err := presigner.PresignGetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(testBucket), Key: aws.String("docs/report #1.pdf")},
+		s3.WithPresignExpires(time.Minute))
+	if err != nil {
+		t.Fatalf("PresignGetObject() error = %v", err)
+	}
+
+	status := func(url string) int {
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Fatalf("GET error = %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if got := status(req.URL); got != http.StatusOK {
+		t.Errorf("presigned GET = %d, want 200", got)
+	}
+	if got := status(strings.Replace(req.URL, "report", "other", 1)); got != http.StatusForbidden {
+		t.Errorf("GET with a changed key = %d, want 403", got)
+	}
+	if got := status(srv.URL + "/" + testBucket + "/docs/report%20%231.pdf"); got != http.StatusForbidden {
+		t.Errorf("anonymous GET = %d, want 403", got)
+	}
+
+	srv.Now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	if got := status(req.URL); got != http.StatusForbidden {
+		t.Errorf("expired presigned GET = %d, want 403", got)
+	}
+}
+
+func TestServer_RejectsWrongCredentials(t *testing.T) {
+	srv := NewServer(testBucket)
+	defer srv.Close()
+
+	client := s3.New(s3.Options{
+		Region:       DefaultRegion,
+		BaseEndpoint: aws.String(srv.URL),
+		UsePathStyle: true,
+		Credentials:  credentials.NewStaticCredentialsProvider(DefaultAccessKeyID, "wrong-secret", ""),
+	})
+	_, err := client.PutObject(context.Background(), &s3.PutObjectInput{
+		Bucket: aws.String(testBucket), Key: aws.String("k"), Body: strings.NewReader("x"),
+	})
+	if err == nil || !strings.Contains(err.Error(), "SignatureDoesNotMatch") {
+		t.Errorf("PutObject() error = %v, want SignatureDoesNotMatch", err)
+	}
+}
+
+func TestServer_CustomerKeyRequiredForReads(t *testing.T) {
+	srv := NewServer(testBucket)
+	defer srv.Close()
+	client := srv.Client()
+	ctx := context.Background()
+
+	key := bytes.Repeat([]byte{7}, 32)
+	sseKey, sseMD5 := customerKey(key)
+	_, err := client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(testBucket), Key: aws.String("secret"), Body: strings.NewReader("x"),
+		SSECustomerAlgorithm: aws.String("AES256"), SSECustomerKey: aws.String(sseKey), SSECustomerKeyMD5: aws.String(sseMD5),
+	})
+	if err != nil {
+		t.Fatalf("PutObject(SSE-C) error = %v", err)
+	}
+
+	if _, err := client.HeadObject(ctx, &s3.HeadObjectInput{Bucket: aws.String(testBucket), Key: aws.String("secret")}); err == nil {
+		t.Error("HeadObject() without the customer key succeeded")
+	}
+	_, err = client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(testBucket), Key: aws.String("secret"),
+		SSECustomerAlgorithm: aws.String("AES256"), SSECustomerKey: aws.String(sseKey), SSECustomerKeyMD5: aws.String(sseMD5),
+	})
+	if err != nil {
+		t.Errorf("HeadObject() with the customer key error = %v", err)
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		header     string
+		start, end int64
+		ok         bool
+	}{
+		{"bytes=0-4", 0, 4, true},
+		{"bytes=5-", 5, 9, true},
+		{"bytes=-3", 7, 9, true},
+		{"bytes=8-100", 8, 9, true},
+		{"bytes=10-", 0, 0, false},
+		{"bytes=4-2", 0, 0, false},
+		{"bytes=0-1,3-4", 0, 0, false},
+		{"items=0-1", 0, 0, false},
+	}
+	for _, tt := range tests {
+		start, end, ok := parseRange(tt.header, 10)
+		if ok != tt.ok || (ok && (start != tt.start || end != tt.end)) {
+			t.Errorf("parseRange(%q) = %d, %d, %v; want %d, %d, %v", tt.header, start, end, ok, tt.start, tt.end, tt.ok)
+		}
+	}
+}
+
+// customerKey returns the base64 SSE-C key and key MD5 headers for a raw key
+func customerKey(key []byte) (string, string) {
+	sum := md5.Sum(key)
+	return base64.StdEncoding.EncodeToString(key), base64.StdEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,225 @@
+package s3test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	sigV4Algorithm   = "AWS4-HMAC-SHA256"
+	sigV4TimeFormat  = "20060102T150405Z"
+	unsignedPayload  = "UNSIGNED-PAYLOAD"
+	streamingPayload = "STREAMING-"
+	maxPresignExpiry = 7 * 24 * time.Hour
+)
+
+// authError is an S3 error caused by a missing or invalid signature
+type authError struct {
+	code    string
+	message string
+}
+
+func (e *authError) Error() string { return e.code + ": " + e.message }
+
+// signedRequest is the parsed signature of a request, from either the
+// Authorization header or presigned URL query parameters
+type signedRequest struct {
+	accessKeyID   string
+	scope         string // date/region/service/aws4_request
+	date          string // yyyymmdd of the scope
+	region        string
+	service       string
+	amzDate       string
+	signedHeaders []string
+	signature     string
+	payloadHash   string
+	presigned     bool
+	expires       time.Duration
+}
+
+// verifySignature checks a request's AWS Signature Version 4 against the server's credentials
+func (s *Server) verifySignature(r *http.Request) (*signedRequest, error) {
+	sr, err := parseSignature(r)
+	if err != nil {
+		return nil, err
+	}
+	if sr.accessKeyID != s.AccessKeyID {
+		return nil, &authError{"InvalidAccessKeyId", "The AWS Access Key Id you provided does not exist in our records."}
+	}
+	if sr.service != "s3" {
+		return nil, &authError{"AuthorizationHeaderMalformed", "The service in the credential scope must be s3."}
+	}
+
+	signedAt, err := time.Parse(sigV4TimeFormat, sr.amzDate)
+	if err != nil || !strings.HasPrefix(sr.amzDate, sr.date) {
+		return nil, &authError{"AccessDenied", "X-Amz-Date is missing or does not match the credential scope."}
+	}
+	if sr.presigned {
+		if sr.expires <= 0 || sr.expires > maxPresignExpiry {
+			return nil, &authError{"AuthorizationQueryParametersError", "X-Amz-Expires must be between 1 second and 7 days."}
+		}
+		if s.now().After(signedAt.Add(sr.expires)) {
+			return nil, &authError{"AccessDenied", "Request has expired"}
+		}
+	}
+
+	canonical := canonicalRequest(r, sr)
+	hash := sha256.Sum256([]byte(canonical))
+	stringToSign := strings.Join([]string{sigV4Algorithm, sr.amzDate, sr.scope, hex.EncodeToString(hash[:])}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretAccessKey), sr.date)
+	key = hmacSHA256(key, sr.region)
+	key = hmacSHA256(key, sr.service)
+	key = hmacSHA256(key, "aws4_request")
+	expected := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	if !hmac.Equal([]byte(expected), []byte(sr.signature)) {
+		return nil, &authError{"SignatureDoesNotMatch", "The request signature we calculated does not match the signature you provided."}
+	}
+	return sr, nil
+}
+
+// parseSignature extracts the signature fields of a header-signed or presigned request
+func parseSignature(r *http.Request) (*signedRequest, error) {
+	query := r.URL.Query()
+	sr := &signedRequest{}
+
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		rest, ok := strings.CutPrefix(auth, sigV4Algorithm+" ")
+		if !ok {
+			return nil, &authError{"AccessDenied", "Only AWS Signature Version 4 is supported."}
+		}
+		fields := map[string]string{}
+		for _, part := range strings.Split(rest, ",") {
+			k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+			fields[k] = v
+		}
+		if err := sr.setCredential(fields["Credential"]); err != nil {
+			return nil, err
+		}
+		sr.signedHeaders = strings.Split(fields["SignedHeaders"], ";")
+		sr.signature = fields["Signature"]
+		sr.amzDate = r.Header.Get("X-Amz-Date")
+		sr.payloadHash = r.Header.Get("X-Amz-Content-Sha256")
+		if sr.payloadHash == "" {
+			return nil, &authError{"InvalidRequest", "Missing required header for this request: x-amz-content-sha256"}
+		}
+		return sr, nil
+	}
+
+	if query.Get("X-Amz-Algorithm") == "" {
+		return nil, &authError{"AccessDenied", "Anonymous access is not allowed."}
+	}
+	if query.Get("X-Amz-Algorithm") != sigV4Algorithm {
+		return nil, &authError{"AuthorizationQueryParametersError", "X-Amz-Algorithm only supports " + sigV4Algorithm}
+	}
+	if err := sr.setCredential(query.Get("X-Amz-Credential")); err != nil {
+		return nil, err
+	}
+	sr.presigned = true
+	sr.signedHeaders = strings.Split(query.Get("X-Amz-SignedHeaders"), ";")
+	sr.signature = query.Get("X-Amz-Signature")
+	sr.amzDate = query.Get("X-Amz-Date")
+	sr.payloadHash = unsignedPayload
+	if hash := query.Get("X-Amz-Content-Sha256"); hash != "" {
+		sr.payloadHash = hash
+	}
+	seconds, err := strconv.Atoi(query.Get("X-Amz-Expires"))
+	if err != nil {
+		return nil, &authError{"AuthorizationQueryParametersError", "X-Amz-Expires must be a number of seconds."}
+	}
+	sr.expires = time.Duration(seconds) * time.Second
+	return sr, nil
+}
+
+// setCredential parses "AKID/yyyymmdd/region/service/aws4_request"
+func (sr *signedRequest) setCredential(credential string) error {
+	parts := strings.Split(credential, "/")
+	if len(parts) != 5 || parts[4] != "aws4_request" {
+		return &authError{"AuthorizationHeaderMalformed", fmt.Sprintf("Malformed credential %q.", credential)}
+	}
+	sr.accessKeyID = parts[0]
+	sr.date, sr.region, sr.service = parts[1], parts[2], parts[3]
+	sr.scope = strings.Join(parts[1:], "/")
+	return nil
+}
+
+// canonicalRequest builds the SigV4 canonical request. S3 signs the path exactly
+// as sent, so the raw request URI is used rather than a re-encoded path.
+func canonicalRequest(r *http.Request, sr *signedRequest) string {
+	rawPath, rawQuery, _ := strings.Cut(r.RequestURI, "?")
+
+	var query []string
+	values, _ := url.ParseQuery(rawQuery)
+	for k, vs := range values {
+		if sr.presigned && k == "X-Amz-Signature" {
+			continue
+		}
+		for _, v := range vs {
+			query = append(query, uriEncode(k)+"="+uriEncode(v))
+		}
+	}
+	sort.Strings(query)
+
+	var headers strings.Builder
+	for _, name := range sr.signedHeaders {
+		headers.WriteString(name)
+		headers.WriteByte(':')
+		headers.WriteString(canonicalHeaderValue(r, name))
+		headers.WriteByte('\n')
+	}
+
+	return strings.Join([]string{
+		r.Method,
+		rawPath,
+		strings.Join(query, "&"),
+		headers.String(),
+		strings.Join(sr.signedHeaders, ";"),
+		sr.payloadHash,
+	}, "\n")
+}
+
+// canonicalHeaderValue returns a header as signed, including the ones net/http moves out of Header
+func canonicalHeaderValue(r *http.Request, name string) string {
+	switch name {
+	case "host":
+		return r.Host
+	case "content-length":
+		return strconv.FormatInt(r.ContentLength, 10)
+	case "transfer-encoding":
+		return strings.Join(r.TransferEncoding, ",")
+	}
+	values := r.Header.Values(name)
+	for i, v := range values {
+		values[i] = strings.Join(strings.Fields(v), " ")
+	}
+	return strings.Join(values, ",")
+}
+
+// uriEncode percent-encodes everything except the RFC 3986 unreserved characters
+func uriEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
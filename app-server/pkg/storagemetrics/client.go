@@ -0,0 +1,134 @@
+// Package storagemetrics records Prometheus metrics for calls to a storage client.
+package storagemetrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/s3"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	factory = promauto.With(metrics.Registry)
+
+	operationDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metrics.Namespace,
+		Name:      "storage_operation_duration_seconds",
+		Help:      "Storage call latency by operation and outcome. Downloads are timed until the body opens.",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 120},
+	}, []string{"operation", "outcome"})
+
+	operationErrors = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Name:      "storage_operation_errors_total",
+		Help:      "Failed storage calls by operation. Missing objects are not counted.",
+	}, []string{"operation"})
+
+	uploadsInFlight = factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: metrics.Namespace,
+		Name:      "storage_uploads_in_flight",
+		Help:      "Uploads currently being written to storage.",
+	})
+)
+
+// Client records metrics for calls to another storage client
+type Client struct {
+	inner s3.S3ClientIface
+}
+
+// NewClient wraps a storage client with metrics
+func NewClient(inner s3.S3ClientIface) *Client {
+	return &Client{inner: inner}
+}
+
+// UploadFile uploads a file, counting it as in flight until it finishes
+func (c *Client) UploadFile(ctx context.Context, key string, file io.Reader, contentType string) error {
+	return c.UploadFileWithMetadata(ctx, key, file, contentType, nil)
+}
+
+// UploadFileWithMetadata uploads a file with metadata, counting it as in flight until it finishes
+func (c *Client) UploadFileWithMetadata(ctx context.Context, key string, file io.Reader, contentType string, metadata map[string]string) error {
+	uploadsInFlight.Inc()
+	defer uploadsInFlight.Dec()
+	return observe("upload", func() error {
+		return c.inner.UploadFileWithMetadata(ctx, key, file, contentType, metadata)
+	})
+}
+
+// GetFileURL makes no network call, so it is not measured
+func (c *Client) GetFileURL(key string) string {
+	return c.inner.GetFileURL(key)
+}
+
+// DeleteFile deletes a file
+func (c *Client) DeleteFile(ctx context.Context, key string) error {
+	return observe("delete", func() error {
+		return c.inner.DeleteFile(ctx, key)
+	})
+}
+
+// ListFiles lists files
+func (c *Client) ListFiles(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	err := observe("list", func() error {
+		var err error
+		keys, err = c.inner.ListFiles(ctx, prefix)
+		return err
+	})
+	return keys, err
+}
+
+// StatFile describes a file
+func (c *Client) StatFile(ctx context.Context, key string) (*s3.FileInfo, error) {
+	var info *s3.FileInfo
+	err := observe("stat", func() error {
+		var err error
+		info, err = c.inner.StatFile(ctx, key)
+		return err
+	})
+	return info, err
+}
+
+// GetFile opens a file
+func (c *Client) GetFile(ctx context.Context, key string, rng *s3.ByteRange) (io.ReadCloser, error) {
+	var body io.ReadCloser
+	err := observe("get", func() error {
+		var err error
+		body, err = c.inner.GetFile(ctx, key, rng)
+		return err
+	})
+	return body, err
+}
+
+// PresignGetURL presigns a download
+func (c *Client) PresignGetURL(ctx context.Context, key string, expires time.Duration) (string, error) {
+	var url string
+	err := observe("presign", func() error {
+		var err error
+		url, err = c.inner.PresignGetURL(ctx, key, expires)
+		return err
+	})
+	return url, err
+}
+
+// observe times fn and records its outcome
+func observe(op string, fn func() error) error {
+	start := time.Now()
+	err := fn()
+	outcome := "ok"
+	switch {
+	case err == nil:
+	case errors.Is(err, s3.ErrNotFound):
+		outcome = "not_found"
+	default:
+		outcome = "error"
+		operationErrors.WithLabelValues(op).Inc()
+	}
+	operationDuration.WithLabelValues(op, outcome).Observe(time.Since(start).Seconds())
+	return err
+}
@@ -0,0 +1,50 @@
+package storagemetrics
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/faultinject"
+	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/localfs"
+	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/s3"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestClient_RecordsOutcomes(t *testing.T) {
+	inner, err := localfs.NewClient(t.TempDir(), "http://localhost:8080", []byte("test-signing-key"))
+	if err != nil {
+		t.Fatalf("localfs.NewClient() error = %v", err)
+	}
+	faulty := faultinject.NewClient(inner, faultinject.Config{Faults: map[faultinject.Op]faultinject.Fault{faultinject.OpList: {ErrorRate: 1}}, Seed: 1})
+	client := NewClient(faulty)
+	ctx := context.Background()
+
+	listErrors := testutil.ToFloat64(operationErrors.WithLabelValues("list"))
+	statErrors := testutil.ToFloat64(operationErrors.WithLabelValues("stat"))
+	uploads := testutil.CollectAndCount(operationDuration)
+
+	if err := client.UploadFile(ctx, "k", strings.NewReader("data"), "text/plain"); err != nil {
+		t.Fatalf("UploadFile() error = %v", err)
+	}
+	if _, err := client.ListFiles(ctx, ""); err == nil {
+		t.Fatal("ListFiles() succeeded despite an injected fault")
+	}
+	if _, err := client.StatFile(ctx, "missing"); !errors.Is(err, s3.ErrNotFound) {
+		t.Fatalf("StatFile() error = %v, want ErrNotFound", err)
+	}
+
+	if got := testutil.ToFloat64(operationErrors.WithLabelValues("list")) - listErrors; got != 1 {
+		t.Errorf("list errors went up by %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(operationErrors.WithLabelValues("stat")) - statErrors; got != 0 {
+		t.Errorf("stat errors went up by %v, want missing objects not counted", got)
+	}
+	if got := testutil.CollectAndCount(operationDuration) - uploads; got != 3 {
+		t.Errorf("%d new latency series, want upload/ok, list/error and stat/not_found", got)
+	}
+	if got := testutil.ToFloat64(uploadsInFlight); got != 0 {
+		t.Errorf("uploads in flight = %v after the upload finished", got)
+	}
+}
@@ -0,0 +1,15 @@
+package webhooks
+
+import (
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// deliveries counts delivery attempts by event type and outcome: delivered,
+// retried or dead
+var deliveries = promauto.With(metrics.Registry).NewCounterVec(prometheus.CounterOpts{
+	Namespace: metrics.Namespace,
+	Name:      "webhook_deliveries_total",
+	Help:      "Webhook delivery attempts by event type and outcome (delivered, retried or dead).",
+}, []string{"event", "outcome"})
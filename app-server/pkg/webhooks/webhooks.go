@@ -0,0 +1,356 @@
+// Package webhooks notifies other systems when files are uploaded, deleted or
+// shared. Each event is POSTed as signed JSON to every configured endpoint;
+// failed deliveries are retried with exponential backoff and kept as dead
+// letters once their attempts run out.
+//
+// Delivery is best-effort: deliveries waiting to be sent or retried are held
+// in memory only, so a crash loses them and they stay pending in the delivery
+// log. A clean shutdown marks those still waiting for a retry as dead.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/models"
+)
+
+// Request headers sent with every delivery
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	EventHeader     = "X-Webhook-Event"
+	IDHeader        = "X-Webhook-ID" // The event ID, the same for every endpoint and attempt
+)
+
+// Delivery statuses
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusDead      = "dead"
+)
+
+// maxBackoff caps the wait between attempts
+const maxBackoff = 10 * time.Minute
+
+// Defaults for Config.Workers and Config.QueueSize
+const (
+	defaultWorkers   = 4
+	defaultQueueSize = 1000
+)
+
+// Config selects the endpoints and how deliveries are retried
+type Config struct {
+	URLs        []string
+	Events      []string // Event types to send; empty sends all
+	Secret      []byte
+	MaxAttempts int
+	Backoff     time.Duration // Wait before the first retry; doubles after each failure
+	Timeout     time.Duration // Per attempt
+	Workers     int           // Attempts made at once; 0 uses 4
+	QueueSize   int           // Deliveries waiting for a worker before new ones are dropped; 0 uses 1000
+}
+
+// DeliveryLog records the progress of each delivery
+type DeliveryLog interface {
+	SaveWebhookDelivery(ctx context.Context, delivery models.WebhookDelivery) error
+}
+
+// NotifierIface sends file events to webhook endpoints
+type NotifierIface interface {
+	// Notify queues the event and returns without waiting for delivery
+	Notify(ctx context.Context, eventType string, file models.FileUpload, share *models.WebhookShare)
+}
+
+// Dispatcher delivers events in the background with a fixed pool of workers.
+// Deliveries wait for a worker in a bounded queue, and a delivery waiting to
+// be retried holds a timer rather than a worker.
+type Dispatcher struct {
+	cfg    Config
+	log    DeliveryLog
+	client *http.Client
+	queue  chan job
+
+	mu      sync.Mutex
+	closed  bool
+	retries map[string]retry // By delivery ID
+	wg      sync.WaitGroup
+}
+
+// job is one delivery to one endpoint
+type job struct {
+	endpoint string
+	delivery models.WebhookDelivery
+	body     []byte
+}
+
+// retry is a job waiting for its backoff to pass
+type retry struct {
+	timer *time.Timer
+	job   job
+}
+
+// NewDispatcher creates a dispatcher for cfg. With no URLs it sends nothing.
+func NewDispatcher(cfg Config, log DeliveryLog) *Dispatcher {
+	if cfg.Workers <= 0 {
+		cfg.Workers = defaultWorkers
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = defaultQueueSize
+	}
+	d := &Dispatcher{
+		cfg: cfg,
+		log: log,
+		client: &http.Client{
+			Timeout: cfg.Timeout,
+			// A redirect could point the signed payload anywhere; treat it as a failure
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		queue:   make(chan job, cfg.QueueSize),
+		retries: make(map[string]retry),
+	}
+	if len(cfg.URLs) > 0 {
+		d.wg.Add(cfg.Workers)
+		for range cfg.Workers {
+			go d.work()
+		}
+	}
+	return d
+}
+
+// Notify sends the event to every endpoint
+func (d *Dispatcher) Notify(ctx context.Context, eventType string, file models.FileUpload, share *models.WebhookShare) {
+	if len(d.cfg.URLs) == 0 || (len(d.cfg.Events) > 0 && !slices.Contains(d.cfg.Events, eventType)) {
+		return
+	}
+
+	event := models.WebhookEvent{ID: newID(), Type: eventType, CreatedAt: time.Now().UTC(), File: file, Share: share}
+	body, err := json.Marshal(event)
+	if err != nil {
+		slog.Error("failed to encode webhook event", "event", eventType, "err", err)
+		return
+	}
+
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		slog.Warn("webhook event dropped during shutdown", "event", eventType, "key", file.S3Key)
+		return
+	}
+	var dropped []models.WebhookDelivery
+	for i, endpoint := range d.cfg.URLs {
+		delivery := models.WebhookDelivery{
+			ID:        fmt.Sprintf("%s-%d", event.ID, i+1),
+			EventID:   event.ID,
+			EventType: eventType,
+			ObjectKey: file.S3Key,
+			Endpoint:  redact(endpoint),
+			Status:    StatusPending,
+			Payload:   string(body),
+			CreatedAt: event.CreatedAt,
+			UpdatedAt: event.CreatedAt,
+		}
+		d.save(delivery)
+		if !d.enqueue(job{endpoint: endpoint, delivery: delivery, body: body}) {
+			dropped = append(dropped, delivery)
+		}
+	}
+	d.mu.Unlock()
+
+	for _, delivery := range dropped {
+		delivery.LastError = "delivery queue full"
+		d.deadLetter(delivery)
+	}
+}
+
+// Close stops retrying and waits until ctx is done for the queued deliveries
+// to be attempted once. Deliveries still waiting for a retry become dead letters.
+func (d *Dispatcher) Close(ctx context.Context) error {
+	var stopped []job
+	d.mu.Lock()
+	if !d.closed {
+		d.closed = true
+		close(d.queue)
+		for id, r := range d.retries {
+			// A timer that already fired finds the dispatcher closed instead
+			if r.timer.Stop() {
+				stopped = append(stopped, r.job)
+			}
+			delete(d.retries, id)
+		}
+	}
+	d.mu.Unlock()
+	for _, j := range stopped {
+		j.delivery.LastError = "shut down before retrying: " + j.delivery.LastError
+		d.deadLetter(j.delivery)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// enqueue hands j to the workers, reporting false if the queue is full. The
+// caller holds d.mu and has checked that the dispatcher is open.
+func (d *Dispatcher) enqueue(j job) bool {
+	select {
+	case d.queue <- j:
+		return true
+	default:
+		return false
+	}
+}
+
+// work makes attempts until Close empties the queue
+func (d *Dispatcher) work() {
+	defer d.wg.Done()
+	for j := range d.queue {
+		d.attempt(j)
+	}
+}
+
+// attempt makes one attempt at a delivery and schedules a retry if it fails
+// with attempts left
+func (d *Dispatcher) attempt(j job) {
+	delivery := &j.delivery
+	delivery.Attempts++
+	status, err := d.send(j.endpoint, *delivery, j.body)
+	delivery.LastStatus = status
+	delivery.UpdatedAt = time.Now().UTC()
+	if err == nil {
+		delivery.Status, delivery.LastError = StatusDelivered, ""
+		deliveries.WithLabelValues(delivery.EventType, "delivered").Inc()
+		d.save(*delivery)
+		return
+	}
+	delivery.LastError = err.Error()
+
+	if delivery.Attempts >= d.cfg.MaxAttempts {
+		d.deadLetter(*delivery)
+		return
+	}
+
+	deliveries.WithLabelValues(delivery.EventType, "retried").Inc()
+	d.save(*delivery)
+
+	wait := backoff(d.cfg.Backoff, delivery.Attempts)
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		delivery.LastError = "shut down before retrying: " + delivery.LastError
+		d.deadLetter(*delivery)
+		return
+	}
+	d.retries[delivery.ID] = retry{timer: time.AfterFunc(wait, func() { d.retry(j) }), job: j}
+	d.mu.Unlock()
+	slog.Warn("webhook delivery failed, retrying", "delivery", delivery.ID, "endpoint", delivery.Endpoint,
+		"attempt", delivery.Attempts, "retry_in", wait, "err", err)
+}
+
+// retry puts a delivery whose backoff has passed back in the queue
+func (d *Dispatcher) retry(j job) {
+	d.mu.Lock()
+	delete(d.retries, j.delivery.ID)
+	reason := ""
+	switch {
+	case d.closed:
+		reason = "shut down before retrying: "
+	case !d.enqueue(j):
+		reason = "delivery queue full: "
+	}
+	d.mu.Unlock()
+	if reason != "" {
+		j.delivery.LastError = reason + j.delivery.LastError
+		d.deadLetter(j.delivery)
+	}
+}
+
+// send makes one attempt and returns the response status, if any
+func (d *Dispatcher) send(endpoint string, delivery models.WebhookDelivery, body []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "go-google-s3-uploader-webhooks")
+	req.Header.Set(EventHeader, delivery.EventType)
+	req.Header.Set(IDHeader, delivery.EventID)
+	req.Header.Set(SignatureHeader, Sign(d.cfg.Secret, time.Now(), body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		// The URL in a *url.Error may carry credentials; keep only the cause
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10)) // Lets the connection be reused
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint responded %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// deadLetter gives up on a delivery. Its payload stays in the delivery log.
+func (d *Dispatcher) deadLetter(delivery models.WebhookDelivery) {
+	delivery.Status = StatusDead
+	deliveries.WithLabelValues(delivery.EventType, "dead").Inc()
+	slog.Error("webhook delivery failed permanently", "delivery", delivery.ID, "endpoint", delivery.Endpoint,
+		"attempts", delivery.Attempts, "err", delivery.LastError)
+	d.save(delivery)
+}
+
+func (d *Dispatcher) save(delivery models.WebhookDelivery) {
+	if err := d.log.SaveWebhookDelivery(context.Background(), delivery); err != nil {
+		slog.Error("failed to record webhook delivery", "delivery", delivery.ID, "err", err)
+	}
+}
+
+// backoff returns the wait after the given failed attempt: base, then
+// doubling up to maxBackoff
+func backoff(base time.Duration, attempt int) time.Duration {
+	wait := base
+	for i := 1; i < attempt && wait < maxBackoff; i++ {
+		wait *= 2
+	}
+	return min(wait, maxBackoff)
+}
+
+// redact drops the query string and credentials, which may hold secrets, from an endpoint URL
+func redact(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "invalid URL"
+	}
+	u.User, u.RawQuery, u.Fragment = nil, "", ""
+	return u.String()
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return "evt_" + hex.EncodeToString(b)
+}
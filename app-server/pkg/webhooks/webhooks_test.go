@@ -0,0 +1,243 @@
+package webhooks_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/metadata"
+	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/webhooks"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/models"
+)
+
+var secret = []byte("test-secret")
+
+// receiver is a local endpoint that answers with the queued statuses, then 204
+type receiver struct {
+	t        *testing.T
+	mu       sync.Mutex
+	statuses []int
+	events   []models.WebhookEvent
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	if err := webhooks.Verify(secret, r.Header.Get(webhooks.SignatureHeader), body, time.Now(), time.Minute); err != nil {
+		rc.t.Errorf("receiver got a bad signature: %v", err)
+	}
+	var event models.WebhookEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		rc.t.Errorf("receiver got an invalid payload: %v", err)
+	}
+	if r.Header.Get(webhooks.EventHeader) != event.Type || r.Header.Get(webhooks.IDHeader) != event.ID {
+		rc.t.Errorf("headers %v do not match event %s %s", r.Header, event.Type, event.ID)
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.events = append(rc.events, event)
+	status := http.StatusNoContent
+	if len(rc.statuses) > 0 {
+		status, rc.statuses = rc.statuses[0], rc.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func newDispatcher(t *testing.T, rc *receiver, events ...string) (*webhooks.Dispatcher, *metadata.MemoryStore) {
+	t.Helper()
+	srv := httptest.NewServer(rc)
+	t.Cleanup(srv.Close)
+	store := metadata.NewMemoryStore()
+	d := webhooks.NewDispatcher(webhooks.Config{
+		URLs:        []string{srv.URL + "/hook?token=abc"},
+		Events:      events,
+		Secret:      secret,
+		MaxAttempts: 3,
+		Backoff:     time.Millisecond,
+		Timeout:     time.Second,
+	}, store)
+	t.Cleanup(func() { d.Close(context.Background()) })
+	return d, store
+}
+
+// settled waits until the only delivery is no longer pending
+func settled(t *testing.T, store *metadata.MemoryStore) models.WebhookDelivery {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		deliveries, _ := store.ListWebhookDeliveries(context.Background(), "", 0)
+		if len(deliveries) == 1 && deliveries[0].Status != webhooks.StatusPending {
+			return deliveries[0]
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("delivery did not settle")
+	return models.WebhookDelivery{}
+}
+
+var file = models.FileUpload{ID: "file_1", Filename: "a.png", Size: 3, ContentType: "image/png", S3Key: "uploads/u1/1_a.png", UserID: "u1"}
+
+func TestDispatcher_Delivers(t *testing.T) {
+	rc := &receiver{t: t}
+	d, store := newDispatcher(t, rc)
+
+	d.Notify(context.Background(), models.WebhookFileShared, file, &models.WebhookShare{MaxDownloads: 2})
+	delivery := settled(t, store)
+	if delivery.Status != webhooks.StatusDelivered || delivery.Attempts != 1 || delivery.LastStatus != http.StatusNoContent {
+		t.Errorf("delivery = %+v, want delivered on the first attempt", delivery)
+	}
+	if !strings.HasSuffix(delivery.Endpoint, "/hook") {
+		t.Errorf("recorded endpoint %q, want it without the query string", delivery.Endpoint)
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if len(rc.events) != 1 || rc.events[0].File != file || rc.events[0].Share.MaxDownloads != 2 {
+		t.Errorf("received %+v, want the file and share", rc.events)
+	}
+}
+
+func TestDispatcher_RetriesThenDelivers(t *testing.T) {
+	rc := &receiver{t: t, statuses: []int{http.StatusInternalServerError, http.StatusBadGateway}}
+	d, store := newDispatcher(t, rc)
+
+	d.Notify(context.Background(), models.WebhookFileUploaded, file, nil)
+	if delivery := settled(t, store); delivery.Status != webhooks.StatusDelivered || delivery.Attempts != 3 {
+		t.Errorf("delivery = %+v, want delivered on the third attempt", delivery)
+	}
+}
+
+func TestDispatcher_DeadLetter(t *testing.T) {
+	rc := &receiver{t: t, statuses: []int{500, 500, 500, 500}}
+	d, store := newDispatcher(t, rc)
+
+	d.Notify(context.Background(), models.WebhookFileDeleted, file, nil)
+	delivery := settled(t, store)
+	if delivery.Status != webhooks.StatusDead || delivery.Attempts != 3 || delivery.LastStatus != 500 || delivery.LastError == "" {
+		t.Errorf("delivery = %+v, want a dead letter after 3 attempts", delivery)
+	}
+	var payload models.WebhookEvent
+	if err := json.Unmarshal([]byte(delivery.Payload), &payload); err != nil || payload.Type != models.WebhookFileDeleted {
+		t.Errorf("dead letter payload = %q, want the event", delivery.Payload)
+	}
+}
+
+func TestDispatcher_EventFilter(t *testing.T) {
+	rc := &receiver{t: t}
+	d, store := newDispatcher(t, rc, models.WebhookFileUploaded)
+
+	d.Notify(context.Background(), models.WebhookFileDeleted, file, nil)
+	if deliveries, _ := store.ListWebhookDeliveries(context.Background(), "", 0); len(deliveries) != 0 {
+		t.Errorf("unsubscribed event created deliveries %+v", deliveries)
+	}
+}
+
+// waitFor polls the delivery log until done accepts it
+func waitFor(t *testing.T, store *metadata.MemoryStore, done func([]models.WebhookDelivery) bool) []models.WebhookDelivery {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		deliveries, _ := store.ListWebhookDeliveries(context.Background(), "", 0)
+		if done(deliveries) {
+			return deliveries
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("deliveries did not reach the expected state")
+	return nil
+}
+
+func countStatus(deliveries []models.WebhookDelivery, status string) int {
+	n := 0
+	for _, d := range deliveries {
+		if d.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+func TestDispatcher_QueueIsBounded(t *testing.T) {
+	arrived, release := make(chan struct{}, 3), make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived <- struct{}{}
+		<-release
+	}))
+	t.Cleanup(srv.Close)
+	store := metadata.NewMemoryStore()
+	d := webhooks.NewDispatcher(webhooks.Config{
+		URLs: []string{srv.URL}, Secret: secret, MaxAttempts: 1, Timeout: 5 * time.Second,
+		Workers: 1, QueueSize: 1,
+	}, store)
+	t.Cleanup(func() { d.Close(context.Background()) })
+
+	// The only worker is busy with the first event, the second waits in the
+	// queue and the third has nowhere to go
+	d.Notify(context.Background(), models.WebhookFileUploaded, file, nil)
+	<-arrived
+	d.Notify(context.Background(), models.WebhookFileUploaded, file, nil)
+	d.Notify(context.Background(), models.WebhookFileUploaded, file, nil)
+	close(release)
+
+	deliveries := waitFor(t, store, func(ds []models.WebhookDelivery) bool {
+		return len(ds) == 3 && countStatus(ds, webhooks.StatusPending) == 0
+	})
+	if delivered, dead := countStatus(deliveries, webhooks.StatusDelivered), countStatus(deliveries, webhooks.StatusDead); delivered != 2 || dead != 1 {
+		t.Fatalf("deliveries = %+v, want 2 delivered and 1 dropped", deliveries)
+	}
+	for _, delivery := range deliveries {
+		if delivery.Status == webhooks.StatusDead && (delivery.Attempts != 0 || delivery.LastError != "delivery queue full") {
+			t.Errorf("dropped delivery = %+v, want it never attempted", delivery)
+		}
+	}
+}
+
+func TestDispatcher_CloseDeadLettersRetries(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(srv.Close)
+	store := metadata.NewMemoryStore()
+	d := webhooks.NewDispatcher(webhooks.Config{
+		URLs: []string{srv.URL}, Secret: secret, MaxAttempts: 3, Backoff: time.Hour, Timeout: time.Second,
+	}, store)
+
+	d.Notify(context.Background(), models.WebhookFileUploaded, file, nil)
+	waitFor(t, store, func(ds []models.WebhookDelivery) bool { return len(ds) == 1 && ds[0].Attempts == 1 })
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := d.Close(ctx); err != nil {
+		t.Fatalf("Close() error = %v, want it not to wait out the backoff", err)
+	}
+	delivery := settled(t, store)
+	if delivery.Status != webhooks.StatusDead || !strings.HasPrefix(delivery.LastError, "shut down before retrying") {
+		t.Errorf("delivery after Close = %+v, want a dead letter", delivery)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Now()
+	body := []byte(`{"id":"evt_1"}`)
+	header := webhooks.Sign(secret, now, body)
+
+	if err := webhooks.Verify(secret, header, body, now, time.Minute); err != nil {
+		t.Errorf("Verify() of a fresh signature error = %v", err)
+	}
+	for name, check := range map[string]func() error{
+		"tampered body": func() error { return webhooks.Verify(secret, header, []byte(`{"id":"evt_2"}`), now, time.Minute) },
+		"wrong secret":  func() error { return webhooks.Verify([]byte("other"), header, body, now, time.Minute) },
+		"replayed":      func() error { return webhooks.Verify(secret, header, body, now.Add(time.Hour), time.Minute) },
+		"malformed":     func() error { return webhooks.Verify(secret, "v1=abc", body, now, time.Minute) },
+	} {
+		if err := check(); err == nil {
+			t.Errorf("Verify() accepted a %s signature", name)
+		}
+	}
+}
@@ -1,33 +1,66 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 
-	"github.com/aruruka/go-google-s3-uploader/auth-server/pkg/config" // This now refers to the package containing LoadEnv and AppConfig
 	"github.com/aruruka/go-google-s3-uploader/auth-server/pkg/handlers"
 	"github.com/aruruka/go-google-s3-uploader/auth-server/pkg/oauth"
 	"github.com/aruruka/go-google-s3-uploader/auth-server/pkg/templates"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/audit"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/config"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/csrf"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/flash"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/health"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/logging"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/metrics"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/ratelimit"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/secheaders"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/server"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/session"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/tracing"
 )
 
 func main() {
+	if handled, err := config.HandleCommand(os.Args[1:], os.Stdout, os.Stderr); handled {
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 	fmt.Println("🔐 Auth Server Starting...")
 
 	// Load application configuration
-	appConfig, err := config.LoadConfig()
+	appConfig, err := config.Load(os.Args[1:])
 	if err != nil {
 		log.Fatalf("Failed to load application configuration: %v", err)
 	}
+	logging.Setup(appConfig.Log.Level)
+	shutdownTracing, err := tracing.Setup(context.Background(), appConfig.Tracing.Exporter, "auth-server")
+	if err != nil {
+		log.Fatalf("Failed to initialize tracing: %v", err)
+	}
 
 	// Initialize OAuth configuration
-	oauthConfig, err := oauth.NewConfig(appConfig)
+	oauthConfig, err := oauth.NewConfig(appConfig.Auth)
 	if err != nil {
 		log.Fatalf("Failed to initialize OAuth config: %v", err)
 	}
+	// Pick up a rotated client secret without a restart. The cookie key is
+	// read once; changing it needs a restart.
+	appConfig.WatchSecret("auth.google_client_secret", oauthConfig.SetClientSecret)
+	go appConfig.RefreshSecrets(context.Background())
 
-	// Initialize template renderer
-	renderer, err := templates.NewTemplateRenderer()
+	// Initialize template renderer, re-reading templates from the checkout
+	// outside production so edits show up without a rebuild
+	var templateOpts []templates.Option
+	if !appConfig.IsProduction() {
+		templateOpts = append(templateOpts, templates.WithLiveReload(".."))
+	}
+	renderer, err := templates.NewTemplateRenderer(templateOpts...)
 	if err != nil {
 		log.Fatalf("Failed to initialize template renderer: %v", err)
 	}
@@ -35,6 +68,17 @@ func main() {
 	// Initialize handlers with dependency injection
 	authHandler := handlers.NewAuthHandler(appConfig, oauthConfig, renderer)
 
+	// Initialize audit log. This server has neither the metadata store nor
+	// storage, so only the file sink applies.
+	auditRecorder, err := audit.Open(audit.Config{
+		Sinks:          config.SplitList(appConfig.Audit.Sinks),
+		File:           appConfig.Audit.File,
+		TrustedProxies: appConfig.Server.TrustedProxies,
+	}, nil, nil)
+	if err != nil {
+		log.Fatalf("Failed to open audit log: %v", err)
+	}
+
 	// Setup routes
 	mux := http.NewServeMux()
 
@@ -45,18 +89,42 @@ func main() {
 	mux.HandleFunc("/auth/callback", authHandler.HandleCallback)
 	mux.HandleFunc("/logout", authHandler.HandleLogout)
 
-	// Health check
+	// Health checks
 	mux.HandleFunc("/health", healthCheck)
+	mux.HandleFunc("/healthz", health.LiveHandler())
+	readiness := health.NewChecker(0, 0)
+	readiness.Register("oidc", oauthConfig.Ping)
+	mux.HandleFunc("/readyz", readiness.ReadyHandler())
+
+	// Prometheus metrics
+	if appConfig.Metrics.Enabled {
+		mux.Handle("/metrics", metrics.Handler(metrics.HandlerConfig{Token: appConfig.Metrics.Token, AllowedNets: appConfig.Metrics.AllowedNets}))
+	}
 
 	// Serve static files
 	fs := http.FileServer(http.Dir("../shared/static/"))
 	mux.Handle("/static/", http.StripPrefix("/static/", fs))
 
 	fmt.Println("✅ Auth Server ready")
-	fmt.Printf("🌐 Visit: http://localhost:%s/login\n", appConfig.PortAuthServer)
+	fmt.Printf("🌐 Visit: http://localhost:%s/login\n", appConfig.Server.AuthPort)
 
 	// Start server
-	log.Fatal(http.ListenAndServe(":"+appConfig.PortAuthServer, mux))
+	rules, err := ratelimit.ParseRules(appConfig.Server.RateLimits)
+	if err != nil {
+		log.Fatalf("Invalid rate limits: %v", err)
+	}
+	limits := ratelimit.Config{Rules: rules, TrustedProxies: appConfig.Server.TrustedProxies}
+	headers := secheaders.Config{HSTSMaxAge: appConfig.Security.HSTSMaxAge, ReportOnly: appConfig.Security.CSPReportOnly}
+	router := flash.Middleware([]byte(appConfig.Server.CookieKey), mux)
+	router = csrf.Middleware(renderer, audit.Middleware(auditRecorder, router))
+	router = session.Middleware([]byte(appConfig.Server.CookieKey), ratelimit.Middleware(ratelimit.NewMemoryStore(), limits, renderer, router))
+	router = secheaders.Middleware(headers, router)
+	srv := server.New(":"+appConfig.Server.AuthPort, tracing.Middleware(logging.Middleware(metrics.Middleware(router))), server.Config{ShutdownTimeout: appConfig.Server.ShutdownTimeout})
+	srv.OnShutdown(auditRecorder.Close)
+	srv.OnShutdown(shutdownTracing)
+	if err := srv.ListenAndServe(); err != nil {
+		log.Fatalf("Server error: %v", err)
+	}
 }
 
 func redirectToLogin(w http.ResponseWriter, r *http.Request) {
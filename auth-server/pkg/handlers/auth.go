@@ -1,19 +1,21 @@
 package handlers
 
 import (
-	"context"
 	"crypto/rand"
 	"encoding/base64"
-	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"time"
 
-	"github.com/aruruka/go-google-s3-uploader/auth-server/pkg/config"
 	"github.com/aruruka/go-google-s3-uploader/auth-server/pkg/oauth"
 	"github.com/aruruka/go-google-s3-uploader/auth-server/pkg/templates"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/audit"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/config"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/flash"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/logging"
 	"github.com/aruruka/go-google-s3-uploader/shared/pkg/models"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/session"
 )
 
 type AuthHandlerIface interface {
@@ -24,12 +26,12 @@ type AuthHandlerIface interface {
 }
 
 type AuthHandler struct {
-	appConfig   *config.AppConfig // Add appConfig
+	appConfig   *config.Config // Add appConfig
 	oauthConfig *oauth.Config
 	renderer    templates.TemplateRendererIface
 }
 
-func NewAuthHandler(appConfig *config.AppConfig, oauthConfig *oauth.Config, renderer templates.TemplateRendererIface) AuthHandlerIface {
+func NewAuthHandler(appConfig *config.Config, oauthConfig *oauth.Config, renderer templates.TemplateRendererIface) AuthHandlerIface {
 	return &AuthHandler{
 		appConfig:   appConfig, // Store appConfig
 		oauthConfig: oauthConfig,
@@ -47,7 +49,7 @@ func (h *AuthHandler) HandleLogin(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	if err := h.renderer.RenderTemplate(w, "login.html", pageData); err != nil {
-		log.Printf("Failed to render login template: %v", err)
+		logging.FromRequest(r).Error("failed to render login template", "err", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
@@ -56,7 +58,7 @@ func (h *AuthHandler) HandleLogin(w http.ResponseWriter, r *http.Request) {
 func (h *AuthHandler) HandleGoogleAuth(w http.ResponseWriter, r *http.Request) {
 	state, err := generateStateToken()
 	if err != nil {
-		log.Printf("Failed to generate state token: %v", err)
+		logging.FromRequest(r).Error("failed to generate state token", "err", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
@@ -68,7 +70,7 @@ func (h *AuthHandler) HandleGoogleAuth(w http.ResponseWriter, r *http.Request) {
 		HttpOnly: true,
 		Secure:   true, // Change back to true for HTTPS
 		SameSite: http.SameSiteLaxMode,
-		Domain:   h.appConfig.ServiceDomain, // Set domain for cross-subdomain cookie
+		Domain:   h.appConfig.Server.ServiceDomain, // Set domain for cross-subdomain cookie
 	})
 
 	authURL := h.oauthConfig.GetAuthURL(state)
@@ -76,18 +78,18 @@ func (h *AuthHandler) HandleGoogleAuth(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *AuthHandler) HandleCallback(w http.ResponseWriter, r *http.Request) {
-	log.Printf("🔍 DEBUG: HandleCallback called with URL: %s", r.URL.String())
-
 	stateCookie, err := r.Cookie("oauth_state")
 	if err != nil {
-		log.Printf("State cookie not found: %v", err)
+		logging.FromRequest(r).Warn("oauth state cookie missing", "err", err)
+		loginFailed(r, "invalid_state")
 		h.renderError(w, "Invalid authentication state", http.StatusBadRequest)
 		return
 	}
 
 	state := r.URL.Query().Get("state")
 	if state != stateCookie.Value {
-		log.Printf("State mismatch: expected %s, got %s", stateCookie.Value, state)
+		logging.FromRequest(r).Warn("oauth state mismatch")
+		loginFailed(r, "invalid_state")
 		h.renderError(w, "Invalid authentication state", http.StatusBadRequest)
 		return
 	}
@@ -100,36 +102,41 @@ func (h *AuthHandler) HandleCallback(w http.ResponseWriter, r *http.Request) {
 	})
 
 	if errMsg := r.URL.Query().Get("error"); errMsg != "" {
-		log.Printf("OAuth error: %s", errMsg)
+		logging.FromRequest(r).Warn("provider returned an error", "error", errMsg)
+		loginFailed(r, "provider_error")
 		h.renderError(w, fmt.Sprintf("Authentication error: %s", errMsg), http.StatusBadRequest)
 		return
 	}
 
 	code := r.URL.Query().Get("code")
 	if code == "" {
-		log.Printf("Authorization code not found")
+		logging.FromRequest(r).Warn("authorization code missing")
+		loginFailed(r, "missing_code")
 		h.renderError(w, "Authorization code not received", http.StatusBadRequest)
 		return
 	}
 
-	ctx := context.Background()
+	ctx := r.Context()
 	token, err := h.oauthConfig.ExchangeCode(ctx, code)
 	if err != nil {
-		log.Printf("Failed to exchange code for token: %v", err)
+		logging.FromRequest(r).Error("failed to exchange authorization code", "err", err)
+		loginFailed(r, "exchange_failed")
 		h.renderError(w, "Failed to exchange authorization code", http.StatusInternalServerError)
 		return
 	}
 
 	rawIDToken, ok := token.Extra("id_token").(string)
 	if !ok {
-		log.Printf("No id_token field in oauth2 token")
+		logging.FromRequest(r).Error("token response has no id_token")
+		loginFailed(r, "invalid_id_token")
 		h.renderError(w, "Invalid token response", http.StatusInternalServerError)
 		return
 	}
 
 	idToken, err := h.oauthConfig.VerifyIDToken(ctx, rawIDToken)
 	if err != nil {
-		log.Printf("Failed to verify ID token: %v", err)
+		logging.FromRequest(r).Error("failed to verify ID token", "err", err)
+		loginFailed(r, "invalid_id_token")
 		h.renderError(w, "Failed to verify token", http.StatusInternalServerError)
 		return
 	}
@@ -142,65 +149,83 @@ func (h *AuthHandler) HandleCallback(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := idToken.Claims(&claims); err != nil {
-		log.Printf("Failed to parse claims: %v", err)
+		logging.FromRequest(r).Error("failed to parse ID token claims", "err", err)
+		loginFailed(r, "invalid_id_token")
 		h.renderError(w, "Failed to parse user information", http.StatusInternalServerError)
 		return
 	}
 
 	user := &models.User{
-		ID:       idToken.Subject,
-		Name:     claims.Name,
-		Email:    claims.Email,
-		Picture:  claims.Picture,
-		Provider: "google",
-		Created:  time.Now(),
+		ID:            idToken.Subject,
+		Name:          claims.Name,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		Picture:       claims.Picture,
+		Provider:      "google",
+		Created:       time.Now(),
 	}
 
-	log.Printf("User authenticated: %s (%s)", user.Name, user.Email)
+	logging.SetUser(r.Context(), user.ID)
 
-	userJSON, _ := json.Marshal(user)
+	value, err := session.Encode([]byte(h.appConfig.Server.CookieKey), user)
+	if err != nil {
+		logging.FromRequest(r).Error("failed to encode session", "err", err)
+		loginFailed(r, "session_error")
+		h.renderError(w, "Failed to start session", http.StatusInternalServerError)
+		return
+	}
 	cookie := &http.Cookie{
-		Name:     "user_session",
-		Value:    base64.StdEncoding.EncodeToString(userJSON),
-		Expires:  time.Now().Add(24 * time.Hour),
-		HttpOnly: false,
+		Name:     session.CookieName,
+		Value:    value,
+		Expires:  user.Created.Add(session.MaxAge),
+		HttpOnly: true,
 		Secure:   true, // Change back to true for HTTPS
 		SameSite: http.SameSiteLaxMode,
 		Path:     "/",
-		Domain:   h.appConfig.ServiceDomain, // Set domain for cross-subdomain cookie
+		Domain:   h.appConfig.Server.ServiceDomain, // Set domain for cross-subdomain cookie
 	}
 
-	log.Printf("🍪 Setting cookie: %s", cookie.String())
 	http.SetCookie(w, cookie)
+	logging.FromRequest(r).Info("user authenticated", "email_verified", user.EmailVerified)
+	loginSucceeded(r, user)
 
-	log.Printf("✅ User authenticated successfully: %s (%s)", user.Name, user.Email)
-	log.Printf("🔄 Redirecting to app-server...")
-
-	// Use appConfig.AppServerURL for redirect
+	// Use appConfig.Server.AppURL for redirect
 	// In App Runner, both services run on same domain, so redirect to root
-	redirectURL := h.appConfig.AppServerURL
-	if h.appConfig.AppServerURL == fmt.Sprintf("https://%s", h.appConfig.ServiceDomain) {
+	redirectURL := h.appConfig.Server.AppURL
+	if h.appConfig.Server.AppURL == fmt.Sprintf("https://%s", h.appConfig.Server.ServiceDomain) {
 		// Same domain scenario (App Runner) - redirect to root path
 		redirectURL = "/"
-		log.Printf("🏠 Redirecting to root path (same domain)")
 	}
 	http.Redirect(w, r, redirectURL, http.StatusTemporaryRedirect)
 }
 
 func (h *AuthHandler) HandleLogout(w http.ResponseWriter, r *http.Request) {
+	audit.Record(r, audit.Logout, nil, "", "")
 	http.SetCookie(w, &http.Cookie{
-		Name:     "user_session",
+		Name:     session.CookieName,
 		Value:    "",
 		Expires:  time.Unix(0, 0),
 		HttpOnly: true,
 	})
 
+	flash.Set(w, flash.Info, "You have been logged out.")
 	http.Redirect(w, r, "/login", http.StatusTemporaryRedirect)
 }
 
-func (h *AuthHandler) renderError(w http.ResponseWriter, message string, statusCode int) {
-	w.WriteHeader(statusCode)
+// loginSucceeded counts and audits a completed sign-in
+func loginSucceeded(r *http.Request, user *models.User) {
+	oauthCallbacks.WithLabelValues("success").Inc()
+	audit.Record(r, audit.LoginSuccess, user, "", "")
+}
+
+// loginFailed counts and audits a failed callback. Nobody is signed in by it,
+// so the event has no actor even if an old session cookie is present.
+func loginFailed(r *http.Request, outcome string) {
+	oauthCallbacks.WithLabelValues(outcome).Inc()
+	audit.RecordAnonymous(r, audit.LoginFailure, "", outcome)
+}
 
+func (h *AuthHandler) renderError(w http.ResponseWriter, message string, statusCode int) {
 	pageData := &models.PageData{
 		Title: "Error",
 		Data: &models.ErrorData{
@@ -210,8 +235,9 @@ func (h *AuthHandler) renderError(w http.ResponseWriter, message string, statusC
 	}
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(statusCode)
 	if err := h.renderer.RenderTemplate(w, "error.html", pageData); err != nil {
-		log.Printf("Failed to render error template: %v", err)
+		slog.Error("failed to render error template", "err", err)
 		http.Error(w, message, statusCode)
 	}
 }
@@ -0,0 +1,281 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aruruka/go-google-s3-uploader/auth-server/pkg/oauth"
+	"github.com/aruruka/go-google-s3-uploader/auth-server/pkg/oauth/oidctest"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/config"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/models"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/session"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// MockTemplateRenderer records the last template rendered
+type MockTemplateRenderer struct {
+	Name string
+	Data interface{}
+}
+
+func (m *MockTemplateRenderer) RenderTemplate(w io.Writer, name string, data interface{}) error {
+	m.Name, m.Data = name, data
+	_, err := w.Write([]byte("mock template output"))
+	return err
+}
+
+const testCallbackURL = "https://auth.example.com/auth/callback"
+
+const testCookieKey = "0123456789abcdef0123456789abcdef"
+
+// newTestAuthHandler wires an AuthHandler to a fake OIDC provider
+func newTestAuthHandler(t *testing.T) (AuthHandlerIface, *MockTemplateRenderer, *oidctest.Provider) {
+	t.Helper()
+	provider := oidctest.NewProvider()
+	t.Cleanup(provider.Close)
+
+	appConfig := &config.Config{
+		Auth: config.AuthConfig{
+			GoogleClientID:     provider.ClientID,
+			GoogleClientSecret: provider.ClientSecret,
+			RedirectURL:        testCallbackURL,
+		},
+		Server: config.ServerConfig{
+			AppURL:        "https://app.example.com",
+			ServiceDomain: "example.com",
+			CookieKey:     testCookieKey,
+		},
+	}
+	oauthConfig, err := oauth.NewConfig(appConfig.Auth, oauth.WithIssuer(provider.URL), oauth.WithHTTPClient(provider.Client()))
+	if err != nil {
+		t.Fatalf("NewConfig() error = %v", err)
+	}
+	renderer := &MockTemplateRenderer{}
+	return NewAuthHandler(appConfig, oauthConfig, renderer), renderer, provider
+}
+
+// startLogin runs /auth/google and the provider's authorize step, returning
+// the state cookie and the callback URL the browser would be sent to
+func startLogin(t *testing.T, h AuthHandlerIface, provider *oidctest.Provider) (*http.Cookie, *url.URL) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.HandleGoogleAuth(rec, httptest.NewRequest(http.MethodGet, "/auth/google", nil))
+	if rec.Code != http.StatusTemporaryRedirect {
+		t.Fatalf("HandleGoogleAuth() status = %d", rec.Code)
+	}
+	var stateCookie *http.Cookie
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == "oauth_state" {
+			stateCookie = c
+		}
+	}
+	if stateCookie == nil {
+		t.Fatal("HandleGoogleAuth() did not set oauth_state cookie")
+	}
+
+	authURL := rec.Header().Get("Location")
+	if !strings.HasPrefix(authURL, provider.URL+"/authorize") {
+		t.Fatalf("auth URL = %q, want provider authorize endpoint", authURL)
+	}
+	client := provider.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatalf("GET authorize error = %v", err)
+	}
+	resp.Body.Close()
+	callback, err := resp.Location()
+	if err != nil {
+		t.Fatalf("authorize response has no redirect: status %d", resp.StatusCode)
+	}
+	return stateCookie, callback
+}
+
+func callback(h AuthHandlerIface, callbackURL *url.URL, stateCookie *http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, callbackURL.String(), nil)
+	if stateCookie != nil {
+		req.AddCookie(&http.Cookie{Name: stateCookie.Name, Value: stateCookie.Value})
+	}
+	rec := httptest.NewRecorder()
+	h.HandleCallback(rec, req)
+	return rec
+}
+
+func errorMessage(t *testing.T, r *MockTemplateRenderer) string {
+	t.Helper()
+	if r.Name != "error.html" {
+		t.Fatalf("rendered template = %q, want error.html", r.Name)
+	}
+	return r.Data.(*models.PageData).Data.(*models.ErrorData).Message
+}
+
+func TestAuthHandler_Login_Success(t *testing.T) {
+	h, _, provider := newTestAuthHandler(t)
+	provider.SetUser("user-42", map[string]any{
+		"email":          "jane@example.com",
+		"email_verified": true,
+		"name":           "Jane Doe",
+		"picture":        "https://example.com/jane.png",
+	})
+
+	stateCookie, callbackURL := startLogin(t, h, provider)
+	rec := callback(h, callbackURL, stateCookie)
+
+	if rec.Code != http.StatusTemporaryRedirect || rec.Header().Get("Location") != "https://app.example.com" {
+		t.Fatalf("HandleCallback() = %d -> %q, want 307 to app server", rec.Code, rec.Header().Get("Location"))
+	}
+	var cookie *http.Cookie
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == session.CookieName {
+			cookie = c
+		}
+	}
+	if cookie == nil {
+		t.Fatal("HandleCallback() did not set user_session cookie")
+	}
+	if !cookie.HttpOnly {
+		t.Error("user_session is readable from scripts")
+	}
+	user, ok := session.Decode([]byte(testCookieKey), cookie.Value, time.Now())
+	if !ok {
+		t.Fatalf("user_session %q is not signed with the cookie key", cookie.Value)
+	}
+	if user.ID != "user-42" || user.Email != "jane@example.com" || !user.EmailVerified || user.Name != "Jane Doe" || user.Provider != "google" {
+		t.Errorf("session user = %+v", user)
+	}
+}
+
+func TestAuthHandler_Callback_StateChecks(t *testing.T) {
+	h, renderer, provider := newTestAuthHandler(t)
+	stateCookie, callbackURL := startLogin(t, h, provider)
+
+	tests := []struct {
+		name   string
+		cookie *http.Cookie
+	}{
+		{"missing state cookie", nil},
+		{"state mismatch", &http.Cookie{Name: "oauth_state", Value: "forged"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := callback(h, callbackURL, tt.cookie)
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+			}
+			if msg := errorMessage(t, renderer); msg != "Invalid authentication state" {
+				t.Errorf("message = %q", msg)
+			}
+		})
+	}
+
+	// The code was never redeemed, so the real cookie still completes the login
+	if rec := callback(h, callbackURL, stateCookie); rec.Code != http.StatusTemporaryRedirect {
+		t.Errorf("callback with valid state = %d, want %d", rec.Code, http.StatusTemporaryRedirect)
+	}
+}
+
+func TestAuthHandler_Callback_MissingCode(t *testing.T) {
+	h, renderer, provider := newTestAuthHandler(t)
+	stateCookie, callbackURL := startLogin(t, h, provider)
+
+	q := callbackURL.Query()
+	q.Del("code")
+	callbackURL.RawQuery = q.Encode()
+
+	rec := callback(h, callbackURL, stateCookie)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if msg := errorMessage(t, renderer); msg != "Authorization code not received" {
+		t.Errorf("message = %q", msg)
+	}
+}
+
+func TestAuthHandler_Callback_ProviderFailures(t *testing.T) {
+	tests := []struct {
+		name    string
+		failure oidctest.Failure
+		status  int
+		message string
+		outcome string
+	}{
+		{"user denied consent", oidctest.FailAuthorizeDenied, http.StatusBadRequest, "Authentication error: access_denied", "provider_error"},
+		{"token exchange rejected", oidctest.FailTokenExchange, http.StatusInternalServerError, "Failed to exchange authorization code", "exchange_failed"},
+		{"missing id_token", oidctest.FailMissingIDToken, http.StatusInternalServerError, "Invalid token response", "invalid_id_token"},
+		{"bad signature", oidctest.FailBadSignature, http.StatusInternalServerError, "Failed to verify token", "invalid_id_token"},
+		{"wrong audience", oidctest.FailWrongAudience, http.StatusInternalServerError, "Failed to verify token", "invalid_id_token"},
+		{"wrong issuer", oidctest.FailWrongIssuer, http.StatusInternalServerError, "Failed to verify token", "invalid_id_token"},
+		{"expired token", oidctest.FailExpired, http.StatusInternalServerError, "Failed to verify token", "invalid_id_token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, renderer, provider := newTestAuthHandler(t)
+			provider.SetFailure(tt.failure)
+
+			stateCookie, callbackURL := startLogin(t, h, provider)
+			before := testutil.ToFloat64(oauthCallbacks.WithLabelValues(tt.outcome))
+			rec := callback(h, callbackURL, stateCookie)
+
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if got := testutil.ToFloat64(oauthCallbacks.WithLabelValues(tt.outcome)) - before; got != 1 {
+				t.Errorf("%s callbacks went up by %v, want 1", tt.outcome, got)
+			}
+			if msg := errorMessage(t, renderer); msg != tt.message {
+				t.Errorf("message = %q, want %q", msg, tt.message)
+			}
+			for _, c := range rec.Result().Cookies() {
+				if c.Name == "user_session" {
+					t.Error("failed login set a user_session cookie")
+				}
+			}
+		})
+	}
+}
+
+func TestAuthHandler_Callback_CodeIsSingleUse(t *testing.T) {
+	h, renderer, provider := newTestAuthHandler(t)
+	stateCookie, callbackURL := startLogin(t, h, provider)
+
+	if rec := callback(h, callbackURL, stateCookie); rec.Code != http.StatusTemporaryRedirect {
+		t.Fatalf("first callback = %d", rec.Code)
+	}
+	rec := callback(h, callbackURL, stateCookie)
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("replayed callback = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+	if msg := errorMessage(t, renderer); msg != "Failed to exchange authorization code" {
+		t.Errorf("message = %q", msg)
+	}
+}
+
+func TestAuthHandler_Callback_Traced(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	h, _, provider := newTestAuthHandler(t)
+	stateCookie, callbackURL := startLogin(t, h, provider)
+	if rec := callback(h, callbackURL, stateCookie); rec.Code != http.StatusTemporaryRedirect {
+		t.Fatalf("callback = %d", rec.Code)
+	}
+
+	spans := map[string]bool{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = true
+	}
+	if !spans["oauth.exchange"] || !spans["oidc.verify"] {
+		t.Errorf("spans = %v, want oauth.exchange and oidc.verify", spans)
+	}
+}
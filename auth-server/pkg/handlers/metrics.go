@@ -0,0 +1,15 @@
+package handlers
+
+import (
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// oauthCallbacks counts OAuth callbacks by outcome: success, invalid_state,
+// provider_error, missing_code, exchange_failed or invalid_id_token
+var oauthCallbacks = promauto.With(metrics.Registry).NewCounterVec(prometheus.CounterOpts{
+	Namespace: metrics.Namespace,
+	Name:      "oauth_callbacks_total",
+	Help:      "OAuth callbacks by outcome.",
+}, []string{"outcome"})
@@ -2,40 +2,90 @@ package oauth
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
+	"net/http"
+	"strings"
+	"sync"
 
-	"github.com/aruruka/go-google-s3-uploader/auth-server/pkg/config" // Import the new config package
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/config"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/tracing"
 
 	"github.com/coreos/go-oidc/v3/oidc"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
 	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/google"
 )
 
+// GoogleIssuer is the OIDC issuer used unless overridden with WithIssuer
+const GoogleIssuer = "https://accounts.google.com"
+
 type Config struct {
-	OAuth2Config *oauth2.Config
+	OAuth2Config *oauth2.Config // Replaced, never modified, when the client secret rotates
 	Verifier     *oidc.IDTokenVerifier
+
+	mu sync.RWMutex // Guards OAuth2Config
+
+	httpClient *http.Client
+	issuer     string
+}
+
+// tracerName identifies this package's spans
+const tracerName = "github.com/aruruka/go-google-s3-uploader/auth-server/pkg/oauth"
+
+// options holds the settings Option functions can override
+type options struct {
+	issuer     string
+	httpClient *http.Client
+}
+
+// Option customizes how NewConfig reaches the identity provider
+type Option func(*options)
+
+// WithIssuer uses a different OIDC issuer than Google, e.g. a fake provider in tests
+func WithIssuer(issuer string) Option {
+	return func(o *options) {
+		o.issuer = issuer
+	}
 }
 
-// NewConfig initializes OAuth configuration using the provided AppConfig.
-func NewConfig(appConfig *config.AppConfig) (*Config, error) {
-	clientID := appConfig.GoogleClientID
-	clientSecret := appConfig.GoogleClientSecret
-	redirectURL := appConfig.RedirectURL
+// WithHTTPClient uses client for discovery, key fetches and token exchanges.
+// The default client traces its requests.
+func WithHTTPClient(client *http.Client) Option {
+	return func(o *options) {
+		o.httpClient = client
+	}
+}
+
+// NewConfig initializes OAuth configuration from the auth section of the config.
+// Endpoints are discovered from the issuer, which defaults to Google.
+func NewConfig(authConfig config.AuthConfig, opts ...Option) (*Config, error) {
+	o := options{
+		issuer:     GoogleIssuer,
+		httpClient: &http.Client{Transport: tracing.Transport(nil)},
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
 
-	// The validation for these variables is now handled in config.LoadConfig()
-	// We just need to ensure they are not empty here, which should already be guaranteed by LoadConfig.
+	clientID := authConfig.GoogleClientID
+	clientSecret := authConfig.GoogleClientSecret
+	redirectURL := authConfig.RedirectURL
+
+	// config.Load already requires these in production; dev placeholders are never empty
 	if clientID == "" {
-		return nil, fmt.Errorf("GOOGLE_CLIENT_ID is empty in AppConfig")
+		return nil, fmt.Errorf("GOOGLE_CLIENT_ID is empty in the auth config")
 	}
 	if clientSecret == "" {
-		return nil, fmt.Errorf("GOOGLE_CLIENT_SECRET is empty in AppConfig")
+		return nil, fmt.Errorf("GOOGLE_CLIENT_SECRET is empty in the auth config")
 	}
 	if redirectURL == "" {
-		return nil, fmt.Errorf("REDIRECT_URL is empty in AppConfig")
+		return nil, fmt.Errorf("REDIRECT_URL is empty in the auth config")
 	}
 
-	provider, err := oidc.NewProvider(context.Background(), "https://accounts.google.com")
+	ctx := oidc.ClientContext(context.Background(), o.httpClient)
+	provider, err := oidc.NewProvider(ctx, o.issuer)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get OIDC provider: %w", err)
 	}
@@ -44,7 +94,7 @@ func NewConfig(appConfig *config.AppConfig) (*Config, error) {
 		ClientID:     clientID,
 		ClientSecret: clientSecret,
 		RedirectURL:  redirectURL,
-		Endpoint:     google.Endpoint,
+		Endpoint:     provider.Endpoint(),
 		Scopes:       []string{oidc.ScopeOpenID, "profile", "email"},
 	}
 
@@ -52,22 +102,93 @@ func NewConfig(appConfig *config.AppConfig) (*Config, error) {
 		ClientID: clientID,
 	})
 
-	log.Printf("OAuth Config Initialized: RedirectURL=%s", redirectURL)
+	log.Printf("OAuth Config Initialized: Issuer=%s, RedirectURL=%s", o.issuer, redirectURL)
 
 	return &Config{
 		OAuth2Config: oauth2Config,
 		Verifier:     verifier,
+		httpClient:   o.httpClient,
+		issuer:       o.issuer,
 	}, nil
 }
 
 func (c *Config) GetAuthURL(state string) string {
-	return c.OAuth2Config.AuthCodeURL(state, oauth2.AccessTypeOffline)
+	return c.oauth2Config().AuthCodeURL(state, oauth2.AccessTypeOffline)
+}
+
+// SetClientSecret switches to a rotated client secret for later code exchanges
+func (c *Config) SetClientSecret(secret string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	rotated := *c.OAuth2Config
+	rotated.ClientSecret = secret
+	c.OAuth2Config = &rotated
+}
+
+func (c *Config) oauth2Config() *oauth2.Config {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.OAuth2Config
 }
 
 func (c *Config) ExchangeCode(ctx context.Context, code string) (*oauth2.Token, error) {
-	return c.OAuth2Config.Exchange(ctx, code)
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "oauth.exchange")
+	defer span.End()
+
+	token, err := c.oauth2Config().Exchange(context.WithValue(ctx, oauth2.HTTPClient, c.httpClient), code)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "token exchange failed")
+	}
+	return token, err
 }
 
 func (c *Config) VerifyIDToken(ctx context.Context, rawIDToken string) (*oidc.IDToken, error) {
-	return c.Verifier.Verify(ctx, rawIDToken)
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "oidc.verify")
+	defer span.End()
+
+	idToken, err := c.Verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "ID token verification failed")
+	}
+	return idToken, err
+}
+
+// Ping checks that the provider's discovery document and signing keys can be
+// fetched, so new logins can be verified. The keys the verifier has cached are
+// not enough: the provider rotates them.
+func (c *Config) Ping(ctx context.Context) error {
+	var discovery struct {
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := c.getJSON(ctx, strings.TrimSuffix(c.issuer, "/")+"/.well-known/openid-configuration", &discovery); err != nil {
+		return fmt.Errorf("OIDC discovery: %w", err)
+	}
+	var jwks struct {
+		Keys []json.RawMessage `json:"keys"`
+	}
+	if err := c.getJSON(ctx, discovery.JWKSURI, &jwks); err != nil {
+		return fmt.Errorf("OIDC signing keys: %w", err)
+	}
+	if len(jwks.Keys) == 0 {
+		return fmt.Errorf("OIDC signing keys: %s has no keys", discovery.JWKSURI)
+	}
+	return nil
+}
+
+func (c *Config) getJSON(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
 }
@@ -0,0 +1,71 @@
+package oauth_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/aruruka/go-google-s3-uploader/auth-server/pkg/oauth"
+	"github.com/aruruka/go-google-s3-uploader/auth-server/pkg/oauth/oidctest"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/config"
+)
+
+func TestConfig_Ping(t *testing.T) {
+	provider := oidctest.NewProvider()
+	defer provider.Close()
+	cfg, err := oauth.NewConfig(config.AuthConfig{
+		GoogleClientID:     provider.ClientID,
+		GoogleClientSecret: provider.ClientSecret,
+		RedirectURL:        "https://auth.example.com/auth/callback",
+	}, oauth.WithIssuer(provider.URL), oauth.WithHTTPClient(provider.Client()))
+	if err != nil {
+		t.Fatalf("NewConfig() error = %v", err)
+	}
+
+	if err := cfg.Ping(context.Background()); err != nil {
+		t.Errorf("Ping() error = %v", err)
+	}
+	provider.Close()
+	if err := cfg.Ping(context.Background()); err == nil {
+		t.Error("Ping() succeeded with the provider down")
+	}
+}
+
+func TestConfig_SetClientSecret(t *testing.T) {
+	provider := oidctest.NewProvider()
+	defer provider.Close()
+	cfg, err := oauth.NewConfig(config.AuthConfig{
+		GoogleClientID:     provider.ClientID,
+		GoogleClientSecret: provider.ClientSecret,
+		RedirectURL:        "https://auth.example.com/auth/callback",
+	}, oauth.WithIssuer(provider.URL), oauth.WithHTTPClient(provider.Client()))
+	if err != nil {
+		t.Fatalf("NewConfig() error = %v", err)
+	}
+
+	// authorize runs the provider's authorize step and returns the code it issues
+	authorize := func() string {
+		client := provider.Client()
+		client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+		resp, err := client.Get(cfg.GetAuthURL("state"))
+		if err != nil {
+			t.Fatalf("GET authorize error = %v", err)
+		}
+		resp.Body.Close()
+		back, err := url.Parse(resp.Header.Get("Location"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return back.Query().Get("code")
+	}
+
+	provider.ClientSecret = "rotated"
+	if _, err := cfg.ExchangeCode(context.Background(), authorize()); err == nil {
+		t.Error("ExchangeCode() with the old secret succeeded after the provider rotated it")
+	}
+	cfg.SetClientSecret("rotated")
+	if _, err := cfg.ExchangeCode(context.Background(), authorize()); err != nil {
+		t.Errorf("ExchangeCode() after SetClientSecret error = %v", err)
+	}
+}
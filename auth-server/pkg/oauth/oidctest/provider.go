@@ -0,0 +1,304 @@
+// Package oidctest runs a local OpenID Connect provider for login tests.
+//
+// The provider serves discovery, JWKS, authorize and token endpoints and signs
+// ID tokens with its own RS256 key, so the real oauth.Config can log users in
+// without reaching Google. Claims and failure modes are configurable per test.
+package oidctest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Default client credentials accepted by a new Provider
+const (
+	DefaultClientID     = "oidctest-client"
+	DefaultClientSecret = "oidctest-secret"
+)
+
+// Failure selects how the provider misbehaves on the next logins
+type Failure int
+
+const (
+	// FailNone completes logins normally
+	FailNone Failure = iota
+	// FailAuthorizeDenied redirects back with error=access_denied, as when the user cancels consent
+	FailAuthorizeDenied
+	// FailTokenExchange rejects the authorization code at the token endpoint
+	FailTokenExchange
+	// FailMissingIDToken returns an access token without an id_token
+	FailMissingIDToken
+	// FailBadSignature signs the ID token with a key that is not in the JWKS
+	FailBadSignature
+	// FailWrongAudience issues the ID token to a different client
+	FailWrongAudience
+	// FailWrongIssuer issues the ID token from a different issuer
+	FailWrongIssuer
+	// FailExpired issues an ID token that has already expired
+	FailExpired
+)
+
+// Provider is a fake OIDC identity provider backed by httptest
+type Provider struct {
+	// URL is the issuer, e.g. http://127.0.0.1:PORT
+	URL string
+
+	ClientID     string
+	ClientSecret string
+
+	server   *httptest.Server
+	key      *rsa.PrivateKey
+	rogueKey *rsa.PrivateKey
+	keyID    string
+
+	mu      sync.Mutex
+	subject string
+	claims  map[string]any
+	failure Failure
+	codes   map[string]authRequest
+}
+
+// authRequest is what an issued authorization code was granted for
+type authRequest struct {
+	clientID    string
+	redirectURI string
+	nonce       string
+}
+
+// NewProvider starts a provider that logs in a default test user. Close it when done.
+func NewProvider() *Provider {
+	p := &Provider{
+		ClientID:     DefaultClientID,
+		ClientSecret: DefaultClientSecret,
+		key:          mustGenerateKey(),
+		rogueKey:     mustGenerateKey(),
+		keyID:        "oidctest-key-1",
+		subject:      "oidctest-user",
+		claims: map[string]any{
+			"email":          "test.user@example.com",
+			"email_verified": true,
+			"name":           "Test User",
+			"picture":        "https://example.com/avatar.png",
+		},
+		codes: make(map[string]authRequest),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.handleDiscovery)
+	mux.HandleFunc("/jwks", p.handleJWKS)
+	mux.HandleFunc("/authorize", p.handleAuthorize)
+	mux.HandleFunc("/token", p.handleToken)
+	p.server = httptest.NewServer(mux)
+	p.URL = p.server.URL
+	return p
+}
+
+// Close shuts the provider down
+func (p *Provider) Close() {
+	p.server.Close()
+}
+
+// Client returns an HTTP client for talking to the provider
+func (p *Provider) Client() *http.Client {
+	return p.server.Client()
+}
+
+// SetUser sets the subject and claims of the ID tokens issued from now on
+func (p *Provider) SetUser(subject string, claims map[string]any) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.subject = subject
+	p.claims = claims
+}
+
+// SetFailure makes later logins fail in the given way
+func (p *Provider) SetFailure(f Failure) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.failure = f
+}
+
+func (p *Provider) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                p.URL,
+		"authorization_endpoint":                p.URL + "/authorize",
+		"token_endpoint":                        p.URL + "/token",
+		"jwks_uri":                              p.URL + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"scopes_supported":                      []string{"openid", "profile", "email"},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post"},
+	})
+}
+
+func (p *Provider) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	pub := p.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": p.keyID,
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+// handleAuthorize skips the login screen and immediately redirects back with a code
+func (p *Provider) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	redirectURI, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || redirectURI.Scheme == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	if q.Get("client_id") != p.ClientID {
+		http.Error(w, "unknown client_id", http.StatusBadRequest)
+		return
+	}
+
+	back := redirectURI.Query()
+	back.Set("state", q.Get("state"))
+
+	p.mu.Lock()
+	if p.failure == FailAuthorizeDenied {
+		back.Set("error", "access_denied")
+	} else {
+		code := randomString()
+		p.codes[code] = authRequest{clientID: p.ClientID, redirectURI: q.Get("redirect_uri"), nonce: q.Get("nonce")}
+		back.Set("code", code)
+	}
+	p.mu.Unlock()
+
+	redirectURI.RawQuery = back.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+func (p *Provider) handleToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, "invalid_request")
+		return
+	}
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientID != p.ClientID || clientSecret != p.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	p.mu.Lock()
+	code := r.PostForm.Get("code")
+	req, found := p.codes[code]
+	delete(p.codes, code) // codes are single use
+	failure := p.failure
+	subject, claims := p.subject, p.claims
+	p.mu.Unlock()
+
+	if r.PostForm.Get("grant_type") != "authorization_code" || !found || failure == FailTokenExchange ||
+		req.redirectURI != r.PostForm.Get("redirect_uri") {
+		tokenError(w, "invalid_grant")
+		return
+	}
+
+	resp := map[string]any{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+	}
+	if failure != FailMissingIDToken {
+		resp["id_token"] = p.issueIDToken(subject, claims, req, failure)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// issueIDToken builds and signs an ID token, applying the token-level failure modes
+func (p *Provider) issueIDToken(subject string, claims map[string]any, req authRequest, failure Failure) string {
+	now := time.Now()
+	payload := map[string]any{}
+	for k, v := range claims {
+		payload[k] = v
+	}
+	payload["iss"] = p.URL
+	payload["sub"] = subject
+	payload["aud"] = req.clientID
+	payload["iat"] = now.Unix()
+	payload["exp"] = now.Add(time.Hour).Unix()
+	if req.nonce != "" {
+		payload["nonce"] = req.nonce
+	}
+
+	key := p.key
+	switch failure {
+	case FailBadSignature:
+		key = p.rogueKey
+	case FailWrongAudience:
+		payload["aud"] = "some-other-client"
+	case FailWrongIssuer:
+		payload["iss"] = "https://issuer.example.com"
+	case FailExpired:
+		payload["iat"] = now.Add(-2 * time.Hour).Unix()
+		payload["exp"] = now.Add(-time.Hour).Unix()
+	}
+	return p.SignToken(key, payload)
+}
+
+// SignToken signs claims as a compact RS256 JWT. Passing nil signs with the provider's key.
+func (p *Provider) SignToken(key *rsa.PrivateKey, claims map[string]any) string {
+	if key == nil {
+		key = p.key
+	}
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": p.keyID})
+	body, _ := json.Marshal(claims)
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(body)
+
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		panic(fmt.Sprintf("oidctest: failed to sign token: %v", err))
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func tokenError(w http.ResponseWriter, code string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": code})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func mustGenerateKey() *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(fmt.Sprintf("oidctest: failed to generate key: %v", err))
+	}
+	return key
+}
+
+func randomString() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,48 @@
+package templates
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/models"
+)
+
+func TestTemplateRenderer_RenderTemplate(t *testing.T) {
+	renderer, err := NewTemplateRenderer()
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+
+	tests := []struct {
+		templateName string
+		data         *models.PageData
+		want         []string
+	}{
+		{"login.html", &models.PageData{Title: "Login", Data: &models.LoginData{}},
+			[]string{"<title>Login</title>", `href="/auth/google"`, `class="footer"`}},
+		{"callback.html", &models.PageData{Title: "Signed in", Data: &models.CallbackData{
+			User: &models.User{Name: "Ada", Email: "ada@example.com"}, RedirectURL: "/",
+		}}, []string{"Welcome, Ada!", "ada@example.com"}},
+		{"error.html", &models.PageData{Title: "Error", Data: &models.ErrorData{StatusCode: 400, Message: "Invalid state parameter"}},
+			[]string{"Error 400", "Invalid state parameter"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.templateName, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := renderer.RenderTemplate(&buf, tt.templateName, tt.data); err != nil {
+				t.Fatalf("RenderTemplate(%s) error = %v", tt.templateName, err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(buf.String(), want) {
+					t.Errorf("RenderTemplate(%s) output is missing %q", tt.templateName, want)
+				}
+			}
+		})
+	}
+
+	if err := renderer.RenderTemplate(&bytes.Buffer{}, "unknown.html", nil); err == nil {
+		t.Error("Expected an error for an unknown template")
+	}
+}
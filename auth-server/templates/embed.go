@@ -0,0 +1,10 @@
+// Package templates embeds the auth server's page templates. Each page defines
+// the head, content and scripts blocks of the shared base layout.
+package templates
+
+import "embed"
+
+// FS holds the page templates
+//
+//go:embed *.html
+var FS embed.FS
@@ -130,7 +130,7 @@ test_container() {
     # Test health check
     echo "   Testing health check endpoint..."
     HEALTH_RESPONSE=$(curl -s http://localhost:8080/health)
-    if [ "$HEALTH_RESPONSE" == "OK" ]; then
+    if echo "$HEALTH_RESPONSE" | grep -q '"status":"ok"'; then
         echo "✅ Health check passed: $HEALTH_RESPONSE"
     else
         echo "❌ Health check failed: $HEALTH_RESPONSE"
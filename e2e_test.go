@@ -0,0 +1,664 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	authOAuth "github.com/aruruka/go-google-s3-uploader/auth-server/pkg/oauth"
+	"github.com/aruruka/go-google-s3-uploader/auth-server/pkg/oauth/oidctest"
+
+	appHandlers "github.com/aruruka/go-google-s3-uploader/app-server/pkg/handlers"
+	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/resilience"
+	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/s3/s3test"
+	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/webhooks"
+
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/config"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/health"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/logging"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/metrics"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/tracing"
+)
+
+const e2eBucket = "e2e-bucket"
+
+// e2eEnv is the combined service running in-process against fake S3 and a fake OIDC provider
+type e2eEnv struct {
+	server   *httptest.Server
+	s3       *s3test.Server
+	provider *oidctest.Provider
+	client   *http.Client
+	// redirects records every URL the client was redirected to on the last request
+	redirects []*url.URL
+}
+
+// newE2EEnv starts the service; overrides replace or add environment variables
+func newE2EEnv(t *testing.T, overrides map[string]string) *e2eEnv {
+	t.Helper()
+	env := &e2eEnv{
+		s3:       s3test.NewServer(e2eBucket),
+		provider: oidctest.NewProvider(),
+	}
+	t.Cleanup(env.s3.Close)
+	t.Cleanup(env.provider.Close)
+
+	// Start first so the configs can point at the server's own URL
+	env.server = httptest.NewUnstartedServer(nil)
+	env.server.StartTLS()
+	t.Cleanup(env.server.Close)
+
+	vars := map[string]string{
+		"ENV":                  "development",
+		"APP_SERVER_URL":       env.server.URL,
+		"REDIRECT_URL":         env.server.URL + "/auth/callback",
+		"GOOGLE_CLIENT_ID":     env.provider.ClientID,
+		"GOOGLE_CLIENT_SECRET": env.provider.ClientSecret,
+		"AWS_REGION":           s3test.DefaultRegion,
+		"S3_BUCKET_NAME":       e2eBucket,
+		"STORAGE_BACKEND":      "s3",
+		"S3_ENDPOINT":          env.s3.URL,
+		"S3_USE_PATH_STYLE":    "true",
+		"S3_ACCESS_KEY_ID":     env.s3.AccessKeyID,
+		"S3_SECRET_ACCESS_KEY": env.s3.SecretAccessKey,
+		"AUTH_SERVER_URL":      "",
+		"CONFIG_FILE":          "",
+		"CSE_MASTER_KEY":       "",
+		"FAULT_INJECTION":      "",
+		"METRICS_TOKEN":        "",
+		"ADMIN_IDS":            "",
+		"WEBHOOK_URLS":         "",
+		"WEBHOOK_SECRET":       "",
+		"AUDIT_FILE":           filepath.Join(t.TempDir(), "audit.jsonl"),
+	}
+	for k, v := range overrides {
+		vars[k] = v
+	}
+	for k, v := range vars {
+		t.Setenv(k, v)
+	}
+	cfg, err := config.Load([]string{"--env-file", ""})
+	if err != nil {
+		t.Fatalf("config.Load() error = %v", err)
+	}
+	router, _, err := newRouter(cfg,
+		authOAuth.WithIssuer(env.provider.URL),
+		authOAuth.WithHTTPClient(env.provider.Client()),
+	)
+	if err != nil {
+		t.Fatalf("newRouter() error = %v", err)
+	}
+	env.server.Config.Handler = tracing.Middleware(logging.Middleware(metrics.Middleware(router)))
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.client = env.server.Client()
+	env.client.Jar = jar
+	env.client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		env.redirects = append(env.redirects, req.URL)
+		return nil
+	}
+	return env
+}
+
+// do sends a request, follows redirects and returns the final response with its body read
+func (e *e2eEnv) do(t *testing.T, req *http.Request) (*http.Response, string) {
+	t.Helper()
+	e.redirects = nil
+	resp, err := e.client.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s error = %v", req.Method, req.URL, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading %s body: %v", req.URL, err)
+	}
+	return resp, string(body)
+}
+
+func (e *e2eEnv) get(t *testing.T, path string) (*http.Response, string) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, e.server.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e.do(t, req)
+}
+
+// cookie returns the named cookie the browser would send to the service
+func (e *e2eEnv) cookie(name string) *http.Cookie {
+	u, _ := url.Parse(e.server.URL)
+	for _, c := range e.client.Jar.Cookies(u) {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// redirectedTo reports whether the last request was redirected through baseURL+path
+func (e *e2eEnv) redirectedTo(baseURL, path string) bool {
+	for _, u := range e.redirects {
+		if u.Scheme+"://"+u.Host == baseURL && u.Path == path {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *e2eEnv) login(t *testing.T) {
+	t.Helper()
+	resp, body := e.get(t, "/auth/google")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("login finished with %d: %s", resp.StatusCode, body)
+	}
+	if !e.redirectedTo(e.provider.URL, "/authorize") || !e.redirectedTo(e.server.URL, "/auth/callback") {
+		t.Fatalf("login redirects = %v, want provider authorize then callback", e.redirects)
+	}
+	if resp.Request.URL.Path != "/" {
+		t.Errorf("login landed on %s, want /", resp.Request.URL)
+	}
+	if e.cookie("user_session") == nil {
+		t.Fatal("login did not set user_session cookie")
+	}
+}
+
+// csrfToken loads the upload page and returns the CSRF token from its form
+func (e *e2eEnv) csrfToken(t *testing.T) string {
+	t.Helper()
+	_, body := e.get(t, "/upload")
+	m := csrfFieldPattern.FindStringSubmatch(body)
+	if m == nil {
+		t.Fatal("upload page has no CSRF token field")
+	}
+	return m[1]
+}
+
+var (
+	csrfFieldPattern = regexp.MustCompile(`name="csrf_token" value="([^"]+)"`)
+	nonceAttrPattern = regexp.MustCompile(`<script nonce="([^"]+)"`)
+)
+
+func (e *e2eEnv) upload(t *testing.T, filename, contentType string, data []byte) (*http.Response, string) {
+	t.Helper()
+	return e.uploadWithToken(t, e.csrfToken(t), filename, contentType, data)
+}
+
+func (e *e2eEnv) uploadWithToken(t *testing.T, token, filename, contentType string, data []byte) (*http.Response, string) {
+	t.Helper()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	mw.WriteField("csrf_token", token)
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", `form-data; name="file"; filename="`+filename+`"`)
+	header.Set("Content-Type", contentType)
+	part, err := mw.CreatePart(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(data)
+	mw.Close()
+
+	req, err := http.NewRequest(http.MethodPost, e.server.URL+"/upload", &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return e.do(t, req)
+}
+
+// postForm builds a form POST as a browser would submit it
+func postForm(t *testing.T, target string, form url.Values) *http.Request {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req
+}
+
+func TestE2E_LoginUploadDownloadLogout(t *testing.T) {
+	env := newE2EEnv(t, nil)
+	env.provider.SetUser("e2e-user", map[string]any{
+		"email":          "e2e@example.com",
+		"email_verified": true,
+		"name":           "E2E User",
+	})
+
+	// Anonymous visitors are sent to the login page
+	resp, _ := env.get(t, "/")
+	if resp.Request.URL.Path != "/login" || resp.StatusCode != http.StatusOK {
+		t.Fatalf("anonymous GET / ended at %s with %d, want /login", resp.Request.URL, resp.StatusCode)
+	}
+
+	env.login(t)
+	if env.cookie("oauth_state") != nil {
+		t.Error("oauth_state cookie was not cleared after login")
+	}
+
+	// Upload, then land on the success page
+	content := []byte("\x89PNG\r\n\x1a\nfake image bytes")
+	resp, body := env.upload(t, "holiday.png", "image/png", content)
+	if resp.StatusCode != http.StatusOK || resp.Request.URL.Path != "/success" {
+		t.Fatalf("upload ended at %s with %d: %s", resp.Request.URL, resp.StatusCode, body)
+	}
+	if !strings.Contains(body, "holiday.png") {
+		t.Error("success page does not mention the uploaded file")
+	}
+	if !strings.Contains(body, "File uploaded successfully") {
+		t.Error("success page does not show the upload flash message")
+	}
+	// Its inline script carries the nonce the policy allows
+	csp := resp.Header.Get("Content-Security-Policy")
+	if m := nonceAttrPattern.FindStringSubmatch(body); m == nil || !strings.Contains(csp, "'nonce-"+m[1]+"'") {
+		t.Errorf("success page script nonce does not match the CSP %q", csp)
+	}
+
+	keys := env.s3.Keys(e2eBucket)
+	if len(keys) != 1 || !strings.HasPrefix(keys[0], "uploads/e2e-user/") || !strings.HasSuffix(keys[0], "_holiday.png") {
+		t.Fatalf("stored keys = %v, want one upload under uploads/e2e-user/", keys)
+	}
+	obj, _ := env.s3.Object(e2eBucket, keys[0])
+	if !bytes.Equal(obj.Data, content) || obj.ContentType != "image/png" {
+		t.Errorf("stored object = %q (%s)", obj.Data, obj.ContentType)
+	}
+
+	// The file shows up in the listing
+	resp, body = env.get(t, "/files")
+	if resp.StatusCode != http.StatusOK || !strings.Contains(body, "holiday.png") {
+		t.Errorf("GET /files = %d, listing does not include the upload", resp.StatusCode)
+	}
+
+	// Download it back through the service
+	resp, body = env.get(t, "/download?key="+url.QueryEscape(keys[0]))
+	if resp.StatusCode != http.StatusOK || body != string(content) {
+		t.Errorf("GET /download = %d %q", resp.StatusCode, body)
+	}
+	if cd := resp.Header.Get("Content-Disposition"); !strings.Contains(cd, "holiday.png") {
+		t.Errorf("Content-Disposition = %q", cd)
+	}
+
+	// Logging out clears the session and protects the pages again
+	resp, body = env.get(t, "/logout")
+	if resp.Request.URL.Path != "/login" {
+		t.Errorf("logout ended at %s, want /login", resp.Request.URL)
+	}
+	if !strings.Contains(body, "You have been logged out.") {
+		t.Error("login page does not show the logout flash message")
+	}
+	if env.cookie("user_session") != nil {
+		t.Error("user_session cookie survived logout")
+	}
+	resp, _ = env.get(t, "/files")
+	if resp.Request.URL.Path != "/login" {
+		t.Errorf("GET /files after logout ended at %s, want /login", resp.Request.URL)
+	}
+}
+
+func TestE2E_UserCannotDownloadOthersFiles(t *testing.T) {
+	env := newE2EEnv(t, nil)
+	env.s3.PutObject(e2eBucket, "uploads/someone-else/1700000000_secret.pdf", []byte("secret"), "application/pdf")
+
+	env.login(t)
+	resp, body := env.get(t, "/download?key="+url.QueryEscape("uploads/someone-else/1700000000_secret.pdf"))
+	if resp.StatusCode != http.StatusNotFound || body == "secret" {
+		t.Errorf("GET other user's file = %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+}
+
+func TestE2E_UploadRequiresCSRFToken(t *testing.T) {
+	env := newE2EEnv(t, nil)
+	env.login(t)
+	token := env.csrfToken(t)
+
+	for name, submitted := range map[string]string{"missing": "", "forged": "not-the-token"} {
+		resp, body := env.uploadWithToken(t, submitted, "forged.png", "image/png", []byte("png bytes"))
+		if resp.StatusCode != http.StatusForbidden || !strings.Contains(body, "Access Denied") {
+			t.Errorf("upload with %s token = %d, want the 403 error page", name, resp.StatusCode)
+		}
+	}
+	if keys := env.s3.Keys(e2eBucket); len(keys) != 0 {
+		t.Fatalf("rejected uploads stored %v", keys)
+	}
+
+	// A token is bound to the session it was issued for
+	env.get(t, "/logout")
+	env.login(t)
+	if resp, _ := env.uploadWithToken(t, token, "stale.png", "image/png", []byte("png bytes")); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("upload with the previous session's token = %d, want 403", resp.StatusCode)
+	}
+	if resp, body := env.upload(t, "fresh.png", "image/png", []byte("png bytes")); resp.StatusCode != http.StatusOK {
+		t.Errorf("upload with the current token = %d: %s", resp.StatusCode, body)
+	}
+}
+
+func TestE2E_RejectedUploadFlashesReason(t *testing.T) {
+	env := newE2EEnv(t, nil)
+	env.login(t)
+
+	resp, body := env.upload(t, "script.sh", "text/x-shellscript", []byte("#!/bin/sh"))
+	if resp.StatusCode != http.StatusOK || resp.Request.URL.Path != "/upload" {
+		t.Fatalf("rejected upload ended at %s with %d, want the upload form", resp.Request.URL, resp.StatusCode)
+	}
+	if !strings.Contains(body, "Upload rejected: Invalid file type") {
+		t.Error("upload form does not show why the upload was rejected")
+	}
+
+	// The message is shown once
+	if _, body := env.get(t, "/upload"); strings.Contains(body, "Upload rejected") {
+		t.Error("flash message was shown again on the next page")
+	}
+}
+
+func TestE2E_SecurityHeaders(t *testing.T) {
+	env := newE2EEnv(t, map[string]string{"SHARE_FRAME_ANCESTORS": "https://wiki.example.com"})
+
+	resp, _ := env.get(t, "/login")
+	if resp.Header.Get("Strict-Transport-Security") == "" || resp.Header.Get("X-Frame-Options") != "DENY" {
+		t.Errorf("GET /login headers = %v, want HSTS and no framing", resp.Header)
+	}
+
+	// Share pages may be embedded by the configured site
+	resp, _ = env.get(t, "/s/unknown-token")
+	if csp := resp.Header.Get("Content-Security-Policy"); !strings.Contains(csp, "frame-ancestors https://wiki.example.com") {
+		t.Errorf("share page CSP = %q, want the configured frame ancestors", csp)
+	}
+	if got := resp.Header.Get("Referrer-Policy"); got != "no-referrer" {
+		t.Errorf("share page Referrer-Policy = %q, want no-referrer", got)
+	}
+
+	// Browsers post reports without a CSRF token
+	report := `{"csp-report": {"document-uri": "` + env.server.URL + `/files", "effective-directive": "script-src-elem", "blocked-uri": "inline"}}`
+	req, _ := http.NewRequest(http.MethodPost, env.server.URL+"/csp-report", strings.NewReader(report))
+	req.Header.Set("Content-Type", "application/csp-report")
+	if resp, body := env.do(t, req); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("POST /csp-report = %d: %s", resp.StatusCode, body)
+	}
+}
+
+func TestE2E_UploadRateLimit(t *testing.T) {
+	env := newE2EEnv(t, map[string]string{"RATE_LIMITS": "/upload:bytes=2KB/1h"})
+	env.login(t)
+	content := append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte("x"), 1000)...)
+
+	if resp, body := env.upload(t, "first.png", "image/png", content); resp.Request.URL.Path != "/success" {
+		t.Fatalf("first upload ended at %s with %d: %s", resp.Request.URL, resp.StatusCode, body)
+	}
+	resp, body := env.upload(t, "second.png", "image/png", content)
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") == "" {
+		t.Fatalf("upload over the byte budget = %d with Retry-After %q, want 429", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+	if !strings.Contains(body, "Too many requests") {
+		t.Error("429 page does not explain the limit")
+	}
+	if keys := env.s3.Keys(e2eBucket); len(keys) != 1 {
+		t.Errorf("stored keys = %v, want only the first upload", keys)
+	}
+}
+
+func TestE2E_AuditLog(t *testing.T) {
+	env := newE2EEnv(t, map[string]string{"ADMIN_IDS": "someone-else, oidctest-user"})
+	env.login(t)
+	if resp, body := env.upload(t, "audit.png", "image/png", []byte("png bytes")); resp.Request.URL.Path != "/success" {
+		t.Fatalf("upload ended at %s with %d: %s", resp.Request.URL, resp.StatusCode, body)
+	}
+	key := env.s3.Keys(e2eBucket)[0]
+
+	form := url.Values{"csrf_token": {env.csrfToken(t)}, "key": {key}}
+	resp, body := env.do(t, postForm(t, env.server.URL+"/files/delete", form))
+	if resp.Request.URL.Path != "/files" || !strings.Contains(body, "Deleted audit.png") {
+		t.Fatalf("delete ended at %s with %d, want the file list with a notice", resp.Request.URL, resp.StatusCode)
+	}
+	if keys := env.s3.Keys(e2eBucket); len(keys) != 0 {
+		t.Errorf("stored keys after delete = %v", keys)
+	}
+
+	resp, body = env.get(t, "/admin/audit")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /admin/audit = %d", resp.StatusCode)
+	}
+	for _, want := range []string{"login.success", "file.upload", "file.delete", key, "test.user@example.com"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("audit log page does not show %q", want)
+		}
+	}
+
+	// Filters narrow the results
+	_, body = env.get(t, "/admin/audit?action=login")
+	if !strings.Contains(body, "login.success") || strings.Contains(body, "<td>file.upload</td>") {
+		t.Error("action filter did not narrow the results to logins")
+	}
+
+	// Events are also in the JSON lines file
+	data, err := os.ReadFile(os.Getenv("AUDIT_FILE"))
+	if err != nil || !strings.Contains(string(data), `"action":"file.delete"`) {
+		t.Errorf("audit file = %q, %v; want the delete event", data, err)
+	}
+}
+
+func TestE2E_AuditLogRequiresAdmin(t *testing.T) {
+	env := newE2EEnv(t, map[string]string{"ADMIN_IDS": "someone-else"})
+	env.login(t)
+	if resp, _ := env.get(t, "/admin/audit"); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("GET /admin/audit as a non-admin = %d, want 403", resp.StatusCode)
+	}
+
+	// An admin whose provider does not vouch for the email is not trusted
+	env = newE2EEnv(t, map[string]string{"ADMIN_IDS": "oidctest-user"})
+	env.provider.SetUser("oidctest-user", map[string]any{
+		"email":          "test.user@example.com",
+		"email_verified": false,
+		"name":           "Test User",
+	})
+	env.login(t)
+	if resp, _ := env.get(t, "/admin/audit"); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("GET /admin/audit as an admin with an unverified email = %d, want 403", resp.StatusCode)
+	}
+}
+
+func TestE2E_ForgedSessionIsSignedOut(t *testing.T) {
+	env := newE2EEnv(t, map[string]string{"ADMIN_IDS": "admin-id"})
+	u, _ := url.Parse(env.server.URL)
+	forged := base64.StdEncoding.EncodeToString([]byte(`{"id":"admin-id","email":"admin@example.com","email_verified":true}`))
+	env.client.Jar.SetCookies(u, []*http.Cookie{{Name: "user_session", Value: forged, Path: "/"}})
+
+	if resp, _ := env.get(t, "/admin/audit"); resp.Request.URL.Path != "/login" {
+		t.Errorf("GET /admin/audit with a forged session ended at %s, want the login page", resp.Request.URL)
+	}
+}
+
+func TestE2E_UploadWebhook(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- r
+		bodies <- body
+	}))
+	defer receiver.Close()
+
+	env := newE2EEnv(t, map[string]string{
+		"WEBHOOK_URLS":   receiver.URL + "/hooks/uploads",
+		"WEBHOOK_SECRET": "e2e-webhook-secret",
+		"ADMIN_IDS":      "oidctest-user",
+	})
+	env.login(t)
+	if resp, body := env.upload(t, "hooked.png", "image/png", []byte("png bytes")); resp.Request.URL.Path != "/success" {
+		t.Fatalf("upload ended at %s with %d: %s", resp.Request.URL, resp.StatusCode, body)
+	}
+
+	var req *http.Request
+	select {
+	case req = <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook was not delivered")
+	}
+	body := <-bodies
+	if err := webhooks.Verify([]byte("e2e-webhook-secret"), req.Header.Get(webhooks.SignatureHeader), body, time.Now(), time.Minute); err != nil {
+		t.Errorf("webhook signature: %v", err)
+	}
+	var event struct {
+		Type string `json:"type"`
+		File struct {
+			Filename string `json:"filename"`
+			S3Key    string `json:"s3_key"`
+			Size     int64  `json:"size"`
+		} `json:"file"`
+	}
+	if err := json.Unmarshal(body, &event); err != nil || event.Type != "file.uploaded" || event.File.Filename != "hooked.png" || event.File.Size != 9 {
+		t.Errorf("webhook payload = %s, want the uploaded file", body)
+	}
+
+	// The delivery log shows it once the receiver's response is recorded
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, page := env.get(t, "/admin/webhooks?status=delivered")
+		if strings.Contains(page, event.File.S3Key) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("delivery log does not show the delivered upload event")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestE2E_FailedLoginSetsNoSession(t *testing.T) {
+	env := newE2EEnv(t, nil)
+	env.provider.SetFailure(oidctest.FailBadSignature)
+
+	resp, _ := env.get(t, "/auth/google")
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("login with forged token = %d, want %d", resp.StatusCode, http.StatusInternalServerError)
+	}
+	if env.cookie("user_session") != nil {
+		t.Error("failed login set a user_session cookie")
+	}
+}
+
+func TestE2E_HealthAndStatic(t *testing.T) {
+	env := newE2EEnv(t, nil)
+
+	resp, body := env.get(t, "/health")
+	var health appHandlers.HealthResponse
+	if err := json.Unmarshal([]byte(body), &health); err != nil {
+		t.Fatalf("GET /health body %q is not JSON: %v", body, err)
+	}
+	if resp.StatusCode != http.StatusOK || health.Status != "ok" || health.Storage.State != resilience.StateClosed {
+		t.Errorf("GET /health = %d %+v", resp.StatusCode, health)
+	}
+	if resp.Header.Get(logging.RequestIDHeader) == "" {
+		t.Errorf("GET /health has no %s header", logging.RequestIDHeader)
+	}
+	if resp, _ := env.get(t, "/upload"); resp.Request.URL.Path != "/login" {
+		t.Errorf("anonymous GET /upload ended at %s, want /login", resp.Request.URL)
+	}
+}
+
+func TestE2E_Readiness(t *testing.T) {
+	readyz := func(env *e2eEnv) (int, health.Report) {
+		t.Helper()
+		resp, body := env.get(t, "/readyz")
+		var report health.Report
+		if err := json.Unmarshal([]byte(body), &report); err != nil {
+			t.Fatalf("GET /readyz body %q is not JSON: %v", body, err)
+		}
+		return resp.StatusCode, report
+	}
+
+	env := newE2EEnv(t, nil)
+	if resp, _ := env.get(t, "/healthz"); resp.StatusCode != http.StatusOK {
+		t.Errorf("GET /healthz = %d", resp.StatusCode)
+	}
+	code, report := readyz(env)
+	if code != http.StatusOK || report.Status != "ok" {
+		t.Errorf("GET /readyz = %d %+v", code, report)
+	}
+	for _, check := range []string{"storage", "oidc", "metadata"} {
+		if report.Checks[check].Status != "ok" {
+			t.Errorf("check %s = %+v, want ok", check, report.Checks[check])
+		}
+	}
+
+	// An instance that cannot reach its bucket stays alive but takes no traffic
+	broken := newE2EEnv(t, map[string]string{"S3_BUCKET_NAME": "no-such-bucket"})
+	if resp, _ := broken.get(t, "/healthz"); resp.StatusCode != http.StatusOK {
+		t.Errorf("GET /healthz with a missing bucket = %d, want 200", resp.StatusCode)
+	}
+	code, report = readyz(broken)
+	if code != http.StatusServiceUnavailable || report.Checks["storage"].Status != "fail" || report.Checks["oidc"].Status != "ok" {
+		t.Errorf("GET /readyz with a missing bucket = %d %+v", code, report)
+	}
+}
+
+func TestE2E_Metrics(t *testing.T) {
+	env := newE2EEnv(t, map[string]string{"METRICS_TOKEN": "scrape-secret"})
+	env.login(t)
+	if resp, _ := env.upload(t, "photo.png", "image/png", []byte("png bytes")); resp.StatusCode != http.StatusOK {
+		t.Fatalf("upload status = %d", resp.StatusCode)
+	}
+
+	if resp, _ := env.get(t, "/metrics"); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("GET /metrics without the token = %d, want 401", resp.StatusCode)
+	}
+	req, _ := http.NewRequest(http.MethodGet, env.server.URL+"/metrics", nil)
+	req.Header.Set("Authorization", "Bearer scrape-secret")
+	resp, body := env.do(t, req)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /metrics with the token = %d", resp.StatusCode)
+	}
+	for _, want := range []string{
+		`uploader_http_requests_total{method="POST",route="/upload",status="303"}`,
+		`uploader_uploads_total{content_type="image/png",outcome="stored"}`,
+		`uploader_storage_operation_duration_seconds_count{operation="upload",outcome="ok"}`,
+		`uploader_oauth_callbacks_total{outcome="success"}`,
+		`uploader_active_sessions`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("/metrics is missing %s", want)
+		}
+	}
+}
+
+func TestE2E_StorageOutageTripsBreaker(t *testing.T) {
+	env := newE2EEnv(t, map[string]string{
+		"FAULT_INJECTION":          "list:error=1",
+		"S3_MAX_ATTEMPTS":          "1", // No SDK retries, which would only wait out the same error
+		"STORAGE_BREAKER_FAILURES": "2",
+		"STORAGE_BREAKER_COOLDOWN": "1h",
+	})
+	env.login(t)
+
+	for i := 0; i < 2; i++ {
+		if resp, _ := env.get(t, "/files"); resp.StatusCode != http.StatusInternalServerError {
+			t.Fatalf("GET /files #%d = %d, want %d", i+1, resp.StatusCode, http.StatusInternalServerError)
+		}
+	}
+	resp, _ := env.get(t, "/files")
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("GET /files with breaker open = %d, want %d", resp.StatusCode, http.StatusServiceUnavailable)
+	}
+
+	_, body := env.get(t, "/health")
+	var health appHandlers.HealthResponse
+	json.Unmarshal([]byte(body), &health)
+	if health.Status != "degraded" || health.Storage.State != resilience.StateOpen || health.Storage.RetryAt == nil {
+		t.Errorf("GET /health with breaker open = %s", body)
+	}
+}
@@ -1,64 +1,166 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 
 	// Auth server imports
-	authConfig "github.com/aruruka/go-google-s3-uploader/auth-server/pkg/config"
 	authHandlers "github.com/aruruka/go-google-s3-uploader/auth-server/pkg/handlers"
 	authOAuth "github.com/aruruka/go-google-s3-uploader/auth-server/pkg/oauth"
 	authTemplates "github.com/aruruka/go-google-s3-uploader/auth-server/pkg/templates"
 
 	// App server imports
-	appConfig "github.com/aruruka/go-google-s3-uploader/app-server/pkg/config"
+	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/envelope"
+	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/faultinject"
 	appHandlers "github.com/aruruka/go-google-s3-uploader/app-server/pkg/handlers"
+	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/localfs"
+	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/metadata"
+	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/resilience"
 	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/s3"
+	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/storagemetrics"
 	appTemplates "github.com/aruruka/go-google-s3-uploader/app-server/pkg/templates"
-)
-
-func healthCheck(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("OK"))
-}
+	"github.com/aruruka/go-google-s3-uploader/app-server/pkg/webhooks"
 
-func main() {
-	log.Println("🚀 Starting combined Go S3 Uploader service...")
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/audit"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/config"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/csrf"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/flash"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/health"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/logging"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/metrics"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/ratelimit"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/secheaders"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/server"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/session"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/tracing"
+)
 
-	// Load auth server configuration
-	authAppConfig, err := authConfig.LoadConfig()
+// newRouter wires the auth and app handlers into a single mux behind the
+// security headers, rate limits, CSRF protection, audit log and flash messages and returns the
+// hooks to run on shutdown. Tests pass OAuth options to point the login flow
+// at a fake identity provider.
+func newRouter(cfg *config.Config, oauthOpts ...authOAuth.Option) (http.Handler, []func(context.Context) error, error) {
+	// Initialize auth server components. Outside production templates are
+	// re-read from the checkout so edits show up without a rebuild.
+	var authTemplateOpts []authTemplates.Option
+	var appTemplateOpts []appTemplates.Option
+	if !cfg.IsProduction() {
+		authTemplateOpts = append(authTemplateOpts, authTemplates.WithLiveReload("."))
+		appTemplateOpts = append(appTemplateOpts, appTemplates.WithLiveReload("."))
+	}
+	authRenderer, err := authTemplates.NewTemplateRenderer(authTemplateOpts...)
 	if err != nil {
-		log.Fatalf("Failed to load auth server config: %v", err)
+		return nil, nil, fmt.Errorf("failed to create auth renderer: %w", err)
 	}
-
-	// Load app server configuration
-	appAppConfig, err := appConfig.LoadConfig()
+	oauthConfig, err := authOAuth.NewConfig(cfg.Auth, oauthOpts...)
 	if err != nil {
-		log.Fatalf("Failed to load app server config: %v", err)
+		return nil, nil, fmt.Errorf("failed to create OAuth config: %w", err)
 	}
+	authHandler := authHandlers.NewAuthHandler(cfg, oauthConfig, authRenderer)
+	// Only the client secret rotates at runtime; the cookie key and webhook
+	// secret are read once, and changing them needs a restart
+	cfg.WatchSecret("auth.google_client_secret", oauthConfig.SetClientSecret)
 
-	// Initialize auth server components
-	authRenderer, err := authTemplates.NewTemplateRenderer()
+	// Initialize app server components
+	appRenderer, err := appTemplates.NewTemplateRenderer(appTemplateOpts...)
 	if err != nil {
-		log.Fatalf("Failed to create auth renderer: %v", err)
+		return nil, nil, fmt.Errorf("failed to create app renderer: %w", err)
 	}
-	oauthConfig, err := authOAuth.NewConfig(authAppConfig)
+	// Initialize storage backend
+	var s3Client s3.S3ClientIface
+	var localStorage *localfs.Client
+	var shutdownHooks []func(context.Context) error
+	readiness := health.NewChecker(0, 0)
+	readiness.Register("oidc", oauthConfig.Ping)
+	faults, err := faultinject.ParseConfig(cfg.Storage.FaultInjection)
 	if err != nil {
-		log.Fatalf("Failed to create OAuth config: %v", err)
+		return nil, nil, fmt.Errorf("invalid FAULT_INJECTION: %w", err)
 	}
-	authHandler := authHandlers.NewAuthHandler(authAppConfig, oauthConfig, authRenderer)
-
-	// Initialize app server components
-	appRenderer, err := appTemplates.NewTemplateRenderer()
-	if err != nil {
-		log.Fatalf("Failed to create app renderer: %v", err)
+	switch cfg.Storage.Backend {
+	case "local":
+		localStorage, err = localfs.NewClient(cfg.Storage.LocalDir, cfg.Server.AppURL, []byte(cfg.Storage.LocalSigningKey))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to initialize local storage: %w", err)
+		}
+		s3Client = localStorage
+		log.Printf("📁 Using local storage at %s", cfg.Storage.LocalDir)
+	default:
+		encryption, err := s3.NewEncryptionConfig(cfg.Storage.SSEMode, cfg.Storage.SSEKMSKeyID, cfg.Storage.SSEBucketKey, cfg.Storage.SSECustomerKey)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid S3 encryption settings: %w", err)
+		}
+		s3Client, err = s3.NewS3Client(
+			s3.WithBucket(cfg.Storage.Bucket, cfg.Storage.Region),
+			s3.WithEncryption(encryption),
+			s3.WithEndpoint(cfg.Storage.Endpoint, cfg.Storage.UsePathStyle),
+			s3.WithCABundle(cfg.Storage.CABundle),
+			s3.WithStaticCredentials(cfg.Storage.AccessKeyID, cfg.Storage.SecretAccessKey, cfg.Storage.SessionToken),
+			s3.WithRetryPolicy(cfg.Storage.RetryMode, cfg.Storage.MaxAttempts),
+			s3.WithHTTPClientWrapper(faultinject.WrapHTTPClient(faults)),
+		)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create S3 client: %w", err)
+		}
+		if uploads, ok := s3Client.(s3.UploadAborter); ok {
+			shutdownHooks = append(shutdownHooks, uploads.AbortPendingUploads)
+		}
+	}
+	if backend, ok := s3Client.(s3.Pinger); ok {
+		readiness.Register("storage", backend.Ping)
+	}
+	if faults.Enabled() {
+		// The S3 SDK sees its faults over HTTP, so it retries them as it would real ones
+		if cfg.Storage.Backend != "local" {
+			faults = faults.Only(faultinject.OpPresign)
+		}
+		s3Client = faultinject.NewClient(s3Client, faults)
+		log.Printf("💥 Storage fault injection enabled: %s", cfg.Storage.FaultInjection)
 	}
-	s3Client, err := s3.NewS3Client()
+	s3Client = storagemetrics.NewClient(s3Client)
+	resilientStorage := resilience.NewClient(s3Client, resilience.Policy{
+		OperationTimeout: cfg.Storage.OperationTimeout,
+		UploadTimeout:    cfg.Storage.UploadTimeout,
+		Breaker: resilience.BreakerConfig{
+			FailureThreshold: cfg.Storage.BreakerFailures,
+			Cooldown:         cfg.Storage.BreakerCooldown,
+		},
+	})
+	s3Client = resilientStorage
+	if cfg.Storage.CSEMasterKey != nil {
+		kms, err := envelope.NewLocalKMS(cfg.Storage.CSEMasterKey)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid client-side encryption key: %w", err)
+		}
+		s3Client = envelope.NewClient(s3Client, kms)
+		log.Printf("🔐 Client-side encryption enabled (master key %s)", kms.KeyID())
+	}
+	store := metadata.NewMemoryStore()
+	readiness.Register("metadata", store.Ping)
+	notifier := webhooks.NewDispatcher(webhooks.Config{
+		URLs:        config.SplitList(cfg.Webhooks.URLs),
+		Events:      config.SplitList(cfg.Webhooks.Events),
+		Secret:      []byte(cfg.Webhooks.Secret),
+		MaxAttempts: cfg.Webhooks.MaxAttempts,
+		Backoff:     cfg.Webhooks.Backoff,
+		Timeout:     cfg.Webhooks.Timeout,
+	}, store)
+	shutdownHooks = append(shutdownHooks, notifier.Close)
+	appHandler := appHandlers.NewAppHandler(cfg, appRenderer, s3Client, store, notifier)
+	auditRecorder, err := audit.Open(audit.Config{
+		Sinks:          config.SplitList(cfg.Audit.Sinks),
+		File:           cfg.Audit.File,
+		S3Prefix:       cfg.Audit.S3Prefix,
+		BatchSize:      cfg.Audit.BatchSize,
+		FlushInterval:  cfg.Audit.FlushInterval,
+		TrustedProxies: cfg.Server.TrustedProxies,
+	}, store, s3Client)
 	if err != nil {
-		log.Fatalf("Failed to create S3 client: %v", err)
+		return nil, nil, fmt.Errorf("failed to open audit log: %w", err)
 	}
-	appHandler := appHandlers.NewAppHandler(appAppConfig, appRenderer, s3Client)
+	shutdownHooks = append(shutdownHooks, auditRecorder.Close)
 
 	// Create combined router
 	mux := http.NewServeMux()
@@ -88,28 +190,132 @@ func main() {
 		}
 	})
 	mux.HandleFunc("/success", appHandler.HandleSuccess)
+	mux.HandleFunc("/files", appHandler.HandleFiles)
+	mux.HandleFunc("/download", appHandler.HandleDownload)
+	mux.HandleFunc("/files/delete", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			appHandler.HandleFileDelete(w, r)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/shares", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			appHandler.HandleShares(w, r)
+		} else if r.Method == http.MethodPost {
+			appHandler.HandleShareCreate(w, r)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/shares/revoke", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			appHandler.HandleShareRevoke(w, r)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	// Admin routes
+	mux.HandleFunc("/admin/audit", appHandler.HandleAuditLog)
+	mux.HandleFunc("/admin/webhooks", appHandler.HandleWebhookDeliveries)
+
+	// Public share routes (no login required)
+	mux.HandleFunc("/s/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			appHandler.HandleShareLanding(w, r)
+		} else if r.Method == http.MethodPost {
+			appHandler.HandleShareDownload(w, r)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	// Presigned downloads for the local storage backend
+	if localStorage != nil {
+		mux.Handle(localfs.RoutePrefix, localStorage)
+	}
 
 	// Shared routes
-	mux.HandleFunc("/health", healthCheck)
+	mux.HandleFunc("/health", appHandlers.NewHealthHandler(resilientStorage))
+	mux.HandleFunc("/healthz", health.LiveHandler())
+	mux.HandleFunc("/readyz", readiness.ReadyHandler())
+
+	// Prometheus metrics
+	if cfg.Metrics.Enabled {
+		mux.Handle("/metrics", metrics.Handler(metrics.HandlerConfig{Token: cfg.Metrics.Token, AllowedNets: cfg.Metrics.AllowedNets}))
+	}
 
 	// Static file serving
 	mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("shared/static/"))))
 
+	rules, err := ratelimit.ParseRules(cfg.Server.RateLimits)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid rate limits: %w", err)
+	}
+	limits := ratelimit.Config{Rules: rules, TrustedProxies: cfg.Server.TrustedProxies}
+
+	router := flash.Middleware([]byte(cfg.Server.CookieKey), mux)
+	router = csrf.Middleware(appRenderer, audit.Middleware(auditRecorder, router))
+	router = ratelimit.Middleware(ratelimit.NewMemoryStore(), limits, appRenderer, router)
+	router = session.Middleware([]byte(cfg.Server.CookieKey), router)
+	return secheaders.Middleware(appHandlers.SecurityHeaders(cfg), router), shutdownHooks, nil
+}
+
+func main() {
+	if handled, err := config.HandleCommand(os.Args[1:], os.Stdout, os.Stderr); handled {
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	log.Println("🚀 Starting combined Go S3 Uploader service...")
+
+	// Load configuration shared by the auth and app routes
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	logging.Setup(cfg.Log.Level)
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing.Exporter, "uploader")
+	if err != nil {
+		log.Fatalf("Failed to initialize tracing: %v", err)
+	}
+
+	router, shutdownHooks, err := newRouter(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize server: %v", err)
+	}
+	go cfg.RefreshSecrets(context.Background()) // Rotates secrets newRouter watches
+
 	// Determine port - App Runner sets PORT environment variable
 	port := os.Getenv("PORT")
 	if port == "" {
 		// Fallback to app server port for local development
-		port = appAppConfig.PortAppServer
-		if port == "" {
-			port = "8080" // Default fallback
-		}
+		port = cfg.Server.AppPort
 	}
 
 	log.Printf("🌐 Server starting on port %s", port)
 	log.Printf("📍 Auth routes: /login, /auth/google, /auth/callback, /logout")
-	log.Printf("📍 App routes: /, /upload, /api/upload, /success")
-	log.Printf("🔧 Health check: /health")
+	log.Printf("📍 App routes: /, /upload, /api/upload, /success, /files, /files/delete, /download, /shares")
+	log.Printf("📍 Share routes: /s/{token}")
+	log.Printf("📍 Admin routes: /admin/audit, /admin/webhooks")
+	log.Printf("🔧 Health checks: /healthz (liveness), /readyz (readiness), /health")
+	if cfg.Metrics.Enabled {
+		log.Printf("📊 Metrics: /metrics")
+	}
 	log.Printf("📁 Static files: /static/")
 
-	log.Fatal(http.ListenAndServe(":"+port, mux))
+	srv := server.New(":"+port, tracing.Middleware(logging.Middleware(metrics.Middleware(router))), server.Config{
+		ReadTimeout:     cfg.Server.ReadTimeout,
+		WriteTimeout:    cfg.Server.WriteTimeout,
+		ShutdownTimeout: cfg.Server.ShutdownTimeout,
+	})
+	for _, hook := range shutdownHooks {
+		srv.OnShutdown(hook)
+	}
+	srv.OnShutdown(shutdownTracing) // Last, so spans from the other hooks are flushed
+	if err := srv.ListenAndServe(); err != nil {
+		log.Fatalf("Server error: %v", err)
+	}
 }
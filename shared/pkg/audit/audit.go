@@ -0,0 +1,190 @@
+// Package audit records who signed in, uploaded, downloaded, shared or
+// deleted what, and when. Handlers call Record; the Recorder installed by
+// Middleware fills in where the request came from and writes the event to
+// every configured sink.
+package audit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/models"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/ratelimit"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/session"
+)
+
+// Actions
+const (
+	LoginSuccess = "login.success"
+	LoginFailure = "login.failure"
+	Logout       = "logout"
+	FileUpload   = "file.upload"
+	FileDownload = "file.download"
+	FileDelete   = "file.delete"
+	ShareCreate  = "share.create"
+	ShareRevoke  = "share.revoke"
+	ShareAccess  = "share.access"
+	AdminSearch  = "admin.audit_search"
+)
+
+// Actions lists every action, for search forms
+var Actions = []string{
+	LoginSuccess, LoginFailure, Logout,
+	FileUpload, FileDownload, FileDelete,
+	ShareCreate, ShareRevoke, ShareAccess,
+	AdminSearch,
+}
+
+// ErrNotSearchable is returned by Search when no sink can be searched
+var ErrNotSearchable = errors.New("no audit sink supports search")
+
+// Sink stores audit events
+type Sink interface {
+	RecordAuditEvent(ctx context.Context, event models.AuditEvent) error
+}
+
+// Searcher is implemented by sinks that can look events up again
+type Searcher interface {
+	// SearchAuditEvents returns the matching events, newest first
+	SearchAuditEvents(ctx context.Context, q models.AuditQuery) ([]models.AuditEvent, error)
+}
+
+// Closer is implemented by sinks that hold buffered events or open files
+type Closer interface {
+	Close(ctx context.Context) error
+}
+
+// Recorder writes events to its sinks
+type Recorder struct {
+	sinks   []Sink
+	trusted []*net.IPNet // Proxies whose X-Forwarded-For names the client
+}
+
+// New creates a recorder writing to sinks. A recorder without sinks drops every event.
+func New(trusted []*net.IPNet, sinks ...Sink) *Recorder {
+	return &Recorder{sinks: sinks, trusted: trusted}
+}
+
+// Record writes the event to every sink. A failing sink is logged and does
+// not stop the others, nor the request that caused the event.
+func (rec *Recorder) Record(ctx context.Context, event models.AuditEvent) {
+	if event.ID == "" {
+		event.ID = newID()
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	for _, sink := range rec.sinks {
+		if err := sink.RecordAuditEvent(ctx, event); err != nil {
+			sinkErrors.WithLabelValues(sinkName(sink)).Inc()
+			slog.Error("failed to record audit event", "sink", sinkName(sink), "action", event.Action, "err", err)
+		}
+	}
+}
+
+// Search looks events up in the first sink that supports it
+func (rec *Recorder) Search(ctx context.Context, q models.AuditQuery) ([]models.AuditEvent, error) {
+	for _, sink := range rec.sinks {
+		if s, ok := sink.(Searcher); ok {
+			return s.SearchAuditEvents(ctx, q)
+		}
+	}
+	return nil, ErrNotSearchable
+}
+
+// Close flushes and closes the sinks; it is meant as a shutdown hook
+func (rec *Recorder) Close(ctx context.Context) error {
+	var errs []error
+	for _, sink := range rec.sinks {
+		if c, ok := sink.(Closer); ok {
+			if err := c.Close(ctx); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", sinkName(sink), err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+type contextKey struct{}
+
+// Middleware makes rec available to Record and Search
+func Middleware(rec *Recorder, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inner := r.WithContext(context.WithValue(r.Context(), contextKey{}, rec))
+		next.ServeHTTP(w, inner)
+		// The mux records the matched pattern on our copy; pass it out as it would
+		r.Pattern = inner.Pattern
+	})
+}
+
+// Record records an action on objectKey by actor, or by the user that
+// session.Middleware verified when actor is nil. A session cookie that fails
+// verification leaves the event without an actor rather than naming whoever
+// the cookie claims. It does nothing outside the middleware.
+func Record(r *http.Request, action string, actor *models.User, objectKey, detail string) {
+	if actor == nil {
+		actor = session.User(r)
+	}
+	record(r, action, actor, objectKey, detail)
+}
+
+// RecordAnonymous records an action that nobody is accountable for, such as a
+// failed sign-in, without an actor even when the request has a valid session
+func RecordAnonymous(r *http.Request, action, objectKey, detail string) {
+	record(r, action, nil, objectKey, detail)
+}
+
+func record(r *http.Request, action string, actor *models.User, objectKey, detail string) {
+	rec, ok := r.Context().Value(contextKey{}).(*Recorder)
+	if !ok {
+		return
+	}
+	event := models.AuditEvent{
+		Action:    action,
+		IP:        ratelimit.ClientIP(r, rec.trusted),
+		UserAgent: r.UserAgent(),
+		ObjectKey: objectKey,
+		Detail:    detail,
+	}
+	if actor != nil {
+		event.ActorID, event.ActorEmail = actor.ID, actor.Email
+	}
+	// The event must be kept even if the client goes away mid-request
+	rec.Record(context.WithoutCancel(r.Context()), event)
+}
+
+// Search runs q against the recorder installed by the middleware
+func Search(r *http.Request, q models.AuditQuery) ([]models.AuditEvent, error) {
+	rec, ok := r.Context().Value(contextKey{}).(*Recorder)
+	if !ok {
+		return nil, ErrNotSearchable
+	}
+	return rec.Search(r.Context(), q)
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// sinkName names a sink for logs and metrics
+func sinkName(sink Sink) string {
+	switch sink.(type) {
+	case *FileSink:
+		return "file"
+	case *S3Sink:
+		return "s3"
+	case Searcher: // The metadata store
+		return "db"
+	default:
+		return fmt.Sprintf("%T", sink)
+	}
+}
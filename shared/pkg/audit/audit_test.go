@@ -0,0 +1,174 @@
+package audit_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/audit"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/models"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/session"
+)
+
+// memorySink keeps events in order, optionally failing every write
+type memorySink struct {
+	mu     sync.Mutex
+	events []models.AuditEvent
+	err    error
+}
+
+func (s *memorySink) RecordAuditEvent(ctx context.Context, event models.AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.events = append(s.events, event)
+	return nil
+}
+
+func TestRecord_FromRequest(t *testing.T) {
+	failing := &memorySink{err: errors.New("disk full")}
+	sink := &memorySink{}
+	rec := audit.New(nil, failing, sink)
+
+	key := []byte("0123456789abcdef0123456789abcdef")
+	h := session.Middleware(key, audit.Middleware(rec, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		audit.Record(r, audit.FileUpload, nil, "uploads/u1/1_a.png", "9 bytes")
+		audit.RecordAnonymous(r, audit.LoginFailure, "", "invalid_state")
+	})))
+	req := httptest.NewRequest(http.MethodPost, "/upload", nil)
+	req.RemoteAddr = "192.0.2.1:1000"
+	req.Header.Set("User-Agent", "test-agent")
+	cookie, _ := session.Encode(key, &models.User{ID: "u1", Email: "ada@example.com", Created: time.Now()})
+	req.AddCookie(&http.Cookie{Name: session.CookieName, Value: cookie})
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	if len(sink.events) != 2 {
+		t.Fatalf("recorded %d events past a failing sink, want 2", len(sink.events))
+	}
+	upload := sink.events[0]
+	if upload.ID == "" || upload.Time.IsZero() || upload.ActorID != "u1" || upload.ActorEmail != "ada@example.com" ||
+		upload.IP != "192.0.2.1" || upload.UserAgent != "test-agent" || upload.ObjectKey != "uploads/u1/1_a.png" {
+		t.Errorf("upload event = %+v, want the session user and client filled in", upload)
+	}
+	if failure := sink.events[1]; failure.ActorID != "" || failure.Detail != "invalid_state" {
+		t.Errorf("failure event = %+v, want no actor", failure)
+	}
+
+	// A forged cookie names nobody
+	req = httptest.NewRequest(http.MethodPost, "/upload", nil)
+	forged := base64.StdEncoding.EncodeToString([]byte(`{"id":"u2","email":"admin@example.com"}`))
+	req.AddCookie(&http.Cookie{Name: session.CookieName, Value: forged})
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if len(sink.events) != 4 || sink.events[2].ActorID != "" || sink.events[2].ActorEmail != "" {
+		t.Errorf("event with a forged session = %+v, want no actor", sink.events[2:])
+	}
+
+	// Outside the middleware Record does nothing
+	audit.Record(httptest.NewRequest(http.MethodGet, "/", nil), audit.Logout, nil, "", "")
+	if len(sink.events) != 4 {
+		t.Error("Record without the middleware stored an event")
+	}
+}
+
+func TestFileSink_Search(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "logs", "audit.jsonl")
+	sink, err := audit.NewFileSink(path)
+	if err != nil {
+		t.Fatalf("NewFileSink() error = %v", err)
+	}
+	defer sink.Close(ctx)
+
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	for i, action := range []string{audit.LoginSuccess, audit.FileUpload, audit.FileDownload, audit.FileUpload} {
+		event := models.AuditEvent{ID: string(rune('a' + i)), Time: start.Add(time.Duration(i) * time.Hour), Action: action, ActorID: "u1"}
+		if err := sink.RecordAuditEvent(ctx, event); err != nil {
+			t.Fatalf("RecordAuditEvent() error = %v", err)
+		}
+	}
+
+	events, err := sink.SearchAuditEvents(ctx, models.AuditQuery{Action: "file", Limit: 2})
+	if err != nil {
+		t.Fatalf("SearchAuditEvents() error = %v", err)
+	}
+	if len(events) != 2 || events[0].ID != "d" || events[1].ID != "c" {
+		t.Errorf("SearchAuditEvents() = %+v, want the two newest file events", events)
+	}
+
+	events, _ = sink.SearchAuditEvents(ctx, models.AuditQuery{Actor: "u1", Until: start.Add(time.Hour)})
+	if len(events) != 1 || events[0].Action != audit.LoginSuccess {
+		t.Errorf("SearchAuditEvents() before the upload = %+v", events)
+	}
+}
+
+// bucket records uploaded objects, failing while err is set
+type bucket struct {
+	mu      sync.Mutex
+	objects map[string]string
+	err     error
+}
+
+func (b *bucket) UploadFile(ctx context.Context, key string, file io.Reader, contentType string) error {
+	data, _ := io.ReadAll(file)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err != nil {
+		return b.err
+	}
+	b.objects[key] = string(data)
+	return nil
+}
+
+func (b *bucket) lines() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := 0
+	for _, data := range b.objects {
+		scanner := bufio.NewScanner(strings.NewReader(data))
+		for scanner.Scan() {
+			n++
+		}
+	}
+	return n
+}
+
+func TestS3Sink_Batches(t *testing.T) {
+	ctx := context.Background()
+	b := &bucket{objects: make(map[string]string), err: errors.New("unavailable")}
+	sink := audit.NewS3Sink(b, "audit/", 2, time.Hour)
+
+	event := models.AuditEvent{Time: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC), Action: audit.Logout}
+	for range 3 {
+		sink.RecordAuditEvent(ctx, event)
+	}
+
+	// A full batch is written without waiting for the interval; while the
+	// bucket fails the events stay queued
+	time.Sleep(50 * time.Millisecond)
+	b.mu.Lock()
+	b.err = nil
+	b.mu.Unlock()
+
+	if err := sink.Close(ctx); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if len(b.objects) != 2 || b.lines() != 3 {
+		t.Errorf("objects = %v, want 3 events in batches of at most 2", b.objects)
+	}
+	for key := range b.objects {
+		if !strings.HasPrefix(key, "audit/2026/01/02/") || !strings.HasSuffix(key, ".jsonl") {
+			t.Errorf("object key %q, want it under audit/ by date", key)
+		}
+	}
+}
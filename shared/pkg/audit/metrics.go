@@ -0,0 +1,13 @@
+package audit
+
+import (
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var sinkErrors = promauto.With(metrics.Registry).NewCounterVec(prometheus.CounterOpts{
+	Namespace: metrics.Namespace,
+	Name:      "audit_sink_errors_total",
+	Help:      "Audit events or batches a sink failed to store, by sink.",
+}, []string{"sink"})
@@ -0,0 +1,52 @@
+package audit
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+)
+
+// Config selects the sinks Open creates
+type Config struct {
+	Sinks          []string // "file", "db" and "s3"; searches use the first of file and db
+	File           string   // Path of the file sink
+	S3Prefix       string
+	BatchSize      int
+	FlushInterval  time.Duration
+	TrustedProxies []*net.IPNet
+}
+
+// Open creates a recorder for cfg. db and storage back the "db" and "s3"
+// sinks; when either is nil, as on the standalone auth server, its sink is
+// skipped with a warning.
+func Open(cfg Config, db Sink, storage Uploader) (*Recorder, error) {
+	var sinks []Sink
+	for _, name := range cfg.Sinks {
+		switch name = strings.TrimSpace(name); name {
+		case "":
+		case "file":
+			sink, err := NewFileSink(cfg.File)
+			if err != nil {
+				return nil, err
+			}
+			sinks = append(sinks, sink)
+		case "db":
+			if db == nil {
+				slog.Warn("audit sink unavailable in this server, skipping", "sink", name)
+				continue
+			}
+			sinks = append(sinks, db)
+		case "s3":
+			if storage == nil {
+				slog.Warn("audit sink unavailable in this server, skipping", "sink", name)
+				continue
+			}
+			sinks = append(sinks, NewS3Sink(storage, cfg.S3Prefix, cfg.BatchSize, cfg.FlushInterval))
+		default:
+			return nil, fmt.Errorf("unknown audit sink %q", name)
+		}
+	}
+	return New(cfg.TrustedProxies, sinks...), nil
+}
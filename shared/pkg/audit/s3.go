@@ -0,0 +1,137 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/models"
+)
+
+// Uploader stores an object; the app's storage client implements it
+type Uploader interface {
+	UploadFile(ctx context.Context, key string, file io.Reader, contentType string) error
+}
+
+// maxPendingBatches bounds how many batches S3Sink holds while uploads fail
+const maxPendingBatches = 100
+
+// S3Sink collects events and stores each batch as one JSON lines object
+// under prefix, named by the date and time of its first event. A batch goes
+// out when it is full, after the flush interval, and on Close.
+type S3Sink struct {
+	uploader  Uploader
+	prefix    string
+	batchSize int
+
+	mu      sync.Mutex
+	pending []models.AuditEvent
+
+	flushNow chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// NewS3Sink starts a sink writing batches of up to batchSize events to uploader
+func NewS3Sink(uploader Uploader, prefix string, batchSize int, flushInterval time.Duration) *S3Sink {
+	s := &S3Sink{
+		uploader:  uploader,
+		prefix:    prefix,
+		batchSize: batchSize,
+		flushNow:  make(chan struct{}, 1),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go s.run(flushInterval)
+	return s
+}
+
+// RecordAuditEvent queues the event for the next batch
+func (s *S3Sink) RecordAuditEvent(ctx context.Context, event models.AuditEvent) error {
+	s.mu.Lock()
+	s.pending = append(s.pending, event)
+	full := len(s.pending) >= s.batchSize
+	s.mu.Unlock()
+
+	if full {
+		select {
+		case s.flushNow <- struct{}{}:
+		default: // A flush is already due
+		}
+	}
+	return nil
+}
+
+// Close writes out the queued events and stops the sink
+func (s *S3Sink) Close(ctx context.Context) error {
+	close(s.stop)
+	<-s.done
+	return s.flush(ctx)
+}
+
+func (s *S3Sink) run(interval time.Duration) {
+	defer close(s.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		case <-s.flushNow:
+		}
+		if err := s.flush(context.Background()); err != nil {
+			slog.Error("failed to write audit batch", "err", err)
+		}
+	}
+}
+
+// flush writes the queued events in batches. Batches that fail stay queued
+// for the next flush, up to maxPendingBatches, beyond which the oldest are dropped.
+func (s *S3Sink) flush(ctx context.Context) error {
+	s.mu.Lock()
+	events := s.pending
+	s.pending = nil
+	s.mu.Unlock()
+
+	for len(events) > 0 {
+		n := min(len(events), s.batchSize)
+		if err := s.write(ctx, events[:n]); err != nil {
+			sinkErrors.WithLabelValues("s3").Inc()
+			s.requeue(events)
+			return err
+		}
+		events = events[n:]
+	}
+	return nil
+}
+
+func (s *S3Sink) write(ctx context.Context, batch []models.AuditEvent) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, event := range batch {
+		if err := enc.Encode(event); err != nil {
+			return err
+		}
+	}
+	// Events are in time order, so the first one dates the batch
+	key := fmt.Sprintf("%s%s-%s.jsonl", s.prefix, batch[0].Time.UTC().Format("2006/01/02/150405"), newID())
+	return s.uploader.UploadFile(ctx, key, &buf, "application/x-ndjson")
+}
+
+// requeue puts events that could not be written back in front of newer ones
+func (s *S3Sink) requeue(events []models.AuditEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending = append(events, s.pending...)
+	if limit := maxPendingBatches * s.batchSize; len(s.pending) > limit {
+		dropped := len(s.pending) - limit
+		s.pending = s.pending[dropped:]
+		slog.Error("dropped audit events that could not be written", "count", dropped)
+	}
+}
@@ -0,0 +1,456 @@
+// Package config loads the configuration shared by the auth server, the app
+// server and the combined binary. Values are layered, later sources winning:
+// defaults, a YAML or TOML file, .env, environment variables and flags.
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/models"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/ratelimit"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/secrets"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/tracing"
+)
+
+// Config is the typed configuration, one section per subsystem. Each field's
+// tags give its key in config files, its environment variable and whether it
+// is a secret, which `config print` redacts. A secret may instead be given as
+// a reference (file:, secretsmanager: or ssm:) or through <VAR>_FILE.
+type Config struct {
+	Env string `config:"env" env:"ENV"` // "production" turns on the production defaults and checks
+
+	Server   ServerConfig   `config:"server"`
+	Auth     AuthConfig     `config:"auth"`
+	Storage  StorageConfig  `config:"storage"`
+	Shares   SharesConfig   `config:"shares"`
+	Security SecurityConfig `config:"security"`
+	Audit    AuditConfig    `config:"audit"`
+	Webhooks WebhooksConfig `config:"webhooks"`
+	Log      LogConfig      `config:"log"`
+	Metrics  MetricsConfig  `config:"metrics"`
+	Tracing  TracingConfig  `config:"tracing"`
+	Secrets  SecretsConfig  `config:"secrets"`
+
+	sources  map[string]string    // Where each key's value came from, for config print
+	refs     map[string]reference // Secrets resolved from a reference, by key
+	resolver *secrets.Resolver
+	watcher  *secrets.Watcher
+}
+
+// ServerConfig holds the listeners and public URLs
+type ServerConfig struct {
+	AppPort         string        `config:"app_port" env:"PORT_APP_SERVER"`
+	AuthPort        string        `config:"auth_port" env:"PORT_AUTH_SERVER"`
+	AppURL          string        `config:"app_url" env:"APP_SERVER_URL"`   // Public URL of the app server
+	AuthURL         string        `config:"auth_url" env:"AUTH_SERVER_URL"` // Public URL of the auth server; defaults to AppURL for the combined binary
+	ReadTimeout     time.Duration `config:"read_timeout" env:"HTTP_READ_TIMEOUT"`
+	WriteTimeout    time.Duration `config:"write_timeout" env:"HTTP_WRITE_TIMEOUT"`
+	ShutdownTimeout time.Duration `config:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`           // How long in-flight requests may finish after SIGTERM
+	CookieKey       string        `config:"cookie_key" env:"COOKIE_SIGNING_KEY" secret:"true"` // Signs session and flash message cookies; every server must share it. Read at startup only.
+	TrustedProxies  []*net.IPNet  `config:"trusted_proxies" env:"TRUSTED_PROXY_CIDRS"`         // Proxies whose X-Forwarded-For names the client
+	RateLimits      string        `config:"rate_limits" env:"RATE_LIMITS"`                     // e.g. "/api/upload:requests=30/1m,bytes=500MB/1h"; empty turns limiting off
+
+	ServiceDomain string `config:"-"` // Host of AppURL, used as the session cookie domain
+}
+
+// AuthConfig holds the Google OAuth client
+type AuthConfig struct {
+	GoogleClientID     string `config:"google_client_id" env:"GOOGLE_CLIENT_ID"`
+	GoogleClientSecret string `config:"google_client_secret" env:"GOOGLE_CLIENT_SECRET" secret:"true"`
+	RedirectURL        string `config:"redirect_url" env:"REDIRECT_URL"`
+	AdminIDs           string `config:"admin_ids" env:"ADMIN_IDS"` // Comma-separated Google account IDs (the sub claim) of the admins
+}
+
+// IsAdmin reports whether user is one of the admins. Admins are named by
+// account ID, which unlike an email address is never reassigned, and must
+// have signed in with a verified email.
+func (a AuthConfig) IsAdmin(user *models.User) bool {
+	if user == nil || user.ID == "" || !user.EmailVerified {
+		return false
+	}
+	for _, admin := range SplitList(a.AdminIDs) {
+		if admin == user.ID {
+			return true
+		}
+	}
+	return false
+}
+
+// StorageConfig selects and tunes the upload backend
+type StorageConfig struct {
+	Backend         string `config:"backend" env:"STORAGE_BACKEND"` // "s3" or "local"
+	LocalDir        string `config:"local_dir" env:"LOCAL_STORAGE_DIR"`
+	LocalSigningKey string `config:"local_signing_key" env:"LOCAL_STORAGE_SIGNING_KEY" secret:"true"` // Empty uses a random per-process key
+
+	Region          string `config:"region" env:"AWS_REGION"`
+	Bucket          string `config:"bucket" env:"S3_BUCKET_NAME"`
+	Endpoint        string `config:"endpoint" env:"S3_ENDPOINT"` // S3-compatible store (MinIO, Ceph); empty uses AWS
+	UsePathStyle    bool   `config:"use_path_style" env:"S3_USE_PATH_STYLE"`
+	CABundle        string `config:"ca_bundle" env:"S3_CA_BUNDLE"`
+	AccessKeyID     string `config:"access_key_id" env:"S3_ACCESS_KEY_ID"` // Empty uses the default AWS credential chain
+	SecretAccessKey string `config:"secret_access_key" env:"S3_SECRET_ACCESS_KEY" secret:"true"`
+	SessionToken    string `config:"session_token" env:"S3_SESSION_TOKEN" secret:"true"`
+
+	SSEMode        string `config:"sse_mode" env:"S3_SSE_MODE"` // "", "SSE-S3", "SSE-KMS" or "SSE-C"; checked by the s3 package
+	SSEKMSKeyID    string `config:"sse_kms_key_id" env:"S3_SSE_KMS_KEY_ID"`
+	SSEBucketKey   bool   `config:"sse_bucket_key" env:"S3_SSE_BUCKET_KEY"`
+	SSECustomerKey string `config:"sse_customer_key" env:"S3_SSE_C_KEY" secret:"true"`
+	CSEMasterKey   []byte `config:"cse_master_key" env:"CSE_MASTER_KEY" secret:"true"` // Base64 256-bit key; empty disables client-side encryption
+
+	RetryMode        string        `config:"retry_mode" env:"S3_RETRY_MODE"`     // "standard" or "adaptive"
+	MaxAttempts      int           `config:"max_attempts" env:"S3_MAX_ATTEMPTS"` // Per request, including retries; 0 uses the SDK default
+	OperationTimeout time.Duration `config:"operation_timeout" env:"STORAGE_OPERATION_TIMEOUT"`
+	UploadTimeout    time.Duration `config:"upload_timeout" env:"STORAGE_UPLOAD_TIMEOUT"`
+	BreakerFailures  int           `config:"breaker_failures" env:"STORAGE_BREAKER_FAILURES"` // 0 disables the circuit breaker
+	BreakerCooldown  time.Duration `config:"breaker_cooldown" env:"STORAGE_BREAKER_COOLDOWN"`
+
+	FaultInjection string `config:"fault_injection" env:"FAULT_INJECTION"` // e.g. "get:latency=200ms,error=0.1"; refused in production
+}
+
+// SharesConfig controls share links
+type SharesConfig struct {
+	DownloadMode string        `config:"download_mode" env:"SHARE_DOWNLOAD_MODE"` // "proxy" or "presign"
+	PresignTTL   time.Duration `config:"presign_ttl" env:"SHARE_PRESIGN_TTL"`
+}
+
+// SecurityConfig controls the browser security headers
+type SecurityConfig struct {
+	HSTSMaxAge          time.Duration `config:"hsts_max_age" env:"HSTS_MAX_AGE"`                   // Sent on HTTPS requests; 0 turns HSTS off
+	CSPReportOnly       bool          `config:"csp_report_only" env:"CSP_REPORT_ONLY"`             // Report CSP violations without blocking them
+	ShareFrameAncestors string        `config:"share_frame_ancestors" env:"SHARE_FRAME_ANCESTORS"` // Space-separated sites that may embed share pages; empty forbids it
+}
+
+// AuditConfig selects where audit events are written
+type AuditConfig struct {
+	Sinks         string        `config:"sinks" env:"AUDIT_SINKS"`                         // Comma-separated: file, db, s3; the first of file and db serves searches
+	File          string        `config:"file" env:"AUDIT_FILE"`                           // JSON lines file for the file sink
+	S3Prefix      string        `config:"s3_prefix" env:"AUDIT_S3_PREFIX"`                 // Key prefix for batches written to the upload bucket
+	BatchSize     int           `config:"s3_batch_size" env:"AUDIT_S3_BATCH_SIZE"`         // Events per S3 object
+	FlushInterval time.Duration `config:"s3_flush_interval" env:"AUDIT_S3_FLUSH_INTERVAL"` // Longest an event waits before its batch is written
+}
+
+// AuditSinks lists the sink names AuditConfig.Sinks accepts
+var AuditSinks = []string{"file", "db", "s3"}
+
+// devCookieKey signs cookies outside production when COOKIE_SIGNING_KEY is
+// unset, so separately started servers still trust each other's sessions
+const devCookieKey = "insecure-development-cookie-signing-key"
+
+// minCookieKeyLen is the shortest cookie signing key accepted
+const minCookieKeyLen = 32
+
+// WebhooksConfig controls the notifications sent when files are uploaded, deleted or shared
+type WebhooksConfig struct {
+	URLs        string        `config:"urls" env:"WEBHOOK_URLS"`                   // Comma-separated endpoints; empty sends none
+	Events      string        `config:"events" env:"WEBHOOK_EVENTS"`               // Comma-separated event types to send; empty sends all
+	Secret      string        `config:"secret" env:"WEBHOOK_SECRET" secret:"true"` // HMAC-SHA256 key for the signature header; read at startup only
+	MaxAttempts int           `config:"max_attempts" env:"WEBHOOK_MAX_ATTEMPTS"`   // Before a delivery becomes a dead letter
+	Backoff     time.Duration `config:"backoff" env:"WEBHOOK_BACKOFF"`             // Wait before the first retry; doubles after each failure
+	Timeout     time.Duration `config:"timeout" env:"WEBHOOK_TIMEOUT"`             // Per attempt
+}
+
+// LogConfig controls logging
+type LogConfig struct {
+	Level slog.Level `config:"level" env:"LOG_LEVEL"` // Debug unless ENV=production
+}
+
+// MetricsConfig controls the /metrics endpoint
+type MetricsConfig struct {
+	Enabled     bool         `config:"enabled" env:"METRICS_ENABLED"` // Turned off in production unless access is restricted
+	Token       string       `config:"token" env:"METRICS_TOKEN" secret:"true"`
+	AllowedNets []*net.IPNet `config:"allowed_cidrs" env:"METRICS_ALLOWED_CIDRS"`
+}
+
+// TracingConfig controls OpenTelemetry tracing
+type TracingConfig struct {
+	Exporter tracing.Exporter `config:"exporter" env:"TRACING_EXPORTER"` // none, stdout or otlp
+}
+
+// SecretsConfig controls how secret references are resolved
+type SecretsConfig struct {
+	Region          string        `config:"region" env:"SECRETS_AWS_REGION"`                 // Region for secretsmanager: and ssm: references; empty uses storage.region
+	RefreshInterval time.Duration `config:"refresh_interval" env:"SECRETS_REFRESH_INTERVAL"` // How often referenced secrets are re-read; 0 reads them only at startup
+}
+
+// DefaultRateLimits guards uploads, the OAuth callback and share password checks
+const DefaultRateLimits = "/upload:requests=30/1m,bytes=500MB/1h;" +
+	"/api/upload:requests=30/1m,bytes=500MB/1h;" +
+	"/auth/callback:requests=20/1m;" +
+	"/s/:requests=30/1m"
+
+// Default returns the configuration used when nothing is set
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			AppPort:         "8080",
+			AuthPort:        "8081",
+			ReadTimeout:     5 * time.Minute,
+			WriteTimeout:    10 * time.Minute,
+			ShutdownTimeout: 20 * time.Second,
+			RateLimits:      DefaultRateLimits,
+		},
+		Storage: StorageConfig{
+			Backend:          "s3",
+			LocalDir:         "./data/storage",
+			Region:           "ap-northeast-1",
+			Bucket:           "raymond-go-s3-uploader-dev-2025",
+			RetryMode:        "standard",
+			MaxAttempts:      3,
+			OperationTimeout: 10 * time.Second,
+			UploadTimeout:    2 * time.Minute,
+			BreakerFailures:  5,
+			BreakerCooldown:  30 * time.Second,
+		},
+		Shares: SharesConfig{
+			DownloadMode: "proxy", // Stream shared files through the app by default
+			PresignTTL:   5 * time.Minute,
+		},
+		Security: SecurityConfig{HSTSMaxAge: 365 * 24 * time.Hour},
+		Audit: AuditConfig{
+			Sinks:         "file,db",
+			File:          "./data/audit.jsonl",
+			S3Prefix:      "audit/",
+			BatchSize:     500,
+			FlushInterval: time.Minute,
+		},
+		Webhooks: WebhooksConfig{MaxAttempts: 6, Backoff: 10 * time.Second, Timeout: 10 * time.Second},
+		Log:      LogConfig{Level: slog.LevelDebug},
+		Metrics:  MetricsConfig{Enabled: true},
+		Tracing:  TracingConfig{Exporter: tracing.ExporterNone},
+		Secrets:  SecretsConfig{RefreshInterval: secrets.DefaultRefreshInterval},
+	}
+}
+
+// IsProduction reports whether ENV=production
+func (c *Config) IsProduction() bool {
+	return c.Env == "production"
+}
+
+// applyEnvDefaults fills in values whose defaults depend on ENV or on other
+// settings. isSet reports whether a key was given by any source.
+func (c *Config) applyEnvDefaults(isSet func(key string) bool) {
+	prod := c.IsProduction()
+	if prod && !isSet("log.level") {
+		c.Log.Level = slog.LevelInfo
+	}
+	if !prod {
+		if c.Auth.GoogleClientID == "" {
+			log.Println("⚠️  GOOGLE_CLIENT_ID not set.")
+			c.Auth.GoogleClientID = "your-google-client-id"
+		}
+		if c.Auth.GoogleClientSecret == "" {
+			log.Println("⚠️  GOOGLE_CLIENT_SECRET not set.")
+			c.Auth.GoogleClientSecret = "your-google-client-secret"
+		}
+		if c.Server.CookieKey == "" {
+			log.Println("⚠️  COOKIE_SIGNING_KEY not set, using an insecure development key.")
+			c.Server.CookieKey = devCookieKey
+		}
+		if c.Auth.RedirectURL == "" {
+			c.Auth.RedirectURL = fmt.Sprintf("http://localhost:%s/auth/callback", c.Server.AuthPort)
+			log.Printf("📍 Using default redirect URL: %s", c.Auth.RedirectURL)
+		}
+	}
+
+	// Only a configured URL names a cookie domain; localhost defaults do not
+	if c.Server.AppURL != "" {
+		if u, err := url.Parse(c.Server.AppURL); err == nil {
+			c.Server.ServiceDomain = u.Host
+		}
+	}
+	if c.Server.AppURL == "" && !prod {
+		c.Server.AppURL = fmt.Sprintf("http://localhost:%s", c.Server.AppPort)
+		log.Printf("📍 Using default App Server URL: %s", c.Server.AppURL)
+	}
+	if c.Server.AuthURL == "" {
+		c.Server.AuthURL = c.Server.AppURL // Both are served by one binary in production
+	}
+
+	if prod && c.Metrics.Enabled && c.Metrics.Token == "" && len(c.Metrics.AllowedNets) == 0 {
+		log.Println("⚠️  /metrics disabled: set METRICS_TOKEN or METRICS_ALLOWED_CIDRS to expose it in production")
+		c.Metrics.Enabled = false
+	}
+}
+
+// Validate reports every invalid or missing value, one per line, naming the
+// file key and the environment variable so either can be fixed
+func (c *Config) Validate() error {
+	var errs []error
+	fail := func(key, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s (%s): %s", key, envName(key), fmt.Sprintf(format, args...)))
+	}
+
+	if c.IsProduction() {
+		for key, value := range map[string]string{
+			"auth.google_client_id":     c.Auth.GoogleClientID,
+			"auth.google_client_secret": c.Auth.GoogleClientSecret,
+			"auth.redirect_url":         c.Auth.RedirectURL,
+			"server.app_url":            c.Server.AppURL,
+			"server.cookie_key":         c.Server.CookieKey,
+		} {
+			if value == "" {
+				fail(key, "required in production")
+			}
+		}
+		if c.Storage.FaultInjection != "" {
+			fail("storage.fault_injection", "must not be set in production")
+		}
+		if c.Server.CookieKey == devCookieKey {
+			fail("server.cookie_key", "the development key must not be used in production")
+		}
+	}
+	if n := len(c.Server.CookieKey); n > 0 && n < minCookieKeyLen {
+		fail("server.cookie_key", "want at least %d characters, got %d", minCookieKeyLen, n)
+	}
+	for key, value := range map[string]string{
+		"server.app_url":    c.Server.AppURL,
+		"server.auth_url":   c.Server.AuthURL,
+		"auth.redirect_url": c.Auth.RedirectURL,
+		"storage.endpoint":  c.Storage.Endpoint,
+	} {
+		if value == "" {
+			continue
+		}
+		if u, err := url.Parse(value); err != nil || u.Scheme == "" || u.Host == "" {
+			fail(key, "want an absolute URL such as https://example.com, got %q", value)
+		}
+	}
+
+	oneOf := func(key, value string, allowed ...string) {
+		for _, a := range allowed {
+			if value == a {
+				return
+			}
+		}
+		fail(key, "must be one of %q, got %q", allowed, value)
+	}
+	oneOf("storage.backend", c.Storage.Backend, "s3", "local")
+	oneOf("storage.retry_mode", c.Storage.RetryMode, "standard", "adaptive")
+	oneOf("shares.download_mode", c.Shares.DownloadMode, "proxy", "presign")
+	if c.Storage.Backend == "s3" && c.Storage.Bucket == "" {
+		fail("storage.bucket", "required for the s3 backend")
+	}
+	if c.Storage.Backend == "local" && c.Storage.LocalDir == "" {
+		fail("storage.local_dir", "required for the local backend")
+	}
+	if n := len(c.Storage.CSEMasterKey); n != 0 && n != 32 {
+		fail("storage.cse_master_key", "want a base64 256-bit key, got %d bytes", n)
+	}
+	for key, n := range map[string]int{
+		"storage.max_attempts":     c.Storage.MaxAttempts,
+		"storage.breaker_failures": c.Storage.BreakerFailures,
+	} {
+		if n < 0 {
+			fail(key, "must not be negative, got %d", n)
+		}
+	}
+
+	for key, d := range map[string]time.Duration{
+		"server.read_timeout":       c.Server.ReadTimeout,
+		"server.write_timeout":      c.Server.WriteTimeout,
+		"server.shutdown_timeout":   c.Server.ShutdownTimeout,
+		"storage.operation_timeout": c.Storage.OperationTimeout,
+		"storage.upload_timeout":    c.Storage.UploadTimeout,
+		"storage.breaker_cooldown":  c.Storage.BreakerCooldown,
+		"shares.presign_ttl":        c.Shares.PresignTTL,
+	} {
+		if d <= 0 {
+			fail(key, "must be a positive duration such as 30s, got %s", d)
+		}
+	}
+	if _, err := ratelimit.ParseRules(c.Server.RateLimits); err != nil {
+		fail("server.rate_limits", "%v", err)
+	}
+	if c.Security.HSTSMaxAge < 0 {
+		fail("security.hsts_max_age", "must not be negative, got %s", c.Security.HSTSMaxAge)
+	}
+	for _, sink := range strings.Split(c.Audit.Sinks, ",") {
+		switch sink = strings.TrimSpace(sink); sink {
+		case "":
+		case "file":
+			if c.Audit.File == "" {
+				fail("audit.file", "required for the file sink")
+			}
+		default:
+			oneOf("audit.sinks", sink, AuditSinks...)
+		}
+	}
+	if c.Audit.BatchSize <= 0 {
+		fail("audit.s3_batch_size", "must be positive, got %d", c.Audit.BatchSize)
+	}
+	if c.Audit.FlushInterval <= 0 {
+		fail("audit.s3_flush_interval", "must be a positive duration such as 30s, got %s", c.Audit.FlushInterval)
+	}
+	if c.Webhooks.URLs != "" && c.Webhooks.Secret == "" {
+		fail("webhooks.secret", "required when webhooks.urls is set")
+	}
+	for _, endpoint := range SplitList(c.Webhooks.URLs) {
+		if u, err := url.Parse(endpoint); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			fail("webhooks.urls", "want absolute http or https URLs, got %q", endpoint)
+		}
+	}
+	for _, event := range SplitList(c.Webhooks.Events) {
+		oneOf("webhooks.events", event, models.WebhookFileUploaded, models.WebhookFileDeleted, models.WebhookFileShared)
+	}
+	if c.Webhooks.MaxAttempts <= 0 {
+		fail("webhooks.max_attempts", "must be positive, got %d", c.Webhooks.MaxAttempts)
+	}
+	for key, d := range map[string]time.Duration{
+		"webhooks.backoff": c.Webhooks.Backoff,
+		"webhooks.timeout": c.Webhooks.Timeout,
+	} {
+		if d <= 0 {
+			fail(key, "must be a positive duration such as 30s, got %s", d)
+		}
+	}
+	if c.Secrets.RefreshInterval < 0 {
+		fail("secrets.refresh_interval", "must not be negative, got %s", c.Secrets.RefreshInterval)
+	}
+	if c.Shares.PresignTTL > 7*24*time.Hour {
+		fail("shares.presign_ttl", "S3 presigned URLs last at most 7 days, got %s", c.Shares.PresignTTL)
+	}
+
+	sortErrors(errs)
+	return errors.Join(errs...)
+}
+
+// SplitList splits a comma-separated value such as WEBHOOK_URLS, dropping blanks
+func SplitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// WatchSecret calls onChange with the new value whenever the reference behind
+// key, such as "auth.google_client_secret", resolves to something else. It
+// does nothing for secrets given directly, which cannot change.
+func (c *Config) WatchSecret(key string, onChange func(string)) {
+	ref, ok := c.refs[key]
+	if !ok || c.Secrets.RefreshInterval == 0 {
+		return
+	}
+	if c.watcher == nil {
+		c.watcher = secrets.NewWatcher(c.resolver, c.Secrets.RefreshInterval)
+	}
+	c.watcher.Watch(ref.ref, ref.value, onChange)
+}
+
+// RefreshSecrets re-reads watched secrets every secrets.refresh_interval
+// until ctx is done. It returns at once when nothing is watched.
+func (c *Config) RefreshSecrets(ctx context.Context) {
+	if c.watcher != nil {
+		c.watcher.Run(ctx)
+	}
+}
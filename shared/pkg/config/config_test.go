@@ -0,0 +1,273 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/secrets"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/secrets/secretstest"
+)
+
+// clearEnv unsets every variable Load reads so the host environment cannot leak in
+func clearEnv(t *testing.T) {
+	t.Helper()
+	for _, f := range fieldsOf(Default()) {
+		t.Setenv(f.env, "")
+		if f.secret {
+			t.Setenv(f.env+"_FILE", "")
+		}
+	}
+	t.Setenv("CONFIG_FILE", "")
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	clearEnv(t)
+	file := writeFile(t, "config.yaml", `
+storage:
+  bucket: from-file
+  region: from-file
+  max_attempts: 7
+shares:
+  presign_ttl: 10m
+server:
+  app_port: "9000"
+`)
+	envFile := writeFile(t, ".env", "S3_BUCKET_NAME=from-dotenv\nAWS_REGION=from-dotenv\n# comment\n")
+	t.Setenv("AWS_REGION", "from-env")
+	t.Setenv("SHARE_PRESIGN_TTL", "15m")
+
+	cfg, err := Load([]string{"--config", file, "--env-file", envFile, "--shares.presign-ttl", "20m"})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Storage.Bucket != "from-dotenv" || cfg.sources["storage.bucket"] != SourceDotEnv {
+		t.Errorf("bucket = %q from %s, want .env over file", cfg.Storage.Bucket, cfg.sources["storage.bucket"])
+	}
+	if cfg.Storage.Region != "from-env" {
+		t.Errorf("region = %q, want the environment over .env", cfg.Storage.Region)
+	}
+	if cfg.Shares.PresignTTL != 20*time.Minute || cfg.sources["shares.presign_ttl"] != SourceFlag {
+		t.Errorf("presign_ttl = %s from %s, want the flag", cfg.Shares.PresignTTL, cfg.sources["shares.presign_ttl"])
+	}
+	if cfg.Storage.MaxAttempts != 7 || cfg.Server.AppPort != "9000" {
+		t.Errorf("file values = %d, %q", cfg.Storage.MaxAttempts, cfg.Server.AppPort)
+	}
+	if cfg.Storage.BreakerFailures != 5 || cfg.sources["storage.breaker_failures"] != SourceDefault {
+		t.Errorf("breaker_failures = %d, want the default", cfg.Storage.BreakerFailures)
+	}
+	if cfg.Server.AppURL != "http://localhost:9000" || cfg.Server.AuthURL != cfg.Server.AppURL {
+		t.Errorf("dev URLs = %q, %q", cfg.Server.AppURL, cfg.Server.AuthURL)
+	}
+}
+
+func TestLoad_TOML(t *testing.T) {
+	clearEnv(t)
+	file := writeFile(t, "config.toml", `
+env = "production"
+[server]
+app_url = "https://uploader.example.com"
+cookie_key = "0123456789abcdef0123456789abcdef"
+[auth]
+google_client_id = "id"
+google_client_secret = "secret"
+redirect_url = "https://uploader.example.com/auth/callback"
+[metrics]
+allowed_cidrs = ["10.0.0.0/8", "192.168.0.0/16"]
+`)
+	cfg, err := Load([]string{"--config", file, "--env-file", ""})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if !cfg.IsProduction() || cfg.Log.Level != slog.LevelInfo {
+		t.Errorf("production defaults not applied: env %q, level %s", cfg.Env, cfg.Log.Level)
+	}
+	if cfg.Server.ServiceDomain != "uploader.example.com" || cfg.Server.AuthURL != "https://uploader.example.com" {
+		t.Errorf("derived server values = %+v", cfg.Server)
+	}
+	if len(cfg.Metrics.AllowedNets) != 2 || !cfg.Metrics.Enabled {
+		t.Errorf("metrics = %+v, want enabled with 2 networks", cfg.Metrics)
+	}
+}
+
+func TestLoad_ValidationMessages(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("ENV", "production")
+	t.Setenv("STORAGE_BACKEND", "ftp")
+	t.Setenv("SHARE_PRESIGN_TTL", "720h")
+	t.Setenv("FAULT_INJECTION", "get:error=1")
+	t.Setenv("RATE_LIMITS", "/upload:requests=lots")
+	t.Setenv("AUDIT_SINKS", "file,syslog")
+	t.Setenv("WEBHOOK_URLS", "https://hooks.example.com/a, ftp://hooks.example.com/b")
+	t.Setenv("COOKIE_SIGNING_KEY", "changeme")
+
+	_, err := Load([]string{"--env-file", ""})
+	if err == nil {
+		t.Fatal("Load succeeded, want validation errors")
+	}
+	for _, want := range []string{
+		"auth.google_client_id (GOOGLE_CLIENT_ID): required in production",
+		"server.app_url (APP_SERVER_URL): required in production",
+		`storage.backend (STORAGE_BACKEND): must be one of ["s3" "local"], got "ftp"`,
+		"shares.presign_ttl (SHARE_PRESIGN_TTL): S3 presigned URLs last at most 7 days",
+		"storage.fault_injection (FAULT_INJECTION): must not be set in production",
+		`server.rate_limits (RATE_LIMITS): rule "/upload:requests=lots": requests: expected <amount>/<duration>`,
+		`audit.sinks (AUDIT_SINKS): must be one of ["file" "db" "s3"], got "syslog"`,
+		"webhooks.secret (WEBHOOK_SECRET): required when webhooks.urls is set",
+		`webhooks.urls (WEBHOOK_URLS): want absolute http or https URLs, got "ftp://hooks.example.com/b"`,
+		"server.cookie_key (COOKIE_SIGNING_KEY): want at least 32 characters, got 8",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error is missing %q:\n%v", want, err)
+		}
+	}
+}
+
+func TestLoad_ParseErrors(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("STORAGE_UPLOAD_TIMEOUT", "soon")
+	t.Setenv("CSE_MASTER_KEY", "%%%")
+	file := writeFile(t, "config.yaml", "storage:\n  bukket: typo\n")
+
+	_, err := Load([]string{"--config", file, "--env-file", ""})
+	if err == nil {
+		t.Fatal("Load succeeded, want parse errors")
+	}
+	for _, want := range []string{
+		`storage.upload_timeout (STORAGE_UPLOAD_TIMEOUT): invalid value "soon" from env: want a duration`,
+		`storage.cse_master_key (CSE_MASTER_KEY): invalid value "[REDACTED]" from env: want base64`,
+		"storage.bukket: unknown key in " + file,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error is missing %q:\n%v", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), "%%%") {
+		t.Errorf("error leaks a secret:\n%v", err)
+	}
+}
+
+func TestHandleCommand_PrintRedactsSecrets(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("GOOGLE_CLIENT_SECRET", "hunter2")
+	t.Setenv("S3_BUCKET_NAME", "my-bucket")
+
+	var stdout, stderr bytes.Buffer
+	handled, err := HandleCommand([]string{"config", "print", "--env-file", "", "--metrics.token", "t0ken"}, &stdout, &stderr)
+	if !handled || err != nil {
+		t.Fatalf("HandleCommand = %v, %v", handled, err)
+	}
+	out := stdout.String()
+	for _, secret := range []string{"hunter2", "t0ken"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("output leaks %q:\n%s", secret, out)
+		}
+	}
+	for _, want := range []string{
+		"auth:\n",
+		`  google_client_secret: [REDACTED] # env, $GOOGLE_CLIENT_SECRET`,
+		`  token: [REDACTED] # flag, $METRICS_TOKEN`,
+		`  bucket: "my-bucket" # env, $S3_BUCKET_NAME`,
+		`  session_token: "" # default, $S3_SESSION_TOKEN`,
+		`  upload_timeout: 2m0s # default, $STORAGE_UPLOAD_TIMEOUT`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output is missing %q:\n%s", want, out)
+		}
+	}
+
+	if handled, _ := HandleCommand([]string{"--config", "x.yaml"}, &stdout, &stderr); handled {
+		t.Error("HandleCommand handled plain flags")
+	}
+}
+
+func TestLoad_SecretReferences(t *testing.T) {
+	clearEnv(t)
+	srv := secretstest.NewServer()
+	defer srv.Close()
+	srv.SetSecret("uploader/s3", `{"access_key_id":"AKIA","secret_access_key":"s3-secret"}`)
+	srv.SetParameter("/uploader/metrics-token", "t0ken")
+	resolver := secrets.NewResolver(secrets.WithSecretsManager(srv.SecretsManagerClient()), secrets.WithSSM(srv.SSMClient()))
+
+	t.Setenv("GOOGLE_CLIENT_SECRET_FILE", writeFile(t, "google", "from-file\n"))
+	t.Setenv("METRICS_TOKEN", "ssm:/uploader/metrics-token")
+	file := writeFile(t, "config.yaml", "storage:\n  access_key_id: AKIA\n  secret_access_key: secretsmanager:uploader/s3#secret_access_key\n")
+
+	cfg, err := Load([]string{"--config", file, "--env-file", ""}, WithResolver(resolver))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Auth.GoogleClientSecret != "from-file" || cfg.Metrics.Token != "t0ken" || cfg.Storage.SecretAccessKey != "s3-secret" {
+		t.Errorf("resolved secrets = %q, %q, %q", cfg.Auth.GoogleClientSecret, cfg.Metrics.Token, cfg.Storage.SecretAccessKey)
+	}
+
+	var out bytes.Buffer
+	if err := Print(&out, cfg); err != nil {
+		t.Fatal(err)
+	}
+	want := "  token: [REDACTED] # env ssm:/uploader/metrics-token, $METRICS_TOKEN"
+	if !strings.Contains(out.String(), want) || strings.Contains(out.String(), "s3-secret") {
+		t.Errorf("print output is missing %q or leaks a secret:\n%s", want, out.String())
+	}
+}
+
+func TestLoad_SecretReferenceErrors(t *testing.T) {
+	clearEnv(t)
+	srv := secretstest.NewServer()
+	defer srv.Close()
+	resolver := secrets.NewResolver(secrets.WithSSM(srv.SSMClient()))
+	t.Setenv("GOOGLE_CLIENT_SECRET", "direct")
+	t.Setenv("GOOGLE_CLIENT_SECRET_FILE", "/run/secrets/google")
+
+	_, err := Load([]string{"--env-file", ""}, WithResolver(resolver))
+	if err == nil || !strings.Contains(err.Error(), "set GOOGLE_CLIENT_SECRET or GOOGLE_CLIENT_SECRET_FILE, not both") {
+		t.Errorf("Load with both set = %v", err)
+	}
+
+	t.Setenv("GOOGLE_CLIENT_SECRET_FILE", "")
+	t.Setenv("METRICS_TOKEN", "ssm:/uploader/missing")
+	_, err = Load([]string{"--env-file", ""}, WithResolver(resolver))
+	if err == nil || !strings.Contains(err.Error(), "metrics.token (METRICS_TOKEN): cannot use ssm:/uploader/missing") {
+		t.Errorf("Load with a missing parameter = %v", err)
+	}
+}
+
+func TestConfig_WatchSecret(t *testing.T) {
+	clearEnv(t)
+	srv := secretstest.NewServer()
+	defer srv.Close()
+	srv.SetSecret("uploader/google", "v1")
+	resolver := secrets.NewResolver(secrets.WithSecretsManager(srv.SecretsManagerClient()))
+	t.Setenv("GOOGLE_CLIENT_SECRET", "secretsmanager:uploader/google")
+	t.Setenv("METRICS_TOKEN", "direct")
+
+	cfg, err := Load([]string{"--env-file", ""}, WithResolver(resolver))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	var rotated []string
+	cfg.WatchSecret("auth.google_client_secret", func(v string) { rotated = append(rotated, v) })
+	cfg.WatchSecret("metrics.token", func(v string) { t.Errorf("direct secret reported a change to %q", v) })
+
+	srv.SetSecret("uploader/google", "v2")
+	if err := cfg.watcher.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(rotated) != 1 || rotated[0] != "v2" {
+		t.Errorf("rotations = %q, want [v2]", rotated)
+	}
+}
@@ -0,0 +1,418 @@
+package config
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/logging"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/metrics"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/secrets"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/tracing"
+	"gopkg.in/yaml.v3"
+)
+
+// Source names recorded for each value and shown by config print
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceDotEnv  = ".env"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+// Option configures Load
+type Option func(*loadOptions)
+
+type loadOptions struct {
+	resolver *secrets.Resolver
+}
+
+// WithResolver resolves secret references with r instead of the default AWS clients
+func WithResolver(r *secrets.Resolver) Option {
+	return func(o *loadOptions) {
+		o.resolver = r
+	}
+}
+
+// reference records where a secret was resolved from and the value it had
+type reference struct {
+	ref   string
+	value string
+}
+
+// Load builds the configuration from args (flags, without the program name)
+// layered over the environment, .env and the config file, resolves secret
+// references, then validates it. The file is named by --config or
+// CONFIG_FILE; .env is read from --env-file.
+func Load(args []string, opts ...Option) (*Config, error) {
+	cfg, err := load(args, io.Discard, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return cfg, nil
+}
+
+// load layers every source without validating, so config print can show an invalid config
+func load(args []string, usage io.Writer, opts ...Option) (*Config, error) {
+	var o loadOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	cfg := Default()
+	fields := fieldsOf(cfg)
+	cfg.sources = make(map[string]string, len(fields))
+	for _, f := range fields {
+		cfg.sources[f.key] = SourceDefault
+	}
+
+	fs := flag.NewFlagSet("uploader", flag.ContinueOnError)
+	fs.SetOutput(usage)
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "YAML or TOML config file (overrides $CONFIG_FILE)")
+	envFile := fs.String("env-file", ".env", "file of KEY=value lines applied where the environment has no value")
+	flagValues := make(map[string]*string, len(fields))
+	for _, f := range fields {
+		flagValues[f.key] = fs.String(flagName(f.key), "", fmt.Sprintf("overrides $%s", f.env))
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %q", fs.Args())
+	}
+
+	var errs []error
+	pending := make(map[string]string) // Secret key -> reference still to resolve
+	set := func(f field, value, source string) {
+		if f.secret && secrets.IsReference(value) {
+			pending[f.key] = strings.TrimSpace(value)
+			cfg.sources[f.key] = source
+			return
+		}
+		delete(pending, f.key)
+		if err := setField(f.value, value); err != nil {
+			errs = append(errs, fmt.Errorf("%s (%s): invalid value %q from %s: %w", f.key, f.env, redact(f, value), source, err))
+			return
+		}
+		cfg.sources[f.key] = source
+	}
+
+	if *configFile != "" {
+		values, err := readFile(*configFile)
+		if err != nil {
+			return nil, err
+		}
+		byKey := make(map[string]field, len(fields))
+		for _, f := range fields {
+			byKey[f.key] = f
+		}
+		for key, value := range values {
+			f, ok := byKey[key]
+			if !ok {
+				errs = append(errs, fmt.Errorf("%s: unknown key in %s", key, *configFile))
+				continue
+			}
+			set(f, value, SourceFile+" "+filepath.Base(*configFile))
+		}
+	}
+
+	dotenv, err := applyDotEnv(*envFile)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range fields {
+		value := os.Getenv(f.env)
+		if path := os.Getenv(f.env + "_FILE"); f.secret && path != "" {
+			if value != "" {
+				errs = append(errs, fmt.Errorf("%s (%s): set %s or %s_FILE, not both", f.key, f.env, f.env, f.env))
+				continue
+			}
+			value = secrets.PrefixFile + path
+		}
+		if value == "" {
+			continue // An empty variable counts as unset
+		}
+		source := SourceEnv
+		if dotenv[f.env] {
+			source = SourceDotEnv
+		}
+		set(f, value, source)
+	}
+
+	explicit := make(map[string]bool)
+	fs.Visit(func(fl *flag.Flag) { explicit[fl.Name] = true })
+	for _, f := range fields {
+		if explicit[flagName(f.key)] {
+			set(f, *flagValues[f.key], SourceFlag)
+		}
+	}
+	if len(errs) == 0 && len(pending) > 0 {
+		errs = cfg.resolveSecrets(fields, pending, o.resolver)
+	}
+	if len(errs) > 0 {
+		sortErrors(errs)
+		return nil, fmt.Errorf("invalid configuration:\n%w", errors.Join(errs...))
+	}
+
+	cfg.applyEnvDefaults(func(key string) bool { return cfg.sources[key] != SourceDefault })
+	return cfg, nil
+}
+
+// resolveTimeout bounds resolving every secret reference at startup
+const resolveTimeout = 30 * time.Second
+
+// resolveSecrets replaces each pending reference with the secret it names
+func (c *Config) resolveSecrets(fields []field, pending map[string]string, resolver *secrets.Resolver) []error {
+	if resolver == nil {
+		region := c.Secrets.Region
+		if region == "" {
+			region = c.Storage.Region
+		}
+		resolver = secrets.NewResolver(secrets.WithRegion(region))
+	}
+	c.resolver = resolver
+	c.refs = make(map[string]reference, len(pending))
+
+	ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+	defer cancel()
+	var errs []error
+	for _, f := range fields {
+		ref, ok := pending[f.key]
+		if !ok {
+			continue
+		}
+		value, err := resolver.Resolve(ctx, ref)
+		if err == nil {
+			err = setField(f.value, value)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s (%s): cannot use %s: %w", f.key, f.env, ref, err))
+			continue
+		}
+		c.refs[f.key] = reference{ref: ref, value: value}
+	}
+	return errs
+}
+
+// field is one settable leaf of Config
+type field struct {
+	key    string // e.g. "storage.bucket"
+	env    string // e.g. "S3_BUCKET_NAME"
+	secret bool
+	value  reflect.Value
+}
+
+// fieldsOf lists cfg's settable fields in declaration order
+func fieldsOf(cfg *Config) []field {
+	var fields []field
+	var walk func(v reflect.Value, prefix string)
+	walk = func(v reflect.Value, prefix string) {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			name := sf.Tag.Get("config")
+			if name == "" || name == "-" {
+				continue
+			}
+			if sf.Type.Kind() == reflect.Struct && sf.Tag.Get("env") == "" {
+				walk(v.Field(i), prefix+name+".")
+				continue
+			}
+			fields = append(fields, field{
+				key:    prefix + name,
+				env:    sf.Tag.Get("env"),
+				secret: sf.Tag.Get("secret") == "true",
+				value:  v.Field(i),
+			})
+		}
+	}
+	walk(reflect.ValueOf(cfg).Elem(), "")
+	return fields
+}
+
+// envName returns the environment variable for a key, for error messages
+func envName(key string) string {
+	for _, f := range fieldsOf(&Config{}) {
+		if f.key == key {
+			return f.env
+		}
+	}
+	return ""
+}
+
+// flagName turns "server.app_url" into "server.app-url"
+func flagName(key string) string {
+	return strings.ReplaceAll(key, "_", "-")
+}
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	levelType    = reflect.TypeOf(slog.Level(0))
+	exporterType = reflect.TypeOf(tracing.Exporter(""))
+	netsType     = reflect.TypeOf([]*net.IPNet(nil))
+	bytesType    = reflect.TypeOf([]byte(nil))
+)
+
+// setField parses s into v according to v's type
+func setField(v reflect.Value, s string) error {
+	s = strings.TrimSpace(s)
+	switch v.Type() {
+	case durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return errors.New("want a duration such as 30s or 5m")
+		}
+		v.SetInt(int64(d))
+	case levelType:
+		level, err := logging.ParseLevel(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(level))
+	case exporterType:
+		exporter, err := tracing.ParseExporter(s)
+		if err != nil {
+			return err
+		}
+		v.SetString(string(exporter))
+	case netsType:
+		nets, err := metrics.ParseCIDRs(s)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(nets))
+	case bytesType:
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return errors.New("want base64")
+		}
+		if len(b) == 0 {
+			b = nil
+		}
+		v.SetBytes(b)
+	default:
+		switch v.Kind() {
+		case reflect.String:
+			v.SetString(s)
+		case reflect.Bool:
+			b, err := strconv.ParseBool(s)
+			if err != nil {
+				return errors.New("want true or false")
+			}
+			v.SetBool(b)
+		case reflect.Int:
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				return errors.New("want an integer")
+			}
+			v.SetInt(int64(n))
+		default:
+			return fmt.Errorf("unsupported type %s", v.Type())
+		}
+	}
+	return nil
+}
+
+// readFile flattens a YAML or TOML file into "section.key" values
+func readFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	var doc map[string]any
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &doc)
+	case ".toml":
+		err = toml.Unmarshal(data, &doc)
+	default:
+		return nil, fmt.Errorf("config file %s: want a .yaml, .yml or .toml extension", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	values := make(map[string]string)
+	var flatten func(prefix string, m map[string]any)
+	flatten = func(prefix string, m map[string]any) {
+		for k, v := range m {
+			switch v := v.(type) {
+			case map[string]any:
+				flatten(prefix+k+".", v)
+			case []any:
+				parts := make([]string, len(v))
+				for i, item := range v {
+					parts[i] = fmt.Sprint(item)
+				}
+				values[prefix+k] = strings.Join(parts, ",")
+			case nil:
+				values[prefix+k] = ""
+			default:
+				values[prefix+k] = fmt.Sprint(v)
+			}
+		}
+	}
+	flatten("", doc)
+	return values, nil
+}
+
+// applyDotEnv exports KEY=value lines from path for keys the environment does
+// not already set, so the AWS SDK sees them too, and returns the keys it set.
+// A missing file is not an error and an empty path skips it.
+func applyDotEnv(path string) (map[string]bool, error) {
+	if path == "" {
+		return nil, nil
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open env file: %w", err)
+	}
+	defer file.Close()
+
+	set := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if os.Getenv(key) == "" {
+			os.Setenv(key, value)
+			set[key] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read env file: %w", err)
+	}
+	return set, nil
+}
+
+// sortErrors orders messages so output is stable despite map iteration
+func sortErrors(errs []error) {
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+}
@@ -0,0 +1,109 @@
+package config
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const redacted = "[REDACTED]"
+
+// Print writes the effective configuration in the config file's YAML layout.
+// Secrets that are set are replaced by [REDACTED] and each line notes the
+// source its value came from.
+func Print(w io.Writer, cfg *Config) error {
+	section := ""
+	for _, f := range fieldsOf(cfg) {
+		prefix, name, nested := strings.Cut(f.key, ".")
+		if !nested {
+			name = prefix
+			prefix = ""
+		}
+		if prefix != section {
+			if _, err := fmt.Fprintf(w, "%s:\n", prefix); err != nil {
+				return err
+			}
+			section = prefix
+		}
+		indent := ""
+		if nested {
+			indent = "  "
+		}
+		value := formatValue(f.value)
+		if f.secret && value != `""` {
+			value = redacted
+		}
+		source := cfg.sources[f.key]
+		if source == "" {
+			source = SourceDefault
+		}
+		if ref, ok := cfg.refs[f.key]; ok {
+			source += " " + ref.ref
+		}
+		if _, err := fmt.Fprintf(w, "%s%s: %s # %s, $%s\n", indent, name, value, source, f.env); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HandleCommand runs `config print [flags]` when args (without the program
+// name) start with it and reports whether it did. Other args are left for
+// the caller, which normally passes them to Load.
+func HandleCommand(args []string, stdout, stderr io.Writer) (bool, error) {
+	if len(args) < 2 || args[0] != "config" || args[1] != "print" {
+		if len(args) > 0 && args[0] == "config" {
+			return true, fmt.Errorf("usage: config print [flags]")
+		}
+		return false, nil
+	}
+	cfg, err := load(args[2:], stderr)
+	if err != nil {
+		return true, err
+	}
+	if err := Print(stdout, cfg); err != nil {
+		return true, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return true, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return true, nil
+}
+
+// formatValue renders a field the way setField parses it
+func formatValue(v reflect.Value) string {
+	switch val := v.Interface().(type) {
+	case time.Duration:
+		return val.String()
+	case slog.Level:
+		return strings.ToLower(val.String())
+	case []*net.IPNet:
+		parts := make([]string, len(val))
+		for i, n := range val {
+			parts[i] = n.String()
+		}
+		return strconv.Quote(strings.Join(parts, ","))
+	case []byte:
+		return strconv.Quote(base64.StdEncoding.EncodeToString(val))
+	case bool:
+		return strconv.FormatBool(val)
+	case int:
+		return strconv.Itoa(val)
+	default:
+		return strconv.Quote(v.String())
+	}
+}
+
+// redact hides a secret's value in error messages
+func redact(f field, value string) string {
+	if f.secret && value != "" {
+		return redacted
+	}
+	return value
+}
@@ -0,0 +1,186 @@
+// Package csrf protects state-changing requests from cross-site request
+// forgery with double-submit tokens tied to the session. A random secret is
+// kept in a cookie and the token pages embed is an HMAC of the session cookie
+// under that secret, so a token is only good for the session it was issued to.
+package csrf
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/logging"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/models"
+)
+
+const (
+	CookieName    = "csrf_secret"  // Holds the per-browser secret
+	FieldName     = "csrf_token"   // Form field carrying the token
+	HeaderName    = "X-CSRF-Token" // Header alternative for scripts
+	SessionCookie = "user_session" // Cookie the token is bound to
+)
+
+// RejectedMessage is shown on the error page when a request fails the check
+const RejectedMessage = "This form has expired or was submitted from another site. Reload the page and try again."
+
+type contextKey struct{}
+
+// RendererIface renders the error page for rejected requests
+type RendererIface interface {
+	RenderTemplate(w io.Writer, name string, data any) error
+}
+
+// Middleware checks the token on every request that is not GET, HEAD,
+// OPTIONS or TRACE and makes the caller's token available through Token.
+// The token comes from the X-CSRF-Token header or the form. Bodies are read
+// before anyone is authenticated, so a multipart form must carry the token as
+// its first field and only the start of it is read.
+func Middleware(renderer RendererIface, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secret, hadSecret := secretFromCookie(r)
+		if !hadSecret {
+			secret = make([]byte, 32)
+			if _, err := rand.Read(secret); err != nil {
+				logging.FromRequest(r).Error("failed to generate CSRF secret", "err", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			http.SetCookie(w, &http.Cookie{
+				Name:     CookieName,
+				Value:    base64.RawURLEncoding.EncodeToString(secret),
+				Path:     "/",
+				HttpOnly: true,
+				Secure:   true,
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
+		token := sign(secret, sessionOf(r))
+
+		if !isSafe(r.Method) {
+			if !hadSecret || !hmac.Equal([]byte(submitted(r)), []byte(token)) {
+				// No path: share links carry their token in it
+				logging.FromRequest(r).Warn("rejected request without a valid CSRF token", "method", r.Method)
+				reject(renderer, w)
+				return
+			}
+		}
+		inner := r.WithContext(context.WithValue(r.Context(), contextKey{}, token))
+		next.ServeHTTP(w, inner)
+		// The mux records the matched pattern on our copy; pass it out as it would
+		r.Pattern = inner.Pattern
+	})
+}
+
+// Token returns the token forms in the response must submit, or "" outside the middleware
+func Token(r *http.Request) string {
+	token, _ := r.Context().Value(contextKey{}).(string)
+	return token
+}
+
+func secretFromCookie(r *http.Request) ([]byte, bool) {
+	cookie, err := r.Cookie(CookieName)
+	if err != nil {
+		return nil, false
+	}
+	secret, err := base64.RawURLEncoding.DecodeString(cookie.Value)
+	if err != nil || len(secret) != 32 {
+		return nil, false
+	}
+	return secret, true
+}
+
+// sessionOf returns the session the token is bound to; anonymous visitors share ""
+func sessionOf(r *http.Request) string {
+	if cookie, err := r.Cookie(SessionCookie); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+func sign(secret []byte, session string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(session))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// maxFormSize bounds the URL-encoded form read for the token
+const maxFormSize = 64 << 10
+
+// maxMultipartPeek is how much of a multipart body is read to find the token
+const maxMultipartPeek = 8 << 10
+
+// submitted returns the token from the header or, failing that, the form
+func submitted(r *http.Request) string {
+	if token := r.Header.Get(HeaderName); token != "" {
+		return token
+	}
+	mediaType, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/x-www-form-urlencoded":
+		r.Body = http.MaxBytesReader(nil, r.Body, maxFormSize)
+		return r.PostFormValue(FieldName)
+	case "multipart/form-data":
+		return firstPartToken(r, params["boundary"])
+	}
+	return ""
+}
+
+// firstPartToken returns the token if it is the first field of the multipart
+// body. It reads no more than maxMultipartPeek bytes and puts them back, so
+// the handler still sees the whole body.
+func firstPartToken(r *http.Request, boundary string) string {
+	if boundary == "" {
+		return ""
+	}
+	head := make([]byte, maxMultipartPeek)
+	n, err := io.ReadFull(r.Body, head)
+	head = head[:n]
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(head), r.Body), r.Body}
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return ""
+	}
+
+	part, err := multipart.NewReader(bytes.NewReader(head), boundary).NextPart()
+	if err != nil || part.FormName() != FieldName || part.FileName() != "" {
+		return ""
+	}
+	token, err := io.ReadAll(io.LimitReader(part, 256))
+	if err != nil {
+		return ""
+	}
+	return string(token)
+}
+
+func isSafe(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+func reject(renderer RendererIface, w http.ResponseWriter) {
+	pageData := &models.PageData{
+		Title: "Request Blocked",
+		Data: &models.ErrorData{
+			StatusCode: http.StatusForbidden,
+			Message:    RejectedMessage,
+		},
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusForbidden)
+	if err := renderer.RenderTemplate(w, "error.html", pageData); err != nil {
+		// The status is already sent, so fall back to the bare message
+		io.WriteString(w, RejectedMessage)
+	}
+}
@@ -0,0 +1,159 @@
+package csrf_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/csrf"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/models"
+)
+
+// errorPage renders the status and message of the error page data
+type errorPage struct{}
+
+func (errorPage) RenderTemplate(w io.Writer, name string, data any) error {
+	e := data.(*models.PageData).Data.(*models.ErrorData)
+	_, err := fmt.Fprintf(w, "%s %d %s", name, e.StatusCode, e.Message)
+	return err
+}
+
+// newHandler returns the protected handler, which echoes its token
+func newHandler() http.Handler {
+	return csrf.Middleware(errorPage{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, csrf.Token(r))
+	}))
+}
+
+// visit does a GET with the given cookies and returns the token and the cookies after it
+func visit(t *testing.T, h http.Handler, cookies ...*http.Cookie) (string, []*http.Cookie) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Body.Len() == 0 {
+		t.Fatalf("GET = %d with token %q", rec.Code, rec.Body)
+	}
+	return rec.Body.String(), append(cookies, rec.Result().Cookies()...)
+}
+
+func post(h http.Handler, form url.Values, header http.Header, cookies []*http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for k, v := range header {
+		req.Header.Set(k, v[0])
+	}
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestMiddleware(t *testing.T) {
+	h := newHandler()
+	session := &http.Cookie{Name: csrf.SessionCookie, Value: "session-a"}
+	token, cookies := visit(t, h, session)
+	if again, _ := visit(t, h, cookies...); again != token {
+		t.Errorf("token changed between requests of one session: %q, %q", token, again)
+	}
+
+	tests := []struct {
+		name    string
+		form    url.Values
+		header  http.Header
+		cookies []*http.Cookie
+		want    int
+	}{
+		{"form token", url.Values{csrf.FieldName: {token}}, nil, cookies, http.StatusOK},
+		{"header token", nil, http.Header{csrf.HeaderName: {token}}, cookies, http.StatusOK},
+		{"bearer token", nil, http.Header{"Authorization": {"Bearer api-token"}}, cookies, http.StatusForbidden},
+		{"missing token", nil, nil, cookies, http.StatusForbidden},
+		{"wrong token", url.Values{csrf.FieldName: {"forged"}}, nil, cookies, http.StatusForbidden},
+		{"no secret cookie", url.Values{csrf.FieldName: {token}}, nil, []*http.Cookie{session}, http.StatusForbidden},
+		{"other session", url.Values{csrf.FieldName: {token}}, nil,
+			[]*http.Cookie{cookies[1], {Name: csrf.SessionCookie, Value: "session-b"}}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := post(h, tt.form, tt.header, tt.cookies)
+			if rec.Code != tt.want {
+				t.Fatalf("POST = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+			if tt.want == http.StatusForbidden && rec.Body.String() != "error.html 403 "+csrf.RejectedMessage {
+				t.Errorf("rejection body = %q, want the rendered error page", rec.Body)
+			}
+		})
+	}
+}
+
+// A multipart body is only read as far as its first field, and the handler
+// still gets all of it
+func TestMiddleware_Multipart(t *testing.T) {
+	var received string
+	h := csrf.Middleware(errorPage{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			io.WriteString(w, csrf.Token(r))
+			return
+		}
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			t.Errorf("FormFile() error = %v", err)
+			return
+		}
+		data, _ := io.ReadAll(file)
+		received = string(data)
+	}))
+	token, cookies := visit(t, h, &http.Cookie{Name: csrf.SessionCookie, Value: "session-a"})
+	upload := strings.Repeat("x", 64<<10)
+
+	tests := []struct {
+		name   string
+		fields []string // fields before the file, each holding the token; nil sends it after
+		want   int
+	}{
+		{"token first", []string{csrf.FieldName}, http.StatusOK},
+		{"token after the file", nil, http.StatusForbidden},
+		{"token after another field", []string{"note", csrf.FieldName}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received = ""
+			var body bytes.Buffer
+			mw := multipart.NewWriter(&body)
+			for _, name := range tt.fields {
+				mw.WriteField(name, token)
+			}
+			fw, _ := mw.CreateFormFile("file", "big.bin")
+			io.WriteString(fw, upload)
+			if tt.fields == nil {
+				mw.WriteField(csrf.FieldName, token)
+			}
+			mw.Close()
+
+			req := httptest.NewRequest(http.MethodPost, "/", &body)
+			req.Header.Set("Content-Type", mw.FormDataContentType())
+			for _, c := range cookies {
+				req.AddCookie(c)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("POST = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+			if tt.want == http.StatusOK && received != upload {
+				t.Errorf("handler got %d bytes of the file, want %d", len(received), len(upload))
+			}
+		})
+	}
+}
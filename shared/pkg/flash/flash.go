@@ -0,0 +1,168 @@
+// Package flash carries one-shot messages across a redirect. A handler calls
+// Set before redirecting; the message travels in a signed cookie and the next
+// HTML page takes it with Take, after which the cookie is cleared.
+package flash
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// CookieName is the cookie holding the pending message
+const CookieName = "flash"
+
+// Message types, used as the flash-<type> CSS class
+const (
+	Success = "success"
+	Error   = "error"
+	Info    = "info"
+	Warning = "warning"
+)
+
+// maxAge bounds how long a message waits for the page after the redirect
+const maxAge = 5 * time.Minute
+
+// Message is a flash message
+type Message struct {
+	Type string `json:"t"`
+	Text string `json:"m"`
+}
+
+// Middleware reads the pending message for the handlers and clears it once an
+// HTML page has been served. Messages are signed with key; an empty key uses
+// a random per-process one, so messages do not survive a restart.
+func Middleware(key []byte, next http.Handler) http.Handler {
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		rand.Read(key)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fw := &writer{ResponseWriter: w, key: key}
+		if cookie, err := r.Cookie(CookieName); err == nil {
+			if msg, ok := decode(key, cookie.Value); ok {
+				fw.pending = &msg
+			} else {
+				slog.Debug("ignoring flash cookie with a bad signature")
+			}
+		}
+		next.ServeHTTP(fw, r)
+	})
+}
+
+// Set queues a message for the next page. It does nothing outside the middleware.
+func Set(w http.ResponseWriter, typ, text string) {
+	fw, ok := find(w)
+	if !ok {
+		return
+	}
+	value, err := encode(fw.key, Message{Type: typ, Text: text})
+	if err != nil {
+		slog.Error("failed to encode flash message", "err", err)
+		return
+	}
+	fw.set = true
+	http.SetCookie(fw, &http.Cookie{
+		Name:     CookieName,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   int(maxAge.Seconds()),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// Take returns the message waiting for this response, if any. The cookie is
+// cleared when the page is served, whether or not Take was called.
+func Take(w io.Writer) (Message, bool) {
+	fw, ok := find(w)
+	if !ok || fw.pending == nil {
+		return Message{}, false
+	}
+	return *fw.pending, true
+}
+
+// writer clears a consumed message when the first HTML page goes out.
+// Redirects and other responses leave it for a later page.
+type writer struct {
+	http.ResponseWriter
+	key     []byte
+	pending *Message
+	set     bool // A handler queued a new message this response
+	wrote   bool
+}
+
+func (w *writer) WriteHeader(status int) {
+	if !w.wrote {
+		w.wrote = true
+		isPage := strings.HasPrefix(w.Header().Get("Content-Type"), "text/html")
+		if w.pending != nil && !w.set && isPage && (status < 300 || status >= 400) {
+			http.SetCookie(w.ResponseWriter, &http.Cookie{Name: CookieName, Path: "/", MaxAge: -1, HttpOnly: true, Secure: true})
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *writer) Write(b []byte) (int, error) {
+	if !w.wrote {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *writer) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// find looks for the middleware's writer beneath any wrappers
+func find(w io.Writer) (*writer, bool) {
+	for {
+		switch v := w.(type) {
+		case *writer:
+			return v, true
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = v.Unwrap()
+		default:
+			return nil, false
+		}
+	}
+}
+
+func encode(key []byte, msg Message) (string, error) {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return "", err
+	}
+	body := base64.RawURLEncoding.EncodeToString(payload)
+	return body + "." + sign(key, body), nil
+}
+
+func decode(key []byte, value string) (Message, bool) {
+	body, sig, ok := strings.Cut(value, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(sign(key, body))) {
+		return Message{}, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(body)
+	if err != nil {
+		return Message{}, false
+	}
+	var msg Message
+	if err := json.Unmarshal(payload, &msg); err != nil || msg.Text == "" {
+		return Message{}, false
+	}
+	return msg, true
+}
+
+func sign(key []byte, body string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(body))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
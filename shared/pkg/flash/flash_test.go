@@ -0,0 +1,96 @@
+package flash_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/flash"
+)
+
+var key = []byte("0123456789abcdef0123456789abcdef")
+
+// serve runs handler behind the middleware with the given flash cookie and
+// returns the response and the flash cookie it set, if any
+func serve(t *testing.T, handler http.HandlerFunc, cookie *http.Cookie) (*httptest.ResponseRecorder, *http.Cookie) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	flash.Middleware(key, handler).ServeHTTP(rec, req)
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == flash.CookieName {
+			return rec, c
+		}
+	}
+	return rec, nil
+}
+
+func redirectWith(typ, text string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		flash.Set(w, typ, text)
+		http.Redirect(w, r, "/next", http.StatusSeeOther)
+	}
+}
+
+// page writes the taken message as the body of an HTML page
+func page(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if msg, ok := flash.Take(w); ok {
+		io.WriteString(w, msg.Type+": "+msg.Text)
+	}
+}
+
+func TestFlash_SurvivesOneRedirect(t *testing.T) {
+	_, cookie := serve(t, redirectWith(flash.Info, "Logged out"), nil)
+	if cookie == nil || cookie.MaxAge <= 0 || !cookie.HttpOnly || !cookie.Secure {
+		t.Fatalf("Set() cookie = %+v, want a live HttpOnly Secure cookie", cookie)
+	}
+
+	// A redirect in between keeps the message for the page after it
+	redirect := func(w http.ResponseWriter, r *http.Request) { http.Redirect(w, r, "/", http.StatusFound) }
+	if _, cleared := serve(t, redirect, cookie); cleared != nil {
+		t.Errorf("redirect touched the flash cookie: %+v", cleared)
+	}
+
+	rec, cleared := serve(t, page, cookie)
+	if rec.Body.String() != "info: Logged out" {
+		t.Errorf("page body = %q, want the message", rec.Body)
+	}
+	if cleared == nil || cleared.MaxAge >= 0 {
+		t.Errorf("page did not clear the flash cookie: %+v", cleared)
+	}
+}
+
+func TestFlash_RejectsTamperedCookies(t *testing.T) {
+	_, cookie := serve(t, redirectWith(flash.Error, "Upload rejected"), nil)
+
+	for name, value := range map[string]string{
+		"unsigned":      "eyJ0IjoiZXJyb3IiLCJtIjoiaGkifQ",
+		"bad signature": cookie.Value + "x",
+		"other key": func() string {
+			rec := httptest.NewRecorder()
+			flash.Middleware([]byte("another key"), redirectWith(flash.Error, "forged")).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+			return rec.Result().Cookies()[0].Value
+		}(),
+	} {
+		rec, _ := serve(t, page, &http.Cookie{Name: flash.CookieName, Value: value})
+		if rec.Body.Len() != 0 {
+			t.Errorf("%s cookie was accepted: %q", name, rec.Body)
+		}
+	}
+}
+
+func TestFlash_OutsideMiddleware(t *testing.T) {
+	rec := httptest.NewRecorder()
+	flash.Set(rec, flash.Success, "ignored")
+	if len(rec.Result().Cookies()) != 0 {
+		t.Error("Set() outside the middleware set a cookie")
+	}
+	if _, ok := flash.Take(rec); ok {
+		t.Error("Take() outside the middleware returned a message")
+	}
+}
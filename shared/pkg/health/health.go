@@ -0,0 +1,158 @@
+// Package health serves liveness and readiness probes.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultCacheTTL is how long a check result is reused. Probes from the
+	// load balancer and several monitors would otherwise each hit S3.
+	DefaultCacheTTL = 10 * time.Second
+	// DefaultTimeout bounds a single check, well inside App Runner's 5s probe timeout
+	DefaultTimeout = 3 * time.Second
+)
+
+// Check reports whether a dependency can serve requests
+type Check func(ctx context.Context) error
+
+// Result is the outcome of one check. Only the status is served: errors can
+// name buckets, endpoints and cloud accounts, so they go to the log instead.
+type Result struct {
+	Status    string    `json:"status"` // "ok" or "fail"
+	Error     string    `json:"-"`
+	Duration  string    `json:"-"`
+	CheckedAt time.Time `json:"-"`
+}
+
+// Report is the JSON body served at /readyz
+type Report struct {
+	Status string            `json:"status"` // "ok" if every check passed, otherwise "unavailable"
+	Checks map[string]Result `json:"checks"`
+}
+
+// Checker runs named readiness checks and caches their results
+type Checker struct {
+	ttl     time.Duration
+	timeout time.Duration
+	now     func() time.Time
+
+	mu     sync.Mutex
+	checks []*namedCheck
+}
+
+type namedCheck struct {
+	name  string
+	check Check
+
+	mu      sync.Mutex // Held while the check runs so concurrent probes share one call
+	result  Result
+	checked bool
+}
+
+// NewChecker creates a checker whose results are reused for ttl and whose
+// checks are cancelled after timeout. Zero values use the defaults.
+func NewChecker(ttl, timeout time.Duration) *Checker {
+	if ttl == 0 {
+		ttl = DefaultCacheTTL
+	}
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	return &Checker{ttl: ttl, timeout: timeout, now: time.Now}
+}
+
+// Register adds a check reported under name
+func (c *Checker) Register(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = append(c.checks, &namedCheck{name: name, check: check})
+}
+
+// Run runs every check whose cached result has expired, in parallel, and reports all of them
+func (c *Checker) Run(ctx context.Context) Report {
+	c.mu.Lock()
+	checks := append([]*namedCheck(nil), c.checks...)
+	c.mu.Unlock()
+
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, nc := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = c.run(ctx, nc)
+		}()
+	}
+	wg.Wait()
+
+	report := Report{Status: "ok", Checks: make(map[string]Result, len(checks))}
+	for i, nc := range checks {
+		report.Checks[nc.name] = results[i]
+		if results[i].Status != "ok" {
+			report.Status = "unavailable"
+		}
+	}
+	return report
+}
+
+func (c *Checker) run(ctx context.Context, nc *namedCheck) Result {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	if nc.checked && c.now().Sub(nc.result.CheckedAt) < c.ttl {
+		return nc.result
+	}
+
+	// Detached from the probe so a caller hanging up does not cache a failure
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.timeout)
+	defer cancel()
+	start := c.now()
+	err := nc.check(ctx)
+
+	nc.result = Result{Status: "ok", Duration: c.now().Sub(start).Round(time.Millisecond).String(), CheckedAt: start}
+	if err != nil {
+		nc.result.Status = "fail"
+		nc.result.Error = err.Error()
+		slog.Warn("readiness check failed", "check", nc.name, "duration", nc.result.Duration, "err", err)
+	}
+	nc.checked = true
+	return nc.result
+}
+
+// ReadyHandler serves the checker's report, answering 503 when any check fails
+// so the load balancer stops routing to this instance
+func (c *Checker) ReadyHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := c.Run(r.Context())
+		status := http.StatusOK
+		if report.Status != "ok" {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSON(w, status, report)
+	}
+}
+
+// LiveHandler answers 200 while the process can serve HTTP. It checks no
+// dependencies, so an outage elsewhere does not get instances restarted.
+func LiveHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// IsProbe reports whether path is a health endpoint, which callers log and trace less
+func IsProbe(path string) bool {
+	return path == "/health" || path == "/healthz" || path == "/readyz"
+}
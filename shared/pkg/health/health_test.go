@@ -0,0 +1,102 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReadyHandler(t *testing.T) {
+	var storageDown atomic.Bool
+	checker := NewChecker(time.Nanosecond, time.Second)
+	checker.Register("storage", func(ctx context.Context) error {
+		if storageDown.Load() {
+			return errors.New("AccessDenied")
+		}
+		return nil
+	})
+	checker.Register("metadata", func(ctx context.Context) error { return nil })
+
+	var body string
+	get := func() (int, Report) {
+		rec := httptest.NewRecorder()
+		checker.ReadyHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		var report Report
+		if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+			t.Fatalf("body %q is not JSON: %v", rec.Body, err)
+		}
+		body = rec.Body.String()
+		return rec.Code, report
+	}
+
+	if code, report := get(); code != http.StatusOK || report.Status != "ok" || len(report.Checks) != 2 {
+		t.Errorf("healthy /readyz = %d %+v", code, report)
+	}
+	storageDown.Store(true)
+	code, report := get()
+	if code != http.StatusServiceUnavailable || report.Status != "unavailable" {
+		t.Errorf("/readyz with storage down = %d %+v", code, report)
+	}
+	if got := report.Checks["storage"]; got.Status != "fail" {
+		t.Errorf("storage check = %+v", got)
+	}
+	if strings.Contains(body, "AccessDenied") {
+		t.Errorf("/readyz body %s exposes the check error", body)
+	}
+	if got := checker.Run(context.Background()).Checks["storage"]; got.Error != "AccessDenied" {
+		t.Errorf("Run() storage check = %+v, want the error kept for callers", got)
+	}
+	if got := report.Checks["metadata"]; got.Status != "ok" {
+		t.Errorf("metadata check = %+v, want ok", got)
+	}
+}
+
+func TestChecker_CachesResults(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	checker := NewChecker(10*time.Second, time.Second)
+	checker.now = func() time.Time { return now }
+	var calls atomic.Int32
+	checker.Register("storage", func(ctx context.Context) error {
+		calls.Add(1)
+		return nil
+	})
+
+	checker.Run(context.Background())
+	now = now.Add(5 * time.Second)
+	checker.Run(context.Background())
+	if got := calls.Load(); got != 1 {
+		t.Errorf("check ran %d times within the TTL, want 1", got)
+	}
+	now = now.Add(6 * time.Second)
+	checker.Run(context.Background())
+	if got := calls.Load(); got != 2 {
+		t.Errorf("check ran %d times after the TTL, want 2", got)
+	}
+}
+
+func TestChecker_TimesOutSlowChecks(t *testing.T) {
+	checker := NewChecker(time.Nanosecond, 20*time.Millisecond)
+	checker.Register("oidc", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	report := checker.Run(context.Background())
+	if got := report.Checks["oidc"]; got.Status != "fail" || got.Error != context.DeadlineExceeded.Error() {
+		t.Errorf("slow check = %+v, want a deadline failure", got)
+	}
+}
+
+func TestLiveHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	LiveHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "{\"status\":\"ok\"}\n" {
+		t.Errorf("/healthz = %d %q", rec.Code, rec.Body)
+	}
+}
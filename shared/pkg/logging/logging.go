@@ -0,0 +1,80 @@
+// Package logging sets up JSON structured logging with secret redaction and per-request context.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Redacted replaces the value of every sensitive attribute
+const Redacted = "[REDACTED]"
+
+// sensitiveKeys are substrings of attribute keys whose values are never logged
+var sensitiveKeys = []string{
+	"cookie", "token", "secret", "password", "passwd", "authorization",
+	"session", "credential", "private_key", "access_key", "master_key", "signing_key", "customer_key",
+}
+
+// ParseLevel parses "debug", "info", "warn" or "error"
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("invalid log level %q: want debug, info, warn or error", s)
+	}
+	return level, nil
+}
+
+// New returns a JSON logger writing to w that drops records below level and redacts secrets
+func New(w io.Writer, level slog.Level) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: redact,
+	}))
+}
+
+// Setup makes a JSON logger on stdout the default for slog and the log package
+func Setup(level slog.Level) {
+	slog.SetDefault(New(os.Stdout, level))
+}
+
+// IsSensitive reports whether an attribute key names a secret
+func IsSensitive(key string) bool {
+	key = strings.ToLower(key)
+	for _, s := range sensitiveKeys {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// redact hides the values of sensitive attributes, and cookie values whatever their key
+func redact(groups []string, a slog.Attr) slog.Attr {
+	if IsSensitive(a.Key) {
+		return slog.String(a.Key, Redacted)
+	}
+	if a.Value.Kind() == slog.KindAny {
+		switch v := a.Value.Any().(type) {
+		case *http.Cookie:
+			return slog.String(a.Key, v.Name+"="+Redacted)
+		case http.Header:
+			return slog.Any(a.Key, redactHeader(v))
+		}
+	}
+	return a
+}
+
+func redactHeader(h http.Header) http.Header {
+	out := make(http.Header, len(h))
+	for name, values := range h {
+		if IsSensitive(name) {
+			values = []string{Redacted}
+		}
+		out[name] = values
+	}
+	return out
+}
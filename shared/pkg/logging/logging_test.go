@@ -0,0 +1,135 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// captureDefault routes the default logger into a buffer for the test
+func captureDefault(t *testing.T, level slog.Level) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(New(&buf, level))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return &buf
+}
+
+// entries decodes each JSON line written to buf
+func entries(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var out []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("log line %q is not JSON: %v", line, err)
+		}
+		out = append(out, entry)
+	}
+	return out
+}
+
+func TestNew_RedactsSecrets(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, slog.LevelInfo)
+	logger.Info("login",
+		"user_session", "eyJpZCI6IjEyMyJ9",
+		"access_token", "ya29.secret",
+		slog.Group("oauth", "client_secret", "shh", "client_id", "public-id"),
+		"cookie_jar", &http.Cookie{Name: "oauth_state", Value: "state-value"},
+		"state", &http.Cookie{Name: "oauth_state", Value: "state-value"},
+		"headers", http.Header{"Authorization": {"Bearer abc"}, "Accept": {"text/html"}},
+		"key", "uploads/u1/report.pdf",
+	)
+
+	out := buf.String()
+	for _, secret := range []string{"eyJpZCI6IjEyMyJ9", "ya29.secret", "shh", "state-value", "Bearer abc"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("log line leaks %q: %s", secret, out)
+		}
+	}
+	for _, kept := range []string{"public-id", "oauth_state=[REDACTED]", "text/html", "uploads/u1/report.pdf"} {
+		if !strings.Contains(out, kept) {
+			t.Errorf("log line lost %q: %s", kept, out)
+		}
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for _, s := range []string{"debug", "INFO", "warn", "error"} {
+		if _, err := ParseLevel(s); err != nil {
+			t.Errorf("ParseLevel(%q) error = %v", s, err)
+		}
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("ParseLevel(\"verbose\") succeeded, want an error")
+	}
+
+	buf := captureDefault(t, slog.LevelInfo)
+	slog.Debug("cookie dump")
+	if buf.Len() != 0 {
+		t.Errorf("debug line written at info level: %s", buf)
+	}
+}
+
+func TestMiddleware_RequestContext(t *testing.T) {
+	buf := captureDefault(t, slog.LevelInfo)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/s/", func(w http.ResponseWriter, r *http.Request) {
+		SetUser(r.Context(), "u1")
+		FromRequest(r).Error("failed to load share", "err", errors.New("boom"))
+		http.Error(w, "oops", http.StatusInternalServerError)
+	})
+	handler := Middleware(mux)
+
+	req := httptest.NewRequest(http.MethodGet, "/s/secret-share-token", nil)
+	req.Header.Set(RequestIDHeader, "abc-123")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get(RequestIDHeader); got != "abc-123" {
+		t.Errorf("response %s = %q, want the incoming ID", RequestIDHeader, got)
+	}
+	logs := entries(t, buf)
+	if len(logs) != 2 {
+		t.Fatalf("got %d log lines, want the handler's and the request line: %s", len(logs), buf)
+	}
+	for _, entry := range logs {
+		if entry["request_id"] != "abc-123" || entry["route"] != "/s/" || entry["user_id"] != "u1" {
+			t.Errorf("log line missing request context: %v", entry)
+		}
+	}
+	if req := logs[1]; req["msg"] != "request" || req["status"] != float64(500) || req["level"] != "ERROR" {
+		t.Errorf("request line = %v", req)
+	}
+	if strings.Contains(buf.String(), "secret-share-token") {
+		t.Errorf("raw path with share token was logged: %s", buf)
+	}
+}
+
+func TestMiddleware_GeneratesRequestIDs(t *testing.T) {
+	captureDefault(t, slog.LevelInfo)
+	var seen string
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestID(r.Context())
+	}))
+
+	for _, incoming := range []string{"", "has spaces\nand newlines", strings.Repeat("x", 100)} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(RequestIDHeader, incoming)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if seen == "" || seen == incoming || rec.Header().Get(RequestIDHeader) != seen {
+			t.Errorf("incoming ID %q: handler saw %q, response header %q", incoming, seen, rec.Header().Get(RequestIDHeader))
+		}
+	}
+}
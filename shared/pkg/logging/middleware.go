@@ -0,0 +1,155 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/health"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader carries the request ID in from a proxy and back out to the client
+const RequestIDHeader = "X-Request-ID"
+
+type contextKey struct{}
+
+// requestInfo is what the middleware knows about a request. Handlers fill in the user.
+type requestInfo struct {
+	id string
+
+	mu     sync.Mutex
+	userID string
+}
+
+func (i *requestInfo) user() string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.userID
+}
+
+// Middleware assigns each request an ID, propagating a valid incoming X-Request-ID,
+// and logs one line per request with its status and duration once it completes
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info := &requestInfo{id: r.Header.Get(RequestIDHeader)}
+		if !validRequestID(info.id) {
+			info.id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, info.id)
+		outer := r
+		r = r.WithContext(context.WithValue(r.Context(), contextKey{}, info))
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		next.ServeHTTP(rec, r)
+		// The mux records the matched pattern on our copy; pass it out as it would
+		outer.Pattern = r.Pattern
+
+		level := slog.LevelInfo
+		switch {
+		case rec.status >= 500:
+			level = slog.LevelError
+		case health.IsProbe(r.URL.Path):
+			level = slog.LevelDebug // Polled every few seconds by the load balancer
+		}
+		FromRequest(r).LogAttrs(r.Context(), level, "request",
+			slog.String("method", r.Method),
+			slog.Int("status", rec.status),
+			slog.Int64("bytes", rec.bytes),
+			slog.Duration("duration", time.Since(start)),
+		)
+	})
+}
+
+// FromRequest returns the default logger annotated with the request ID, the
+// route pattern (never the raw path, which may hold share tokens), the user
+// and, when the request is traced, the trace ID
+func FromRequest(r *http.Request) *slog.Logger {
+	logger := slog.Default()
+	info, _ := r.Context().Value(contextKey{}).(*requestInfo)
+	if info == nil {
+		return logger
+	}
+	attrs := []any{slog.String("request_id", info.id)}
+	if r.Pattern != "" {
+		attrs = append(attrs, slog.String("route", r.Pattern))
+	}
+	if user := info.user(); user != "" {
+		attrs = append(attrs, slog.String("user_id", user))
+	}
+	if span := trace.SpanContextFromContext(r.Context()); span.HasTraceID() {
+		attrs = append(attrs, slog.String("trace_id", span.TraceID().String()))
+	}
+	return logger.With(attrs...)
+}
+
+// RequestID returns the ID the middleware assigned to the request, or ""
+func RequestID(ctx context.Context) string {
+	if info, ok := ctx.Value(contextKey{}).(*requestInfo); ok {
+		return info.id
+	}
+	return ""
+}
+
+// SetUser records the signed-in user so later log lines for the request include it
+func SetUser(ctx context.Context, userID string) {
+	if info, ok := ctx.Value(contextKey{}).(*requestInfo); ok {
+		info.mu.Lock()
+		info.userID = userID
+		info.mu.Unlock()
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// validRequestID accepts short IDs of safe characters so clients cannot inject into logs
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// statusRecorder captures the status code and body size of a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if !s.wroteHeader {
+		s.status = status
+		s.wroteHeader = true
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	s.wroteHeader = true
+	n, err := s.ResponseWriter.Write(b)
+	s.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to flush
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
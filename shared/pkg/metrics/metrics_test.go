@@ -0,0 +1,91 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMiddleware_LabelsByPattern(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/s/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	handler := Middleware(mux)
+
+	byPattern := testutil.ToFloat64(requestsTotal.WithLabelValues("/s/", http.MethodGet, "404"))
+	unmatched := testutil.ToFloat64(requestsTotal.WithLabelValues("unmatched", http.MethodGet, "404"))
+	for _, path := range []string{"/s/token-one", "/s/token-two", "/nowhere"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	if got := testutil.ToFloat64(requestsTotal.WithLabelValues("/s/", http.MethodGet, "404")) - byPattern; got != 2 {
+		t.Errorf("requests for /s/ went up by %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(requestsTotal.WithLabelValues("unmatched", http.MethodGet, "404")) - unmatched; got != 1 {
+		t.Errorf("unmatched requests went up by %v, want 1", got)
+	}
+}
+
+func TestHandler_AccessControl(t *testing.T) {
+	nets, err := ParseCIDRs("10.0.0.0/8, 127.0.0.1/32")
+	if err != nil {
+		t.Fatalf("ParseCIDRs() error = %v", err)
+	}
+	if _, err := ParseCIDRs("10.0.0.0/33"); err == nil {
+		t.Error("ParseCIDRs() accepted an invalid network")
+	}
+
+	tests := []struct {
+		name       string
+		cfg        HandlerConfig
+		remoteAddr string
+		auth       string
+		want       int
+	}{
+		{"open", HandlerConfig{}, "203.0.113.9:1234", "", http.StatusOK},
+		{"allowed network", HandlerConfig{AllowedNets: nets}, "10.1.2.3:1234", "", http.StatusOK},
+		{"other network", HandlerConfig{AllowedNets: nets}, "203.0.113.9:1234", "", http.StatusForbidden},
+		{"valid token", HandlerConfig{Token: "s3cret"}, "203.0.113.9:1234", "Bearer s3cret", http.StatusOK},
+		{"wrong token", HandlerConfig{Token: "s3cret"}, "203.0.113.9:1234", "Bearer guess", http.StatusUnauthorized},
+		{"missing token", HandlerConfig{Token: "s3cret"}, "203.0.113.9:1234", "", http.StatusUnauthorized},
+		{"token from other network", HandlerConfig{Token: "s3cret", AllowedNets: nets}, "203.0.113.9:1234", "Bearer s3cret", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			rec := httptest.NewRecorder()
+			Handler(tt.cfg).ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestActiveSessions(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	tracker := &sessionTracker{lastSeen: make(map[string]time.Time), now: func() time.Time { return now }}
+	prev := sessions
+	sessions = tracker
+	t.Cleanup(func() { sessions = prev })
+
+	SessionSeen("u1")
+	SessionSeen("u2")
+	now = now.Add(10 * time.Minute)
+	SessionSeen("u2")
+	if got := tracker.active(); got != 2 {
+		t.Errorf("active() = %v, want 2", got)
+	}
+	now = now.Add(10 * time.Minute)
+	if got := tracker.active(); got != 1 {
+		t.Errorf("active() after u1 went quiet = %v, want 1", got)
+	}
+}
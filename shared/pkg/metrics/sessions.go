@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ActiveSessionWindow is how recently a user must have made a request to count as active.
+// Sessions live in signed cookies rather than a server-side store, so activity is the best signal.
+const ActiveSessionWindow = 15 * time.Minute
+
+// sessionTracker remembers when each user was last seen
+type sessionTracker struct {
+	mu       sync.Mutex
+	lastSeen map[string]time.Time
+	now      func() time.Time
+}
+
+var sessions = &sessionTracker{lastSeen: make(map[string]time.Time), now: time.Now}
+
+func init() {
+	factory.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "active_sessions",
+		Help:      "Signed-in users who made a request within the last 15 minutes.",
+	}, sessions.active)
+}
+
+// SessionSeen records a request from a signed-in user
+func SessionSeen(userID string) {
+	sessions.mu.Lock()
+	defer sessions.mu.Unlock()
+	sessions.lastSeen[userID] = sessions.now()
+}
+
+// active counts recently seen users, forgetting the rest
+func (t *sessionTracker) active() float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	cutoff := t.now().Add(-ActiveSessionWindow)
+	for user, seen := range t.lastSeen {
+		if seen.Before(cutoff) {
+			delete(t.lastSeen, user)
+		}
+	}
+	return float64(len(t.lastSeen))
+}
@@ -1,15 +1,19 @@
 package models
 
-import "time"
+import (
+	"strings"
+	"time"
+)
 
 // User represents a user in the system
 type User struct {
-	ID       string    `json:"id"`
-	Name     string    `json:"name"`
-	Email    string    `json:"email"`
-	Picture  string    `json:"picture"`
-	Provider string    `json:"provider"`
-	Created  time.Time `json:"created"`
+	ID            string    `json:"id"`
+	Name          string    `json:"name"`
+	Email         string    `json:"email"`
+	EmailVerified bool      `json:"email_verified"` // As the provider said at sign-in
+	Picture       string    `json:"picture"`
+	Provider      string    `json:"provider"`
+	Created       time.Time `json:"created"`
 }
 
 // PageData represents the common data structure for all pages
@@ -20,6 +24,7 @@ type PageData struct {
 	FlashType    string      `json:"flash_type,omitempty"` // success, error, info, warning
 	Data         interface{} `json:"data,omitempty"`       // Page-specific data
 	CSRFToken    string      `json:"csrf_token,omitempty"`
+	CSPNonce     string      `json:"-"` // Inline scripts must carry it; filled in by the renderer
 }
 
 // ErrorData represents data for error pages
@@ -84,3 +89,185 @@ type CallbackData struct {
 	Error       string `json:"error,omitempty"`
 	RedirectURL string `json:"redirect_url,omitempty"`
 }
+
+// Share-specific models
+
+// Share represents a public download link for a single uploaded file
+type Share struct {
+	Token         string     `json:"token"`
+	S3Key         string     `json:"s3_key"`
+	Filename      string     `json:"filename"`
+	OwnerID       string     `json:"owner_id"`
+	CreatedAt     time.Time  `json:"created_at"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+	PasswordHash  string     `json:"-"`
+	MaxDownloads  int        `json:"max_downloads,omitempty"` // 0 means unlimited
+	DownloadCount int        `json:"download_count"`
+	RevokedAt     *time.Time `json:"revoked_at,omitempty"`
+}
+
+// HasPassword reports whether the share is password protected
+func (s *Share) HasPassword() bool {
+	return s.PasswordHash != ""
+}
+
+// Status returns why a share can no longer be used, or "active"
+func (s *Share) Status(now time.Time) string {
+	switch {
+	case s.RevokedAt != nil:
+		return "revoked"
+	case s.ExpiresAt != nil && !now.Before(*s.ExpiresAt):
+		return "expired"
+	case s.MaxDownloads > 0 && s.DownloadCount >= s.MaxDownloads:
+		return "exhausted"
+	default:
+		return "active"
+	}
+}
+
+// ShareAccess records a single attempt to use a share link
+type ShareAccess struct {
+	Token     string    `json:"token"`
+	Time      time.Time `json:"time"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	Outcome   string    `json:"outcome"` // viewed, downloaded, resumed, bad_password, expired, revoked, exhausted
+}
+
+// FileEntry represents a stored file in the owner's file list
+type FileEntry struct {
+	S3Key      string    `json:"s3_key"`
+	Filename   string    `json:"filename"`
+	UploadedAt time.Time `json:"uploaded_at,omitempty"`
+}
+
+// FilesData represents data for the file list page
+type FilesData struct {
+	Files []FileEntry `json:"files"`
+}
+
+// ShareView pairs a share with its public URL and access history
+type ShareView struct {
+	Share    *Share `json:"share"`
+	URL      string `json:"url"`
+	Status   string `json:"status"`
+	Accesses int    `json:"accesses"`
+}
+
+// SharesData represents data for the share management page
+type SharesData struct {
+	Shares     []ShareView `json:"shares"`
+	CreatedURL string      `json:"created_url,omitempty"` // Link created by the previous request
+}
+
+// ShareDownloadData represents data for the public share download page
+type ShareDownloadData struct {
+	Token            string     `json:"token"`
+	Filename         string     `json:"filename"`
+	Size             int64      `json:"size"`
+	ExpiresAt        *time.Time `json:"expires_at,omitempty"`
+	NeedsPassword    bool       `json:"needs_password"`
+	DownloadsLeft    int        `json:"downloads_left,omitempty"` // -1 means unlimited
+	PasswordRejected bool       `json:"password_rejected,omitempty"`
+}
+
+// Audit-specific models
+
+// AuditEvent records who did what to which object, and from where
+type AuditEvent struct {
+	ID         string    `json:"id"`
+	Time       time.Time `json:"time"`
+	Action     string    `json:"action"` // e.g. login.success or file.upload
+	ActorID    string    `json:"actor_id,omitempty"`
+	ActorEmail string    `json:"actor_email,omitempty"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	ObjectKey  string    `json:"object_key,omitempty"`
+	Detail     string    `json:"detail,omitempty"` // Outcome or reason, e.g. the share token prefix or why a login failed
+}
+
+// AuditQuery selects audit events. Empty fields match every event.
+type AuditQuery struct {
+	Actor  string    `json:"actor,omitempty"`  // User ID or email
+	Action string    `json:"action,omitempty"` // Action or action prefix, e.g. "login"
+	Object string    `json:"object,omitempty"` // Part of the object key
+	Since  time.Time `json:"since,omitempty"`
+	Until  time.Time `json:"until,omitempty"`
+	Limit  int       `json:"limit,omitempty"` // Newest events first; 0 means no limit
+}
+
+// Matches reports whether the event is selected by the query, ignoring Limit
+func (q AuditQuery) Matches(e AuditEvent) bool {
+	switch {
+	case q.Actor != "" && q.Actor != e.ActorID && !strings.EqualFold(q.Actor, e.ActorEmail):
+		return false
+	case q.Action != "" && e.Action != q.Action && !strings.HasPrefix(e.Action, q.Action+"."):
+		return false
+	case q.Object != "" && !strings.Contains(e.ObjectKey, q.Object):
+		return false
+	case !q.Since.IsZero() && e.Time.Before(q.Since):
+		return false
+	case !q.Until.IsZero() && !e.Time.Before(q.Until):
+		return false
+	}
+	return true
+}
+
+// AuditData represents data for the audit log search page
+type AuditData struct {
+	Query   AuditQuery   `json:"query"`
+	Since   string       `json:"since,omitempty"` // Date filters as entered, YYYY-MM-DD
+	Until   string       `json:"until,omitempty"`
+	Events  []AuditEvent `json:"events"`
+	Actions []string     `json:"actions"` // Offered in the action filter
+	Error   string       `json:"error,omitempty"`
+}
+
+// Webhook-specific models
+
+// Webhook event types
+const (
+	WebhookFileUploaded = "file.uploaded"
+	WebhookFileDeleted  = "file.deleted"
+	WebhookFileShared   = "file.shared"
+)
+
+// WebhookEvent is the JSON body sent to webhook endpoints
+type WebhookEvent struct {
+	ID        string        `json:"id"`
+	Type      string        `json:"type"` // One of the Webhook* event types
+	CreatedAt time.Time     `json:"created_at"`
+	File      FileUpload    `json:"file"`
+	Share     *WebhookShare `json:"share,omitempty"` // Set for file.shared
+}
+
+// WebhookShare describes a new share link without its secret token
+type WebhookShare struct {
+	ExpiresAt         *time.Time `json:"expires_at,omitempty"`
+	MaxDownloads      int        `json:"max_downloads,omitempty"`
+	PasswordProtected bool       `json:"password_protected"`
+}
+
+// WebhookDelivery tracks sending one event to one endpoint. A delivery that
+// runs out of attempts is kept with its payload as a dead letter.
+type WebhookDelivery struct {
+	ID         string    `json:"id"`
+	EventID    string    `json:"event_id"`
+	EventType  string    `json:"event_type"`
+	ObjectKey  string    `json:"object_key"`
+	Endpoint   string    `json:"endpoint"` // Without query string or credentials
+	Status     string    `json:"status"`   // pending, delivered or dead
+	Attempts   int       `json:"attempts"`
+	LastStatus int       `json:"last_status,omitempty"` // HTTP status of the last attempt, 0 if it got no response
+	LastError  string    `json:"last_error,omitempty"`
+	Payload    string    `json:"payload"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// WebhooksData represents data for the webhook delivery log page
+type WebhooksData struct {
+	Deliveries []WebhookDelivery `json:"deliveries"`
+	Status     string            `json:"status,omitempty"` // Filter, e.g. "dead"
+	Endpoints  int               `json:"endpoints"`        // How many endpoints are configured
+}
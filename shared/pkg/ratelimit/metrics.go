@@ -0,0 +1,13 @@
+package ratelimit
+
+import (
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var limitedTotal = promauto.With(metrics.Registry).NewCounterVec(prometheus.CounterOpts{
+	Namespace: metrics.Namespace,
+	Name:      "http_rate_limited_total",
+	Help:      "Requests rejected with 429 by rule route and the limit they exceeded (requests or bytes).",
+}, []string{"route", "limit"})
@@ -0,0 +1,97 @@
+package ratelimit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// byteUnits are the size suffixes ParseRules accepts, longest first
+var byteUnits = []struct {
+	suffix string
+	size   int64
+}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}}
+
+// ParseRules parses a rule spec such as
+//
+//	/api/upload:requests=30/1m,bytes=500MB/1h;/auth/callback:requests=10/1m
+//
+// Each ";"-separated entry names a route (a trailing slash covers every path
+// under it) and its limits: requests=<count>/<duration> and
+// bytes=<size>/<duration>, with sizes in B, KB, MB or GB. An empty spec
+// limits nothing.
+func ParseRules(spec string) ([]Rule, error) {
+	var rules []Rule
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		route, settings, found := strings.Cut(entry, ":")
+		route = strings.TrimSpace(route)
+		if !found || !strings.HasPrefix(route, "/") {
+			return nil, fmt.Errorf("rule %q: expected /route:key=value", entry)
+		}
+		if seen[route] {
+			return nil, fmt.Errorf("rule %q: route %s is listed twice", entry, route)
+		}
+		seen[route] = true
+
+		rule := Rule{Route: route}
+		for _, setting := range strings.Split(settings, ",") {
+			key, value, found := strings.Cut(strings.TrimSpace(setting), "=")
+			if !found {
+				return nil, fmt.Errorf("rule %q: expected key=value, got %q", entry, setting)
+			}
+			var err error
+			switch key {
+			case "requests":
+				rule.Requests, err = parseLimit(value, func(s string) (int64, error) { return strconv.ParseInt(s, 10, 64) })
+			case "bytes":
+				rule.Bytes, err = parseLimit(value, parseSize)
+			default:
+				err = fmt.Errorf("unknown setting")
+			}
+			if err != nil {
+				return nil, fmt.Errorf("rule %q: %s: %w", entry, key, err)
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// parseLimit parses <amount>/<duration>
+func parseLimit(value string, parseAmount func(string) (int64, error)) (Limit, error) {
+	amount, per, found := strings.Cut(value, "/")
+	if !found {
+		return Limit{}, fmt.Errorf("expected <amount>/<duration>, got %q", value)
+	}
+	n, err := parseAmount(amount)
+	if err != nil {
+		return Limit{}, err
+	}
+	d, err := time.ParseDuration(per)
+	if err != nil {
+		return Limit{}, err
+	}
+	if n <= 0 || d <= 0 {
+		return Limit{}, fmt.Errorf("want a positive amount and duration, got %q", value)
+	}
+	return Limit{N: n, Per: d}, nil
+}
+
+func parseSize(s string) (int64, error) {
+	for _, unit := range byteUnits {
+		if number, ok := strings.CutSuffix(strings.ToUpper(s), unit.suffix); ok {
+			n, err := strconv.ParseInt(number, 10, 64)
+			if err != nil {
+				return 0, err
+			}
+			return n * unit.size, nil
+		}
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
@@ -0,0 +1,194 @@
+// Package ratelimit limits how many requests, and how many uploaded bytes, each
+// client may send to a route. Limits are token buckets kept per route and per
+// client, where the client is the user session.Middleware verified, else the
+// request's address. Requests over a limit get 429 with Retry-After.
+package ratelimit
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/logging"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/models"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/session"
+)
+
+// Limit allows N units per Per, in bursts of up to N
+type Limit struct {
+	N   int64
+	Per time.Duration
+}
+
+func (l Limit) enabled() bool {
+	return l.N > 0 && l.Per > 0
+}
+
+// rate is the refill rate in units per second
+func (l Limit) rate() float64 {
+	return float64(l.N) / l.Per.Seconds()
+}
+
+// Rule limits the requests to a route
+type Rule struct {
+	Route    string // A path, or with a trailing slash every path under it, as in a mux pattern
+	Requests Limit  // Requests per client
+	Bytes    Limit  // Request body bytes per client
+}
+
+// Config configures the middleware
+type Config struct {
+	Rules          []Rule
+	TrustedProxies []*net.IPNet // Connections from these may name the client in X-Forwarded-For
+}
+
+// RendererIface renders the error page for limited requests
+type RendererIface interface {
+	RenderTemplate(w io.Writer, name string, data any) error
+}
+
+// Middleware enforces the rule matching each request's path. Requests to other
+// paths pass untouched. A request takes from all of its buckets or none, so one
+// refused for its size leaves its request quota alone. If the store fails the
+// request is let through, so an outage of a shared store does not take the
+// service down with it.
+func Middleware(store Store, cfg Config, renderer RendererIface, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rule, ok := cfg.match(r.URL.Path)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		client := cfg.clientKey(r)
+
+		var kinds []string
+		var draws []Draw
+		if rule.Requests.enabled() {
+			kinds = append(kinds, "requests")
+			draws = append(draws, Draw{Key: rule.Route + "|requests|" + client, Limit: rule.Requests, N: 1})
+		}
+		if rule.Bytes.enabled() && r.Body != nil && r.Body != http.NoBody {
+			switch {
+			case r.ContentLength < 0:
+				http.Error(w, "Content-Length required", http.StatusLengthRequired)
+				return
+			case r.ContentLength > rule.Bytes.N:
+				http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			kinds = append(kinds, "bytes")
+			draws = append(draws, Draw{Key: rule.Route + "|bytes|" + client, Limit: rule.Bytes, N: r.ContentLength})
+		}
+		if len(draws) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		waits, err := store.Take(r.Context(), draws)
+		if err != nil {
+			logging.FromRequest(r).Warn("rate limit store failed, allowing request", "err", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+		var longest time.Duration
+		for i, wait := range waits {
+			if wait > 0 {
+				limitedTotal.WithLabelValues(rule.Route, kinds[i]).Inc()
+				logging.FromRequest(r).Info("rate limited request", "rule", rule.Route, "limit", kinds[i], "retry_after", wait)
+				longest = max(longest, wait)
+			}
+		}
+		if longest > 0 {
+			reject(renderer, w, longest)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// match returns the rule for path: an exact route, else the longest subtree route
+func (c Config) match(path string) (Rule, bool) {
+	var best Rule
+	found := false
+	for _, rule := range c.Rules {
+		if rule.Route == path {
+			return rule, true
+		}
+		if strings.HasSuffix(rule.Route, "/") && strings.HasPrefix(path, rule.Route) && len(rule.Route) > len(best.Route) {
+			best, found = rule, true
+		}
+	}
+	return best, found
+}
+
+// clientKey names who a request counts against: a verified user, else the
+// address, so rotating unverified credentials never buys a fresh bucket
+func (c Config) clientKey(r *http.Request) string {
+	if user := session.User(r); user != nil {
+		return "user:" + user.ID
+	}
+	return "ip:" + ClientIP(r, c.TrustedProxies)
+}
+
+// ClientIP returns the address of the client behind r. X-Forwarded-For is
+// read only when the connection comes from a trusted proxy, and then from the
+// right, skipping further trusted proxies, since clients can prepend anything.
+func ClientIP(r *http.Request, trusted []*net.IPNet) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !isTrusted(trusted, host) {
+		return host
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		host = hop
+		if !isTrusted(trusted, hop) {
+			break
+		}
+	}
+	return host
+}
+
+func isTrusted(nets []*net.IPNet, addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// reject renders the error page with the time to wait, rounded up to whole seconds
+func reject(renderer RendererIface, w http.ResponseWriter, wait time.Duration) {
+	seconds := int64(math.Ceil(wait.Seconds()))
+	message := fmt.Sprintf("Too many requests. Please wait %d seconds and try again.", seconds)
+	w.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusTooManyRequests)
+	pageData := &models.PageData{
+		Title: "Too Many Requests",
+		Data: &models.ErrorData{
+			StatusCode: http.StatusTooManyRequests,
+			Message:    message,
+		},
+	}
+	if err := renderer.RenderTemplate(w, "error.html", pageData); err != nil {
+		// The status is already sent, so fall back to the bare message
+		io.WriteString(w, message)
+	}
+}
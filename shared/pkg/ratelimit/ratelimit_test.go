@@ -0,0 +1,226 @@
+package ratelimit_test
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/models"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/ratelimit"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/session"
+)
+
+// errorPage renders the status and message of the error page data
+type errorPage struct{}
+
+func (errorPage) RenderTemplate(w io.Writer, name string, data any) error {
+	e := data.(*models.PageData).Data.(*models.ErrorData)
+	_, err := fmt.Fprintf(w, "%s %d %s", name, e.StatusCode, e.Message)
+	return err
+}
+
+func newHandler(t *testing.T, store ratelimit.Store, spec string) http.Handler {
+	t.Helper()
+	rules, err := ratelimit.ParseRules(spec)
+	if err != nil {
+		t.Fatalf("ParseRules() error = %v", err)
+	}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, "ok") })
+	return session.Middleware(sessionKey, ratelimit.Middleware(store, ratelimit.Config{Rules: rules}, errorPage{}, ok))
+}
+
+// send posts body to path from the given address and returns the status
+func send(h http.Handler, path, remoteAddr, body string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.RemoteAddr = remoteAddr
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+var sessionKey = []byte("0123456789abcdef0123456789abcdef")
+
+// signedIn returns a valid session cookie for userID
+func signedIn(userID string) *http.Cookie {
+	value, _ := session.Encode(sessionKey, &models.User{ID: userID, Created: time.Now()})
+	return &http.Cookie{Name: session.CookieName, Value: value}
+}
+
+// forged returns an unsigned session cookie claiming to be userID
+func forged(userID string) *http.Cookie {
+	return &http.Cookie{Name: session.CookieName, Value: base64.StdEncoding.EncodeToString([]byte(`{"id":"` + userID + `"}`))}
+}
+
+func TestParseRules(t *testing.T) {
+	rules, err := ratelimit.ParseRules(" /api/upload:requests=30/1m,bytes=5MB/1h ; /s/:requests=10/30s ")
+	if err != nil {
+		t.Fatalf("ParseRules() error = %v", err)
+	}
+	want := []ratelimit.Rule{
+		{Route: "/api/upload", Requests: ratelimit.Limit{N: 30, Per: time.Minute}, Bytes: ratelimit.Limit{N: 5 << 20, Per: time.Hour}},
+		{Route: "/s/", Requests: ratelimit.Limit{N: 10, Per: 30 * time.Second}},
+	}
+	if fmt.Sprint(rules) != fmt.Sprint(want) {
+		t.Errorf("ParseRules() = %v, want %v", rules, want)
+	}
+
+	for _, spec := range []string{
+		"api/upload:requests=1/1m",
+		"/upload:requests=1",
+		"/upload:requests=0/1m",
+		"/upload:bytes=5XB/1h",
+		"/upload:burst=5",
+		"/upload:requests=1/1m;/upload:requests=2/1m",
+	} {
+		if _, err := ratelimit.ParseRules(spec); err == nil {
+			t.Errorf("ParseRules(%q) accepted an invalid spec", spec)
+		}
+	}
+}
+
+func TestMemoryStore_Take(t *testing.T) {
+	store := ratelimit.NewMemoryStore()
+	limit := ratelimit.Limit{N: 2, Per: time.Hour}
+	take := func(draws ...ratelimit.Draw) []time.Duration {
+		waits, _ := store.Take(context.Background(), draws)
+		return waits
+	}
+	for i := range 2 {
+		if waits := take(ratelimit.Draw{Key: "k", Limit: limit, N: 1}); waits != nil {
+			t.Fatalf("take %d waited %v within the burst", i+1, waits)
+		}
+	}
+	if waits := take(ratelimit.Draw{Key: "k", Limit: limit, N: 1}); len(waits) != 1 || waits[0] < 29*time.Minute || waits[0] > 30*time.Minute {
+		t.Errorf("take over the burst waits = %v, want about 30m for one token", waits)
+	}
+
+	// A draw that must wait keeps the others from taking anything
+	waits := take(ratelimit.Draw{Key: "other", Limit: limit, N: 1}, ratelimit.Draw{Key: "k", Limit: limit, N: 1})
+	if len(waits) != 2 || waits[0] != 0 || waits[1] == 0 {
+		t.Errorf("waits = %v, want only the empty bucket to wait", waits)
+	}
+	if waits := take(ratelimit.Draw{Key: "other", Limit: limit, N: 2}); waits != nil {
+		t.Errorf("bucket untouched by a refused take waited %v", waits)
+	}
+}
+
+func TestMiddleware_Requests(t *testing.T) {
+	h := newHandler(t, ratelimit.NewMemoryStore(), "/api/upload:requests=2/1m")
+
+	for range 2 {
+		if rec := send(h, "/api/upload", "192.0.2.1:1000", ""); rec.Code != http.StatusOK {
+			t.Fatalf("request within the limit = %d", rec.Code)
+		}
+	}
+	rec := send(h, "/api/upload", "192.0.2.1:1000", "")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "30" {
+		t.Fatalf("request over the limit = %d with Retry-After %q, want 429 after 30s", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if !strings.HasPrefix(rec.Body.String(), "error.html 429 Too many requests") {
+		t.Errorf("body = %q, want the rendered error page", rec.Body)
+	}
+
+	// Other clients and other routes have their own buckets
+	if rec := send(h, "/api/upload", "192.0.2.2:1000", ""); rec.Code != http.StatusOK {
+		t.Errorf("other address = %d", rec.Code)
+	}
+	if rec := send(h, "/api/upload", "192.0.2.1:1000", "", signedIn("u1")); rec.Code != http.StatusOK {
+		t.Errorf("signed-in user on the limited address = %d", rec.Code)
+	}
+	// Unverified identities count against the address
+	for _, id := range []string{"u2", "u3"} {
+		if rec := send(h, "/api/upload", "192.0.2.1:1000", "", forged(id)); rec.Code != http.StatusTooManyRequests {
+			t.Errorf("forged session %s on the limited address = %d, want 429", id, rec.Code)
+		}
+	}
+	if rec := send(h, "/files", "192.0.2.1:1000", ""); rec.Code != http.StatusOK {
+		t.Errorf("unlimited route = %d", rec.Code)
+	}
+}
+
+func TestMiddleware_Bytes(t *testing.T) {
+	h := newHandler(t, ratelimit.NewMemoryStore(), "/api/upload:bytes=100B/1h")
+	body := strings.Repeat("x", 60)
+
+	if rec := send(h, "/api/upload", "192.0.2.1:1000", body); rec.Code != http.StatusOK {
+		t.Fatalf("first upload = %d", rec.Code)
+	}
+	if rec := send(h, "/api/upload", "192.0.2.1:1000", body); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("upload over the byte budget = %d, want 429", rec.Code)
+	}
+	if rec := send(h, "/api/upload", "192.0.2.2:1000", strings.Repeat("x", 101)); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("upload larger than the whole budget = %d, want 413", rec.Code)
+	}
+}
+
+func TestMiddleware_RefusedRequestTakesNothing(t *testing.T) {
+	h := newHandler(t, ratelimit.NewMemoryStore(), "/api/upload:requests=2/1m,bytes=100B/1h")
+	body := strings.Repeat("x", 60)
+
+	if rec := send(h, "/api/upload", "192.0.2.1:1000", body); rec.Code != http.StatusOK {
+		t.Fatalf("first upload = %d", rec.Code)
+	}
+	if rec := send(h, "/api/upload", "192.0.2.1:1000", body); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("upload over the byte budget = %d, want 429", rec.Code)
+	}
+	if rec := send(h, "/api/upload", "192.0.2.1:1000", "small"); rec.Code != http.StatusOK {
+		t.Errorf("upload within both limits after a refused one = %d, want its request quota intact", rec.Code)
+	}
+}
+
+// brokenStore fails every call
+type brokenStore struct{}
+
+func (brokenStore) Take(context.Context, []ratelimit.Draw) ([]time.Duration, error) {
+	return nil, errors.New("store unavailable")
+}
+
+func TestMiddleware_FailsOpen(t *testing.T) {
+	h := newHandler(t, brokenStore{}, "/api/upload:requests=1/1m")
+	for range 2 {
+		if rec := send(h, "/api/upload", "192.0.2.1:1000", ""); rec.Code != http.StatusOK {
+			t.Errorf("request with a broken store = %d, want it allowed", rec.Code)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	_, proxies, _ := net.ParseCIDR("10.0.0.0/8")
+	trusted := []*net.IPNet{proxies}
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		want       string
+	}{
+		{"direct", "192.0.2.1:1000", "", "192.0.2.1"},
+		{"untrusted proxy", "192.0.2.1:1000", "198.51.100.7", "192.0.2.1"},
+		{"trusted proxy", "10.0.0.5:1000", "198.51.100.7", "198.51.100.7"},
+		{"spoofed hop", "10.0.0.5:1000", "203.0.113.9, 198.51.100.7", "198.51.100.7"},
+		{"proxy chain", "10.0.0.5:1000", "198.51.100.7, 10.0.0.6", "198.51.100.7"},
+		{"garbage", "10.0.0.5:1000", "not-an-ip", "10.0.0.5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if got := ratelimit.ClientIP(req, trusted); got != tt.want {
+				t.Errorf("ClientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
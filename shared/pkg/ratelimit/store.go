@@ -0,0 +1,96 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Store keeps the token buckets. MemoryStore limits each instance on its own;
+// a backend shared by all instances, such as Redis, can implement Store to
+// enforce the limits across them.
+type Store interface {
+	// Take removes the tokens of every draw if each bucket holds enough.
+	// Otherwise it takes none and returns, for each draw, how long until its
+	// bucket will hold enough, or 0 if it already does.
+	Take(ctx context.Context, draws []Draw) (waits []time.Duration, err error)
+}
+
+// Draw is N tokens to take from the bucket at Key
+type Draw struct {
+	Key   string
+	Limit Limit
+	N     int64
+}
+
+// sweepInterval is how often MemoryStore drops buckets that have refilled
+const sweepInterval = time.Minute
+
+// MemoryStore implements Store in process memory
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	full    time.Time // When the bucket is back to capacity and can be forgotten
+}
+
+// NewMemoryStore creates a new in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]*bucket), lastSweep: time.Now()}
+}
+
+// Take implements Store
+func (m *MemoryStore) Take(ctx context.Context, draws []Draw) ([]time.Duration, error) {
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if now.Sub(m.lastSweep) >= sweepInterval {
+		m.sweep(now)
+	}
+
+	var waits []time.Duration
+	buckets := make([]*bucket, len(draws))
+	for i, d := range draws {
+		b, ok := m.buckets[d.Key]
+		if !ok {
+			b = &bucket{tokens: float64(d.Limit.N), updated: now}
+			m.buckets[d.Key] = b
+		}
+		b.tokens = min(float64(d.Limit.N), b.tokens+now.Sub(b.updated).Seconds()*d.Limit.rate())
+		b.updated = now
+		buckets[i] = b
+
+		if missing := float64(d.N) - b.tokens; missing > 0 {
+			if waits == nil {
+				waits = make([]time.Duration, len(draws))
+			}
+			waits[i] = time.Duration(missing / d.Limit.rate() * float64(time.Second))
+		}
+	}
+	if waits != nil {
+		return waits, nil
+	}
+
+	for i, d := range draws {
+		b := buckets[i]
+		b.tokens -= float64(d.N)
+		b.full = now.Add(time.Duration((float64(d.Limit.N) - b.tokens) / d.Limit.rate() * float64(time.Second)))
+	}
+	return nil, nil
+}
+
+// sweep drops the buckets that have refilled, which a new bucket would match
+func (m *MemoryStore) sweep(now time.Time) {
+	for key, b := range m.buckets {
+		if !now.Before(b.full) {
+			delete(m.buckets, key)
+		}
+	}
+	m.lastSweep = now
+}
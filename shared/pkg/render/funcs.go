@@ -0,0 +1,63 @@
+package render
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"strings"
+	"time"
+)
+
+// funcs are the helpers available to every template
+var funcs = template.FuncMap{
+	"formatDate":     formatDate,
+	"formatFileSize": formatFileSize,
+	"json":           toJSON,
+	"safe":           safe,
+	"dict":           dict,
+	"join":           strings.Join,
+}
+
+// formatDate formats a time.Time to a readable string
+func formatDate(t time.Time) string {
+	return t.Format("January 2, 2006 at 3:04 PM")
+}
+
+// formatFileSize formats bytes to human readable format
+func formatFileSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
+
+// toJSON converts data to JSON string
+func toJSON(data interface{}) string {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Sprintf("Error: %v", err)
+	}
+	return string(b)
+}
+
+// safe marks a string as safe for HTML output
+func safe(s string) template.HTML {
+	return template.HTML(s)
+}
+
+// dict creates a map for use in templates
+func dict(values ...interface{}) map[string]interface{} {
+	dict := make(map[string]interface{})
+	for i := 0; i < len(values); i += 2 {
+		if i+1 < len(values) {
+			dict[fmt.Sprintf("%v", values[i])] = values[i+1]
+		}
+	}
+	return dict
+}
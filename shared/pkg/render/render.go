@@ -0,0 +1,145 @@
+// Package render renders the pages of both servers inside one shared layout.
+// The layout, the header, footer and flash partials and the error page live
+// here; each server registers only its own pages, which fill in the layout's
+// head, content and scripts blocks.
+package render
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/flash"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/models"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/secheaders"
+)
+
+//go:embed templates
+var embedded embed.FS
+
+// LayoutsDir is where the shared templates live, relative to the repository root
+const LayoutsDir = "shared/pkg/render/templates"
+
+// Renderer renders pages inside the shared base layout. Each page is its own
+// template set, so pages may define blocks with the same names.
+type Renderer struct {
+	pages   fs.FS // The server's page templates
+	layouts fs.FS // base.html, components/*.html and error.html
+	live    bool  // Re-parse before every render so template edits show up without a rebuild
+
+	templates map[string]*template.Template
+}
+
+// Option configures a Renderer
+type Option func(*Renderer)
+
+// WithLiveReload reads the templates from the checkout at root instead of the
+// embedded copies and re-parses them on every render. pagesDir is the
+// server's page directory relative to root. Meant for development; if root
+// holds no templates the embedded ones are kept.
+func WithLiveReload(root, pagesDir string) Option {
+	return func(r *Renderer) {
+		pagesDir := filepath.Join(root, pagesDir)
+		layoutsDir := filepath.Join(root, LayoutsDir)
+		for _, dir := range []string{pagesDir, layoutsDir} {
+			if _, err := os.Stat(dir); err != nil {
+				slog.Warn("templates not found on disk, using the embedded copies", "dir", dir, "err", err)
+				return
+			}
+		}
+		r.pages, r.layouts, r.live = os.DirFS(pagesDir), os.DirFS(layoutsDir), true
+	}
+}
+
+// New creates a renderer for the *.html pages in pages. The shared error.html
+// is registered too unless pages has its own.
+func New(pages fs.FS, opts ...Option) (*Renderer, error) {
+	layouts, err := fs.Sub(embedded, "templates")
+	if err != nil {
+		return nil, err
+	}
+	r := &Renderer{pages: pages, layouts: layouts}
+	for _, opt := range opts {
+		opt(r)
+	}
+	templates, err := r.parse()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load templates: %w", err)
+	}
+	r.templates = templates
+	return r, nil
+}
+
+// parse builds one template set per page: the layout, the partials and the page
+func (r *Renderer) parse() (map[string]*template.Template, error) {
+	names, err := fs.Glob(r.pages, "*.html")
+	if err != nil {
+		return nil, err
+	}
+	sources := map[string]fs.FS{"error.html": r.layouts}
+	for _, name := range names {
+		sources[name] = r.pages
+	}
+
+	templates := make(map[string]*template.Template, len(sources))
+	for name, src := range sources {
+		t, err := template.New(name).Funcs(funcs).ParseFS(r.layouts, "base.html", "components/*.html")
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse layout for %s: %w", name, err)
+		}
+		if _, err := t.ParseFS(src, name); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+		}
+		templates[name] = t
+	}
+	return templates, nil
+}
+
+// RenderTemplate renders a page inside the base layout. Output is buffered so
+// a failing template never leaves half a page written.
+func (r *Renderer) RenderTemplate(w io.Writer, name string, data any) error {
+	templates := r.templates
+	if r.live {
+		var err error
+		if templates, err = r.parse(); err != nil {
+			return err
+		}
+	}
+	t, ok := templates[name]
+	if !ok {
+		return fmt.Errorf("template %s not found", name)
+	}
+
+	if page, ok := data.(*models.PageData); ok {
+		data = fromResponse(w, page)
+	}
+
+	var buf bytes.Buffer
+	if err := t.ExecuteTemplate(&buf, "base.html", data); err != nil {
+		return fmt.Errorf("failed to render %s: %w", name, err)
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// fromResponse fills in what the middlewares attached to the response: the
+// message queued before a redirect, unless the handler set its own, and the
+// nonce for inline scripts. The handler's page data is left untouched.
+func fromResponse(w io.Writer, page *models.PageData) *models.PageData {
+	filled := *page
+	if filled.FlashMessage == "" {
+		if msg, ok := flash.Take(w); ok {
+			filled.FlashMessage, filled.FlashType = msg.Text, msg.Type
+		}
+	}
+	if filled.CSPNonce == "" {
+		filled.CSPNonce = secheaders.Nonce(w)
+	}
+	return &filled
+}
@@ -0,0 +1,83 @@
+package secheaders
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/logging"
+)
+
+// maxReportSize bounds a report body; real ones are well under a kilobyte
+const maxReportSize = 16 << 10
+
+// report is the body browsers POST to a report-uri
+type report struct {
+	Body struct {
+		DocumentURI        string `json:"document-uri"`
+		ViolatedDirective  string `json:"violated-directive"`
+		EffectiveDirective string `json:"effective-directive"`
+		BlockedURI         string `json:"blocked-uri"`
+		SourceFile         string `json:"source-file"`
+		LineNumber         int    `json:"line-number"`
+		Disposition        string `json:"disposition"`
+	} `json:"csp-report"`
+}
+
+// handleReport logs a violation report. URLs lose their query, and paths
+// under secret routes are cut back to the prefix, so no token reaches the logs.
+func handleReport(cfg Config, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var rep report
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxReportSize)).Decode(&rep); err != nil {
+		http.Error(w, "Invalid report", http.StatusBadRequest)
+		return
+	}
+	v := rep.Body
+	directive := v.EffectiveDirective
+	if directive == "" {
+		directive = v.ViolatedDirective
+	}
+	logging.FromRequest(r).Warn("content security policy violation",
+		"document", cfg.redact(v.DocumentURI),
+		"directive", directive,
+		"blocked", blockedOrigin(v.BlockedURI),
+		"source", cfg.redact(v.SourceFile),
+		"line", v.LineNumber,
+		"disposition", v.Disposition,
+	)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// redact strips a URL down to its path, or its route prefix for secret routes
+func (c Config) redact(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Path == "" {
+		return ""
+	}
+	if route := c.match(u.Path); route.Secret {
+		return route.Prefix + "…"
+	}
+	return u.Path
+}
+
+// blockedOrigin keeps keywords such as "inline" or "eval" and only the origin of URLs
+func blockedOrigin(raw string) string {
+	u, err := url.Parse(raw)
+	switch {
+	case err != nil:
+		return ""
+	case u.Host != "":
+		return u.Scheme + "://" + u.Host
+	case u.Scheme != "":
+		return u.Scheme // data:, blob:
+	case strings.Contains(raw, "/"):
+		return "" // A relative URL, which browsers do not send
+	}
+	return raw
+}
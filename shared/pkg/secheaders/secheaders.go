@@ -0,0 +1,159 @@
+// Package secheaders sets the browser security headers on every response: a
+// Content Security Policy that only runs scripts from our origin or inline
+// scripts carrying the per-request nonce, HSTS over HTTPS, and the
+// X-Content-Type-Options, X-Frame-Options, Referrer-Policy and
+// Permissions-Policy headers. Routes can relax the policy, for example to let
+// other sites embed share pages, and browsers report violations to ReportPath.
+package secheaders
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/logging"
+)
+
+// ReportPath is where browsers send CSP violation reports
+const ReportPath = "/csp-report"
+
+// DefaultReferrerPolicy is used by routes that do not set their own
+const DefaultReferrerPolicy = "strict-origin-when-cross-origin"
+
+// permissionsPolicy turns off the powerful features no page uses
+const permissionsPolicy = "camera=(), geolocation=(), microphone=(), payment=(), usb=()"
+
+// Policy is what a route may change about the headers
+type Policy struct {
+	FrameAncestors []string // Sources allowed to embed the page, such as https://wiki.example.com; empty forbids framing
+	FormAction     []string // Form targets besides 'self', including where a submission redirects to
+	ReferrerPolicy string   // Empty uses DefaultReferrerPolicy
+}
+
+// Route applies a policy to every path under Prefix
+type Route struct {
+	Prefix string
+	Policy Policy
+	Secret bool // Paths carry secrets, such as share tokens, so reports log only the prefix
+}
+
+// Config configures the middleware
+type Config struct {
+	HSTSMaxAge time.Duration // Sent on HTTPS requests; 0 leaves HSTS off
+	ReportOnly bool          // Report violations without blocking anything, to try out a policy
+	Routes     []Route       // The longest matching prefix wins; other paths get the zero Policy
+}
+
+// Middleware sets the security headers and serves violation reports at ReportPath
+func Middleware(cfg Config, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == ReportPath {
+			handleReport(cfg, w, r)
+			return
+		}
+
+		nonce, err := newNonce()
+		if err != nil {
+			logging.FromRequest(r).Error("failed to generate CSP nonce", "err", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		policy := cfg.match(r.URL.Path).Policy
+
+		h := w.Header()
+		cspHeader := "Content-Security-Policy"
+		if cfg.ReportOnly {
+			cspHeader = "Content-Security-Policy-Report-Only"
+		}
+		h.Set(cspHeader, policy.csp(nonce))
+		h.Set("X-Content-Type-Options", "nosniff")
+		if len(policy.FrameAncestors) == 0 {
+			h.Set("X-Frame-Options", "DENY") // For browsers that predate frame-ancestors
+		}
+		referrer := policy.ReferrerPolicy
+		if referrer == "" {
+			referrer = DefaultReferrerPolicy
+		}
+		h.Set("Referrer-Policy", referrer)
+		h.Set("Permissions-Policy", permissionsPolicy)
+		if cfg.HSTSMaxAge > 0 && isHTTPS(r) {
+			h.Set("Strict-Transport-Security", fmt.Sprintf("max-age=%d", int(cfg.HSTSMaxAge.Seconds())))
+		}
+
+		next.ServeHTTP(&writer{ResponseWriter: w, nonce: nonce}, r)
+	})
+}
+
+// Nonce returns the nonce inline scripts in this response must carry, or ""
+// outside the middleware
+func Nonce(w io.Writer) string {
+	for {
+		switch v := w.(type) {
+		case *writer:
+			return v.nonce
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = v.Unwrap()
+		default:
+			return ""
+		}
+	}
+}
+
+// writer carries the response's nonce to the renderer
+type writer struct {
+	http.ResponseWriter
+	nonce string
+}
+
+func (w *writer) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// match returns the route with the longest prefix of path
+func (c Config) match(path string) Route {
+	var best Route
+	for _, route := range c.Routes {
+		if strings.HasPrefix(path, route.Prefix) && len(route.Prefix) > len(best.Prefix) {
+			best = route
+		}
+	}
+	return best
+}
+
+// csp builds the policy. Styles may stay inline: the pages use style
+// attributes throughout, and scripts are what the policy is meant to stop.
+func (p Policy) csp(nonce string) string {
+	frameAncestors := "'none'"
+	if len(p.FrameAncestors) > 0 {
+		frameAncestors = strings.Join(p.FrameAncestors, " ")
+	}
+	return strings.Join([]string{
+		"default-src 'self'",
+		"script-src 'self' 'nonce-" + nonce + "'",
+		"style-src 'self' 'unsafe-inline'",
+		"img-src 'self' data:", // The upload preview is a data: URL
+		"object-src 'none'",
+		"base-uri 'self'",
+		strings.Join(append([]string{"form-action 'self'"}, p.FormAction...), " "),
+		"frame-ancestors " + frameAncestors,
+		"report-uri " + ReportPath,
+	}, "; ")
+}
+
+func newNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// isHTTPS reports whether the browser reached us over HTTPS, directly or
+// through a TLS-terminating load balancer
+func isHTTPS(r *http.Request) bool {
+	return r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
+}
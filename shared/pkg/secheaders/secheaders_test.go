@@ -0,0 +1,132 @@
+package secheaders_test
+
+import (
+	"bytes"
+	"crypto/tls"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/secheaders"
+)
+
+var cfg = secheaders.Config{
+	HSTSMaxAge: time.Hour,
+	Routes: []secheaders.Route{{
+		Prefix: "/s/",
+		Policy: secheaders.Policy{FrameAncestors: []string{"https://wiki.example.com"}, ReferrerPolicy: "no-referrer"},
+		Secret: true,
+	}},
+}
+
+// echoNonce writes the nonce the response's inline scripts must carry
+var echoNonce = secheaders.Middleware(cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	io.WriteString(w, secheaders.Nonce(w))
+}))
+
+func get(path string, modify func(*http.Request)) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if modify != nil {
+		modify(req)
+	}
+	rec := httptest.NewRecorder()
+	echoNonce.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestMiddleware_Defaults(t *testing.T) {
+	rec := get("/files", nil)
+	h := rec.Header()
+	for name, want := range map[string]string{
+		"X-Content-Type-Options": "nosniff",
+		"X-Frame-Options":        "DENY",
+		"Referrer-Policy":        secheaders.DefaultReferrerPolicy,
+		"Permissions-Policy":     "camera=(), geolocation=(), microphone=(), payment=(), usb=()",
+	} {
+		if got := h.Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	if h.Get("Strict-Transport-Security") != "" {
+		t.Error("HSTS sent over plain HTTP")
+	}
+
+	nonce := rec.Body.String()
+	csp := h.Get("Content-Security-Policy")
+	for _, want := range []string{"script-src 'self' 'nonce-" + nonce + "'", "frame-ancestors 'none'", "form-action 'self'", "report-uri " + secheaders.ReportPath} {
+		if nonce == "" || !strings.Contains(csp, want) {
+			t.Errorf("CSP %q does not contain %q", csp, want)
+		}
+	}
+	if again := get("/files", nil).Body.String(); again == nonce {
+		t.Error("nonce was reused across requests")
+	}
+}
+
+func TestMiddleware_HSTSOverHTTPS(t *testing.T) {
+	for name, modify := range map[string]func(*http.Request){
+		"tls":           func(r *http.Request) { r.TLS = &tls.ConnectionState{} },
+		"load balancer": func(r *http.Request) { r.Header.Set("X-Forwarded-Proto", "https") },
+	} {
+		if got := get("/", modify).Header().Get("Strict-Transport-Security"); got != "max-age=3600" {
+			t.Errorf("%s: Strict-Transport-Security = %q, want max-age=3600", name, got)
+		}
+	}
+}
+
+func TestMiddleware_RoutePolicy(t *testing.T) {
+	h := get("/s/token", nil).Header()
+	if csp := h.Get("Content-Security-Policy"); !strings.Contains(csp, "frame-ancestors https://wiki.example.com;") {
+		t.Errorf("share CSP = %q, want the configured frame ancestors", csp)
+	}
+	if h.Get("X-Frame-Options") != "" || h.Get("Referrer-Policy") != "no-referrer" {
+		t.Errorf("share headers = %v, want no X-Frame-Options and no referrer", h)
+	}
+}
+
+func TestMiddleware_ReportOnly(t *testing.T) {
+	rec := httptest.NewRecorder()
+	secheaders.Middleware(secheaders.Config{ReportOnly: true}, http.NotFoundHandler()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Header().Get("Content-Security-Policy") != "" || rec.Header().Get("Content-Security-Policy-Report-Only") == "" {
+		t.Errorf("report-only headers = %v", rec.Header())
+	}
+}
+
+func TestReport_LogsRedactedViolation(t *testing.T) {
+	var logs bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+
+	body := `{"csp-report": {
+		"document-uri": "https://app.example.com/s/secret-token?x=1",
+		"effective-directive": "script-src-elem",
+		"blocked-uri": "https://evil.example.com/x.js?leak=1",
+		"source-file": "https://app.example.com/files?q=secret",
+		"line-number": 12
+	}}`
+	req := httptest.NewRequest(http.MethodPost, secheaders.ReportPath, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/csp-report")
+	rec := httptest.NewRecorder()
+	echoNonce.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("report = %d, want 204", rec.Code)
+	}
+	out := logs.String()
+	for _, want := range []string{`"document":"/s/…"`, `"directive":"script-src-elem"`, `"blocked":"https://evil.example.com"`, `"source":"/files"`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("log %s does not contain %s", out, want)
+		}
+	}
+	if strings.Contains(out, "secret") || strings.Contains(out, "leak") {
+		t.Errorf("log leaks a URL secret: %s", out)
+	}
+
+	if rec := get(secheaders.ReportPath, nil); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET report = %d, want 405", rec.Code)
+	}
+}
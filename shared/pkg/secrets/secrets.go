@@ -0,0 +1,199 @@
+// Package secrets resolves references to secrets kept outside the
+// configuration: mounted files, AWS Secrets Manager secrets and SSM
+// parameters. A Watcher re-resolves them so rotated values are picked up
+// without a redeploy.
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+// Reference prefixes. A Secrets Manager reference may end in #key to pick one
+// field of a JSON secret, e.g. "secretsmanager:uploader/google#client_secret".
+const (
+	PrefixFile           = "file:"           // file:/run/secrets/google_client_secret
+	PrefixSecretsManager = "secretsmanager:" // secretsmanager:<name or ARN>[#<json key>]
+	PrefixSSM            = "ssm:"            // ssm:/uploader/google-client-secret, decrypted if a SecureString
+)
+
+// IsReference reports whether value names a secret rather than being one
+func IsReference(value string) bool {
+	return strings.HasPrefix(value, PrefixFile) ||
+		strings.HasPrefix(value, PrefixSecretsManager) ||
+		strings.HasPrefix(value, PrefixSSM)
+}
+
+// SecretsManagerAPI is the Secrets Manager call the resolver makes
+type SecretsManagerAPI interface {
+	GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error)
+}
+
+// SSMAPI is the Parameter Store call the resolver makes
+type SSMAPI interface {
+	GetParameter(ctx context.Context, params *ssm.GetParameterInput, optFns ...func(*ssm.Options)) (*ssm.GetParameterOutput, error)
+}
+
+// Resolver turns references into secret values. AWS clients are created on
+// first use, so configurations without AWS references never load AWS config.
+type Resolver struct {
+	region string
+
+	mu             sync.Mutex
+	secretsManager SecretsManagerAPI
+	ssm            SSMAPI
+}
+
+// Option configures a Resolver
+type Option func(*Resolver)
+
+// WithRegion sets the AWS region; empty keeps the default chain's (AWS_REGION, profile)
+func WithRegion(region string) Option {
+	return func(r *Resolver) {
+		r.region = region
+	}
+}
+
+// WithSecretsManager uses api instead of a client built from the default AWS config
+func WithSecretsManager(api SecretsManagerAPI) Option {
+	return func(r *Resolver) {
+		r.secretsManager = api
+	}
+}
+
+// WithSSM uses api instead of a client built from the default AWS config
+func WithSSM(api SSMAPI) Option {
+	return func(r *Resolver) {
+		r.ssm = api
+	}
+}
+
+// NewResolver creates a resolver
+func NewResolver(opts ...Option) *Resolver {
+	r := &Resolver{}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Resolve returns the current value behind ref. Surrounding whitespace is
+// trimmed, since files and console-entered secrets often end in a newline.
+func (r *Resolver) Resolve(ctx context.Context, ref string) (string, error) {
+	var value string
+	var err error
+	switch {
+	case strings.HasPrefix(ref, PrefixFile):
+		value, err = r.resolveFile(strings.TrimPrefix(ref, PrefixFile))
+	case strings.HasPrefix(ref, PrefixSecretsManager):
+		value, err = r.resolveSecretsManager(ctx, strings.TrimPrefix(ref, PrefixSecretsManager))
+	case strings.HasPrefix(ref, PrefixSSM):
+		value, err = r.resolveSSM(ctx, strings.TrimPrefix(ref, PrefixSSM))
+	default:
+		return "", fmt.Errorf("not a secret reference: want a %s, %s or %s prefix", PrefixFile, PrefixSecretsManager, PrefixSSM)
+	}
+	if err != nil {
+		return "", err
+	}
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", fmt.Errorf("%s is empty", ref)
+	}
+	return value, nil
+}
+
+func (r *Resolver) resolveFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file: %w", err)
+	}
+	return string(data), nil
+}
+
+func (r *Resolver) resolveSecretsManager(ctx context.Context, ref string) (string, error) {
+	id, key, hasKey := strings.Cut(ref, "#")
+	api, err := r.secretsManagerClient(ctx)
+	if err != nil {
+		return "", err
+	}
+	out, err := api.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{SecretId: aws.String(id)})
+	if err != nil {
+		return "", fmt.Errorf("failed to get secret %s: %w", id, err)
+	}
+	value := aws.ToString(out.SecretString)
+	if !hasKey {
+		return value, nil
+	}
+
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(value), &fields); err != nil {
+		return "", fmt.Errorf("secret %s is not a JSON object, so #%s cannot be selected", id, key)
+	}
+	field, ok := fields[key].(string)
+	if !ok {
+		return "", fmt.Errorf("secret %s has no string field %q", id, key)
+	}
+	return field, nil
+}
+
+func (r *Resolver) resolveSSM(ctx context.Context, name string) (string, error) {
+	api, err := r.ssmClient(ctx)
+	if err != nil {
+		return "", err
+	}
+	out, err := api.GetParameter(ctx, &ssm.GetParameterInput{Name: aws.String(name), WithDecryption: aws.Bool(true)})
+	if err != nil {
+		return "", fmt.Errorf("failed to get parameter %s: %w", name, err)
+	}
+	if out.Parameter == nil {
+		return "", fmt.Errorf("parameter %s has no value", name)
+	}
+	return aws.ToString(out.Parameter.Value), nil
+}
+
+func (r *Resolver) secretsManagerClient(ctx context.Context) (SecretsManagerAPI, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.secretsManager == nil {
+		cfg, err := r.loadAWSConfig(ctx)
+		if err != nil {
+			return nil, err
+		}
+		r.secretsManager = secretsmanager.NewFromConfig(cfg)
+	}
+	return r.secretsManager, nil
+}
+
+func (r *Resolver) ssmClient(ctx context.Context) (SSMAPI, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.ssm == nil {
+		cfg, err := r.loadAWSConfig(ctx)
+		if err != nil {
+			return nil, err
+		}
+		r.ssm = ssm.NewFromConfig(cfg)
+	}
+	return r.ssm, nil
+}
+
+func (r *Resolver) loadAWSConfig(ctx context.Context) (aws.Config, error) {
+	var opts []func(*awsconfig.LoadOptions) error
+	if r.region != "" {
+		opts = append(opts, awsconfig.WithRegion(r.region))
+	}
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	return cfg, nil
+}
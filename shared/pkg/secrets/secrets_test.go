@@ -0,0 +1,96 @@
+package secrets_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/secrets"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/secrets/secretstest"
+)
+
+func newResolver(t *testing.T) (*secrets.Resolver, *secretstest.Server) {
+	t.Helper()
+	srv := secretstest.NewServer()
+	t.Cleanup(srv.Close)
+	return secrets.NewResolver(
+		secrets.WithSecretsManager(srv.SecretsManagerClient()),
+		secrets.WithSSM(srv.SSMClient()),
+	), srv
+}
+
+func TestResolver_Resolve(t *testing.T) {
+	resolver, srv := newResolver(t)
+	srv.SetSecret("uploader/google", `{"client_id":"id","client_secret":"from-json"}`)
+	srv.SetSecret("uploader/plain", "from-secrets-manager\n")
+	srv.SetParameter("/uploader/metrics-token", "from-ssm")
+	path := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(path, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		ref  string
+		want string
+	}{
+		{"file:" + path, "from-file"},
+		{"secretsmanager:uploader/plain", "from-secrets-manager"},
+		{"secretsmanager:uploader/google#client_secret", "from-json"},
+		{"ssm:/uploader/metrics-token", "from-ssm"},
+	}
+	for _, tt := range tests {
+		got, err := resolver.Resolve(context.Background(), tt.ref)
+		if err != nil || got != tt.want {
+			t.Errorf("Resolve(%q) = %q, %v; want %q", tt.ref, got, err, tt.want)
+		}
+	}
+}
+
+func TestResolver_ResolveErrors(t *testing.T) {
+	resolver, srv := newResolver(t)
+	srv.SetSecret("uploader/plain", "not json")
+
+	tests := []struct {
+		ref  string
+		want string
+	}{
+		{"file:/nonexistent/secret", "failed to read secret file"},
+		{"secretsmanager:uploader/missing", "ResourceNotFoundException"},
+		{"secretsmanager:uploader/plain#key", "is not a JSON object"},
+		{"ssm:/uploader/missing", "ParameterNotFound"},
+		{"vault:secret/uploader", "not a secret reference"},
+	}
+	for _, tt := range tests {
+		if _, err := resolver.Resolve(context.Background(), tt.ref); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Resolve(%q) error = %v, want it to mention %q", tt.ref, err, tt.want)
+		}
+	}
+}
+
+func TestWatcher_Refresh(t *testing.T) {
+	resolver, srv := newResolver(t)
+	srv.SetParameter("/uploader/google-client-secret", "v1")
+	watcher := secrets.NewWatcher(resolver, 0)
+	var got []string
+	watcher.Watch("ssm:/uploader/google-client-secret", "v1", func(v string) { got = append(got, v) })
+
+	ctx := context.Background()
+	if err := watcher.Refresh(ctx); err != nil || len(got) != 0 {
+		t.Fatalf("unchanged refresh = %v, changes %q", err, got)
+	}
+	srv.SetParameter("/uploader/google-client-secret", "v2")
+	if err := watcher.Refresh(ctx); err != nil || len(got) != 1 || got[0] != "v2" {
+		t.Fatalf("refresh after rotation = %v, changes %q; want [v2]", err, got)
+	}
+
+	// A failing lookup reports the error and keeps the last value
+	srv.SetParameter("/uploader/google-client-secret", "")
+	if err := watcher.Refresh(ctx); err == nil {
+		t.Error("refresh of an empty parameter succeeded")
+	}
+	if len(got) != 1 {
+		t.Errorf("failed refresh reported changes %q", got)
+	}
+}
@@ -0,0 +1,125 @@
+// Package secretstest provides an in-process stand-in for AWS Secrets Manager
+// and SSM Parameter Store, speaking the JSON protocol the AWS SDK uses.
+// Request signatures are not checked.
+package secretstest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+// DefaultRegion is the region clients from the server are configured for
+const DefaultRegion = "us-east-1"
+
+// Server is a fake Secrets Manager and Parameter Store
+type Server struct {
+	*httptest.Server
+
+	mu         sync.Mutex
+	secrets    map[string]string
+	parameters map[string]string
+	requests   int
+}
+
+// NewServer starts a server with no secrets or parameters
+func NewServer() *Server {
+	s := &Server{secrets: make(map[string]string), parameters: make(map[string]string)}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// SetSecret creates or rotates a Secrets Manager secret
+func (s *Server) SetSecret(id, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.secrets[id] = value
+}
+
+// SetParameter creates or overwrites a parameter
+func (s *Server) SetParameter(name, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.parameters[name] = value
+}
+
+// Requests returns how many API calls the server has answered
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+// SecretsManagerClient returns an SDK client configured for the server
+func (s *Server) SecretsManagerClient() *secretsmanager.Client {
+	return secretsmanager.New(secretsmanager.Options{
+		Region:       DefaultRegion,
+		BaseEndpoint: aws.String(s.URL),
+		Credentials:  credentials.NewStaticCredentialsProvider("AKIDSECRETSTEST", "secretstest", ""),
+	})
+}
+
+// SSMClient returns an SDK client configured for the server
+func (s *Server) SSMClient() *ssm.Client {
+	return ssm.New(ssm.Options{
+		Region:       DefaultRegion,
+		BaseEndpoint: aws.String(s.URL),
+		Credentials:  credentials.NewStaticCredentialsProvider("AKIDSECRETSTEST", "secretstest", ""),
+	})
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		SecretId string
+		Name     string
+	}
+	if r.Method != http.MethodPost || json.NewDecoder(r.Body).Decode(&req) != nil {
+		writeError(w, http.StatusBadRequest, "SerializationException", "malformed request")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+	switch target := r.Header.Get("X-Amz-Target"); target {
+	case "secretsmanager.GetSecretValue":
+		value, ok := s.secrets[req.SecretId]
+		if !ok {
+			writeError(w, http.StatusBadRequest, "ResourceNotFoundException", "Secrets Manager can't find the specified secret.")
+			return
+		}
+		writeJSON(w, map[string]any{
+			"ARN":          "arn:aws:secretsmanager:" + DefaultRegion + ":123456789012:secret:" + req.SecretId,
+			"Name":         req.SecretId,
+			"SecretString": value,
+		})
+	case "AmazonSSM.GetParameter":
+		value, ok := s.parameters[req.Name]
+		if !ok {
+			writeError(w, http.StatusBadRequest, "ParameterNotFound", "")
+			return
+		}
+		writeJSON(w, map[string]any{
+			"Parameter": map[string]any{"Name": req.Name, "Type": "SecureString", "Value": value, "Version": 1},
+		})
+	default:
+		writeError(w, http.StatusBadRequest, "UnknownOperationException", "unsupported operation "+target)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, body any) {
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"__type": code, "message": message})
+}
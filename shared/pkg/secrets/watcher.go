@@ -0,0 +1,82 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// DefaultRefreshInterval is how often a Watcher re-resolves its references
+const DefaultRefreshInterval = 5 * time.Minute
+
+// Watcher re-resolves references and reports values that changed
+type Watcher struct {
+	resolver *Resolver
+	interval time.Duration
+
+	mu      sync.Mutex
+	watches []*watch
+}
+
+type watch struct {
+	ref      string
+	value    string
+	onChange func(string)
+}
+
+// NewWatcher creates a watcher refreshing every interval. Zero uses DefaultRefreshInterval.
+func NewWatcher(resolver *Resolver, interval time.Duration) *Watcher {
+	if interval == 0 {
+		interval = DefaultRefreshInterval
+	}
+	return &Watcher{resolver: resolver, interval: interval}
+}
+
+// Watch calls onChange with the new value whenever ref stops resolving to current
+func (w *Watcher) Watch(ref, current string, onChange func(string)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.watches = append(w.watches, &watch{ref: ref, value: current, onChange: onChange})
+}
+
+// Refresh resolves every watched reference once. A reference that fails to
+// resolve keeps its last value, so a brief outage never blanks a secret.
+func (w *Watcher) Refresh(ctx context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var errs []error
+	for _, wt := range w.watches {
+		value, err := w.resolver.Resolve(ctx, wt.ref)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", wt.ref, err))
+			continue
+		}
+		if value == wt.value {
+			continue
+		}
+		wt.value = value
+		wt.onChange(value)
+		slog.Info("secret rotated", "ref", wt.ref)
+	}
+	return errors.Join(errs...)
+}
+
+// Run refreshes on the watcher's interval until ctx is done
+func (w *Watcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := w.Refresh(ctx); err != nil {
+				slog.Warn("secret refresh failed; keeping the previous values", "err", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,164 @@
+// Package server runs an http.Server with hardened timeouts and graceful shutdown on SIGINT/SIGTERM.
+package server
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// Config holds the server limits and the shutdown deadline. Zero values fall back to DefaultConfig.
+type Config struct {
+	ReadHeaderTimeout time.Duration // Time allowed to read request headers (slowloris protection)
+	ReadTimeout       time.Duration // Time allowed to read a whole request, including upload bodies
+	WriteTimeout      time.Duration // Time allowed to write a whole response, including downloads
+	IdleTimeout       time.Duration // How long keep-alive connections may sit idle
+	MaxHeaderBytes    int
+	ShutdownTimeout   time.Duration // How long in-flight requests may finish before they are cancelled
+	AbortTimeout      time.Duration // How long cancelled requests and shutdown hooks get to clean up
+}
+
+// DefaultConfig returns limits suited to a browser-facing app with file uploads.
+// Shutdown and abort together stay under the 30s most orchestrators wait before SIGKILL.
+func DefaultConfig() Config {
+	return Config{
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       5 * time.Minute,
+		WriteTimeout:      10 * time.Minute,
+		IdleTimeout:       2 * time.Minute,
+		MaxHeaderBytes:    64 << 10,
+		ShutdownTimeout:   20 * time.Second,
+		AbortTimeout:      5 * time.Second,
+	}
+}
+
+func (c Config) withDefaults() Config {
+	d := DefaultConfig()
+	if c.ReadHeaderTimeout <= 0 {
+		c.ReadHeaderTimeout = d.ReadHeaderTimeout
+	}
+	if c.ReadTimeout <= 0 {
+		c.ReadTimeout = d.ReadTimeout
+	}
+	if c.WriteTimeout <= 0 {
+		c.WriteTimeout = d.WriteTimeout
+	}
+	if c.IdleTimeout <= 0 {
+		c.IdleTimeout = d.IdleTimeout
+	}
+	if c.MaxHeaderBytes <= 0 {
+		c.MaxHeaderBytes = d.MaxHeaderBytes
+	}
+	if c.ShutdownTimeout <= 0 {
+		c.ShutdownTimeout = d.ShutdownTimeout
+	}
+	if c.AbortTimeout <= 0 {
+		c.AbortTimeout = d.AbortTimeout
+	}
+	return c
+}
+
+// Server wraps http.Server with a drain-then-abort shutdown sequence
+type Server struct {
+	cfg        Config
+	srv        *http.Server
+	cancelReqs context.CancelFunc // Cancels the context of every in-flight request
+	hooks      []func(context.Context) error
+}
+
+// New builds a server for handler listening on addr
+func New(addr string, handler http.Handler, cfg Config) *Server {
+	cfg = cfg.withDefaults()
+	baseCtx, cancel := context.WithCancel(context.Background())
+	return &Server{
+		cfg:        cfg,
+		cancelReqs: cancel,
+		srv: &http.Server{
+			Addr:              addr,
+			Handler:           handler,
+			ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+			ReadTimeout:       cfg.ReadTimeout,
+			WriteTimeout:      cfg.WriteTimeout,
+			IdleTimeout:       cfg.IdleTimeout,
+			MaxHeaderBytes:    cfg.MaxHeaderBytes,
+			BaseContext:       func(net.Listener) context.Context { return baseCtx },
+		},
+	}
+}
+
+// OnShutdown registers fn to run once requests have finished or been cancelled,
+// e.g. to abort storage uploads that are still pending. Hooks run in order.
+func (s *Server) OnShutdown(fn func(context.Context) error) {
+	s.hooks = append(s.hooks, fn)
+}
+
+// ListenAndServe serves until SIGINT or SIGTERM, then shuts down gracefully
+func (s *Server) ListenAndServe() error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	ln, err := net.Listen("tcp", s.srv.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx, ln)
+}
+
+// Serve accepts connections on ln until ctx is done, then shuts down gracefully.
+// It returns nil after a clean shutdown.
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- s.srv.Serve(ln) }()
+
+	select {
+	case err := <-serveErr:
+		s.cancelReqs()
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Printf("🛑 Shutting down: draining connections for up to %v", s.cfg.ShutdownTimeout)
+	err := s.shutdown()
+	<-serveErr
+	return err
+}
+
+// shutdown stops accepting connections, lets in-flight requests finish until the
+// deadline, then cancels the rest and gives them a short window to clean up
+func (s *Server) shutdown() error {
+	drainCtx, cancel := context.WithTimeout(context.Background(), s.cfg.ShutdownTimeout)
+	defer cancel()
+	err := s.srv.Shutdown(drainCtx)
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		log.Printf("⏱️ Drain deadline passed, cancelling in-flight requests")
+		s.cancelReqs()
+		abortCtx, cancel := context.WithTimeout(context.Background(), s.cfg.AbortTimeout)
+		defer cancel()
+		if err := s.srv.Shutdown(abortCtx); errors.Is(err, context.DeadlineExceeded) {
+			log.Printf("⚠️ Requests still running after cancellation, closing connections: %v", err)
+			s.srv.Close()
+		}
+	}
+	s.cancelReqs()
+
+	hookCtx, cancel := context.WithTimeout(context.Background(), s.cfg.AbortTimeout)
+	defer cancel()
+	var hookErrs []error
+	for _, hook := range s.hooks {
+		if err := hook(hookCtx); err != nil {
+			log.Printf("⚠️ Shutdown hook failed: %v", err)
+			hookErrs = append(hookErrs, err)
+		}
+	}
+	if len(hookErrs) > 0 {
+		return errors.Join(hookErrs...)
+	}
+	log.Printf("✅ Server stopped")
+	return nil
+}
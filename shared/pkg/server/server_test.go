@@ -0,0 +1,118 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// startServer serves handler on a random port until the returned cancel is called
+func startServer(t *testing.T, handler http.Handler, cfg Config) (*Server, string, context.CancelFunc, chan error) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen() error = %v", err)
+	}
+	srv := New(ln.Addr().String(), handler, cfg)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- srv.Serve(ctx, ln) }()
+	t.Cleanup(cancel)
+	return srv, "http://" + ln.Addr().String(), cancel, done
+}
+
+func TestNew_AppliesDefaults(t *testing.T) {
+	srv := New(":0", http.NotFoundHandler(), Config{WriteTimeout: time.Minute})
+	if srv.srv.WriteTimeout != time.Minute {
+		t.Errorf("WriteTimeout = %v, want the configured 1m", srv.srv.WriteTimeout)
+	}
+	d := DefaultConfig()
+	if srv.srv.ReadHeaderTimeout != d.ReadHeaderTimeout || srv.srv.IdleTimeout != d.IdleTimeout || srv.srv.MaxHeaderBytes != d.MaxHeaderBytes {
+		t.Errorf("unset limits not defaulted: %+v", srv.srv)
+	}
+}
+
+func TestServe_DrainsInFlightRequests(t *testing.T) {
+	started := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		io.WriteString(w, "finished")
+	})
+	_, url, cancel, done := startServer(t, handler, Config{ShutdownTimeout: 5 * time.Second})
+
+	type result struct {
+		body string
+		err  error
+	}
+	resc := make(chan result, 1)
+	go func() {
+		resp, err := http.Get(url)
+		if err != nil {
+			resc <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		resc <- result{string(body), err}
+	}()
+	<-started
+	cancel()
+
+	if res := <-resc; res.err != nil || res.body != "finished" {
+		t.Errorf("in-flight request = %q, %v, want it to finish", res.body, res.err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Serve() error = %v, want nil after a clean shutdown", err)
+	}
+	if _, err := http.Get(url); err == nil {
+		t.Error("server still accepting connections after shutdown")
+	}
+}
+
+func TestServe_CancelsRequestsAfterDeadline(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		events []string
+	)
+	record := func(e string) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, e)
+	}
+
+	started := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-r.Context().Done()
+		record("request cancelled")
+	})
+	srv, url, cancel, done := startServer(t, handler, Config{ShutdownTimeout: 50 * time.Millisecond, AbortTimeout: time.Second})
+	hookErr := errors.New("abort failed")
+	srv.OnShutdown(func(ctx context.Context) error {
+		record("hook")
+		return hookErr
+	})
+
+	go http.Get(url)
+	<-started
+	start := time.Now()
+	cancel()
+
+	if err := <-done; !errors.Is(err, hookErr) {
+		t.Errorf("Serve() error = %v, want the hook's error", err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("shutdown took %v despite a 50ms deadline", elapsed)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) != 2 || events[0] != "request cancelled" || events[1] != "hook" {
+		t.Errorf("events = %v, want the request cancelled before hooks run", events)
+	}
+}
@@ -0,0 +1,72 @@
+package session_test
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/models"
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/session"
+)
+
+var key = []byte("0123456789abcdef0123456789abcdef")
+
+func TestEncodeDecode(t *testing.T) {
+	now := time.Now()
+	value, err := session.Encode(key, &models.User{ID: "u1", Email: "user@example.com", Created: now})
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	if user, ok := session.Decode(key, value, now); !ok || user.ID != "u1" || user.Email != "user@example.com" {
+		t.Errorf("Decode() = %+v, %v, want the encoded user", user, ok)
+	}
+
+	// Swap in another email, keeping the signature
+	body, sig, _ := strings.Cut(value, ".")
+	payload, _ := base64.RawURLEncoding.DecodeString(body)
+	forged := strings.Replace(string(payload), "user@example.com", "admin@example.com", 1)
+	edited := base64.RawURLEncoding.EncodeToString([]byte(forged)) + "." + sig
+	expired := now.Add(session.MaxAge + time.Minute)
+	for name, c := range map[string]struct {
+		key   []byte
+		value string
+		now   time.Time
+	}{
+		"edited user":   {key, edited, now},
+		"unsigned":      {key, base64.StdEncoding.EncodeToString([]byte(forged)), now},
+		"other key":     {[]byte("another-key"), value, now},
+		"no key":        {nil, value, now},
+		"expired":       {key, value, expired},
+		"no signature":  {key, body, now},
+		"empty payload": {key, "." + sig, now},
+	} {
+		if _, ok := session.Decode(c.key, c.value, c.now); ok {
+			t.Errorf("Decode() accepted a cookie with %s", name)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	value, _ := session.Encode(key, &models.User{ID: "u1", Created: time.Now()})
+	var got *models.User
+	handler := session.Middleware(key, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = session.User(r)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: session.CookieName, Value: value})
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if got == nil || got.ID != "u1" {
+		t.Errorf("User() = %+v, want u1", got)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: session.CookieName, Value: base64.StdEncoding.EncodeToString([]byte(`{"id":"u1"}`))})
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if got != nil {
+		t.Errorf("User() = %+v for an unsigned cookie, want nil", got)
+	}
+}
@@ -0,0 +1,105 @@
+// Package tracing sets up OpenTelemetry tracing and instruments incoming HTTP requests.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/health"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+)
+
+// Exporter selects where finished spans are sent
+type Exporter string
+
+const (
+	ExporterNone   Exporter = "none"   // Tracing disabled; instrumentation is a no-op
+	ExporterStdout Exporter = "stdout" // Spans printed as JSON, for local debugging
+	ExporterOTLP   Exporter = "otlp"   // OTLP over HTTP, configured by the standard OTEL_EXPORTER_OTLP_* variables
+)
+
+// ParseExporter parses a TRACING_EXPORTER value
+func ParseExporter(s string) (Exporter, error) {
+	switch e := Exporter(strings.ToLower(strings.TrimSpace(s))); e {
+	case ExporterNone, ExporterStdout, ExporterOTLP:
+		return e, nil
+	default:
+		return "", fmt.Errorf("unknown exporter %q (want none, stdout or otlp)", s)
+	}
+}
+
+// Setup installs a global tracer provider exporting to exporter and the W3C
+// trace context propagator. The returned function flushes buffered spans and
+// should run on shutdown. With ExporterNone nothing is installed, so every
+// span is a no-op and incoming trace headers are ignored.
+func Setup(ctx context.Context, exporter Exporter, serviceName string) (func(context.Context) error, error) {
+	if exporter == ExporterNone || exporter == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	var spanExporter sdktrace.SpanExporter
+	var err error
+	switch exporter {
+	case ExporterStdout:
+		spanExporter, err = stdouttrace.New()
+	case ExporterOTLP:
+		spanExporter, err = otlptracehttp.New(ctx)
+	default:
+		return nil, fmt.Errorf("unknown exporter %q", exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s exporter: %w", exporter, err)
+	}
+
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES override the defaults
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName(serviceName)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(spanExporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return provider.Shutdown, nil
+}
+
+// Middleware starts a server span for each request, continuing the caller's
+// trace when a traceparent header is present. Spans are named after the route
+// pattern once the mux has matched one. Health probes are not traced.
+func Middleware(next http.Handler) http.Handler {
+	return otelhttp.NewHandler(next, "http.server",
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			if r.Pattern != "" {
+				return r.Method + " " + r.Pattern
+			}
+			return r.Method
+		}),
+		otelhttp.WithFilter(func(r *http.Request) bool {
+			return !health.IsProbe(r.URL.Path)
+		}),
+	)
+}
+
+// Transport wraps base so outgoing requests get client spans and carry the trace context
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return otelhttp.NewTransport(base)
+}
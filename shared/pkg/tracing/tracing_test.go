@@ -0,0 +1,107 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aruruka/go-google-s3-uploader/shared/pkg/logging"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// recordSpans installs an in-memory tracer provider for the test
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	})
+	return recorder
+}
+
+func TestMiddleware_ContinuesTraceAndNamesRoute(t *testing.T) {
+	recorder := recordSpans(t)
+	var logs bytes.Buffer
+	prevLogger := slog.Default()
+	slog.SetDefault(logging.New(&logs, slog.LevelInfo))
+	t.Cleanup(func() { slog.SetDefault(prevLogger) })
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/s/", func(w http.ResponseWriter, r *http.Request) {
+		logging.FromRequest(r).Info("serving share")
+	})
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {})
+	handler := Middleware(logging.Middleware(mux))
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodGet, "/s/share-token", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, want one for the share and none for /health", len(spans))
+	}
+	if got := spans[0].Name(); got != "GET /s/" {
+		t.Errorf("span name = %q, want the route pattern", got)
+	}
+	if got := spans[0].SpanContext().TraceID().String(); got != traceID {
+		t.Errorf("trace ID = %s, want the incoming %s", got, traceID)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		if !strings.Contains(line, `"trace_id":"`+traceID+`"`) {
+			t.Errorf("log line without the trace ID: %s", line)
+		}
+	}
+}
+
+func TestTransport_PropagatesTraceContext(t *testing.T) {
+	recordSpans(t)
+	var traceparent string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+	}))
+	defer upstream.Close()
+
+	ctx, span := otel.Tracer("test").Start(context.Background(), "parent")
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, upstream.URL, nil)
+	resp, err := (&http.Client{Transport: Transport(nil)}).Do(req)
+	span.End()
+	if err != nil {
+		t.Fatalf("request error = %v", err)
+	}
+	resp.Body.Close()
+
+	if !strings.Contains(traceparent, span.SpanContext().TraceID().String()) {
+		t.Errorf("upstream traceparent = %q, want trace %s", traceparent, span.SpanContext().TraceID())
+	}
+}
+
+func TestParseExporter(t *testing.T) {
+	for _, s := range []string{"none", "STDOUT", " otlp "} {
+		if _, err := ParseExporter(s); err != nil {
+			t.Errorf("ParseExporter(%q) error = %v", s, err)
+		}
+	}
+	if _, err := ParseExporter("jaeger"); err == nil {
+		t.Error("ParseExporter(\"jaeger\") succeeded, want an error")
+	}
+
+	shutdown, err := Setup(context.Background(), ExporterNone, "test")
+	if err != nil || shutdown(context.Background()) != nil {
+		t.Errorf("Setup(none) = %v, want a no-op", err)
+	}
+}
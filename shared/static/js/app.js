@@ -20,6 +20,15 @@ document.addEventListener('DOMContentLoaded', function() {
         }, 5000);
     });
     
+    // Ask before submitting destructive forms
+    document.querySelectorAll('form[data-confirm]').forEach(function(form) {
+        form.addEventListener('submit', function(e) {
+            if (!confirm(form.dataset.confirm)) {
+                e.preventDefault();
+            }
+        });
+    });
+    
     // Enhanced form validation
     const forms = document.querySelectorAll('form');
     forms.forEach(function(form) {
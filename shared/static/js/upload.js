@@ -11,38 +11,58 @@ document.addEventListener('DOMContentLoaded', function() {
     const progressBar = document.getElementById('progressBar');
     const progressFill = document.getElementById('progressFill');
 
+    // Limits come from the server through data- attributes on the form
+    const maxSize = uploadForm ? Number(uploadForm.dataset.maxSize) || 0 : 0;
+    const allowedTypes = uploadForm && uploadForm.dataset.allowedTypes ?
+        uploadForm.dataset.allowedTypes.split(',') : [];
+
+    function formatSize(bytes) {
+        return window.AppUtils ?
+            window.AppUtils.formatFileSize(bytes) :
+            (bytes / 1024 / 1024).toFixed(2) + ' MB';
+    }
+
     // File preview functionality
     if (fileInput) {
         fileInput.addEventListener('change', function(e) {
             const file = e.target.files[0];
             if (file) {
-                // File size validation
-                const maxSize = 10 * 1024 * 1024; // 10MB
-                if (file.size > maxSize) {
-                    alert('File size exceeds 10MB limit. Please choose a smaller file.');
+                // File size validation, against the limit the server sent with the page
+                if (maxSize > 0 && file.size > maxSize) {
+                    alert(`File size exceeds the ${formatSize(maxSize)} limit. Please choose a smaller file.`);
                     fileInput.value = '';
                     return;
                 }
                 
                 // File type validation
-                const allowedTypes = ['image/jpeg', 'image/jpg', 'image/png', 'image/gif', 'image/webp'];
-                if (!allowedTypes.includes(file.type)) {
-                    alert('Please select a valid image file (JPG, PNG, GIF, or WebP).');
+                if (allowedTypes.length > 0 && !allowedTypes.includes(file.type)) {
+                    alert('Please select a supported file (JPG, PNG, GIF, WebP, PDF or ZIP).');
                     fileInput.value = '';
                     return;
                 }
 
+                if (fileName) {
+                    fileName.textContent = `Selected: ${file.name} (${formatSize(file.size)})`;
+                }
+
+                // Only images get a preview
+                if (!file.type.startsWith('image/')) {
+                    if (previewImage) {
+                        previewImage.removeAttribute('src');
+                        previewImage.style.display = 'none';
+                    }
+                    if (filePreview) {
+                        filePreview.style.display = 'block';
+                    }
+                    return;
+                }
+
                 // Show preview
                 const reader = new FileReader();
                 reader.onload = function(e) {
                     if (previewImage) {
                         previewImage.src = e.target.result;
-                    }
-                    if (fileName) {
-                        const fileSizeFormatted = window.AppUtils ? 
-                            window.AppUtils.formatFileSize(file.size) : 
-                            (file.size / 1024 / 1024).toFixed(2) + ' MB';
-                        fileName.textContent = `Selected: ${file.name} (${fileSizeFormatted})`;
+                        previewImage.style.display = '';
                     }
                     if (filePreview) {
                         filePreview.style.display = 'block';
@@ -84,7 +104,7 @@ document.addEventListener('DOMContentLoaded', function() {
             }
 
             // For actual uploads, we'll use XMLHttpRequest to track progress
-            if (window.location.pathname !== '/upload' || uploadForm.action.includes('api/upload')) {
+            if (uploadForm.getAttribute('action')) {
                 // This is a real form submission, let it proceed
                 return;
             }